@@ -2,6 +2,7 @@ package config
 
 import (
 	"sync"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/joho/godotenv"
@@ -13,7 +14,14 @@ type (
 		Log    Log
 		DB     DB
 		Auth0  Auth0
+		LLM    LLM
 		Gemini Gemini
+		OpenAI OpenAI
+		Fake   FakeLLM
+		Cache  Cache
+		Quota  Quota
+		Admin  Admin
+		Digest Digest
 		App    App
 	}
 	HTTP struct {
@@ -32,10 +40,71 @@ type (
 		CallbackURL   string `env:"AUTH0_CALLBACK_URL,required"`
 		SessionSecret string `env:"SESSION_SECRET,required"`
 	}
+	LLM struct {
+		// Provider selects the model backend: "gemini", "openai" or "fake"
+		Provider string `env:"LLM_PROVIDER" envDefault:"gemini"`
+		// How many times an invalid recipe response is sent back for correction
+		RepairAttempts int `env:"LLM_REPAIR_ATTEMPTS" envDefault:"2"`
+		// Retries with jittered exponential backoff for transient errors
+		MaxRetries     int           `env:"LLM_MAX_RETRIES" envDefault:"2"`
+		RetryBaseDelay time.Duration `env:"LLM_RETRY_BASE_DELAY" envDefault:"500ms"`
+		RetryMaxDelay  time.Duration `env:"LLM_RETRY_MAX_DELAY" envDefault:"5s"`
+		CallTimeout    time.Duration `env:"LLM_CALL_TIMEOUT" envDefault:"60s"`
+		StreamTimeout  time.Duration `env:"LLM_STREAM_TIMEOUT" envDefault:"90s"`
+		// Consecutive failed calls that open the circuit breaker, and how long it stays open
+		BreakerThreshold int           `env:"LLM_BREAKER_THRESHOLD" envDefault:"5"`
+		BreakerCooldown  time.Duration `env:"LLM_BREAKER_COOLDOWN" envDefault:"30s"`
+	}
 	Gemini struct {
 		APIKey string `env:"GEMINI_API_KEY"`
 		Model  string `env:"GEMINI_MODEL" envDefault:"gemini-1.5-flash"`
 	}
+	OpenAI struct {
+		// BaseURL of any OpenAI-compatible server, e.g. http://localhost:11434/v1 for Ollama
+		BaseURL string `env:"OPENAI_BASE_URL" envDefault:"https://api.openai.com/v1"`
+		APIKey  string `env:"OPENAI_API_KEY"`
+		Model   string `env:"OPENAI_MODEL" envDefault:"gpt-4o-mini"`
+	}
+	FakeLLM struct {
+		// FixturesPath optionally replaces the built-in canned responses
+		FixturesPath string        `env:"FAKE_LLM_FIXTURES"`
+		Latency      time.Duration `env:"FAKE_LLM_LATENCY" envDefault:"0s"`
+		FailEvery    int           `env:"FAKE_LLM_FAIL_EVERY" envDefault:"0"`
+	}
+	Cache struct {
+		// RecipeTTL is how long a generation result is reused; 0 disables the cache
+		RecipeTTL time.Duration `env:"RECIPE_CACHE_TTL" envDefault:"30m"`
+	}
+	Quota struct {
+		// Generation budgets per user (UTC day / calendar month); 0 disables
+		DailyLimit   int `env:"QUOTA_DAILY_LIMIT" envDefault:"50"`
+		MonthlyLimit int `env:"QUOTA_MONTHLY_LIMIT" envDefault:"500"`
+		// Token-bucket rate limits on generate requests; a rate of 0 disables
+		UserRatePerMinute float64 `env:"RATE_LIMIT_USER_PER_MINUTE" envDefault:"6"`
+		UserBurst         int     `env:"RATE_LIMIT_USER_BURST" envDefault:"3"`
+		IPRatePerMinute   float64 `env:"RATE_LIMIT_IP_PER_MINUTE" envDefault:"20"`
+		IPBurst           int     `env:"RATE_LIMIT_IP_BURST" envDefault:"10"`
+		// TrustProxy keys IP limits on X-Forwarded-For; only enable behind a proxy that sets it
+		TrustProxy bool `env:"TRUST_PROXY_HEADERS" envDefault:"false"`
+	}
+	Admin struct {
+		// APIToken guards the /admin endpoints as a bearer token; empty disables them
+		APIToken string `env:"ADMIN_API_TOKEN"`
+	}
+	Digest struct {
+		// Enabled runs the daily expiring-items digest in the server
+		Enabled bool `env:"DIGEST_ENABLED" envDefault:"true"`
+		// Hour is the UTC hour the digest runs at; Days how far ahead it looks
+		Hour int `env:"DIGEST_HOUR" envDefault:"8"`
+		Days int `env:"DIGEST_DAYS" envDefault:"3"`
+		// ExpiredDays is how long after expiring an item is still reported
+		ExpiredDays int `env:"DIGEST_EXPIRED_DAYS" envDefault:"3"`
+		// SuggestRecipe adds a spoiling-mode recipe, which costs an LLM call per user
+		SuggestRecipe bool `env:"DIGEST_SUGGEST_RECIPE" envDefault:"true"`
+		// Notifier is "log" or "file"; the file notifier appends JSON lines to FilePath
+		Notifier string `env:"DIGEST_NOTIFIER" envDefault:"log"`
+		FilePath string `env:"DIGEST_FILE" envDefault:"digests.jsonl"`
+	}
 	App struct {
 		FrontendURL string `env:"FRONTEND_URL" envDefault:"http://localhost:3000"`
 	}
@@ -0,0 +1,473 @@
+package agents
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Confidence is how sure the allergen engine is that an ingredient contains
+// an allergen
+type Confidence int
+
+const (
+	// ConfidenceLow ingredients sometimes contain the allergen
+	// (e.g. chocolate for milk)
+	ConfidenceLow Confidence = iota + 1
+	// ConfidenceMedium ingredients usually contain it (e.g. pesto for milk)
+	ConfidenceMedium
+	// ConfidenceHigh ingredients are the allergen or made from it
+	ConfidenceHigh
+)
+
+// String returns "low", "medium" or "high"
+func (c Confidence) String() string {
+	switch c {
+	case ConfidenceLow:
+		return "low"
+	case ConfidenceMedium:
+		return "medium"
+	case ConfidenceHigh:
+		return "high"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the confidence by name in JSON
+func (c Confidence) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// AllergenMatch explains why one ingredient was matched to an allergen
+type AllergenMatch struct {
+	Ingredient string     `json:"ingredient"`
+	Allergen   string     `json:"allergen"` // canonical allergen, e.g. "milk" for "dairy"
+	Term       string     `json:"term"`     // the ontology term that matched, e.g. "parmesan"
+	Confidence Confidence `json:"confidence"`
+	Reason     string     `json:"reason"`
+}
+
+// allergenSpec is the curated entry for one allergen. Terms and exceptions
+// are written as plain phrases and tokenized once at startup.
+type allergenSpec struct {
+	high   []string // the allergen itself or foods made from it
+	medium []string // dishes and products that usually contain it
+	low    []string // products that sometimes contain it
+	// safe phrases use an allergen term without containing the allergen,
+	// e.g. "coconut milk"; their words never match
+	safe []string
+	// freeFrom phrases mark the whole ingredient as free of the allergen,
+	// e.g. "dairy-free cheese"
+	freeFrom []string
+}
+
+var (
+	wheatHigh = []string{
+		"wheat", "flour", "bread", "breadcrumb", "bread crumb", "panko", "flatbread",
+		"cornbread", "shortbread", "pasta", "spaghetti", "macaroni", "penne", "linguine",
+		"fettuccine", "lasagna", "orzo", "noodle", "udon", "ramen", "couscous", "bulgur",
+		"semolina", "durum", "farina", "spelt", "farro", "kamut", "einkorn", "seitan",
+		"cracker", "tortilla", "pita", "naan", "bagel", "croissant", "crouton", "pastry",
+		"cake", "cookie", "biscuit", "roux", "gnocchi", "soy sauce",
+	}
+	wheatMedium = []string{
+		"breaded", "battered", "tempura", "dumpling", "gravy", "teriyaki", "hoisin",
+	}
+	wheatSafe = []string{
+		"rice flour", "almond flour", "coconut flour", "corn flour", "chickpea flour",
+		"oat flour", "tapioca flour", "potato flour", "buckwheat flour", "cassava flour",
+		"rice noodle", "glass noodle",
+		"bean thread noodle", "rice pasta", "corn tortilla", "rice paper", "rice cracker",
+	}
+)
+
+// allergenOntology maps each canonical allergen to its curated entry
+var allergenOntology = map[string]allergenSpec{
+	"milk": {
+		high: []string{
+			"milk", "dairy", "cheese", "butter", "cream", "yogurt", "yoghurt", "whey",
+			"casein", "caseinate", "lactose", "ghee", "buttermilk", "kefir", "custard",
+			"ricotta", "mozzarella", "parmesan", "cheddar", "brie", "feta", "gouda",
+			"mascarpone", "paneer", "burrata", "gruyere", "pecorino", "provolone",
+			"half and half", "creme fraiche", "sour cream", "ice cream", "condensed milk",
+			"evaporated milk", "cream cheese", "cottage cheese",
+		},
+		medium: []string{"alfredo", "bechamel", "pesto", "ranch", "tzatziki", "queso", "caesar dressing"},
+		low:    []string{"chocolate", "margarine", "nougat", "caramel"},
+		safe: []string{
+			"coconut milk", "coconut cream", "almond milk", "soy milk", "oat milk", "rice milk",
+			"cashew milk", "oat cream", "coconut yogurt", "soy yogurt", "cocoa butter", "shea butter", "peanut butter", "almond butter",
+			"cashew butter", "nut butter", "seed butter", "sunflower butter", "apple butter",
+			"cream of tartar",
+		},
+		freeFrom: []string{"dairy free", "milk free", "vegan"},
+	},
+	"eggs": {
+		high: []string{
+			"egg", "egg white", "egg yolk", "albumin", "ovalbumin", "lysozyme", "meringue",
+			"mayonnaise", "mayo", "aioli", "custard", "hollandaise", "bearnaise", "eggnog",
+			"frittata", "omelet", "omelette", "quiche",
+		},
+		medium:   []string{"brioche", "challah", "tempura", "caesar dressing", "fresh pasta"},
+		low:      []string{"marshmallow", "pastry", "cake"},
+		safe:     []string{"flax egg", "chia egg"},
+		freeFrom: []string{"egg free", "eggless", "vegan"},
+	},
+	"peanuts": {
+		high:     []string{"peanut", "groundnut", "arachis oil", "monkey nut"},
+		medium:   []string{"satay", "pad thai", "kung pao", "mixed nut"},
+		low:      []string{"nut butter", "chocolate"},
+		freeFrom: []string{"peanut free", "nut free"},
+	},
+	"tree nuts": {
+		high: []string{
+			"nut", "almond", "cashew", "walnut", "pecan", "pistachio", "hazelnut", "filbert",
+			"macadamia", "brazil nut", "pine nut", "pignoli", "chestnut", "praline",
+			"marzipan", "frangipane", "nutella", "gianduja",
+		},
+		medium:   []string{"pesto", "baklava", "nougat"},
+		low:      []string{"amaretto", "mortadella", "granola"},
+		safe:     []string{"water chestnut"},
+		freeFrom: []string{"nut free", "tree nut free"},
+	},
+	"wheat": {
+		high:     wheatHigh,
+		medium:   wheatMedium,
+		low:      []string{"bouillon", "stock cube"},
+		safe:     wheatSafe,
+		freeFrom: []string{"wheat free", "gluten free"},
+	},
+	"gluten": {
+		high:     append([]string{"gluten", "barley", "rye", "malt", "triticale", "beer", "brewer yeast"}, wheatHigh...),
+		medium:   wheatMedium,
+		low:      []string{"oat", "bouillon", "stock cube"},
+		safe:     wheatSafe,
+		freeFrom: []string{"gluten free"},
+	},
+	"soy": {
+		high: []string{
+			"soy", "soya", "soybean", "tofu", "tempeh", "edamame", "miso", "natto", "tamari",
+			"shoyu", "textured vegetable protein", "tvp",
+		},
+		medium:   []string{"teriyaki", "hoisin", "lecithin", "vegetable protein"},
+		low:      []string{"vegetable oil"},
+		freeFrom: []string{"soy free"},
+	},
+	"fish": {
+		high: []string{
+			"fish", "salmon", "tuna", "cod", "tilapia", "halibut", "sardine", "anchovy",
+			"mackerel", "trout", "haddock", "pollock", "snapper", "sea bass", "catfish",
+			"swordfish", "mahi mahi", "herring", "bonito", "fish sauce", "nuoc mam",
+		},
+		medium: []string{"worcestershire", "caesar dressing", "dashi", "surimi", "imitation crab"},
+	},
+	"shellfish": {
+		high: []string{
+			"shellfish", "shrimp", "crab", "lobster", "clam", "mussel", "oyster", "scallop",
+			"crawfish", "crayfish", "prawn", "langoustine", "squid", "calamari", "octopus",
+			"crustacean", "mollusc", "mollusk",
+		},
+		medium: []string{"paella", "bouillabaisse", "cioppino"},
+		safe:   []string{"crab apple", "oyster mushroom"},
+	},
+	"sesame": {
+		high:   []string{"sesame", "tahini", "benne", "gomashio", "halvah", "halva"},
+		medium: []string{"hummus", "zaatar", "za atar", "furikake"},
+	},
+}
+
+// allergenAliases maps how users name allergens to ontology keys
+var allergenAliases = map[string][]string{
+	"milk": {"milk"}, "dairy": {"milk"}, "lactose": {"milk"}, "cow milk": {"milk"},
+	"egg":    {"eggs"},
+	"peanut": {"peanuts"}, "groundnut": {"peanuts"},
+	"tree nut": {"tree nuts"}, "nut": {"tree nuts"},
+	"wheat":  {"wheat"},
+	"gluten": {"gluten"}, "celiac": {"gluten"}, "coeliac": {"gluten"},
+	"soy": {"soy"}, "soya": {"soy"}, "soybean": {"soy"},
+	"fish":      {"fish"},
+	"shellfish": {"shellfish"}, "crustacean": {"shellfish"}, "mollusk": {"shellfish"}, "mollusc": {"shellfish"},
+	"seafood": {"fish", "shellfish"},
+	"sesame":  {"sesame"},
+}
+
+// allergenTerm is a tokenized ontology phrase
+type allergenTerm struct {
+	phrase     string
+	tokens     []string
+	confidence Confidence
+}
+
+// allergenRule is an ontology entry compiled for matching
+type allergenRule struct {
+	allergen string
+	terms    []allergenTerm // best first: confidence, then length
+	safe     [][]string
+	freeFrom [][]string
+}
+
+// compiledOntology holds every ontology entry ready for matching
+var compiledOntology = compileOntology()
+
+func compileOntology() map[string]*allergenRule {
+	rules := make(map[string]*allergenRule, len(allergenOntology))
+	for name, spec := range allergenOntology {
+		rules[name] = compileSpec(name, spec)
+	}
+	return rules
+}
+
+// compileSpec tokenizes one curated entry into a rule named name
+func compileSpec(name string, spec allergenSpec) *allergenRule {
+	rule := &allergenRule{allergen: name}
+	add := func(phrases []string, c Confidence) {
+		for _, p := range phrases {
+			rule.terms = append(rule.terms, allergenTerm{phrase: p, tokens: ingredientTokens(p), confidence: c})
+		}
+	}
+	add(spec.high, ConfidenceHigh)
+	add(spec.medium, ConfidenceMedium)
+	add(spec.low, ConfidenceLow)
+	sortTerms(rule.terms)
+	for _, p := range spec.safe {
+		rule.safe = append(rule.safe, ingredientTokens(p))
+	}
+	for _, p := range spec.freeFrom {
+		rule.freeFrom = append(rule.freeFrom, ingredientTokens(p))
+	}
+	return rule
+}
+
+func sortTerms(terms []allergenTerm) {
+	sort.SliceStable(terms, func(i, j int) bool {
+		if terms[i].confidence != terms[j].confidence {
+			return terms[i].confidence > terms[j].confidence
+		}
+		return len(terms[i].tokens) > len(terms[j].tokens)
+	})
+}
+
+// allergenRules resolves the user's allergens to ontology rules. Allergens
+// the ontology does not know still match themselves with high confidence.
+func allergenRules(allergens []string) []*allergenRule {
+	var rules []*allergenRule
+	seen := make(map[string]bool)
+	for _, allergen := range allergens {
+		tokens := ingredientTokens(allergen)
+		if len(tokens) == 0 {
+			continue
+		}
+		key := strings.Join(tokens, " ")
+
+		names, ok := allergenAliases[key]
+		if !ok {
+			if _, known := compiledOntology[key]; known {
+				names = []string{key}
+			}
+		}
+		if len(names) == 0 {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			rules = append(rules, &allergenRule{
+				allergen: strings.ToLower(strings.TrimSpace(allergen)),
+				terms:    []allergenTerm{{phrase: key, tokens: tokens, confidence: ConfidenceHigh}},
+				freeFrom: [][]string{append(tokens[:len(tokens):len(tokens)], "free")},
+			})
+			continue
+		}
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				rules = append(rules, compiledOntology[name])
+			}
+		}
+	}
+	return rules
+}
+
+// match returns the strongest term of r found in an ingredient's tokens
+// outside any safe phrase
+func (r *allergenRule) match(tokens []string) (allergenTerm, bool) {
+	for _, phrase := range r.freeFrom {
+		if len(phraseIndexes(tokens, phrase)) > 0 {
+			return allergenTerm{}, false
+		}
+	}
+
+	safe := make([]bool, len(tokens))
+	for _, phrase := range r.safe {
+		for _, i := range phraseIndexes(tokens, phrase) {
+			for j := range phrase {
+				safe[i+j] = true
+			}
+		}
+	}
+
+	for _, term := range r.terms {
+		for _, i := range phraseIndexes(tokens, term.tokens) {
+			covered := false
+			for j := range term.tokens {
+				covered = covered || safe[i+j]
+			}
+			if !covered {
+				return term, true
+			}
+		}
+	}
+	return allergenTerm{}, false
+}
+
+// matchIngredient checks one ingredient name against every rule
+func matchIngredient(name string, rules []*allergenRule) []AllergenMatch {
+	tokens := ingredientTokens(name)
+	var matches []AllergenMatch
+	for _, rule := range rules {
+		term, ok := rule.match(tokens)
+		if !ok {
+			continue
+		}
+		matches = append(matches, AllergenMatch{
+			Ingredient: name,
+			Allergen:   rule.allergen,
+			Term:       term.phrase,
+			Confidence: term.confidence,
+			Reason:     matchReason(term, rule.allergen),
+		})
+	}
+	return matches
+}
+
+func matchReason(term allergenTerm, allergen string) string {
+	switch {
+	case term.phrase == allergen:
+		return fmt.Sprintf("contains %s", allergen)
+	case term.confidence == ConfidenceHigh:
+		return fmt.Sprintf("%q is a %s ingredient", term.phrase, allergen)
+	case term.confidence == ConfidenceMedium:
+		return fmt.Sprintf("%q usually contains %s", term.phrase, allergen)
+	default:
+		return fmt.Sprintf("%q may contain %s", term.phrase, allergen)
+	}
+}
+
+// phraseIndexes returns every position at which phrase occurs in tokens
+func phraseIndexes(tokens, phrase []string) []int {
+	if len(phrase) == 0 {
+		return nil
+	}
+	var idx []int
+	for i := 0; i+len(phrase) <= len(tokens); i++ {
+		found := true
+		for j, p := range phrase {
+			if tokens[i+j] != p {
+				found = false
+				break
+			}
+		}
+		if found {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// accentFolder maps accented letters common in ingredient names to ASCII
+var accentFolder = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ä", "a", "ç", "c", "è", "e", "é", "e", "ê", "e",
+	"ë", "e", "î", "i", "ï", "i", "ñ", "n", "ô", "o", "ö", "o", "ù", "u", "û", "u", "ü", "u",
+)
+
+// ingredientTokens splits an ingredient name into whole lower-case words
+// with simple plurals reduced, so "butternut" never matches "butter" and
+// "eggplant" never matches "egg". Unlike nameTokens it keeps stopwords,
+// which ontology phrases such as "half and half" rely on, and drops
+// possessives so "brewer's yeast" reads as "brewer yeast".
+func ingredientTokens(s string) []string {
+	s = accentFolder.Replace(strings.ToLower(s)) + " "
+	s = strings.NewReplacer("'s ", " ", "’s ", " ").Replace(s)
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = singular(w)
+	}
+	return words
+}
+
+// Product conflict levels
+const (
+	ConflictContains   = "contains"    // the product contains the allergen
+	ConflictMayContain = "may_contain" // it may contain traces of it
+)
+
+// ProductConflict is one of the user's allergens found in a packaged product
+type ProductConflict struct {
+	Allergen string `json:"allergen"` // canonical allergen, e.g. "milk" for "dairy"
+	Source   string `json:"source"`   // "allergens", "traces" or "product_name"
+	Term     string `json:"term"`     // the product tag or name that matched
+	Level    string `json:"level"`    // ConflictContains or ConflictMayContain
+	Reason   string `json:"reason"`
+}
+
+// CheckProduct compares a product's declared allergens and traces, such as
+// Open Food Facts' "en:milk" tags, and its name against the user's
+// allergens, using the same ontology as recipe ingredients. Each allergen is
+// reported once, from the strongest evidence: declared allergens, then
+// traces, then the product name.
+func CheckProduct(name string, allergens, traces, userAllergens []string) []ProductConflict {
+	if len(userAllergens) == 0 {
+		return nil
+	}
+
+	var conflicts []ProductConflict
+	for _, rule := range allergenRules(userAllergens) {
+		if c, ok := matchProductTags(rule, allergens, "allergens", ConflictContains); ok {
+			conflicts = append(conflicts, c)
+			continue
+		}
+		if c, ok := matchProductTags(rule, traces, "traces", ConflictMayContain); ok {
+			conflicts = append(conflicts, c)
+			continue
+		}
+		if term, ok := rule.match(ingredientTokens(name)); ok && term.confidence >= filterConfidence {
+			level := ConflictContains
+			if term.confidence < ConfidenceHigh {
+				level = ConflictMayContain
+			}
+			conflicts = append(conflicts, ProductConflict{
+				Allergen: rule.allergen,
+				Source:   "product_name",
+				Term:     name,
+				Level:    level,
+				Reason:   matchReason(term, rule.allergen),
+			})
+		}
+	}
+	return conflicts
+}
+
+// matchProductTags returns a conflict for the first tag matching rule
+func matchProductTags(rule *allergenRule, tags []string, source, level string) (ProductConflict, bool) {
+	for _, tag := range tags {
+		if _, ok := rule.match(ingredientTokens(stripTagLanguage(tag))); !ok {
+			continue
+		}
+		reason := fmt.Sprintf("declares %s", rule.allergen)
+		if level == ConflictMayContain {
+			reason = fmt.Sprintf("may contain traces of %s", rule.allergen)
+		}
+		return ProductConflict{Allergen: rule.allergen, Source: source, Term: tag, Level: level, Reason: reason}, true
+	}
+	return ProductConflict{}, false
+}
+
+// stripTagLanguage drops a taxonomy language prefix: "en:milk" -> "milk"
+func stripTagLanguage(tag string) string {
+	if i := strings.Index(tag, ":"); i >= 0 && i <= 3 {
+		return tag[i+1:]
+	}
+	return tag
+}
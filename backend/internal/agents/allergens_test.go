@@ -0,0 +1,128 @@
+package agents
+
+import (
+	"testing"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+)
+
+func TestMatchIngredient(t *testing.T) {
+	cases := []struct {
+		ingredient string
+		allergens  []string
+		want       string // matched term, empty for no match
+		confidence Confidence
+	}{
+		{"butternut squash", []string{"dairy"}, "", 0},
+		{"eggplant", []string{"eggs"}, "", 0},
+		{"coconut milk", []string{"milk"}, "", 0},
+		{"cocoa butter", []string{"milk"}, "", 0},
+		{"peanut butter", []string{"dairy"}, "", 0},
+		{"water chestnuts", []string{"tree nuts"}, "", 0},
+		{"buckwheat flour", []string{"wheat"}, "", 0},
+		{"rice noodles", []string{"gluten"}, "", 0},
+		{"dairy-free cheese", []string{"dairy"}, "", 0},
+		{"Unsalted Butter", []string{"Dairy"}, "butter", ConfidenceHigh},
+		{"grated Parmesan", []string{"milk"}, "parmesan", ConfidenceHigh},
+		{"coconut milk and heavy cream", []string{"milk"}, "cream", ConfidenceHigh},
+		{"basil pesto", []string{"milk"}, "pesto", ConfidenceMedium},
+		{"dark chocolate", []string{"milk"}, "chocolate", ConfidenceLow},
+		{"Eggs", []string{"egg"}, "egg", ConfidenceHigh},
+		{"crème fraîche", []string{"dairy"}, "creme fraiche", ConfidenceHigh},
+		{"brewer's yeast", []string{"gluten"}, "brewer yeast", ConfidenceHigh},
+		{"Worcestershire sauce", []string{"fish"}, "worcestershire", ConfidenceMedium},
+		{"sliced turkey", []string{"Turkey"}, "turkey", ConfidenceHigh},
+		{"turkey-free gravy", []string{"turkey"}, "", 0},
+	}
+
+	for _, tc := range cases {
+		matches := matchIngredient(tc.ingredient, allergenRules(tc.allergens))
+		if tc.want == "" {
+			if len(matches) != 0 {
+				t.Errorf("%q vs %v: unexpected match %+v", tc.ingredient, tc.allergens, matches[0])
+			}
+			continue
+		}
+		if len(matches) != 1 {
+			t.Errorf("%q vs %v: got %d matches, want 1", tc.ingredient, tc.allergens, len(matches))
+			continue
+		}
+		if m := matches[0]; m.Term != tc.want || m.Confidence != tc.confidence {
+			t.Errorf("%q vs %v: matched %q (%s), want %q (%s)", tc.ingredient, tc.allergens, m.Term, m.Confidence, tc.want, tc.confidence)
+		}
+	}
+}
+
+func TestAllergenAliasesShareRules(t *testing.T) {
+	rules := allergenRules([]string{"Dairy", "milk", "Seafood", "shellfish"})
+	if len(rules) != 3 {
+		t.Fatalf("got %d rules, want milk, fish and shellfish", len(rules))
+	}
+	if rules[0].allergen != "milk" {
+		t.Errorf("dairy resolved to %q, want milk", rules[0].allergen)
+	}
+}
+
+func TestValidateRecipeIngredientsReasons(t *testing.T) {
+	f := NewAllergenFilter(logger.GetLogger("error"))
+	r := Recipe{
+		Ingredients:        []Ingredient{{Name: "eggplant"}, {Name: "mozzarella"}, {Name: "milk chocolate"}},
+		MissingIngredients: []Ingredient{{Name: "egg noodles"}},
+	}
+
+	matches := f.ValidateRecipeIngredients(r, []string{"dairy", "eggs"})
+	if len(matches) != 3 {
+		t.Fatalf("got %d matches, want mozzarella, milk chocolate and egg noodles: %+v", len(matches), matches)
+	}
+	if m := matches[1]; m.Term != "milk" || m.Confidence != ConfidenceHigh || m.Reason == "" {
+		t.Errorf("milk chocolate should match milk with high confidence, got %+v", m)
+	}
+	if got := f.Check(r, []string{"dairy"}).Status; got != AllergenFlagged {
+		t.Errorf("status = %s, want %s", got, AllergenFlagged)
+	}
+	if got := f.Check(Recipe{Ingredients: []Ingredient{{Name: "dark chocolate"}}}, []string{"dairy"}).Status; got != AllergenCaution {
+		t.Errorf("low confidence status = %s, want %s", got, AllergenCaution)
+	}
+	if got := f.FilterRecipes([]Recipe{{Ingredients: []Ingredient{{Name: "dark chocolate"}}}}, []string{"dairy"}); len(got) != 1 {
+		t.Error("low confidence matches should not filter a recipe")
+	}
+}
+
+func TestCheckProduct(t *testing.T) {
+	conflicts := CheckProduct("Hazelnut Spread", []string{"en:milk"}, []string{"en:peanuts"},
+		[]string{"dairy", "peanuts", "tree nuts", "eggs"})
+	if len(conflicts) != 3 {
+		t.Fatalf("got %d conflicts, want milk, peanuts and tree nuts: %+v", len(conflicts), conflicts)
+	}
+
+	want := map[string]struct{ source, level string }{
+		"milk":      {"allergens", ConflictContains},
+		"peanuts":   {"traces", ConflictMayContain},
+		"tree nuts": {"product_name", ConflictContains},
+	}
+	for _, c := range conflicts {
+		w, ok := want[c.Allergen]
+		if !ok || c.Source != w.source || c.Level != w.level {
+			t.Errorf("unexpected conflict %+v", c)
+		}
+	}
+
+	if got := CheckProduct("Coconut Milk", nil, nil, []string{"milk"}); len(got) != 0 {
+		t.Errorf("coconut milk should not conflict with milk, got %+v", got)
+	}
+}
+
+func TestExcludeUnsafePantryItems(t *testing.T) {
+	items := []PantryItem{
+		{Name: "Cheddar"},
+		{Name: "Granola Bar", Traces: []string{"en:nuts"}},
+		{Name: "Brown Rice"},
+	}
+	kept, excluded := excludeUnsafePantryItems(items, []string{"dairy", "tree nuts"})
+	if len(kept) != 1 || kept[0].Name != "Brown Rice" {
+		t.Errorf("kept %+v, want only Brown Rice", kept)
+	}
+	if len(excluded) != 2 {
+		t.Errorf("excluded %v, want Cheddar and Granola Bar", excluded)
+	}
+}
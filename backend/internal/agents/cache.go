@@ -0,0 +1,281 @@
+package agents
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCacheEntries bounds memory use; the entries closest to expiry are
+// evicted first when it is reached
+const maxCacheEntries = 1024
+
+// ResultCache holds successful GenerateResults in memory, keyed by CacheKey,
+// for a fixed TTL. Entries are indexed by user so a pantry or profile change
+// can drop them. All methods are safe on a nil *ResultCache, which caches
+// nothing.
+type ResultCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+	byUser  map[string]map[string]struct{}
+	now     func() time.Time
+}
+
+type cacheEntry struct {
+	userID    string
+	result    GenerateResult
+	expiresAt time.Time
+}
+
+// NewResultCache creates a cache whose entries live for ttl
+func NewResultCache(ttl time.Duration) *ResultCache {
+	return &ResultCache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+		byUser:  make(map[string]map[string]struct{}),
+		now:     time.Now,
+	}
+}
+
+// Get returns a copy of the cached result for key, marked Cached
+func (c *ResultCache) Get(key string) (*GenerateResult, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(entry.expiresAt) {
+		c.remove(key)
+		return nil, false
+	}
+
+	result := entry.result.clone()
+	result.Cached = true
+	return &result, true
+}
+
+// Set stores result under key for the cache TTL
+func (c *ResultCache) Set(userID, key string, result *GenerateResult) {
+	if c == nil || result == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= maxCacheEntries {
+		c.evict()
+	}
+
+	c.entries[key] = cacheEntry{
+		userID:    userID,
+		result:    result.clone(),
+		expiresAt: c.now().Add(c.ttl),
+	}
+	keys, ok := c.byUser[userID]
+	if !ok {
+		keys = make(map[string]struct{})
+		c.byUser[userID] = keys
+	}
+	keys[key] = struct{}{}
+}
+
+// clone deep-copies a result, so neither the cache nor its callers see
+// the other's in-place edits to recipes
+func (r *GenerateResult) clone() GenerateResult {
+	c := *r
+	c.PantryOnlyRecipes = cloneRecipes(r.PantryOnlyRecipes)
+	c.FlexibleRecipes = cloneRecipes(r.FlexibleRecipes)
+	c.PersonalRecipes = cloneRecipes(r.PersonalRecipes)
+	c.AllRecipes = cloneRecipes(r.AllRecipes)
+	c.DietaryRejections = slices.Clone(r.DietaryRejections)
+	for i := range c.DietaryRejections {
+		c.DietaryRejections[i].Violations = slices.Clone(c.DietaryRejections[i].Violations)
+	}
+	c.ExcludedPantryItems = slices.Clone(r.ExcludedPantryItems)
+	return c
+}
+
+func cloneRecipes(recipes []Recipe) []Recipe {
+	out := slices.Clone(recipes)
+	for i := range out {
+		r := &out[i]
+		r.Ingredients = cloneIngredients(r.Ingredients)
+		r.MissingIngredients = cloneIngredients(r.MissingIngredients)
+		r.Instructions = slices.Clone(r.Instructions)
+		r.Tags = slices.Clone(r.Tags)
+		r.Substitutions = slices.Clone(r.Substitutions)
+		for j := range r.Substitutions {
+			r.Substitutions[j].Allergens = slices.Clone(r.Substitutions[j].Allergens)
+		}
+		if r.Explanation != nil {
+			e := *r.Explanation
+			e.PantryIngredients = slices.Clone(e.PantryIngredients)
+			e.ExpiringItemsUsed = slices.Clone(e.ExpiringItemsUsed)
+			e.ItemsToBuy = slices.Clone(e.ItemsToBuy)
+			e.AllergenCheck.Matches = slices.Clone(e.AllergenCheck.Matches)
+			e.DietaryCheck.Diets = slices.Clone(e.DietaryCheck.Diets)
+			e.DietaryCheck.Unrecognized = slices.Clone(e.DietaryCheck.Unrecognized)
+			e.DietaryCheck.Violations = slices.Clone(e.DietaryCheck.Violations)
+			e.GoalFit = slices.Clone(e.GoalFit)
+			r.Explanation = &e
+		}
+	}
+	return out
+}
+
+func cloneIngredients(ingredients []Ingredient) []Ingredient {
+	out := slices.Clone(ingredients)
+	for i := range out {
+		out[i].AllergenFlags = slices.Clone(out[i].AllergenFlags)
+	}
+	return out
+}
+
+// InvalidateUser drops every cached result for a user
+func (c *ResultCache) InvalidateUser(userID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.byUser[userID] {
+		delete(c.entries, key)
+	}
+	delete(c.byUser, userID)
+}
+
+// PantryChanged implements pantry.ChangeNotifier
+func (c *ResultCache) PantryChanged(userID string) {
+	c.InvalidateUser(userID)
+}
+
+// ProfileChanged implements users.ChangeNotifier
+func (c *ResultCache) ProfileChanged(userID string) {
+	c.InvalidateUser(userID)
+}
+
+// Len returns how many entries are stored, including expired ones not yet evicted
+func (c *ResultCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// remove deletes one entry; the caller holds mu
+func (c *ResultCache) remove(key string) {
+	entry, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	delete(c.entries, key)
+	if keys := c.byUser[entry.userID]; keys != nil {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(c.byUser, entry.userID)
+		}
+	}
+}
+
+// evict drops expired entries, or the one expiring soonest if none have
+// expired; the caller holds mu
+func (c *ResultCache) evict() {
+	now := c.now()
+	oldestKey := ""
+	var oldest time.Time
+	evicted := false
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			c.remove(key)
+			evicted = true
+			continue
+		}
+		if oldestKey == "" || entry.expiresAt.Before(oldest) {
+			oldestKey, oldest = key, entry.expiresAt
+		}
+	}
+	if !evicted && oldestKey != "" {
+		c.remove(oldestKey)
+	}
+}
+
+// CacheKey returns a canonical hash of everything that influences a
+// generation: user, mode and the normalised RecipeRequest. Lists are sorted
+// and case-folded so logically equal requests share a key.
+func CacheKey(req GenerateRequest) string {
+	items := make([]PantryItem, len(req.PantryItems))
+	copy(items, req.PantryItems)
+	for i := range items {
+		items[i].Name = strings.ToLower(strings.TrimSpace(items[i].Name))
+		if items[i].ExpirationDate != nil {
+			day := items[i].ExpirationDate.UTC().Truncate(24 * time.Hour)
+			items[i].ExpirationDate = &day
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Name != items[j].Name {
+			return items[i].Name < items[j].Name
+		}
+		return items[i].ID < items[j].ID
+	})
+
+	canonical := struct {
+		UserID             string           `json:"user_id"`
+		Mode               OrchestratorMode `json:"mode"`
+		PantryItems        []PantryItem     `json:"pantry_items"`
+		Allergens          []string         `json:"allergens"`
+		AllergenStrict     bool             `json:"allergen_strict"`
+		DietaryPreferences []string         `json:"dietary_preferences"`
+		NutritionalGoals   []string         `json:"nutritional_goals"`
+		CookingSkill       string           `json:"cooking_skill"`
+		CuisinePreferences []string         `json:"cuisine_preferences"`
+		RecipeCount        int              `json:"recipe_count"`
+		UserPrompt         string           `json:"user_prompt"`
+	}{
+		UserID:             req.UserID,
+		Mode:               req.Mode,
+		PantryItems:        items,
+		Allergens:          canonicalList(req.Allergens),
+		AllergenStrict:     req.AllergenPolicy.Strict(),
+		DietaryPreferences: canonicalList(req.DietaryPreferences),
+		NutritionalGoals:   canonicalList(req.NutritionalGoals),
+		CookingSkill:       strings.ToLower(strings.TrimSpace(req.CookingSkill)),
+		CuisinePreferences: canonicalList(req.CuisinePreferences),
+		RecipeCount:        req.RecipeCount,
+		UserPrompt:         strings.TrimSpace(req.UserPrompt),
+	}
+
+	data, _ := json.Marshal(canonical)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalList lower-cases, trims, sorts and de-duplicates a list
+func canonicalList(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return out
+}
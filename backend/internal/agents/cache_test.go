@@ -0,0 +1,123 @@
+package agents
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+	"github.com/Jayyk09/CUHackIt/services/gemini"
+)
+
+func TestCacheKeyIsCanonical(t *testing.T) {
+	a := GenerateRequest{
+		RecipeRequest: RecipeRequest{
+			PantryItems: testPantry(),
+			Allergens:   []string{"Peanuts", "milk"},
+			RecipeCount: 2,
+		},
+		Mode:   ModeFlexible,
+		UserID: "u1",
+	}
+	b := a
+	b.PantryItems = []PantryItem{a.PantryItems[2], a.PantryItems[0], a.PantryItems[1]}
+	b.Allergens = []string{" milk", "peanuts", "MILK"}
+	b.ForceRefresh = true
+
+	if CacheKey(a) != CacheKey(b) {
+		t.Fatal("expected reordered, re-cased request to share a cache key")
+	}
+
+	c := a
+	c.Mode = ModePantryOnly
+	if CacheKey(a) == CacheKey(c) {
+		t.Fatal("expected mode to change the cache key")
+	}
+	d := a
+	d.UserPrompt = "spicy"
+	if CacheKey(a) == CacheKey(d) {
+		t.Fatal("expected prompt to change the cache key")
+	}
+}
+
+func TestOrchestratorServesFromCache(t *testing.T) {
+	fake := gemini.NewFakeClient(logger.GetLogger("error"))
+	cache := NewResultCache(time.Minute)
+	o := newTestOrchestrator(fake).WithCache(cache)
+	req := GenerateRequest{
+		RecipeRequest: RecipeRequest{PantryItems: testPantry(), RecipeCount: 2},
+		Mode:          ModeFlexible,
+		UserID:        "u1",
+	}
+
+	first, err := o.Generate(context.Background(), req)
+	if err != nil || first.Cached {
+		t.Fatalf("expected fresh result, got cached=%v err=%v", first != nil && first.Cached, err)
+	}
+
+	var events int
+	second, err := o.GenerateStream(context.Background(), req, func(RecipeEvent) { events++ })
+	if err != nil || !second.Cached {
+		t.Fatalf("expected cached result, got %+v, %v", second, err)
+	}
+	if events != second.TotalCount {
+		t.Fatalf("expected cached recipes to be replayed as %d events, got %d", second.TotalCount, events)
+	}
+	if fake.Calls() != 1 {
+		t.Fatalf("expected one provider call, got %d", fake.Calls())
+	}
+
+	req.ForceRefresh = true
+	if third, _ := o.Generate(context.Background(), req); third.Cached {
+		t.Fatal("expected force_refresh to bypass the cache")
+	}
+
+	cache.PantryChanged("u1")
+	req.ForceRefresh = false
+	if fourth, _ := o.Generate(context.Background(), req); fourth.Cached {
+		t.Fatal("expected pantry change to invalidate the cache")
+	}
+	if fake.Calls() != 3 {
+		t.Fatalf("expected three provider calls, got %d", fake.Calls())
+	}
+}
+
+func TestResultCacheExpires(t *testing.T) {
+	cache := NewResultCache(time.Minute)
+	now := time.Unix(0, 0)
+	cache.now = func() time.Time { return now }
+
+	cache.Set("u1", "k", &GenerateResult{TotalCount: 1})
+	if _, ok := cache.Get("k"); !ok {
+		t.Fatal("expected hit before TTL")
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok := cache.Get("k"); ok {
+		t.Fatal("expected miss after TTL")
+	}
+	if cache.Len() != 0 {
+		t.Fatalf("expected expired entry to be removed, have %d", cache.Len())
+	}
+}
+
+func TestResultCacheCopiesRecipes(t *testing.T) {
+	cache := NewResultCache(time.Minute)
+	original := &GenerateResult{AllRecipes: []Recipe{{
+		Title:       "Omelette",
+		Ingredients: []Ingredient{{Name: "egg"}},
+		Explanation: &RecipeExplanation{ItemsToBuy: []string{"chives"}},
+	}}}
+	cache.Set("u1", "k", original)
+	original.AllRecipes[0].Ingredients[0].Name = "changed after Set"
+
+	got, _ := cache.Get("k")
+	got.AllRecipes[0].Title = "Ranked Omelette"
+	got.AllRecipes[0].Ingredients[0].Name = "tofu"
+	got.AllRecipes[0].Explanation.ItemsToBuy[0] = "nothing"
+
+	again, _ := cache.Get("k")
+	r := again.AllRecipes[0]
+	if r.Title != "Omelette" || r.Ingredients[0].Name != "egg" || r.Explanation.ItemsToBuy[0] != "chives" {
+		t.Fatalf("cached recipe was changed through a caller's copy: %+v", r)
+	}
+}
@@ -0,0 +1,314 @@
+package agents
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+)
+
+// Dietary check statuses
+const (
+	DietCompliant  = "compliant"
+	DietCaution    = "caution" // only low confidence violations
+	DietViolated   = "violated"
+	DietNotChecked = "not_checked" // the user has no diet the validator knows
+)
+
+// DietaryViolation explains how a recipe breaks one of the user's diets
+type DietaryViolation struct {
+	Diet       string     `json:"diet"`                 // canonical diet, e.g. "vegan"
+	Class      string     `json:"class"`                // ingredient class, e.g. "meat", or "carbs" for macro limits
+	Ingredient string     `json:"ingredient,omitempty"` // empty for macro and combination rules
+	Term       string     `json:"term,omitempty"`       // the class term that matched, e.g. "bacon"
+	Confidence Confidence `json:"confidence"`
+	Reason     string     `json:"reason"`
+}
+
+// DietaryCheck reports the outcome of checking a recipe against the user's
+// dietary preferences
+type DietaryCheck struct {
+	Status       string             `json:"status"`                 // DietCompliant, DietCaution, DietViolated or DietNotChecked
+	Diets        []string           `json:"diets,omitempty"`        // the canonical diets checked
+	Unrecognized []string           `json:"unrecognized,omitempty"` // preferences no rule covers, left to the prompt
+	Violations   []DietaryViolation `json:"violations,omitempty"`
+}
+
+// DietaryRejection is a recipe the validator removed and why
+type DietaryRejection struct {
+	Title      string             `json:"title"`
+	Source     string             `json:"source"`
+	Violations []DietaryViolation `json:"violations"`
+}
+
+// dietClassSpecs are the ingredient classes diets forbid beyond the allergen
+// ontology entries they share (see dietClassRules). Terms, safe phrases and
+// confidence work as they do for allergens.
+var dietClassSpecs = map[string]allergenSpec{
+	"meat": {
+		high: []string{
+			"meat", "beef", "steak", "veal", "lamb", "mutton", "goat", "venison", "bison",
+			"pork", "bacon", "ham", "prosciutto", "pancetta", "guanciale", "sausage", "chorizo",
+			"pepperoni", "salami", "hot dog", "meatball", "mince", "brisket", "oxtail", "jerky",
+			"chicken", "turkey", "duck", "goose", "quail", "poultry", "lard", "tallow",
+			"bone broth", "chicken broth", "chicken stock", "beef broth", "beef stock",
+		},
+		medium: []string{"gravy", "bouillon", "stock cube"},
+		safe: []string{
+			"vegetable broth", "vegetable stock", "vegetable bouillon", "mushroom broth",
+			"veggie sausage", "veggie burger", "goat cheese", "goat milk", "goat yogurt",
+			"goat butter", "goat kefir", "lamb lettuce",
+		},
+		freeFrom: []string{"vegan", "vegetarian", "meatless", "meat free", "plant based"},
+	},
+	"pork": {
+		high: []string{
+			"pork", "bacon", "ham", "prosciutto", "pancetta", "guanciale", "lard", "chorizo",
+			"pepperoni", "salami", "pork belly", "spare rib",
+		},
+		medium: []string{"sausage", "hot dog", "gelatin", "gelatine", "mortadella"},
+		safe: []string{
+			"turkey bacon", "beef bacon", "turkey ham", "chicken sausage", "turkey sausage",
+			"beef sausage", "veggie sausage",
+		},
+		freeFrom: []string{"pork free", "halal", "vegan", "vegetarian"},
+	},
+	"gelatin": {
+		high:     []string{"gelatin", "gelatine", "aspic"},
+		medium:   []string{"marshmallow", "gummy", "collagen"},
+		freeFrom: []string{"vegan", "gelatin free"},
+	},
+	"honey": {
+		high:     []string{"honey", "honeycomb"},
+		freeFrom: []string{"vegan"},
+	},
+	"alcohol": {
+		high: []string{
+			"wine", "beer", "rum", "vodka", "whiskey", "whisky", "bourbon", "brandy", "cognac",
+			"gin", "tequila", "sake", "mirin", "sherry", "liqueur", "vermouth", "champagne",
+			"prosecco", "marsala", "amaretto", "kahlua",
+		},
+		medium: []string{"cider"},
+		low:    []string{"vanilla extract"},
+		safe: []string{
+			"wine vinegar", "cider vinegar", "sherry vinegar", "root beer", "ginger beer",
+		},
+		freeFrom: []string{"alcohol free", "non alcoholic"},
+	},
+	"high carb": {
+		high: append([]string{
+			"sugar", "brown sugar", "honey", "maple syrup", "agave", "corn syrup", "molasses",
+			"rice", "potato", "corn", "cornstarch", "oat", "oatmeal", "quinoa", "bean", "lentil",
+			"chickpea", "banana",
+		}, wheatHigh...),
+		medium: []string{"ketchup", "barbecue sauce", "bbq sauce", "teriyaki", "hoisin"},
+		safe: []string{
+			"cauliflower rice", "riced cauliflower", "rice vinegar", "rice wine vinegar",
+			"green bean", "bean sprout", "sugar snap pea", "sugar free", "almond flour",
+			"coconut flour", "lettuce wrap",
+		},
+		freeFrom: []string{"keto", "low carb"},
+	},
+}
+
+// dietClassRules holds every ingredient class ready for matching, keyed by
+// class name. Classes that are also allergens reuse the allergen ontology.
+var dietClassRules = compileDietClasses()
+
+func compileDietClasses() map[string]*allergenRule {
+	rules := make(map[string]*allergenRule, len(dietClassSpecs)+5)
+	for name, spec := range dietClassSpecs {
+		rules[name] = compileSpec(name, spec)
+	}
+	for class, allergen := range map[string]string{
+		"dairy": "milk", "eggs": "eggs", "fish": "fish", "shellfish": "shellfish", "gluten": "gluten",
+	} {
+		rules[class] = compiledOntology[allergen]
+	}
+	return rules
+}
+
+// dietSpec is what one diet rules out
+type dietSpec struct {
+	forbidden []string    // ingredient classes the diet excludes
+	maxCarbsG float64     // carbs per serving, 0 for no limit
+	separate  [][2]string // classes that must not share a recipe
+}
+
+// dietSpecs maps each canonical diet to its rules
+var dietSpecs = map[string]dietSpec{
+	"vegan":       {forbidden: []string{"meat", "fish", "shellfish", "dairy", "eggs", "gelatin", "honey"}},
+	"vegetarian":  {forbidden: []string{"meat", "fish", "shellfish", "gelatin"}},
+	"pescatarian": {forbidden: []string{"meat", "gelatin"}},
+	"halal":       {forbidden: []string{"pork", "alcohol"}},
+	"kosher":      {forbidden: []string{"pork", "shellfish"}, separate: [][2]string{{"meat", "dairy"}}},
+	"gluten free": {forbidden: []string{"gluten"}},
+	"dairy free":  {forbidden: []string{"dairy"}},
+	"keto":        {forbidden: []string{"high carb"}, maxCarbsG: 20},
+	"low carb":    {maxCarbsG: 50},
+}
+
+// dietAliases maps how users name diets to dietSpecs keys
+var dietAliases = map[string]string{
+	"plant based": "vegan", "vegetarian": "vegetarian", "lacto ovo vegetarian": "vegetarian",
+	"pescetarian": "pescatarian",
+	"ketogenic":   "keto",
+	"lowcarb":     "low carb",
+	"celiac":      "gluten free", "coeliac": "gluten free", "no gluten": "gluten free",
+	"lactose free": "dairy free", "no dairy": "dairy free",
+}
+
+// resolveDiets maps the user's preferences to canonical diets, returning
+// the preferences no rule covers separately
+func resolveDiets(preferences []string) (diets, unrecognized []string) {
+	for _, pref := range preferences {
+		key := strings.Join(ingredientTokens(pref), " ")
+		if alias, ok := dietAliases[key]; ok {
+			key = alias
+		}
+		if _, ok := dietSpecs[key]; !ok {
+			if strings.TrimSpace(pref) != "" {
+				unrecognized = append(unrecognized, pref)
+			}
+			continue
+		}
+		diets = appendUnique(diets, key)
+	}
+	return diets, unrecognized
+}
+
+// checkDiet checks a recipe against every diet in preferences
+func checkDiet(recipe Recipe, preferences []string) DietaryCheck {
+	diets, unrecognized := resolveDiets(preferences)
+	check := DietaryCheck{Status: DietNotChecked, Diets: diets, Unrecognized: unrecognized}
+	if len(diets) == 0 {
+		return check
+	}
+
+	var ingredients []string
+	for _, list := range [][]Ingredient{recipe.Ingredients, recipe.MissingIngredients} {
+		for _, ing := range list {
+			ingredients = append(ingredients, ing.Name)
+		}
+	}
+
+	for _, diet := range diets {
+		check.Violations = append(check.Violations, dietViolations(diet, recipe, ingredients)...)
+	}
+
+	check.Status = DietCompliant
+	for _, v := range check.Violations {
+		if v.Confidence >= filterConfidence {
+			check.Status = DietViolated
+			break
+		}
+		check.Status = DietCaution
+	}
+	return check
+}
+
+// dietViolations applies one diet's class, combination and macro rules
+func dietViolations(diet string, recipe Recipe, ingredients []string) []DietaryViolation {
+	spec := dietSpecs[diet]
+	var violations []DietaryViolation
+
+	for _, class := range spec.forbidden {
+		for _, name := range ingredients {
+			term, ok := dietClassRules[class].match(ingredientTokens(name))
+			if !ok {
+				continue
+			}
+			violations = append(violations, DietaryViolation{
+				Diet:       diet,
+				Class:      class,
+				Ingredient: name,
+				Term:       term.phrase,
+				Confidence: term.confidence,
+				Reason:     matchReason(term, class),
+			})
+		}
+	}
+
+	for _, pair := range spec.separate {
+		a, aOK := firstClassMatch(pair[0], ingredients)
+		b, bOK := firstClassMatch(pair[1], ingredients)
+		if aOK && bOK {
+			violations = append(violations, DietaryViolation{
+				Diet:       diet,
+				Class:      pair[0] + " and " + pair[1],
+				Confidence: ConfidenceHigh,
+				Reason:     fmt.Sprintf("combines %s (%s) with %s (%s)", pair[0], a, pair[1], b),
+			})
+		}
+	}
+
+	// Carbs of 0 mean the model gave no macros, which cannot be judged
+	if spec.maxCarbsG > 0 && recipe.CarbsG > spec.maxCarbsG {
+		violations = append(violations, DietaryViolation{
+			Diet:       diet,
+			Class:      "carbs",
+			Confidence: ConfidenceHigh,
+			Reason:     fmt.Sprintf("%.0fg carbs per serving exceeds the %.0fg limit", recipe.CarbsG, spec.maxCarbsG),
+		})
+	}
+	return violations
+}
+
+// firstClassMatch returns the first ingredient that confidently belongs to class
+func firstClassMatch(class string, ingredients []string) (string, bool) {
+	for _, name := range ingredients {
+		if term, ok := dietClassRules[class].match(ingredientTokens(name)); ok && term.confidence >= filterConfidence {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// DietaryValidator filters recipes that break the user's dietary
+// preferences. Like AllergenFilter it is a post-processing filter applied
+// to generated recipes; preferences it does not recognize are left to the
+// prompt.
+type DietaryValidator struct {
+	log *logger.Logger
+}
+
+// NewDietaryValidator creates a new DietaryValidator
+func NewDietaryValidator(log *logger.Logger) *DietaryValidator {
+	return &DietaryValidator{log: log}
+}
+
+// Check runs every known diet in preferences against a recipe
+func (v *DietaryValidator) Check(recipe Recipe, preferences []string) DietaryCheck {
+	return checkDiet(recipe, preferences)
+}
+
+// FilterRecipes filters out recipes that violate the dietary preferences
+func (v *DietaryValidator) FilterRecipes(recipes []Recipe, preferences []string) []Recipe {
+	kept, _ := v.Partition(recipes, preferences)
+	return kept
+}
+
+// Partition splits recipes into the compliant ones, including those with
+// only low confidence violations, and rejections for the rest
+func (v *DietaryValidator) Partition(recipes []Recipe, preferences []string) ([]Recipe, []DietaryRejection) {
+	if diets, _ := resolveDiets(preferences); len(diets) == 0 {
+		return recipes, nil
+	}
+
+	var kept []Recipe
+	var rejected []DietaryRejection
+	for _, recipe := range recipes {
+		check := checkDiet(recipe, preferences)
+		if check.Status != DietViolated {
+			kept = append(kept, recipe)
+			continue
+		}
+		v.log.Debug("DietaryValidator: Filtered out recipe '%s': %s", recipe.Title, check.Violations[0].Reason)
+		rejected = append(rejected, DietaryRejection{Title: recipe.Title, Source: recipe.Source, Violations: check.Violations})
+	}
+
+	if len(rejected) > 0 {
+		v.log.Info("DietaryValidator: %d of %d recipes passed dietary check", len(kept), len(recipes))
+	}
+	return kept, rejected
+}
@@ -0,0 +1,100 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+	"github.com/Jayyk09/CUHackIt/services/gemini"
+)
+
+func TestCheckDiet(t *testing.T) {
+	recipe := func(carbs float64, names ...string) Recipe {
+		r := Recipe{CarbsG: carbs}
+		for _, n := range names {
+			r.Ingredients = append(r.Ingredients, Ingredient{Name: n})
+		}
+		return r
+	}
+
+	cases := []struct {
+		name   string
+		recipe Recipe
+		diets  []string
+		want   string
+		class  string // class of the first violation
+	}{
+		{"vegan bacon", recipe(0, "smoked bacon", "tomato"), []string{"Vegan"}, DietViolated, "meat"},
+		{"vegan butter", recipe(0, "vegan butter", "tofu"), []string{"vegan"}, DietCompliant, ""},
+		{"vegan honey", recipe(0, "honey", "oats"), []string{"plant-based"}, DietViolated, "honey"},
+		{"vegetarian broth", recipe(0, "vegetable broth", "eggs"), []string{"vegetarian"}, DietCompliant, ""},
+		{"vegetarian goat cheese", recipe(0, "goat cheese", "goat's milk yogurt", "lamb's lettuce"), []string{"vegetarian"}, DietCompliant, ""},
+		{"vegetarian goat", recipe(0, "goat shoulder"), []string{"vegetarian"}, DietViolated, "meat"},
+		{"vegetarian gelatin", recipe(0, "gelatin"), []string{"vegetarian"}, DietViolated, "gelatin"},
+		{"pescatarian salmon", recipe(0, "salmon fillet"), []string{"pescetarian"}, DietCompliant, ""},
+		{"halal wine", recipe(0, "red wine", "beef"), []string{"Halal"}, DietViolated, "alcohol"},
+		{"halal vinegar", recipe(0, "red wine vinegar", "turkey bacon"), []string{"halal"}, DietCompliant, ""},
+		{"kosher cheeseburger", recipe(0, "ground beef", "cheddar"), []string{"kosher"}, DietViolated, "meat and dairy"},
+		{"keto rice", recipe(0, "white rice", "chicken"), []string{"Keto"}, DietViolated, "high carb"},
+		{"keto cauliflower rice", recipe(0, "cauliflower rice"), []string{"ketogenic"}, DietCompliant, ""},
+		{"low carb macros", recipe(65, "chicken"), []string{"low-carb"}, DietViolated, "carbs"},
+		{"low carb unknown macros", recipe(0, "pasta"), []string{"low carb"}, DietCompliant, ""},
+		{"gluten free", recipe(0, "rice noodles"), []string{"Gluten-Free"}, DietCompliant, ""},
+		{"vanilla extract", recipe(0, "vanilla extract"), []string{"halal"}, DietCaution, ""},
+		{"unknown diet", recipe(0, "bacon"), []string{"mediterranean"}, DietNotChecked, ""},
+	}
+
+	for _, tc := range cases {
+		check := checkDiet(tc.recipe, tc.diets)
+		if check.Status != tc.want {
+			t.Errorf("%s: status = %s, want %s (%+v)", tc.name, check.Status, tc.want, check.Violations)
+			continue
+		}
+		if tc.class != "" && check.Violations[0].Class != tc.class {
+			t.Errorf("%s: violation class = %q, want %q", tc.name, check.Violations[0].Class, tc.class)
+		}
+	}
+
+	if check := checkDiet(recipe(0), []string{"vegan", "mediterranean"}); len(check.Unrecognized) != 1 {
+		t.Errorf("expected mediterranean to be reported as unrecognized, got %v", check.Unrecognized)
+	}
+}
+
+func TestOrchestratorRejectsOffDietRecipes(t *testing.T) {
+	fake := gemini.NewFakeClient(logger.GetLogger("error"))
+	o := newTestOrchestrator(fake)
+
+	var streamed []string
+	result, err := o.GenerateStream(context.Background(), GenerateRequest{
+		RecipeRequest: RecipeRequest{PantryItems: testPantry(), RecipeCount: 2, DietaryPreferences: []string{"pescatarian"}},
+		Mode:          ModeFlexible,
+	}, func(ev RecipeEvent) {
+		if ev.Type == RecipeEventRecipe {
+			streamed = append(streamed, ev.Recipe.Title)
+		}
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.TotalCount != 1 || result.DietFilteredCount != 1 || len(result.FlexibleRecipes) != 1 {
+		t.Fatalf("expected the chicken recipe rejected, got total=%d diet_filtered=%d", result.TotalCount, result.DietFilteredCount)
+	}
+	if rej := result.DietaryRejections[0]; rej.Title != "Chicken Fajita Bowls" || rej.Violations[0].Diet != "pescatarian" {
+		t.Errorf("unexpected rejection %+v", rej)
+	}
+	if got := result.AllRecipes[0].Explanation.DietaryCheck.Status; got != DietCompliant {
+		t.Errorf("kept recipe dietary status = %s, want %s", got, DietCompliant)
+	}
+	if len(streamed) != 1 || streamed[0] != result.AllRecipes[0].Title {
+		t.Errorf("expected only the compliant recipe to be streamed, got %v", streamed)
+	}
+
+	_, err = o.Generate(context.Background(), GenerateRequest{
+		RecipeRequest: RecipeRequest{PantryItems: testPantry(), RecipeCount: 2, DietaryPreferences: []string{"vegan"}},
+		Mode:          ModeFlexible,
+	})
+	if !errors.Is(err, ErrAllRecipesFiltered) {
+		t.Errorf("expected ErrAllRecipesFiltered when every recipe is off-diet, got %v", err)
+	}
+}
@@ -1,10 +1,6 @@
 package agents
 
-import (
-	"strings"
-
-	"github.com/Jayyk09/CUHackIt/pkg/logger"
-)
+import "github.com/Jayyk09/CUHackIt/pkg/logger"
 
 // AllergenFilter filters recipes based on user allergens
 // This is a post-processing filter applied to generated recipes
@@ -17,58 +13,9 @@ func NewAllergenFilter(log *logger.Logger) *AllergenFilter {
 	return &AllergenFilter{log: log}
 }
 
-// commonAllergenDerivatives maps allergens to their derivatives/related ingredients
-var commonAllergenDerivatives = map[string][]string{
-	"peanuts": {
-		"peanut", "peanut butter", "peanut oil", "groundnut", "arachis oil",
-	},
-	"tree nuts": {
-		"almond", "cashew", "walnut", "pecan", "pistachio", "hazelnut", "macadamia",
-		"brazil nut", "pine nut", "chestnut", "almond milk", "almond butter",
-		"cashew milk", "walnut oil",
-	},
-	"milk": {
-		"milk", "dairy", "cheese", "butter", "cream", "yogurt", "ice cream",
-		"whey", "casein", "lactose", "ghee", "sour cream", "half and half",
-		"condensed milk", "evaporated milk", "cream cheese", "cottage cheese",
-		"ricotta", "mozzarella", "parmesan", "cheddar", "brie", "feta",
-	},
-	"dairy": {
-		"milk", "dairy", "cheese", "butter", "cream", "yogurt", "ice cream",
-		"whey", "casein", "lactose", "ghee", "sour cream", "half and half",
-		"condensed milk", "evaporated milk", "cream cheese", "cottage cheese",
-		"ricotta", "mozzarella", "parmesan", "cheddar", "brie", "feta",
-	},
-	"eggs": {
-		"egg", "eggs", "egg white", "egg yolk", "mayonnaise", "meringue",
-		"albumin", "globulin", "lysozyme", "ovalbumin",
-	},
-	"wheat": {
-		"wheat", "flour", "bread", "pasta", "noodle", "cracker", "cookie",
-		"cake", "pastry", "couscous", "bulgur", "semolina", "durum",
-		"farina", "seitan", "breadcrumb",
-	},
-	"gluten": {
-		"wheat", "barley", "rye", "flour", "bread", "pasta", "noodle",
-		"cracker", "cookie", "cake", "pastry", "couscous", "bulgur",
-		"semolina", "seitan", "soy sauce", "malt",
-	},
-	"soy": {
-		"soy", "soya", "soybean", "tofu", "tempeh", "edamame", "miso",
-		"soy sauce", "soy milk", "soy lecithin", "tamari",
-	},
-	"fish": {
-		"fish", "salmon", "tuna", "cod", "tilapia", "halibut", "sardine",
-		"anchovy", "fish sauce", "worcestershire", "caesar dressing",
-	},
-	"shellfish": {
-		"shellfish", "shrimp", "crab", "lobster", "clam", "mussel", "oyster",
-		"scallop", "crawfish", "crayfish", "prawn",
-	},
-	"sesame": {
-		"sesame", "sesame seed", "sesame oil", "tahini", "hummus", "halvah",
-	},
-}
+// filterConfidence is the weakest match that removes a recipe. Low
+// confidence matches ("may contain") are reported but not filtered.
+const filterConfidence = ConfidenceMedium
 
 // FilterRecipes filters out recipes that contain allergens
 func (f *AllergenFilter) FilterRecipes(recipes []Recipe, allergens []string) []Recipe {
@@ -78,27 +25,15 @@ func (f *AllergenFilter) FilterRecipes(recipes []Recipe, allergens []string) []R
 
 	f.log.Info("AllergenFilter: Filtering %d recipes against %d allergens", len(recipes), len(allergens))
 
-	// Build a set of all allergen-related terms
-	allergenTerms := make(map[string]bool)
-	for _, allergen := range allergens {
-		allergenLower := strings.ToLower(strings.TrimSpace(allergen))
-		allergenTerms[allergenLower] = true
-
-		// Add derivatives
-		if derivatives, ok := commonAllergenDerivatives[allergenLower]; ok {
-			for _, derivative := range derivatives {
-				allergenTerms[strings.ToLower(derivative)] = true
-			}
-		}
-	}
+	rules := allergenRules(allergens)
 
 	var safeRecipes []Recipe
 	for _, recipe := range recipes {
-		if f.isRecipeSafe(recipe, allergenTerms) {
-			safeRecipes = append(safeRecipes, recipe)
-		} else {
-			f.log.Debug("AllergenFilter: Filtered out recipe '%s' due to allergen match", recipe.Title)
+		if match, ok := firstBlockingMatch(recipeAllergenMatches(recipe, rules)); ok {
+			f.log.Debug("AllergenFilter: Filtered out recipe '%s': %s (%s)", recipe.Title, match.Ingredient, match.Reason)
+			continue
 		}
+		safeRecipes = append(safeRecipes, recipe)
 	}
 
 	f.log.Info("AllergenFilter: %d of %d recipes passed allergen check", len(safeRecipes), len(recipes))
@@ -106,76 +41,84 @@ func (f *AllergenFilter) FilterRecipes(recipes []Recipe, allergens []string) []R
 	return safeRecipes
 }
 
-// isRecipeSafe checks if a recipe contains any allergen-related ingredients
-func (f *AllergenFilter) isRecipeSafe(recipe Recipe, allergenTerms map[string]bool) bool {
-	// Check all ingredients
-	for _, ingredient := range recipe.Ingredients {
-		if f.containsAllergen(ingredient.Name, allergenTerms) {
-			return false
+// Partition splits recipes into the safe ones and the names of the
+// ingredients that made the rest unsafe
+func (f *AllergenFilter) Partition(recipes []Recipe, allergens []string) ([]Recipe, []string) {
+	rules := allergenRules(allergens)
+	var safe []Recipe
+	var flagged []string
+	for _, recipe := range recipes {
+		blocked := false
+		for _, m := range recipeAllergenMatches(recipe, rules) {
+			if m.Confidence >= filterConfidence {
+				blocked = true
+				flagged = appendUnique(flagged, m.Ingredient)
+			}
 		}
-	}
-
-	// Check missing ingredients too
-	for _, ingredient := range recipe.MissingIngredients {
-		if f.containsAllergen(ingredient.Name, allergenTerms) {
-			return false
+		if !blocked {
+			safe = append(safe, recipe)
 		}
 	}
-
-	return true
+	return safe, flagged
 }
 
-// containsAllergen checks if an ingredient name contains any allergen terms
-func (f *AllergenFilter) containsAllergen(ingredientName string, allergenTerms map[string]bool) bool {
-	ingredientLower := strings.ToLower(ingredientName)
-
-	// Check direct match
-	if allergenTerms[ingredientLower] {
-		return true
+// recipeAllergenMatches checks every ingredient, including the ones to buy
+func recipeAllergenMatches(recipe Recipe, rules []*allergenRule) []AllergenMatch {
+	var matches []AllergenMatch
+	for _, ingredient := range recipe.Ingredients {
+		matches = append(matches, matchIngredient(ingredient.Name, rules)...)
+	}
+	for _, ingredient := range recipe.MissingIngredients {
+		matches = append(matches, matchIngredient(ingredient.Name, rules)...)
 	}
+	return matches
+}
 
-	// Check if ingredient contains any allergen term
-	for term := range allergenTerms {
-		if strings.Contains(ingredientLower, term) {
-			return true
+// firstBlockingMatch returns the first match confident enough to filter on
+func firstBlockingMatch(matches []AllergenMatch) (AllergenMatch, bool) {
+	for _, m := range matches {
+		if m.Confidence >= filterConfidence {
+			return m, true
 		}
 	}
+	return AllergenMatch{}, false
+}
 
-	return false
+// Allergen check statuses
+const (
+	AllergenSafe       = "safe"
+	AllergenCaution    = "caution" // only low confidence matches
+	AllergenFlagged    = "flagged"
+	AllergenNotChecked = "not_checked" // the user has no allergens
+)
+
+// AllergenCheck reports the outcome of checking a recipe against the user's allergens
+type AllergenCheck struct {
+	Status  string          `json:"status"` // AllergenSafe, AllergenCaution, AllergenFlagged or AllergenNotChecked
+	Matches []AllergenMatch `json:"matches,omitempty"`
 }
 
-// ValidateRecipeIngredients validates that a recipe doesn't contain any allergens
-// Returns a list of problematic ingredients if any are found
-func (f *AllergenFilter) ValidateRecipeIngredients(recipe Recipe, allergens []string) []string {
+// Check runs ValidateRecipeIngredients and summarizes the outcome
+func (f *AllergenFilter) Check(recipe Recipe, allergens []string) AllergenCheck {
 	if len(allergens) == 0 {
-		return nil
+		return AllergenCheck{Status: AllergenNotChecked}
 	}
-
-	// Build allergen terms
-	allergenTerms := make(map[string]bool)
-	for _, allergen := range allergens {
-		allergenLower := strings.ToLower(strings.TrimSpace(allergen))
-		allergenTerms[allergenLower] = true
-		if derivatives, ok := commonAllergenDerivatives[allergenLower]; ok {
-			for _, derivative := range derivatives {
-				allergenTerms[strings.ToLower(derivative)] = true
-			}
-		}
+	matches := f.ValidateRecipeIngredients(recipe, allergens)
+	if len(matches) == 0 {
+		return AllergenCheck{Status: AllergenSafe}
 	}
-
-	var problematicIngredients []string
-
-	for _, ingredient := range recipe.Ingredients {
-		if f.containsAllergen(ingredient.Name, allergenTerms) {
-			problematicIngredients = append(problematicIngredients, ingredient.Name)
-		}
+	if _, ok := firstBlockingMatch(matches); ok {
+		return AllergenCheck{Status: AllergenFlagged, Matches: matches}
 	}
+	return AllergenCheck{Status: AllergenCaution, Matches: matches}
+}
 
-	for _, ingredient := range recipe.MissingIngredients {
-		if f.containsAllergen(ingredient.Name, allergenTerms) {
-			problematicIngredients = append(problematicIngredients, ingredient.Name)
-		}
+// ValidateRecipeIngredients validates that a recipe doesn't contain any allergens.
+// It returns one match per offending ingredient and allergen, with the
+// ontology term that matched, its confidence and a readable reason.
+func (f *AllergenFilter) ValidateRecipeIngredients(recipe Recipe, allergens []string) []AllergenMatch {
+	if len(allergens) == 0 {
+		return nil
 	}
-
-	return problematicIngredients
+	return recipeAllergenMatches(recipe, allergenRules(allergens))
 }
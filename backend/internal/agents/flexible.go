@@ -12,13 +12,13 @@ const DefaultMaxMissingItems = 3
 
 // FlexibleRecipeAgent generates recipes using pantry items plus a limited number of additional ingredients
 type FlexibleRecipeAgent struct {
-	client          *gemini.Client
+	client          gemini.Provider
 	log             *logger.Logger
 	maxMissingItems int
 }
 
 // NewFlexibleRecipeAgent creates a new FlexibleRecipeAgent
-func NewFlexibleRecipeAgent(client *gemini.Client, log *logger.Logger) *FlexibleRecipeAgent {
+func NewFlexibleRecipeAgent(client gemini.Provider, log *logger.Logger) *FlexibleRecipeAgent {
 	return &FlexibleRecipeAgent{
 		client:          client,
 		log:             log,
@@ -39,6 +39,11 @@ func (a *FlexibleRecipeAgent) Name() string {
 
 // GenerateRecipes generates recipes using pantry items plus up to N additional ingredients
 func (a *FlexibleRecipeAgent) GenerateRecipes(ctx context.Context, req RecipeRequest) (*RecipeResponse, error) {
+	return a.StreamRecipes(ctx, req, nil)
+}
+
+// StreamRecipes is GenerateRecipes with progress reported through emit
+func (a *FlexibleRecipeAgent) StreamRecipes(ctx context.Context, req RecipeRequest, emit EmitFunc) (*RecipeResponse, error) {
 	a.log.Info("FlexibleRecipeAgent: Generating %d recipes from %d pantry items (max %d missing allowed)",
 		req.RecipeCount, len(req.PantryItems), a.maxMissingItems)
 
@@ -53,7 +58,7 @@ func (a *FlexibleRecipeAgent) GenerateRecipes(ctx context.Context, req RecipeReq
 	}
 
 	// Generate recipes
-	recipes, err := a.client.GenerateRecipes(ctx, geminiReq)
+	recipes, err := generateWithEvents(ctx, a.client, false, geminiReq, "flexible", emit)
 	if err != nil {
 		a.log.Error("FlexibleRecipeAgent: Failed to generate recipes: %v", err)
 		return nil, err
@@ -3,6 +3,7 @@ package agents
 import (
 	"context"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/Jayyk09/CUHackIt/pkg/logger"
@@ -11,7 +12,7 @@ import (
 
 var (
 	ErrNoRecipesGenerated = errors.New("no recipes could be generated")
-	ErrAllRecipesFiltered = errors.New("all recipes were filtered due to allergens")
+	ErrAllRecipesFiltered = errors.New("all recipes were filtered due to allergens or dietary preferences")
 	ErrInvalidRequest     = errors.New("invalid recipe request")
 )
 
@@ -24,6 +25,9 @@ const (
 	ModeBoth       OrchestratorMode = "both"
 	ModeSpoiling   OrchestratorMode = "spoiling"
 	ModePersonal   OrchestratorMode = "personal"
+	// ModeEnsemble runs every agent concurrently and returns the best
+	// RecipeCount recipes of the deduplicated union
+	ModeEnsemble OrchestratorMode = "ensemble"
 )
 
 // Orchestrator coordinates multiple agents to generate recipes
@@ -33,25 +37,54 @@ type Orchestrator struct {
 	spoilingAgent  *SpoilingAgent
 	personalAgent  *PersonalRecipeAgent
 	allergenFilter *AllergenFilter
+	substituter    *Substituter
+	dietValidator  *DietaryValidator
+	cache          *ResultCache
 	log            *logger.Logger
 }
 
-// NewOrchestrator creates a new Orchestrator with all agents
-func NewOrchestrator(geminiClient *gemini.Client, log *logger.Logger) *Orchestrator {
+// NewOrchestrator creates a new Orchestrator with all agents backed by the given provider
+func NewOrchestrator(provider gemini.Provider, log *logger.Logger) *Orchestrator {
 	return &Orchestrator{
-		pantryAgent:    NewPantryOnlyAgent(geminiClient, log),
-		flexibleAgent:  NewFlexibleRecipeAgent(geminiClient, log),
-		spoilingAgent:  NewSpoilingAgent(geminiClient, log),
-		personalAgent:  NewPersonalRecipeAgent(geminiClient, log),
+		pantryAgent:    NewPantryOnlyAgent(provider, log),
+		flexibleAgent:  NewFlexibleRecipeAgent(provider, log),
+		spoilingAgent:  NewSpoilingAgent(provider, log),
+		personalAgent:  NewPersonalRecipeAgent(provider, log),
 		allergenFilter: NewAllergenFilter(log),
+		substituter:    NewSubstituter(provider, log),
+		dietValidator:  NewDietaryValidator(log),
 		log:            log,
 	}
 }
 
+// ChargesQuota reports whether a generation counts against the user's
+// quota. Failures give the user nothing and cached results cost nothing,
+// but recipes generated and then filtered were paid for and still count.
+func ChargesQuota(result *GenerateResult, err error) bool {
+	if err != nil {
+		return errors.Is(err, ErrAllRecipesFiltered)
+	}
+	return result == nil || !result.Cached
+}
+
+// WithCache serves repeated requests from cache (nil disables caching)
+func (o *Orchestrator) WithCache(cache *ResultCache) *Orchestrator {
+	o.cache = cache
+	return o
+}
+
 // GenerateRequest contains the request for the orchestrator
 type GenerateRequest struct {
 	RecipeRequest
 	Mode OrchestratorMode `json:"mode"`
+
+	// UserID scopes cached results so they can be invalidated per user
+	UserID string `json:"user_id,omitempty"`
+	// ForceRefresh bypasses the cache; the fresh result still replaces it
+	ForceRefresh bool `json:"force_refresh,omitempty"`
+	// ExcludeUnsafePantryItems keeps pantry items whose declared allergens,
+	// traces or name conflict with the user's allergens away from the agents
+	ExcludeUnsafePantryItems bool `json:"exclude_unsafe_pantry_items,omitempty"`
 }
 
 // GenerateResult contains the combined results from all agents
@@ -62,11 +95,42 @@ type GenerateResult struct {
 	AllRecipes        []Recipe  `json:"all_recipes"`
 	GeneratedAt       time.Time `json:"generated_at"`
 	TotalCount        int       `json:"total_count"`
-	FilteredCount     int       `json:"filtered_count"` // How many were removed due to allergens
+	FilteredCount     int       `json:"filtered_count"`            // How many were removed due to allergens
+	DuplicateCount    int       `json:"duplicate_count,omitempty"` // Near-identical recipes dropped in ensemble mode
+	Cached            bool      `json:"cached"`                    // Served from the result cache
+
+	// SubstitutedCount is how many unsafe recipes were kept by swapping
+	// their flagged ingredients rather than being removed
+	SubstitutedCount int `json:"substituted_count,omitempty"`
+	// DietFilteredCount is how many recipes were removed for breaking the
+	// user's dietary preferences; DietaryRejections says why
+	DietFilteredCount int                `json:"diet_filtered_count,omitempty"`
+	DietaryRejections []DietaryRejection `json:"dietary_rejections,omitempty"`
+
+	// ExcludedPantryItems names the pantry items withheld from the agents
+	// because of ExcludeUnsafePantryItems
+	ExcludedPantryItems []string `json:"excluded_pantry_items,omitempty"`
 }
 
 // Generate orchestrates recipe generation across agents
 func (o *Orchestrator) Generate(ctx context.Context, req GenerateRequest) (*GenerateResult, error) {
+	return o.GenerateStream(ctx, req, nil)
+}
+
+// GenerateStream is Generate that also fans in the agents' RecipeEvents and
+// forwards them to emit, one at a time, as they are produced. Recipe events
+// are numbered across agents via Index. Under the strict allergen policy with
+// allergens set, step events are withheld and only recipes that pass the
+// allergen filter are emitted. Recipes that break a known diet in the
+// dietary preferences are never emitted, and are removed from the result.
+// In ensemble mode nothing is emitted until the recipes have been ranked.
+// emit may be nil.
+func (o *Orchestrator) GenerateStream(ctx context.Context, req GenerateRequest, emit EmitFunc) (*GenerateResult, error) {
+	var excluded []string
+	if req.ExcludeUnsafePantryItems && len(req.Allergens) > 0 {
+		req.PantryItems, excluded = excludeUnsafePantryItems(req.PantryItems, req.Allergens)
+	}
+
 	// Allow empty pantry when the user provides a prompt or when using personal mode
 	// (personal mode derives everything from the user profile, not the pantry).
 	if len(req.PantryItems) == 0 && req.UserPrompt == "" && req.Mode != ModePersonal {
@@ -80,125 +144,326 @@ func (o *Orchestrator) Generate(ctx context.Context, req GenerateRequest) (*Gene
 		req.RecipeCount = 3 // Max 3 recipes per agent
 	}
 
+	var cacheKey string
+	if o.cache != nil {
+		cacheKey = CacheKey(req)
+		if !req.ForceRefresh {
+			if cached, ok := o.cache.Get(cacheKey); ok {
+				o.log.Info("Orchestrator: Serving %d cached recipes (mode=%s)", cached.TotalCount, req.Mode)
+				replayEvents(cached.AllRecipes, emit)
+				return cached, nil
+			}
+		}
+	}
+
 	o.log.Info("Orchestrator: Starting recipe generation (mode=%s, pantry_items=%d, recipe_count=%d)",
 		req.Mode, len(req.PantryItems), req.RecipeCount)
 
 	result := &GenerateResult{
-		GeneratedAt: time.Now(),
+		GeneratedAt:         time.Now(),
+		ExcludedPantryItems: excluded,
 	}
 
 	var allRecipes []Recipe
-	var totalGenerated int
+
+	ctx = gemini.WithUsageTags(ctx, gemini.UsageTags{UserID: req.UserID, Mode: string(req.Mode)})
+	emit = o.fanIn(emit, req)
 
 	switch req.Mode {
 	case ModePantryOnly:
-		recipes, err := o.generatePantryOnly(ctx, req.RecipeRequest)
+		recipes, err := o.generatePantryOnly(ctx, req.RecipeRequest, emit)
 		if err != nil {
 			return nil, err
 		}
+		recipes = o.enforceAllergens(ctx, req.RecipeRequest, recipes, o.generatePantryOnly, emit, result)
 		result.PantryOnlyRecipes = recipes
 		allRecipes = append(allRecipes, recipes...)
-		totalGenerated = len(recipes)
 
 	case ModeFlexible:
-		recipes, err := o.generateFlexible(ctx, req.RecipeRequest)
+		recipes, err := o.generateFlexible(ctx, req.RecipeRequest, emit)
 		if err != nil {
 			return nil, err
 		}
+		recipes = o.enforceAllergens(ctx, req.RecipeRequest, recipes, o.generateFlexible, emit, result)
 		result.FlexibleRecipes = recipes
 		allRecipes = append(allRecipes, recipes...)
-		totalGenerated = len(recipes)
 
 	case ModeBoth:
 		// Generate from both agents concurrently
-		pantryRecipes, flexibleRecipes, err := o.generateBoth(ctx, req.RecipeRequest)
+		pantryRecipes, flexibleRecipes, err := o.generateBoth(ctx, req.RecipeRequest, emit)
 		if err != nil {
 			return nil, err
 		}
+		if pantryRecipes != nil {
+			pantryRecipes = o.enforceAllergens(ctx, req.RecipeRequest, pantryRecipes, o.generatePantryOnly, emit, result)
+		}
+		if flexibleRecipes != nil {
+			flexibleRecipes = o.enforceAllergens(ctx, req.RecipeRequest, flexibleRecipes, o.generateFlexible, emit, result)
+		}
 		result.PantryOnlyRecipes = pantryRecipes
 		result.FlexibleRecipes = flexibleRecipes
 		allRecipes = append(allRecipes, pantryRecipes...)
 		allRecipes = append(allRecipes, flexibleRecipes...)
-		totalGenerated = len(pantryRecipes) + len(flexibleRecipes)
 
 	case ModeSpoiling:
-		recipes, err := o.generateSpoiling(ctx, req.RecipeRequest)
+		recipes, err := o.generateSpoiling(ctx, req.RecipeRequest, emit)
 		if err != nil {
 			return nil, err
 		}
+		recipes = o.enforceAllergens(ctx, req.RecipeRequest, recipes, o.generateSpoiling, emit, result)
 		result.PantryOnlyRecipes = recipes
 		allRecipes = append(allRecipes, recipes...)
-		totalGenerated = len(recipes)
+
+	case ModeEnsemble:
+		recipes, err := o.generateEnsemble(ctx, req.RecipeRequest, result)
+		if err != nil {
+			return nil, err
+		}
+		// Reject off-diet recipes before ranking so they do not take a slot
+		recipes = o.rejectOffDiet(recipes, req.RecipeRequest, result)
+		ranked, duplicates := rankRecipes(recipes, req.RecipeRequest, req.RecipeCount)
+		allRecipes = ranked
+		result.DuplicateCount = duplicates
+		replayEvents(ranked, emit)
 
 	case ModePersonal:
-		recipes, err := o.generatePersonal(ctx, req.RecipeRequest)
+		recipes, err := o.generatePersonal(ctx, req.RecipeRequest, emit)
 		if err != nil {
 			return nil, err
 		}
+		recipes = o.enforceAllergens(ctx, req.RecipeRequest, recipes, o.generatePersonal, emit, result)
 		result.PersonalRecipes = recipes
 		allRecipes = append(allRecipes, recipes...)
-		totalGenerated = len(recipes)
 
 	default:
 		// Default to pantry-only
-		recipes, err := o.generatePantryOnly(ctx, req.RecipeRequest)
+		recipes, err := o.generatePantryOnly(ctx, req.RecipeRequest, emit)
 		if err != nil {
 			return nil, err
 		}
+		recipes = o.enforceAllergens(ctx, req.RecipeRequest, recipes, o.generatePantryOnly, emit, result)
 		result.PantryOnlyRecipes = recipes
 		allRecipes = append(allRecipes, recipes...)
-		totalGenerated = len(recipes)
 	}
 
-	// Apply hard allergen post-filter only in personal mode.
-	// In pantry/flexible modes allergens are soft hints to Gemini; the post-filter
-	// there is overly aggressive and would wipe out all recipes if the model
-	// didn't perfectly comply. Personal mode double-enforces them.
-	if req.Mode == ModePersonal && len(req.Allergens) > 0 {
-		filteredRecipes := o.allergenFilter.FilterRecipes(allRecipes, req.Allergens)
-		result.FilteredCount = totalGenerated - len(filteredRecipes)
-		allRecipes = filteredRecipes
+	// Dietary preferences are checked after generation, whichever agent
+	// produced the recipes
+	allRecipes = o.rejectOffDiet(allRecipes, req.RecipeRequest, result)
+	for _, recipes := range []*[]Recipe{&result.PantryOnlyRecipes, &result.FlexibleRecipes, &result.PersonalRecipes} {
+		*recipes = o.dietValidator.FilterRecipes(*recipes, req.DietaryPreferences)
+	}
 
-		if result.PersonalRecipes != nil {
-			result.PersonalRecipes = o.allergenFilter.FilterRecipes(result.PersonalRecipes, req.Allergens)
-		}
+	// Explain every recipe server-side, whichever agent produced it
+	for _, recipes := range [][]Recipe{allRecipes, result.PantryOnlyRecipes, result.FlexibleRecipes, result.PersonalRecipes} {
+		explainRecipes(recipes, req.RecipeRequest, o.allergenFilter)
 	}
 
 	result.AllRecipes = allRecipes
 	result.TotalCount = len(allRecipes)
 
 	if result.TotalCount == 0 {
-		if result.FilteredCount > 0 {
+		if result.FilteredCount > 0 || result.DietFilteredCount > 0 {
 			return result, ErrAllRecipesFiltered
 		}
 		return result, ErrNoRecipesGenerated
 	}
 
-	o.log.Info("Orchestrator: Generated %d recipes (%d filtered)", result.TotalCount, result.FilteredCount)
+	o.log.Info("Orchestrator: Generated %d recipes (%d filtered, %d off-diet)",
+		result.TotalCount, result.FilteredCount, result.DietFilteredCount)
+
+	if o.cache != nil {
+		o.cache.Set(req.UserID, cacheKey, result)
+	}
 
 	return result, nil
 }
 
+// maxAllergenRetries bounds how many times the strict allergen policy asks
+// an agent for replacements
+const maxAllergenRetries = 2
+
+// generateFunc is the signature shared by the per-agent generate methods
+type generateFunc func(ctx context.Context, req RecipeRequest, emit EmitFunc) ([]Recipe, error)
+
+// enforceAllergens applies the user's allergen policy to one agent's
+// recipes. Under the strict policy unsafe recipes are rescued by
+// substituting their flagged ingredients where possible; the rest are
+// dropped and counted in result.FilteredCount, and gen is asked for
+// replacements, told which ingredients to avoid, until req.RecipeCount safe
+// recipes are in hand or the retries run out. Rescued recipes and
+// replacements are streamed only once kept, so none reaches the stream and
+// is then cut to fit req.RecipeCount. Under the warn policy recipes
+// are kept; their flagged ingredients are annotated when the recipes are
+// explained.
+func (o *Orchestrator) enforceAllergens(ctx context.Context, req RecipeRequest, recipes []Recipe, gen generateFunc, emit EmitFunc, result *GenerateResult) []Recipe {
+	if len(req.Allergens) == 0 || !req.AllergenPolicy.Strict() {
+		return recipes
+	}
+
+	safe, avoid, dropped := o.screenAllergens(ctx, req, recipes, nil, req.RecipeCount, emit, result)
+	for attempt := 1; dropped > 0 && len(safe) < req.RecipeCount && attempt <= maxAllergenRetries; attempt++ {
+		retry := req
+		retry.RecipeCount = req.RecipeCount - len(safe)
+		retry.AvoidIngredients = avoid
+
+		o.log.Info("Orchestrator: %d unsafe recipes dropped, requesting %d replacements (attempt %d)",
+			dropped, retry.RecipeCount, attempt)
+		// Replacements are not streamed as produced: some may be
+		// duplicates or beyond the count, and are emitted below once kept
+		more, err := gen(ctx, retry, nil)
+		if err != nil {
+			o.log.Warn("Orchestrator: allergen replacement failed: %v", err)
+			break
+		}
+
+		var fresh []Recipe
+		for _, r := range more {
+			if !containsSimilar(safe, r) && !containsSimilar(fresh, r) {
+				fresh = append(fresh, r)
+			}
+		}
+
+		moreSafe, moreAvoid, moreDropped := o.screenAllergens(ctx, req, fresh, avoid, retry.RecipeCount, nil, result)
+		dropped += moreDropped
+		avoid = moreAvoid
+		for _, r := range moreSafe {
+			safe = append(safe, r)
+			if emit != nil {
+				emit(RecipeEvent{Type: RecipeEventRecipe, Source: r.Source, Recipe: &r})
+			}
+		}
+	}
+
+	result.FilteredCount += dropped
+	return safe
+}
+
+// screenAllergens keeps up to limit recipes that are safe for req.Allergens,
+// trying to rescue the rest with substitutions; recipes past limit are left
+// unscreened. Rescued recipes are counted in result.SubstitutedCount and
+// emitted, since the stream withheld them while they were unsafe, unless
+// they break req's diets. Ingredients that could not be substituted are
+// added to avoid and returned with the number of recipes dropped; recipes
+// using an ingredient already in avoid are dropped without another attempt.
+func (o *Orchestrator) screenAllergens(ctx context.Context, req RecipeRequest, recipes []Recipe, avoid []string, limit int, emit EmitFunc, result *GenerateResult) ([]Recipe, []string, int) {
+	var safe []Recipe
+	dropped := 0
+	for _, r := range recipes {
+		if len(safe) == limit {
+			break
+		}
+		_, flagged := o.allergenFilter.Partition([]Recipe{r}, req.Allergens)
+		if len(flagged) == 0 {
+			safe = append(safe, r)
+			continue
+		}
+
+		if !containsAny(avoid, flagged) {
+			if rescued, ok := o.substituter.Substitute(ctx, r, req.Allergens, req.DietaryPreferences, req.PantryItems); ok {
+				o.log.Info("Orchestrator: substituted %d ingredients in '%s'", len(rescued.Substitutions)-len(r.Substitutions), r.Title)
+				result.SubstitutedCount++
+				safe = append(safe, rescued)
+				// Off-diet recipes are rejected later and must not reach
+				// the stream first
+				if emit != nil && o.dietValidator.Check(rescued, req.DietaryPreferences).Status != DietViolated {
+					emit(RecipeEvent{Type: RecipeEventRecipe, Source: rescued.Source, Recipe: &rescued})
+				}
+				continue
+			}
+		}
+		dropped++
+		avoid = appendUnique(avoid, flagged...)
+	}
+	return safe, avoid, dropped
+}
+
+// rejectOffDiet removes the recipes that break req's dietary preferences,
+// recording why in result
+func (o *Orchestrator) rejectOffDiet(recipes []Recipe, req RecipeRequest, result *GenerateResult) []Recipe {
+	kept, rejected := o.dietValidator.Partition(recipes, req.DietaryPreferences)
+	result.DietFilteredCount += len(rejected)
+	result.DietaryRejections = append(result.DietaryRejections, rejected...)
+	return kept
+}
+
+// containsAny reports whether list holds any of values
+func containsAny(list, values []string) bool {
+	for _, v := range values {
+		for _, existing := range list {
+			if existing == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsSimilar reports whether recipes already holds a near-duplicate of r
+func containsSimilar(recipes []Recipe, r Recipe) bool {
+	for _, existing := range recipes {
+		if similarRecipes(existing, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendUnique appends the values not already in list
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, existing := range list {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// replayEvents emits a recipe event for each cached recipe
+func replayEvents(recipes []Recipe, emit EmitFunc) {
+	if emit == nil {
+		return
+	}
+	counts := make(map[string]int)
+	for i := range recipes {
+		r := recipes[i]
+		emit(RecipeEvent{
+			Type:        RecipeEventRecipe,
+			Source:      r.Source,
+			SourceIndex: counts[r.Source],
+			Index:       i,
+			Recipe:      &r,
+		})
+		counts[r.Source]++
+	}
+}
+
 // generatePantryOnly generates recipes using only pantry items.
 // If Gemini can't form any recipes from the pantry alone, it falls back to
 // flexible mode so the user always gets results.
-func (o *Orchestrator) generatePantryOnly(ctx context.Context, req RecipeRequest) ([]Recipe, error) {
-	resp, err := o.pantryAgent.GenerateRecipes(ctx, req)
+func (o *Orchestrator) generatePantryOnly(ctx context.Context, req RecipeRequest, emit EmitFunc) ([]Recipe, error) {
+	resp, err := o.pantryAgent.StreamRecipes(ctx, req, emit)
 	if err != nil {
 		return nil, err
 	}
 
 	if len(resp.Recipes) == 0 {
 		o.log.Info("Orchestrator: pantry-only yielded 0 recipes, falling back to flexible mode")
-		return o.generateFlexible(ctx, req)
+		return o.generateFlexible(ctx, req, emit)
 	}
 
 	return resp.Recipes, nil
 }
 
 // generateFlexible generates recipes with additional ingredients allowed
-func (o *Orchestrator) generateFlexible(ctx context.Context, req RecipeRequest) ([]Recipe, error) {
-	resp, err := o.flexibleAgent.GenerateRecipes(ctx, req)
+func (o *Orchestrator) generateFlexible(ctx context.Context, req RecipeRequest, emit EmitFunc) ([]Recipe, error) {
+	resp, err := o.flexibleAgent.StreamRecipes(ctx, req, emit)
 	if err != nil {
 		return nil, err
 	}
@@ -206,7 +471,7 @@ func (o *Orchestrator) generateFlexible(ctx context.Context, req RecipeRequest)
 }
 
 // generateBoth generates recipes from both agents concurrently
-func (o *Orchestrator) generateBoth(ctx context.Context, req RecipeRequest) ([]Recipe, []Recipe, error) {
+func (o *Orchestrator) generateBoth(ctx context.Context, req RecipeRequest, emit EmitFunc) ([]Recipe, []Recipe, error) {
 	type result struct {
 		recipes []Recipe
 		err     error
@@ -217,13 +482,13 @@ func (o *Orchestrator) generateBoth(ctx context.Context, req RecipeRequest) ([]R
 
 	// Generate pantry-only recipes
 	go func() {
-		recipes, err := o.generatePantryOnly(ctx, req)
+		recipes, err := o.generatePantryOnly(ctx, req, emit)
 		resultChan <- result{recipes: recipes, err: err, source: "pantry_only"}
 	}()
 
 	// Generate flexible recipes
 	go func() {
-		recipes, err := o.generateFlexible(ctx, req)
+		recipes, err := o.generateFlexible(ctx, req, emit)
 		resultChan <- result{recipes: recipes, err: err, source: "flexible"}
 	}()
 
@@ -254,8 +519,8 @@ func (o *Orchestrator) generateBoth(ctx context.Context, req RecipeRequest) ([]R
 }
 
 // generateSpoiling generates recipes prioritizing expiring ingredients
-func (o *Orchestrator) generateSpoiling(ctx context.Context, req RecipeRequest) ([]Recipe, error) {
-	resp, err := o.spoilingAgent.GenerateRecipes(ctx, req)
+func (o *Orchestrator) generateSpoiling(ctx context.Context, req RecipeRequest, emit EmitFunc) ([]Recipe, error) {
+	resp, err := o.spoilingAgent.StreamRecipes(ctx, req, emit)
 	if err != nil {
 		return nil, err
 	}
@@ -263,14 +528,144 @@ func (o *Orchestrator) generateSpoiling(ctx context.Context, req RecipeRequest)
 }
 
 // generatePersonal generates recipes from the user's profile with no pantry dependency
-func (o *Orchestrator) generatePersonal(ctx context.Context, req RecipeRequest) ([]Recipe, error) {
-	resp, err := o.personalAgent.GenerateRecipes(ctx, req)
+func (o *Orchestrator) generatePersonal(ctx context.Context, req RecipeRequest, emit EmitFunc) ([]Recipe, error) {
+	resp, err := o.personalAgent.StreamRecipes(ctx, req, emit)
 	if err != nil {
 		return nil, err
 	}
 	return resp.Recipes, nil
 }
 
+// generateEnsemble runs every applicable agent concurrently without
+// streaming. Agents that need a pantry are skipped without one, and the
+// spoiling agent when nothing is about to expire. Under the strict allergen
+// policy unsafe recipes are rescued by substitution or dropped; the union of
+// the other agents usually leaves enough to rank, so no replacements are
+// requested. Filtered and substituted recipes are counted in res. It returns
+// the union, failing only if every agent failed.
+func (o *Orchestrator) generateEnsemble(ctx context.Context, req RecipeRequest, res *GenerateResult) ([]Recipe, error) {
+	agents := []Agent{o.personalAgent}
+	if len(req.PantryItems) > 0 {
+		agents = append(agents, o.pantryAgent)
+		if hasExpiringItems(req.PantryItems) {
+			agents = append(agents, o.spoilingAgent)
+		}
+	}
+	if len(req.PantryItems) > 0 || req.UserPrompt != "" {
+		agents = append(agents, o.flexibleAgent)
+	}
+
+	type result struct {
+		recipes []Recipe
+		err     error
+		source  string
+	}
+	resultChan := make(chan result, len(agents))
+	for _, agent := range agents {
+		go func(agent Agent) {
+			resp, err := agent.GenerateRecipes(ctx, req)
+			if err != nil {
+				resultChan <- result{err: err, source: agent.Name()}
+				return
+			}
+			resultChan <- result{recipes: resp.Recipes, source: agent.Name()}
+		}(agent)
+	}
+
+	var union []Recipe
+	var lastErr error
+	succeeded := 0
+	for range agents {
+		r := <-resultChan
+		if r.err != nil {
+			o.log.Error("Orchestrator: %s agent failed: %v", r.source, r.err)
+			lastErr = r.err
+			continue
+		}
+		succeeded++
+		if len(req.Allergens) > 0 && req.AllergenPolicy.Strict() {
+			kept, _, dropped := o.screenAllergens(ctx, req, r.recipes, nil, len(r.recipes), nil, res)
+			res.FilteredCount += dropped
+			r.recipes = kept
+		}
+		union = append(union, r.recipes...)
+	}
+
+	if succeeded == 0 {
+		return nil, lastErr
+	}
+	return union, nil
+}
+
+// excludeUnsafePantryItems splits off the pantry items that conflict with
+// the user's allergens, returning the rest and the names of those removed
+func excludeUnsafePantryItems(items []PantryItem, allergens []string) ([]PantryItem, []string) {
+	kept := make([]PantryItem, 0, len(items))
+	var excluded []string
+	for _, item := range items {
+		if len(CheckProduct(item.Name, item.Allergens, item.Traces, allergens)) > 0 {
+			excluded = append(excluded, item.Name)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept, excluded
+}
+
+// hasExpiringItems reports whether any unexpired pantry item expires soon
+func hasExpiringItems(items []PantryItem) bool {
+	for _, item := range items {
+		if item.IsExpiringSoon && !item.IsExpired {
+			return true
+		}
+	}
+	return false
+}
+
+// fanIn wraps emit so events from concurrently running agents are delivered
+// one at a time with recipe events numbered in arrival order. It returns nil
+// when emit is nil so agents can skip streaming entirely.
+func (o *Orchestrator) fanIn(emit EmitFunc, req GenerateRequest) EmitFunc {
+	if emit == nil {
+		return nil
+	}
+
+	// Under the strict policy nothing unsafe may reach the client: steps
+	// are withheld since they describe recipes before they can be checked
+	checkAllergens := len(req.Allergens) > 0 && req.AllergenPolicy.Strict()
+	diets, _ := resolveDiets(req.DietaryPreferences)
+
+	var mu sync.Mutex
+	next := 0
+	return func(ev RecipeEvent) {
+		if checkAllergens {
+			if ev.Type == RecipeEventStep {
+				return
+			}
+			if len(o.allergenFilter.FilterRecipes([]Recipe{*ev.Recipe}, req.Allergens)) == 0 {
+				return
+			}
+		}
+		if len(diets) > 0 && ev.Type == RecipeEventRecipe && checkDiet(*ev.Recipe, req.DietaryPreferences).Status == DietViolated {
+			return
+		}
+
+		if ev.Type == RecipeEventRecipe && ev.Recipe != nil {
+			r := *ev.Recipe
+			explainRecipe(&r, req.RecipeRequest, o.allergenFilter)
+			ev.Recipe = &r
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if ev.Type == RecipeEventRecipe {
+			ev.Index = next
+			next++
+		}
+		emit(ev)
+	}
+}
+
 // QuickGenerate is a convenience method for quick recipe generation
 func (o *Orchestrator) QuickGenerate(ctx context.Context, pantryItems []PantryItem, allergens []string) (*GenerateResult, error) {
 	return o.Generate(ctx, GenerateRequest{
@@ -0,0 +1,295 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+	"github.com/Jayyk09/CUHackIt/services/gemini"
+)
+
+func testPantry() []PantryItem {
+	soon := time.Now().Add(24 * time.Hour)
+	return []PantryItem{
+		{ID: "1", Name: "Chicken Breast", Category: "MEAT", Quantity: 2, Unit: "lb", ExpirationDate: &soon, IsExpiringSoon: true},
+		{ID: "2", Name: "Brown Rice", Category: "PANTRY", Quantity: 1, Unit: "lb"},
+		{ID: "3", Name: "Eggs", Category: "DAIRY", Quantity: 12, Unit: "item"},
+	}
+}
+
+func newTestOrchestrator(fake *gemini.FakeClient) *Orchestrator {
+	return NewOrchestrator(fake, logger.GetLogger("error"))
+}
+
+func TestOrchestratorModesWithFakeProvider(t *testing.T) {
+	tests := []struct {
+		mode      OrchestratorMode
+		wantCount int
+	}{
+		{ModePantryOnly, 2},
+		{ModeFlexible, 2},
+		{ModeBoth, 4},
+		{ModeSpoiling, 2},
+		{ModePersonal, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			o := newTestOrchestrator(gemini.NewFakeClient(logger.GetLogger("error")))
+			result, err := o.Generate(context.Background(), GenerateRequest{
+				RecipeRequest: RecipeRequest{PantryItems: testPantry(), RecipeCount: 2},
+				Mode:          tt.mode,
+			})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result.TotalCount != tt.wantCount {
+				t.Fatalf("expected %d recipes, got %d", tt.wantCount, result.TotalCount)
+			}
+		})
+	}
+}
+
+func TestOrchestratorBothSurvivesOneAgentFailure(t *testing.T) {
+	fake := gemini.NewFakeClient(logger.GetLogger("error")).WithFailEvery(2)
+	o := newTestOrchestrator(fake)
+
+	result, err := o.Generate(context.Background(), GenerateRequest{
+		RecipeRequest: RecipeRequest{PantryItems: testPantry(), RecipeCount: 2},
+		Mode:          ModeBoth,
+	})
+	if err != nil {
+		t.Fatalf("expected partial success, got %v", err)
+	}
+	if result.TotalCount != 2 {
+		t.Fatalf("expected 2 recipes from the surviving agent, got %d", result.TotalCount)
+	}
+}
+
+func TestOrchestratorPropagatesProviderError(t *testing.T) {
+	fake := gemini.NewFakeClient(logger.GetLogger("error"))
+	fake.Enqueue(gemini.FakeResponse{Err: gemini.ErrGenerationFail})
+	o := newTestOrchestrator(fake)
+
+	_, err := o.Generate(context.Background(), GenerateRequest{
+		RecipeRequest: RecipeRequest{PantryItems: testPantry(), RecipeCount: 2},
+		Mode:          ModeFlexible,
+	})
+	if !errors.Is(err, gemini.ErrGenerationFail) {
+		t.Fatalf("expected ErrGenerationFail, got %v", err)
+	}
+}
+
+func TestOrchestratorPersonalFiltersAllergens(t *testing.T) {
+	fake := gemini.NewFakeClient(logger.GetLogger("error"))
+	o := newTestOrchestrator(fake)
+
+	result, err := o.Generate(context.Background(), GenerateRequest{
+		RecipeRequest: RecipeRequest{RecipeCount: 2, Allergens: []string{"turkey"}},
+		Mode:          ModePersonal,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// The fixture only ever offers the recipe already kept as a replacement,
+	// and turkey has no substitute, which is asked of the model only once
+	if result.FilteredCount != 1 || result.TotalCount != 1 {
+		t.Fatalf("expected 1 kept and 1 filtered, got total=%d filtered=%d", result.TotalCount, result.FilteredCount)
+	}
+	if fake.Calls() != 2+maxAllergenRetries {
+		t.Errorf("expected one substitution and %d replacement attempts, got %d calls", maxAllergenRetries, fake.Calls())
+	}
+}
+
+func TestOrchestratorStrictPolicyReplacesUnsafeRecipes(t *testing.T) {
+	fake := gemini.NewFakeClient(logger.GetLogger("error"))
+	fake.Enqueue(gemini.FakeResponse{Text: `{"recipes": [
+		{"title": "Grilled Mahi Mahi", "ingredients": [{"name": "mahi mahi", "amount": "1"}], "instructions": ["Grill."]},
+		{"title": "Chicken Fajita Bowls", "ingredients": [{"name": "chicken breast", "amount": "1"}], "instructions": ["Cook."]}
+	]}`}, gemini.FakeResponse{Err: gemini.ErrGenerationFail}, gemini.FakeResponse{Text: `{"recipes": [
+		{"title": "Lemon Herb Chicken", "ingredients": [{"name": "chicken breast", "amount": "1"}], "instructions": ["Roast."]}
+	]}`})
+	o := newTestOrchestrator(fake)
+
+	var streamed []string
+	result, err := o.GenerateStream(context.Background(), GenerateRequest{
+		RecipeRequest: RecipeRequest{PantryItems: testPantry(), RecipeCount: 2, Allergens: []string{"fish"}},
+		Mode:          ModeFlexible,
+	}, func(ev RecipeEvent) {
+		if ev.Type == RecipeEventRecipe {
+			streamed = append(streamed, ev.Recipe.Title)
+		}
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.TotalCount != 2 || result.FilteredCount != 1 {
+		t.Fatalf("expected 2 safe recipes and 1 filtered, got total=%d filtered=%d", result.TotalCount, result.FilteredCount)
+	}
+	if got := result.AllRecipes[1].Title; got != "Lemon Herb Chicken" {
+		t.Errorf("expected the replacement second, got %q", got)
+	}
+	if prompts := fake.Prompts(); len(prompts) != 3 || !strings.Contains(prompts[2], "mahi mahi") {
+		t.Errorf("expected the replacement prompt to name the ingredient to avoid")
+	}
+	for _, title := range streamed {
+		if title == "Grilled Mahi Mahi" {
+			t.Error("unsafe recipe was streamed under the strict policy")
+		}
+	}
+}
+
+func TestEnforceAllergensStreamsOnlyKeptRecipes(t *testing.T) {
+	recipe := func(title string, ingredients ...string) Recipe {
+		r := Recipe{Title: title, Instructions: []string{"Cook."}}
+		for _, name := range ingredients {
+			r.Ingredients = append(r.Ingredients, Ingredient{Name: name, Amount: "1"})
+		}
+		return r
+	}
+	chicken := recipe("Lemon Herb Chicken", "chicken breast")
+	rice := recipe("Brown Rice Bowl", "brown rice")
+	eggs := recipe("Scrambled Eggs", "eggs")
+
+	tests := []struct {
+		name      string
+		allergens []string
+		recipes   []Recipe
+		more      []Recipe // what the agent returns, and streams, when asked for replacements
+		want      []string // streamed by enforceAllergens rather than the agent
+	}{
+		{
+			name:      "rescue past the count",
+			allergens: []string{"dairy"},
+			recipes:   []Recipe{chicken, rice, recipe("Buttered Eggs", "eggs", "butter")},
+		},
+		{
+			name:      "replacements past the count",
+			allergens: []string{"fish"},
+			recipes:   []Recipe{chicken, recipe("Grilled Mahi Mahi", "mahi mahi")},
+			more:      []Recipe{chicken, rice, eggs},
+			want:      []string{"Brown Rice Bowl"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := gemini.NewFakeClient(logger.GetLogger("error"))
+			fake.Enqueue(gemini.FakeResponse{Err: gemini.ErrGenerationFail})
+			o := newTestOrchestrator(fake)
+			req := RecipeRequest{PantryItems: testPantry(), RecipeCount: 2, Allergens: tt.allergens}
+			gen := func(ctx context.Context, req RecipeRequest, emit EmitFunc) ([]Recipe, error) {
+				for i := range tt.more {
+					if emit != nil {
+						emit(RecipeEvent{Type: RecipeEventRecipe, Recipe: &tt.more[i]})
+					}
+				}
+				return tt.more, nil
+			}
+
+			var streamed []string
+			result := &GenerateResult{}
+			kept := o.enforceAllergens(context.Background(), req, tt.recipes, gen, func(ev RecipeEvent) {
+				streamed = append(streamed, ev.Recipe.Title)
+			}, result)
+
+			if len(kept) != req.RecipeCount {
+				t.Fatalf("expected %d recipes kept, got %d", req.RecipeCount, len(kept))
+			}
+			if result.SubstitutedCount != 0 {
+				t.Errorf("expected no substitution past the count, got %d", result.SubstitutedCount)
+			}
+			if !slices.Equal(streamed, tt.want) {
+				t.Errorf("streamed %v, want %v", streamed, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrchestratorWarnPolicyAnnotatesUnsafeRecipes(t *testing.T) {
+	fake := gemini.NewFakeClient(logger.GetLogger("error"))
+	o := newTestOrchestrator(fake)
+
+	result, err := o.Generate(context.Background(), GenerateRequest{
+		RecipeRequest: RecipeRequest{
+			PantryItems:    testPantry(),
+			RecipeCount:    2,
+			Allergens:      []string{"dairy"},
+			AllergenPolicy: AllergenPolicyWarn,
+		},
+		Mode: ModeFlexible,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.TotalCount != 2 || result.FilteredCount != 0 || fake.Calls() != 1 {
+		t.Fatalf("expected both recipes kept without retries, got total=%d filtered=%d calls=%d",
+			result.TotalCount, result.FilteredCount, fake.Calls())
+	}
+
+	pasta := result.AllRecipes[0]
+	if pasta.Explanation.AllergenCheck.Status != AllergenFlagged {
+		t.Errorf("expected %q to be flagged, got %s", pasta.Title, pasta.Explanation.AllergenCheck.Status)
+	}
+	for _, ing := range pasta.Ingredients {
+		if flagged := len(ing.AllergenFlags) > 0; flagged != (ing.Name == "heavy cream") {
+			t.Errorf("ingredient %q: flagged=%v", ing.Name, flagged)
+		}
+	}
+}
+
+func TestOrchestratorGenerateStreamEmitsAsProduced(t *testing.T) {
+	o := newTestOrchestrator(gemini.NewFakeClient(logger.GetLogger("error")))
+
+	var steps, recipes int
+	var indices []int
+	result, err := o.GenerateStream(context.Background(), GenerateRequest{
+		RecipeRequest: RecipeRequest{PantryItems: testPantry(), RecipeCount: 2},
+		Mode:          ModeBoth,
+	}, func(ev RecipeEvent) {
+		switch ev.Type {
+		case RecipeEventStep:
+			steps++
+		case RecipeEventRecipe:
+			recipes++
+			indices = append(indices, ev.Index)
+		}
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if recipes != result.TotalCount {
+		t.Fatalf("expected %d recipe events, got %d", result.TotalCount, recipes)
+	}
+	if steps == 0 {
+		t.Fatal("expected step events before recipes completed")
+	}
+	for i, idx := range indices {
+		if idx != i {
+			t.Fatalf("recipe events not numbered in arrival order: %v", indices)
+		}
+	}
+}
+
+func TestChargesQuota(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *GenerateResult
+		err    error
+		want   bool
+	}{
+		{"generated", &GenerateResult{}, nil, true},
+		{"cached", &GenerateResult{Cached: true}, nil, false},
+		{"all filtered", &GenerateResult{FilteredCount: 2}, ErrAllRecipesFiltered, true},
+		{"failed", nil, errors.New("model unreachable"), false},
+		{"nothing generated", &GenerateResult{}, ErrNoRecipesGenerated, false},
+	}
+	for _, tt := range tests {
+		if got := ChargesQuota(tt.result, tt.err); got != tt.want {
+			t.Errorf("%s: ChargesQuota = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -11,12 +11,12 @@ import (
 // PantryOnlyAgent generates recipes using ONLY items from the user's pantry
 // No additional ingredients will be suggested
 type PantryOnlyAgent struct {
-	client *gemini.Client
+	client gemini.Provider
 	log    *logger.Logger
 }
 
 // NewPantryOnlyAgent creates a new PantryOnlyAgent
-func NewPantryOnlyAgent(client *gemini.Client, log *logger.Logger) *PantryOnlyAgent {
+func NewPantryOnlyAgent(client gemini.Provider, log *logger.Logger) *PantryOnlyAgent {
 	return &PantryOnlyAgent{
 		client: client,
 		log:    log,
@@ -30,6 +30,11 @@ func (a *PantryOnlyAgent) Name() string {
 
 // GenerateRecipes generates recipes using only pantry items
 func (a *PantryOnlyAgent) GenerateRecipes(ctx context.Context, req RecipeRequest) (*RecipeResponse, error) {
+	return a.StreamRecipes(ctx, req, nil)
+}
+
+// StreamRecipes is GenerateRecipes with progress reported through emit
+func (a *PantryOnlyAgent) StreamRecipes(ctx context.Context, req RecipeRequest, emit EmitFunc) (*RecipeResponse, error) {
 	a.log.Info("PantryOnlyAgent: Generating %d recipes from %d pantry items", req.RecipeCount, len(req.PantryItems))
 
 	// Convert to Gemini request format
@@ -43,7 +48,7 @@ func (a *PantryOnlyAgent) GenerateRecipes(ctx context.Context, req RecipeRequest
 	}
 
 	// Generate recipes
-	recipes, err := a.client.GenerateRecipes(ctx, geminiReq)
+	recipes, err := generateWithEvents(ctx, a.client, false, geminiReq, "pantry_only", emit)
 	if err != nil {
 		a.log.Error("PantryOnlyAgent: Failed to generate recipes: %v", err)
 		return nil, err
@@ -12,12 +12,12 @@ import (
 // (allergens, dietary prefs, nutritional goals, cooking skill, cuisines).
 // No pantry is required — all ingredients are "to buy".
 type PersonalRecipeAgent struct {
-	client *gemini.Client
+	client gemini.Provider
 	log    *logger.Logger
 }
 
 // NewPersonalRecipeAgent creates a new PersonalRecipeAgent.
-func NewPersonalRecipeAgent(client *gemini.Client, log *logger.Logger) *PersonalRecipeAgent {
+func NewPersonalRecipeAgent(client gemini.Provider, log *logger.Logger) *PersonalRecipeAgent {
 	return &PersonalRecipeAgent{
 		client: client,
 		log:    log,
@@ -31,6 +31,11 @@ func (a *PersonalRecipeAgent) Name() string {
 
 // GenerateRecipes generates profile-first recipes with allergens as hard blocks.
 func (a *PersonalRecipeAgent) GenerateRecipes(ctx context.Context, req RecipeRequest) (*RecipeResponse, error) {
+	return a.StreamRecipes(ctx, req, nil)
+}
+
+// StreamRecipes is GenerateRecipes with progress reported through emit.
+func (a *PersonalRecipeAgent) StreamRecipes(ctx context.Context, req RecipeRequest, emit EmitFunc) (*RecipeResponse, error) {
 	a.log.Info("PersonalRecipeAgent: Generating %d recipes from user profile", req.RecipeCount)
 
 	geminiReq := gemini.GenerateRecipesRequest{
@@ -42,7 +47,7 @@ func (a *PersonalRecipeAgent) GenerateRecipes(ctx context.Context, req RecipeReq
 		UserPrompt:      req.UserPrompt,
 	}
 
-	recipes, err := a.client.GeneratePersonalRecipes(ctx, geminiReq)
+	recipes, err := generateWithEvents(ctx, a.client, true, geminiReq, "personal", emit)
 	if err != nil {
 		a.log.Error("PersonalRecipeAgent: Failed to generate recipes: %v", err)
 		return nil, err
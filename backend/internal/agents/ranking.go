@@ -0,0 +1,439 @@
+package agents
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Ranking weights; they sum to 1 so scores fall in [0, 1]
+const (
+	weightCoverage = 0.35 // share of ingredients already in the pantry
+	weightExpiring = 0.25 // expiring pantry items used up
+	weightMissing  = 0.20 // fewer items to buy
+	weightMacros   = 0.20 // fit against nutritional goals
+)
+
+// Recipes this similar are treated as the same dish
+const (
+	duplicateTitleSimilarity      = 0.6
+	duplicateIngredientSimilarity = 0.5
+)
+
+// neutralMacroFit scores recipes when no goal can be checked, so they are
+// neither rewarded nor punished relative to each other
+const neutralMacroFit = 0.5
+
+// pantryStaples are assumed to be on hand and never count as items to buy
+var pantryStaples = map[string]bool{
+	"salt": true, "pepper": true, "black pepper": true, "water": true,
+	"oil": true, "olive oil": true, "vegetable oil": true, "cooking spray": true,
+}
+
+// nameStopwords carry no meaning when comparing titles and ingredient names
+var nameStopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "the": true, "with": true, "of": true,
+	"in": true, "on": true, "for": true, "style": true, "easy": true, "quick": true,
+	"fresh": true, "homemade": true, "simple": true,
+}
+
+// Goal fit statuses
+const (
+	GoalMet     = "met"
+	GoalPartial = "partial"
+	GoalMissed  = "missed"
+	GoalUnknown = "unknown" // the goal cannot be judged from calories and macros
+)
+
+// RecipeExplanation is the server-side breakdown behind a recipe's score.
+// It is computed from the pantry and the recipe's ingredients and macros;
+// the model's own from_pantry flags are not trusted.
+type RecipeExplanation struct {
+	Score             float64       `json:"score"`
+	PantryCoverage    float64       `json:"pantry_coverage"`     // fraction of ingredients found in the pantry
+	PantryIngredients []string      `json:"pantry_ingredients"`  // ingredients matched to a pantry item
+	ExpiringItemsUsed []string      `json:"expiring_items_used"` // expiring pantry items the recipe consumes
+	ItemsToBuyCount   int           `json:"items_to_buy_count"`
+	ItemsToBuy        []string      `json:"items_to_buy"` // neither in the pantry nor a staple
+	AllergenCheck     AllergenCheck `json:"allergen_check"`
+	DietaryCheck      DietaryCheck  `json:"dietary_check"`
+	MacroFit          float64       `json:"macro_fit"` // mean goal score, 0.5 when no goal can be judged
+	GoalFit           []GoalFit     `json:"goal_fit"`
+
+	expiringMax int // how many expiring items the recipe could reasonably use
+}
+
+// GoalFit is how well a recipe meets one nutritional goal
+type GoalFit struct {
+	Goal   string  `json:"goal"`
+	Status string  `json:"status"` // GoalMet, GoalPartial, GoalMissed or GoalUnknown
+	Score  float64 `json:"score"`
+	Detail string  `json:"detail,omitempty"`
+}
+
+// explainRecipe attaches the explanation and score to r
+func explainRecipe(r *Recipe, req RecipeRequest, filter *AllergenFilter) {
+	e := scoreRecipe(*r, req)
+	e.AllergenCheck = filter.Check(*r, req.Allergens)
+	e.DietaryCheck = checkDiet(*r, req.DietaryPreferences)
+	r.Score = e.Score
+	r.Explanation = &e
+	r.Ingredients = flagIngredients(r.Ingredients, e.AllergenCheck.Matches)
+	r.MissingIngredients = flagIngredients(r.MissingIngredients, e.AllergenCheck.Matches)
+}
+
+// flagIngredients returns a copy of ingredients with each allergen match
+// attached to the ingredient it was found in
+func flagIngredients(ingredients []Ingredient, matches []AllergenMatch) []Ingredient {
+	if len(ingredients) == 0 {
+		return ingredients
+	}
+	flagged := make([]Ingredient, len(ingredients))
+	for i, ing := range ingredients {
+		ing.AllergenFlags = nil
+		for _, m := range matches {
+			if m.Ingredient == ing.Name {
+				ing.AllergenFlags = append(ing.AllergenFlags, m)
+			}
+		}
+		flagged[i] = ing
+	}
+	return flagged
+}
+
+// explainRecipes runs explainRecipe over a slice in place
+func explainRecipes(recipes []Recipe, req RecipeRequest, filter *AllergenFilter) {
+	for i := range recipes {
+		explainRecipe(&recipes[i], req, filter)
+	}
+}
+
+// scoreRecipe rates r from its ingredient list and macros. The allergen
+// check is left to the caller.
+func scoreRecipe(r Recipe, req RecipeRequest) RecipeExplanation {
+	s := RecipeExplanation{
+		PantryIngredients: []string{},
+		ExpiringItemsUsed: []string{},
+		ItemsToBuy:        []string{},
+	}
+
+	pantry := make([][]string, len(req.PantryItems))
+	for i, item := range req.PantryItems {
+		pantry[i] = nameTokens(item.Name)
+	}
+
+	used := make(map[int]bool)
+	matched := 0
+	for _, ing := range r.Ingredients {
+		if idx := matchPantryItem(nameTokens(ing.Name), pantry); idx >= 0 {
+			matched++
+			used[idx] = true
+			s.PantryIngredients = append(s.PantryIngredients, ing.Name)
+			continue
+		}
+		s.ItemsToBuy = appendToBuy(s.ItemsToBuy, ing.Name)
+	}
+	for _, ing := range r.MissingIngredients {
+		if matchPantryItem(nameTokens(ing.Name), pantry) < 0 {
+			s.ItemsToBuy = appendToBuy(s.ItemsToBuy, ing.Name)
+		}
+	}
+	s.ItemsToBuyCount = len(s.ItemsToBuy)
+	if len(r.Ingredients) > 0 {
+		s.PantryCoverage = float64(matched) / float64(len(r.Ingredients))
+	}
+
+	expiring := 0
+	for i, item := range req.PantryItems {
+		if !item.IsExpiringSoon || item.IsExpired {
+			continue
+		}
+		expiring++
+		if used[i] {
+			s.ExpiringItemsUsed = append(s.ExpiringItemsUsed, item.Name)
+		}
+	}
+	s.expiringMax = min(expiring, len(r.Ingredients))
+
+	s.GoalFit = goalFits(r, req.NutritionalGoals)
+	s.MacroFit = macroFit(s.GoalFit)
+
+	s.Score = weightCoverage*s.PantryCoverage +
+		weightMissing/float64(1+s.ItemsToBuyCount) +
+		weightMacros*s.MacroFit
+	if s.expiringMax > 0 {
+		s.Score += weightExpiring * float64(len(s.ExpiringItemsUsed)) / float64(s.expiringMax)
+	}
+	return s
+}
+
+// rankRecipes scores recipes, drops near-duplicates (keeping the better
+// scoring copy) and returns the best limit in descending score order along
+// with how many duplicates were dropped
+func rankRecipes(recipes []Recipe, req RecipeRequest, limit int) ([]Recipe, int) {
+	all := make([]Recipe, len(recipes))
+	for i, r := range recipes {
+		r.Score = scoreRecipe(r, req).Score
+		all[i] = r
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Score > all[j].Score
+	})
+
+	var kept []Recipe
+	duplicates := 0
+	for _, r := range all {
+		isDuplicate := false
+		for _, k := range kept {
+			if similarRecipes(r, k) {
+				isDuplicate = true
+				break
+			}
+		}
+		if isDuplicate {
+			duplicates++
+			continue
+		}
+		kept = append(kept, r)
+	}
+
+	if limit > 0 && len(kept) > limit {
+		kept = kept[:limit]
+	}
+	return kept, duplicates
+}
+
+// similarRecipes reports whether a and b are near-identical: the same
+// normalised title, or similar titles built from similar ingredients
+func similarRecipes(a, b Recipe) bool {
+	ta, tb := nameTokens(a.Title), nameTokens(b.Title)
+	if strings.Join(ta, " ") == strings.Join(tb, " ") {
+		return true
+	}
+	if jaccard(ta, tb) < duplicateTitleSimilarity {
+		return false
+	}
+	return jaccard(ingredientKeys(a), ingredientKeys(b)) >= duplicateIngredientSimilarity
+}
+
+// ingredientKeys returns each ingredient's normalised name
+func ingredientKeys(r Recipe) []string {
+	keys := make([]string, 0, len(r.Ingredients))
+	for _, ing := range r.Ingredients {
+		if key := strings.Join(nameTokens(ing.Name), " "); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// matchPantryItem returns the index of the first pantry item whose name
+// contains every token of the ingredient, or the other way round, or -1
+func matchPantryItem(ingredient []string, pantry [][]string) int {
+	if len(ingredient) == 0 {
+		return -1
+	}
+	for i, item := range pantry {
+		if len(item) == 0 {
+			continue
+		}
+		if containsAll(item, ingredient) || containsAll(ingredient, item) {
+			return i
+		}
+	}
+	return -1
+}
+
+// MatchPantryName returns the index of the pantry item name an ingredient
+// refers to, matched the way recipes are ranked, or -1
+func MatchPantryName(ingredient string, names []string) int {
+	pantry := make([][]string, len(names))
+	for i, name := range names {
+		pantry[i] = nameTokens(name)
+	}
+	return matchPantryItem(nameTokens(ingredient), pantry)
+}
+
+// appendToBuy adds an ingredient to the shopping list unless it is a staple
+// or already listed
+func appendToBuy(list []string, name string) []string {
+	key := strings.Join(nameTokens(name), " ")
+	if key == "" || pantryStaples[key] || pantryStaples[strings.ToLower(strings.TrimSpace(name))] {
+		return list
+	}
+	for _, existing := range list {
+		if strings.Join(nameTokens(existing), " ") == key {
+			return list
+		}
+	}
+	return append(list, name)
+}
+
+// nameTokens lower-cases s, splits it into words, drops stopwords and
+// reduces simple plurals ("eggs" -> "egg", "tomatoes" -> "tomato")
+func nameTokens(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := words[:0]
+	for _, w := range words {
+		if nameStopwords[w] {
+			continue
+		}
+		tokens = append(tokens, singular(w))
+	}
+	return tokens
+}
+
+// singular strips common English plural endings
+func singular(w string) string {
+	switch {
+	case len(w) > 4 && strings.HasSuffix(w, "ies"):
+		return w[:len(w)-3] + "y"
+	case len(w) > 4 && strings.HasSuffix(w, "oes"):
+		return w[:len(w)-2]
+	case len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss"):
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+// containsAll reports whether every token of sub appears in set
+func containsAll(set, sub []string) bool {
+	for _, t := range sub {
+		found := false
+		for _, s := range set {
+			if s == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// jaccard returns |a ∩ b| / |a ∪ b| over the distinct values of a and b
+func jaccard(a, b []string) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+	setA := make(map[string]bool, len(a))
+	for _, v := range a {
+		setA[v] = true
+	}
+	union := len(setA)
+	shared := 0
+	seen := make(map[string]bool, len(b))
+	for _, v := range b {
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		if setA[v] {
+			shared++
+		} else {
+			union++
+		}
+	}
+	return float64(shared) / float64(union)
+}
+
+// macroFit averages the goals that could be judged, or returns
+// neutralMacroFit when none could
+func macroFit(fits []GoalFit) float64 {
+	total, n := 0.0, 0
+	for _, f := range fits {
+		if f.Status == GoalUnknown {
+			continue
+		}
+		total += f.Score
+		n++
+	}
+	if n == 0 {
+		return neutralMacroFit
+	}
+	return total / float64(n)
+}
+
+// goalFits judges r against each nutritional goal that can be derived from
+// calories and macros; the rest are reported as GoalUnknown
+func goalFits(r Recipe, goals []string) []GoalFit {
+	fits := make([]GoalFit, 0, len(goals))
+	if len(goals) == 0 {
+		return fits
+	}
+
+	calories := r.CaloriesPerServing
+	if calories <= 0 {
+		calories = 4*r.ProteinG + 4*r.CarbsG + 9*r.FatG
+	}
+	share := func(grams, kcalPerGram float64) float64 {
+		return kcalPerGram * grams / calories
+	}
+
+	for _, goal := range goals {
+		fit := GoalFit{Goal: goal, Status: GoalUnknown}
+		if calories <= 0 {
+			fit.Detail = "no nutrition data"
+			fits = append(fits, fit)
+			continue
+		}
+
+		switch strings.ToLower(strings.TrimSpace(goal)) {
+		case "high-protein", "high protein":
+			v := share(r.ProteinG, 4)
+			fit.Score = atLeast(v, 0.25)
+			fit.Detail = fmt.Sprintf("%.0f%% of calories from protein (target at least 25%%)", v*100)
+		case "low-carb", "low carb":
+			v := share(r.CarbsG, 4)
+			fit.Score = atMost(v, 0.26)
+			fit.Detail = fmt.Sprintf("%.0f%% of calories from carbs (target at most 26%%)", v*100)
+		case "keto":
+			v := share(r.CarbsG, 4)
+			fit.Score = atMost(v, 0.10)
+			fit.Detail = fmt.Sprintf("%.0f%% of calories from carbs (target at most 10%%)", v*100)
+		case "low-fat", "low fat":
+			v := share(r.FatG, 9)
+			fit.Score = atMost(v, 0.30)
+			fit.Detail = fmt.Sprintf("%.0f%% of calories from fat (target at most 30%%)", v*100)
+		case "low-calorie", "low calorie":
+			fit.Score = atMost(calories, 500)
+			fit.Detail = fmt.Sprintf("%.0f kcal per serving (target at most 500)", calories)
+		default:
+			fit.Detail = "cannot be judged from calories and macros"
+			fits = append(fits, fit)
+			continue
+		}
+
+		switch {
+		case fit.Score >= 1:
+			fit.Status = GoalMet
+		case fit.Score > 0:
+			fit.Status = GoalPartial
+		default:
+			fit.Status = GoalMissed
+		}
+		fits = append(fits, fit)
+	}
+	return fits
+}
+
+// atLeast is 1 when v >= target, falling linearly to 0 at v = 0
+func atLeast(v, target float64) float64 {
+	if v >= target {
+		return 1
+	}
+	return max(0, v/target)
+}
+
+// atMost is 1 when v <= limit, falling linearly to 0 at twice the limit
+func atMost(v, limit float64) float64 {
+	if v <= limit {
+		return 1
+	}
+	return max(0, 1-(v-limit)/limit)
+}
@@ -0,0 +1,131 @@
+package agents
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+	"github.com/Jayyk09/CUHackIt/services/gemini"
+)
+
+func TestScoreRecipeUsesPantryNotModelFlags(t *testing.T) {
+	req := RecipeRequest{PantryItems: testPantry(), NutritionalGoals: []string{"high-protein"}}
+
+	s := scoreRecipe(Recipe{
+		Title: "Chicken Fried Rice",
+		Ingredients: []Ingredient{
+			{Name: "chicken breasts"},
+			{Name: "rice"},
+			{Name: "egg", FromPantry: false},
+			{Name: "scallions", FromPantry: true}, // the model's claim is ignored
+			{Name: "salt"},
+		},
+		ProteinG: 40, CarbsG: 50, FatG: 10,
+	}, req)
+
+	if s.PantryCoverage != 3.0/5 {
+		t.Errorf("PantryCoverage = %v, want 0.6", s.PantryCoverage)
+	}
+	if len(s.ExpiringItemsUsed) != 1 || s.ExpiringItemsUsed[0] != "Chicken Breast" {
+		t.Errorf("ExpiringItemsUsed = %v, want [Chicken Breast]", s.ExpiringItemsUsed)
+	}
+	if s.ItemsToBuyCount != 1 || s.ItemsToBuy[0] != "scallions" {
+		t.Errorf("ItemsToBuy = %v, want [scallions] (salt is a staple)", s.ItemsToBuy)
+	}
+	if s.MacroFit != 1 {
+		t.Errorf("MacroFit = %v, want 1 for 40%% protein calories", s.MacroFit)
+	}
+}
+
+func TestGoalFits(t *testing.T) {
+	r := Recipe{CaloriesPerServing: 600, ProteinG: 30, CarbsG: 60, FatG: 20}
+	fits := goalFits(r, []string{"high-protein", "keto", "low-sodium"})
+
+	want := []string{GoalPartial, GoalMissed, GoalUnknown}
+	for i, fit := range fits {
+		if fit.Status != want[i] {
+			t.Errorf("%s: status = %s (score %.2f), want %s", fit.Goal, fit.Status, fit.Score, want[i])
+		}
+	}
+	// Only the judged goals count towards the macro fit
+	if got := macroFit(fits); got != fits[0].Score/2 {
+		t.Errorf("macroFit = %v, want %v", got, fits[0].Score/2)
+	}
+	if got := macroFit(goalFits(Recipe{}, []string{"keto"})); got != neutralMacroFit {
+		t.Errorf("macroFit without nutrition data = %v, want %v", got, neutralMacroFit)
+	}
+}
+
+func TestExplainRecipeAllergenCheck(t *testing.T) {
+	filter := NewAllergenFilter(logger.GetLogger("error"))
+	r := Recipe{Ingredients: []Ingredient{{Name: "butter"}, {Name: "rice"}}}
+
+	cases := []struct {
+		allergens []string
+		want      string
+	}{
+		{nil, AllergenNotChecked},
+		{[]string{"peanuts"}, AllergenSafe},
+		{[]string{"dairy"}, AllergenFlagged},
+	}
+	for _, tc := range cases {
+		explainRecipe(&r, RecipeRequest{Allergens: tc.allergens}, filter)
+		if got := r.Explanation.AllergenCheck.Status; got != tc.want {
+			t.Errorf("allergens %v: status = %s, want %s", tc.allergens, got, tc.want)
+		}
+	}
+	if r.Score != r.Explanation.Score {
+		t.Errorf("Score = %v, explanation says %v", r.Score, r.Explanation.Score)
+	}
+}
+
+func TestRankRecipesDropsNearDuplicates(t *testing.T) {
+	req := RecipeRequest{PantryItems: testPantry()}
+	recipes := []Recipe{
+		{Title: "Chicken and Rice Bowl", Source: "flexible", Ingredients: []Ingredient{{Name: "chicken breast"}, {Name: "rice"}, {Name: "soy sauce"}, {Name: "lime"}}},
+		{Title: "Chicken Rice Bowls", Source: "pantry_only", Ingredients: []Ingredient{{Name: "chicken breast"}, {Name: "brown rice"}, {Name: "soy sauce"}}},
+		{Title: "Chicken Salad", Source: "personal", Ingredients: []Ingredient{{Name: "chicken breast"}, {Name: "lettuce"}}},
+	}
+
+	ranked, duplicates := rankRecipes(recipes, req, 3)
+	if duplicates != 1 || len(ranked) != 2 {
+		t.Fatalf("got %d recipes and %d duplicates, want 2 and 1", len(ranked), duplicates)
+	}
+	// The copy with less to buy wins
+	if ranked[0].Source != "pantry_only" {
+		t.Errorf("kept %q from %s, want the pantry_only copy", ranked[0].Title, ranked[0].Source)
+	}
+	if ranked[0].Score < ranked[1].Score {
+		t.Errorf("scores not descending: %v, %v", ranked[0].Score, ranked[1].Score)
+	}
+}
+
+func TestOrchestratorEnsembleRanksAcrossAgents(t *testing.T) {
+	fake := gemini.NewFakeClient(logger.GetLogger("error"))
+	o := newTestOrchestrator(fake)
+
+	var events []RecipeEvent
+	result, err := o.GenerateStream(context.Background(), GenerateRequest{
+		RecipeRequest: RecipeRequest{PantryItems: testPantry(), RecipeCount: 2},
+		Mode:          ModeEnsemble,
+	}, func(ev RecipeEvent) { events = append(events, ev) })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if fake.Calls() != 4 {
+		t.Errorf("expected all 4 agents to run, got %d calls", fake.Calls())
+	}
+	if result.TotalCount != 2 {
+		t.Fatalf("expected the top 2 recipes, got %d", result.TotalCount)
+	}
+	if got := result.AllRecipes[0].Title; got != "Garlic Chicken and Rice" {
+		t.Errorf("expected the pantry-heavy recipe first, got %q", got)
+	}
+	if len(events) != 2 || events[0].Recipe.Title != result.AllRecipes[0].Title {
+		t.Fatalf("expected only the ranked recipes to be emitted, got %d events", len(events))
+	}
+	if result.AllRecipes[0].Explanation == nil || events[0].Recipe.Explanation == nil {
+		t.Error("expected returned and streamed recipes to carry an explanation")
+	}
+}
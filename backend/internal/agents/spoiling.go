@@ -15,12 +15,12 @@ import (
 // It uses a custom prompt that tells the AI to build meals around the most
 // urgent items first.
 type SpoilingAgent struct {
-	client *gemini.Client
+	client gemini.Provider
 	log    *logger.Logger
 }
 
 // NewSpoilingAgent creates a new SpoilingAgent
-func NewSpoilingAgent(client *gemini.Client, log *logger.Logger) *SpoilingAgent {
+func NewSpoilingAgent(client gemini.Provider, log *logger.Logger) *SpoilingAgent {
 	return &SpoilingAgent{
 		client: client,
 		log:    log,
@@ -34,6 +34,11 @@ func (a *SpoilingAgent) Name() string {
 
 // GenerateRecipes generates recipes prioritizing expiring ingredients
 func (a *SpoilingAgent) GenerateRecipes(ctx context.Context, req RecipeRequest) (*RecipeResponse, error) {
+	return a.StreamRecipes(ctx, req, nil)
+}
+
+// StreamRecipes is GenerateRecipes with progress reported through emit
+func (a *SpoilingAgent) StreamRecipes(ctx context.Context, req RecipeRequest, emit EmitFunc) (*RecipeResponse, error) {
 	// Sort pantry items by days until expiry (ascending) so the prompt
 	// presents the most urgent items first.
 	sorted := make([]PantryItem, len(req.PantryItems))
@@ -63,14 +68,14 @@ func (a *SpoilingAgent) GenerateRecipes(ctx context.Context, req RecipeRequest)
 
 	prompt := buildSpoilingPrompt(string(pantryJSON), string(prefsJSON), string(urgentJSON), req.RecipeCount, prefs)
 
-	recipes, err := a.client.GenerateRecipes(ctx, gemini.GenerateRecipesRequest{
+	recipes, err := generateWithEvents(ctx, a.client, false, gemini.GenerateRecipesRequest{
 		PantryItems:     geminiItems,
 		Preferences:     prefs,
 		RecipeCount:     req.RecipeCount,
 		PantryOnly:      true,
 		MaxMissingItems: 0,
 		UserPrompt:      prompt,
-	})
+	}, "spoiling", emit)
 	if err != nil {
 		a.log.Error("SpoilingAgent: Failed to generate recipes: %v", err)
 		return nil, err
@@ -0,0 +1,88 @@
+package agents
+
+import (
+	"context"
+
+	"github.com/Jayyk09/CUHackIt/services/gemini"
+)
+
+// RecipeEventType identifies what a RecipeEvent carries
+type RecipeEventType string
+
+const (
+	// RecipeEventStep is emitted as soon as an instruction step has been generated
+	RecipeEventStep RecipeEventType = "step"
+	// RecipeEventRecipe is emitted as soon as a whole recipe has been generated
+	RecipeEventRecipe RecipeEventType = "recipe"
+)
+
+// RecipeEvent is a piece of an agent's output reported while generation is
+// still running
+type RecipeEvent struct {
+	Type        RecipeEventType `json:"type"`
+	Source      string          `json:"source"`       // agent that produced the event
+	SourceIndex int             `json:"source_index"` // 0-based recipe position within the agent's response
+	Index       int             `json:"index"`        // 0-based position across all agents (recipe events only, set by the orchestrator)
+	StepIndex   int             `json:"step_index"`   // 0-based step position (step events only)
+	Step        string          `json:"step,omitempty"`
+	Recipe      *Recipe         `json:"recipe,omitempty"`
+}
+
+// EmitFunc receives RecipeEvents. Agents call it synchronously from the
+// generating goroutine.
+type EmitFunc func(RecipeEvent)
+
+// generateWithEvents runs a provider call, streaming events through emit when
+// the provider supports it. Providers that cannot stream still emit one
+// recipe event per recipe once the whole response is available. Model usage
+// is tagged with source as the agent name.
+func generateWithEvents(ctx context.Context, client gemini.Provider, personal bool, req gemini.GenerateRecipesRequest, source string, emit EmitFunc) ([]gemini.Recipe, error) {
+	ctx = gemini.WithUsageTags(ctx, gemini.UsageTags{Agent: source})
+
+	streamer, ok := client.(gemini.RecipeStreamer)
+	if emit == nil || !ok {
+		var recipes []gemini.Recipe
+		var err error
+		if personal {
+			recipes, err = client.GeneratePersonalRecipes(ctx, req)
+		} else {
+			recipes, err = client.GenerateRecipes(ctx, req)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if emit != nil {
+			for i, r := range convertFromGeminiRecipes(recipes, source) {
+				r := r
+				emit(RecipeEvent{Type: RecipeEventRecipe, Source: source, SourceIndex: i, Recipe: &r})
+			}
+		}
+		return recipes, nil
+	}
+
+	onEvent := func(ev gemini.StreamEvent) {
+		switch ev.Type {
+		case gemini.StreamEventStep:
+			emit(RecipeEvent{
+				Type:        RecipeEventStep,
+				Source:      source,
+				SourceIndex: ev.RecipeIndex,
+				StepIndex:   ev.StepIndex,
+				Step:        ev.Step,
+			})
+		case gemini.StreamEventRecipe:
+			r := convertFromGeminiRecipes([]gemini.Recipe{*ev.Recipe}, source)[0]
+			emit(RecipeEvent{
+				Type:        RecipeEventRecipe,
+				Source:      source,
+				SourceIndex: ev.RecipeIndex,
+				Recipe:      &r,
+			})
+		}
+	}
+
+	if personal {
+		return streamer.StreamPersonalRecipes(ctx, req, onEvent)
+	}
+	return streamer.StreamRecipes(ctx, req, onEvent)
+}
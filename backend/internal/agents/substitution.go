@@ -0,0 +1,348 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+	"github.com/Jayyk09/CUHackIt/services/gemini"
+)
+
+// Substitution sources
+const (
+	SubstitutionTable = "table" // the built-in substitution table
+	SubstitutionLLM   = "llm"   // suggested by the model
+)
+
+// maxLLMSubstitutes bounds how many substitutes are asked of the model
+const maxLLMSubstitutes = 3
+
+// Substitution records one ingredient swapped out of a recipe
+type Substitution struct {
+	Original   string   `json:"original"`
+	Substitute string   `json:"substitute"`
+	Allergens  []string `json:"allergens"` // why the original was swapped out
+	Source     string   `json:"source"`    // SubstitutionTable or SubstitutionLLM
+	FromPantry bool     `json:"from_pantry"`
+}
+
+// substitutionTable maps an ingredient, or the ontology term it matched, to
+// substitutes in order of preference. Candidates are re-checked against all
+// of the user's allergens, so soy milk is never offered to someone avoiding
+// soy, and against their diets, so chicken is never offered to a vegan.
+var substitutionTable = map[string][]string{
+	// milk
+	"milk":         {"oat milk", "rice milk", "soy milk", "coconut milk"},
+	"buttermilk":   {"oat milk with lemon juice"},
+	"butter":       {"olive oil", "vegan butter", "coconut oil"},
+	"ghee":         {"coconut oil", "olive oil"},
+	"cream":        {"coconut cream", "oat cream"},
+	"heavy cream":  {"coconut cream", "oat cream"},
+	"sour cream":   {"coconut yogurt", "vegan sour cream"},
+	"yogurt":       {"coconut yogurt", "soy yogurt"},
+	"cheese":       {"vegan cheese", "nutritional yeast"},
+	"cream cheese": {"vegan cream cheese"},
+	"parmesan":     {"nutritional yeast", "vegan parmesan"},
+	"mozzarella":   {"vegan mozzarella"},
+	"cheddar":      {"vegan cheddar", "nutritional yeast"},
+	"feta":         {"vegan feta", "firm tofu"},
+	"ricotta":      {"vegan ricotta", "silken tofu"},
+	"paneer":       {"extra firm tofu", "chickpeas"},
+
+	// eggs
+	"egg":        {"flax egg", "chia egg", "applesauce"},
+	"mayonnaise": {"vegan mayonnaise"},
+	"mayo":       {"vegan mayonnaise"},
+
+	// wheat and gluten
+	"flour":       {"rice flour", "oat flour", "almond flour"},
+	"pasta":       {"rice pasta", "gluten-free pasta"},
+	"spaghetti":   {"rice pasta", "gluten-free spaghetti"},
+	"penne":       {"rice pasta", "gluten-free penne"},
+	"macaroni":    {"rice pasta", "gluten-free macaroni"},
+	"noodle":      {"rice noodles", "glass noodles"},
+	"udon":        {"rice noodles"},
+	"ramen":       {"rice noodles"},
+	"bread":       {"gluten-free bread"},
+	"breadcrumb":  {"gluten-free breadcrumbs", "crushed rice crackers"},
+	"bread crumb": {"gluten-free breadcrumbs", "crushed rice crackers"},
+	"panko":       {"gluten-free panko", "crushed rice crackers"},
+	"tortilla":    {"corn tortillas"},
+	"couscous":    {"quinoa"},
+	"bulgur":      {"quinoa", "brown rice"},
+	"barley":      {"brown rice", "quinoa"},
+	"soy sauce":   {"tamari", "coconut aminos"},
+
+	// soy
+	"soy":     {"coconut aminos"},
+	"tofu":    {"chickpeas", "white beans"},
+	"edamame": {"green peas"},
+	"tamari":  {"coconut aminos"},
+	"miso":    {"tahini"},
+
+	// peanuts and tree nuts
+	"peanut":        {"sunflower seeds", "pumpkin seeds"},
+	"peanut butter": {"sunflower seed butter"},
+	"nut":           {"pumpkin seeds", "sunflower seeds"},
+	"almond":        {"pumpkin seeds", "sunflower seeds"},
+	"cashew":        {"sunflower seeds", "pumpkin seeds"},
+	"walnut":        {"pumpkin seeds", "sunflower seeds"},
+	"pecan":         {"pumpkin seeds", "sunflower seeds"},
+	"pine nut":      {"sunflower seeds", "pumpkin seeds"},
+	"almond butter": {"sunflower seed butter"},
+	"almond milk":   {"oat milk", "rice milk"},
+	"almond flour":  {"oat flour", "rice flour"},
+
+	// sesame
+	"sesame":     {"pumpkin seeds", "poppy seeds"},
+	"sesame oil": {"olive oil", "avocado oil"},
+	"tahini":     {"sunflower seed butter"},
+
+	// fish and shellfish
+	"fish":           {"firm tofu", "hearts of palm", "chicken breast"},
+	"salmon":         {"firm tofu", "hearts of palm", "chicken breast"},
+	"tuna":           {"chickpeas", "chicken breast"},
+	"cod":            {"firm tofu", "hearts of palm", "chicken breast"},
+	"tilapia":        {"firm tofu", "hearts of palm", "chicken breast"},
+	"anchovy":        {"capers", "olives"},
+	"fish sauce":     {"coconut aminos", "soy sauce"},
+	"worcestershire": {"coconut aminos", "balsamic vinegar"},
+	"shrimp":         {"king oyster mushrooms", "firm tofu", "chicken breast"},
+	"prawn":          {"king oyster mushrooms", "firm tofu", "chicken breast"},
+	"crab":           {"hearts of palm", "chicken breast"},
+	"lobster":        {"king oyster mushrooms", "chicken breast"},
+	"scallop":        {"king oyster mushrooms", "chicken breast"},
+	"oyster sauce":   {"hoisin sauce", "mushroom stir-fry sauce"},
+}
+
+// Substituter proposes allergen-safe replacements for flagged ingredients,
+// from substitutionTable first and the model second
+type Substituter struct {
+	client gemini.Provider
+	log    *logger.Logger
+}
+
+// NewSubstituter creates a Substituter. client may be nil, leaving only the
+// built-in table.
+func NewSubstituter(client gemini.Provider, log *logger.Logger) *Substituter {
+	return &Substituter{client: client, log: log}
+}
+
+// Substitute rewrites recipe so no ingredient matches the allergens at the
+// filtering confidence. Each flagged ingredient is replaced, preferring
+// substitutes already in the pantry, and marked with SubstitutedFor; the
+// swaps are listed in Recipe.Substitutions and applied to the description
+// and instructions. Substitutes that break any of diets are never chosen.
+// It returns false if any flagged ingredient has no safe substitute, in
+// which case recipe should be discarded.
+func (s *Substituter) Substitute(ctx context.Context, recipe Recipe, allergens, diets []string, pantry []PantryItem) (Recipe, bool) {
+	rules := allergenRules(allergens)
+	pantryTokens := make([][]string, len(pantry))
+	for i, item := range pantry {
+		pantryTokens[i] = nameTokens(item.Name)
+	}
+
+	out := recipe
+	out.Ingredients = append([]Ingredient(nil), recipe.Ingredients...)
+	out.MissingIngredients = append([]Ingredient(nil), recipe.MissingIngredients...)
+	out.Substitutions = append([]Substitution(nil), recipe.Substitutions...)
+
+	replacements := make(map[string]string) // lower-cased text -> substitute
+	for _, list := range [][]Ingredient{out.Ingredients, out.MissingIngredients} {
+		for i, ing := range list {
+			var blocking []AllergenMatch
+			for _, m := range matchIngredient(ing.Name, rules) {
+				if m.Confidence >= filterConfidence {
+					blocking = append(blocking, m)
+				}
+			}
+			if len(blocking) == 0 {
+				continue
+			}
+
+			sub, ok := s.substituteFor(ctx, recipe.Title, ing.Name, blocking, rules, diets, pantryTokens)
+			if !ok {
+				s.log.Debug("Substituter: no safe substitute for '%s' in '%s'", ing.Name, recipe.Title)
+				return recipe, false
+			}
+
+			// Instructions often shorten "heavy cream" to "cream", so the
+			// matched term is rewritten too
+			replacements[strings.ToLower(ing.Name)] = sub.Substitute
+			for _, m := range blocking {
+				if _, taken := replacements[m.Term]; !taken {
+					replacements[m.Term] = sub.Substitute
+				}
+			}
+			list[i] = Ingredient{
+				Name:           sub.Substitute,
+				Amount:         ing.Amount,
+				Unit:           ing.Unit,
+				FromPantry:     sub.FromPantry,
+				SubstitutedFor: ing.Name,
+			}
+			out.Substitutions = append(out.Substitutions, sub)
+		}
+	}
+
+	// Kept ingredients map to themselves so a term inside one, like the
+	// "butter" in "peanut butter", is left alone
+	for _, list := range [][]Ingredient{out.Ingredients, out.MissingIngredients} {
+		for _, ing := range list {
+			if key := strings.ToLower(ing.Name); ing.SubstitutedFor == "" && replacements[key] == "" {
+				replacements[key] = ""
+			}
+		}
+	}
+
+	out.Description = rewriteMentions(out.Description, replacements)
+	out.Instructions = make([]string, len(recipe.Instructions))
+	for i, step := range recipe.Instructions {
+		out.Instructions[i] = rewriteMentions(step, replacements)
+	}
+	return out, true
+}
+
+// substituteFor picks the best safe substitute for one flagged ingredient
+func (s *Substituter) substituteFor(ctx context.Context, title, ingredient string, blocking []AllergenMatch, rules []*allergenRule, diets []string, pantry [][]string) (Substitution, bool) {
+	sub := Substitution{Original: ingredient}
+	for _, m := range blocking {
+		sub.Allergens = appendUnique(sub.Allergens, m.Allergen)
+	}
+
+	candidates := onDiet(safeSubstitutes(tableSubstitutes(ingredient, blocking), rules), diets)
+	sub.Source = SubstitutionTable
+	if len(candidates) == 0 {
+		candidates = onDiet(safeSubstitutes(s.llmSubstitutes(ctx, title, ingredient, sub.Allergens, diets), rules), diets)
+		sub.Source = SubstitutionLLM
+	}
+	if len(candidates) == 0 {
+		return sub, false
+	}
+
+	sub.Substitute = candidates[0]
+	for _, c := range candidates {
+		if matchPantryItem(nameTokens(c), pantry) >= 0 {
+			sub.Substitute = c
+			sub.FromPantry = true
+			break
+		}
+	}
+	return sub, true
+}
+
+// tableSubstitutes looks up the whole ingredient name, then each matched term
+func tableSubstitutes(ingredient string, blocking []AllergenMatch) []string {
+	var out []string
+	keys := []string{strings.Join(ingredientTokens(ingredient), " ")}
+	for _, m := range blocking {
+		keys = append(keys, m.Term)
+	}
+	for _, key := range keys {
+		out = appendUnique(out, substitutionTable[key]...)
+	}
+	return out
+}
+
+// safeSubstitutes keeps the candidates that match none of the rules
+func safeSubstitutes(candidates []string, rules []*allergenRule) []string {
+	var safe []string
+	for _, c := range candidates {
+		blocked := false
+		for _, m := range matchIngredient(c, rules) {
+			if m.Confidence >= filterConfidence {
+				blocked = true
+				break
+			}
+		}
+		if !blocked {
+			safe = append(safe, c)
+		}
+	}
+	return safe
+}
+
+// onDiet keeps the candidates that DietaryValidator would not reject as an
+// ingredient under diets
+func onDiet(candidates []string, diets []string) []string {
+	if resolved, _ := resolveDiets(diets); len(resolved) == 0 {
+		return candidates
+	}
+	var kept []string
+	for _, c := range candidates {
+		if checkDiet(Recipe{Ingredients: []Ingredient{{Name: c}}}, diets).Status != DietViolated {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// llmSubstitutes asks the model for substitutes when the table has none.
+// Failures are logged and yield no candidates.
+func (s *Substituter) llmSubstitutes(ctx context.Context, title, ingredient string, allergens, diets []string) []string {
+	if s.client == nil {
+		return nil
+	}
+
+	ctx = gemini.WithUsageTags(ctx, gemini.UsageTags{Agent: "substitution"})
+	dietNote := ""
+	if len(diets) > 0 {
+		dietNote = fmt.Sprintf("\nThey must also suit these diets: %s.", strings.Join(diets, ", "))
+	}
+	prompt := fmt.Sprintf(`Suggest up to %d common grocery ingredients that can replace "%s" in the recipe "%s".
+The substitutes must not contain or be derived from any of these allergens: %s.%s
+Respond with JSON only, in the form {"substitutes": ["ingredient", ...]}, best substitute first.`,
+		maxLLMSubstitutes, ingredient, title, strings.Join(allergens, ", "), dietNote)
+
+	text, err := s.client.GenerateText(ctx, prompt)
+	if err != nil {
+		s.log.Warn("Substituter: model suggestion for '%s' failed: %v", ingredient, err)
+		return nil
+	}
+
+	var resp struct {
+		Substitutes []string `json:"substitutes"`
+	}
+	if err := json.Unmarshal([]byte(gemini.RepairJSON(text)), &resp); err != nil {
+		s.log.Warn("Substituter: could not parse model suggestion for '%s': %v", ingredient, err)
+		return nil
+	}
+
+	var out []string
+	for _, c := range resp.Substitutes {
+		if c = strings.TrimSpace(c); c != "" && len(out) < maxLLMSubstitutes {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// rewriteMentions replaces whole-word, case-insensitive mentions of each key,
+// plain or plural, with its substitute in a single pass, longest key first
+// so "heavy cream" wins over "cream". Keys mapped to "" are left as written.
+func rewriteMentions(text string, replacements map[string]string) string {
+	if text == "" || len(replacements) == 0 {
+		return text
+	}
+	keys := make([]string, 0, len(replacements))
+	for k := range replacements {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+
+	quoted := make([]string, len(keys))
+	for i, k := range keys {
+		quoted[i] = regexp.QuoteMeta(k)
+	}
+	re := regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)(?:es|s)?\b`)
+	return re.ReplaceAllStringFunc(text, func(match string) string {
+		if sub := replacements[strings.ToLower(re.FindStringSubmatch(match)[1])]; sub != "" {
+			return sub
+		}
+		return match
+	})
+}
@@ -0,0 +1,163 @@
+package agents
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+	"github.com/Jayyk09/CUHackIt/services/gemini"
+)
+
+func TestSubstituteFromTable(t *testing.T) {
+	s := NewSubstituter(nil, logger.GetLogger("error"))
+	recipe := Recipe{
+		Title:       "Creamy Peanut Noodles",
+		Description: "Noodles in a heavy cream sauce.",
+		Ingredients: []Ingredient{
+			{Name: "heavy cream", Amount: "1", Unit: "cup"},
+			{Name: "peanut butter", Amount: "2", Unit: "tbsp"},
+			{Name: "unsalted butter", Amount: "1", Unit: "tbsp"},
+		},
+		Instructions: []string{"Melt the butter and whisk in the peanut butter.", "Stir in the cream."},
+	}
+	pantry := []PantryItem{{Name: "Oat Cream"}}
+
+	out, ok := s.Substitute(context.Background(), recipe, []string{"dairy"}, nil, pantry)
+	if !ok {
+		t.Fatal("expected every dairy ingredient to have a substitute")
+	}
+	if len(out.Substitutions) != 2 {
+		t.Fatalf("got %d substitutions, want cream and butter: %+v", len(out.Substitutions), out.Substitutions)
+	}
+
+	cream := out.Ingredients[0]
+	if cream.Name != "oat cream" || !cream.FromPantry || cream.SubstitutedFor != "heavy cream" || cream.Amount != "1" {
+		t.Errorf("expected the pantry's oat cream to replace heavy cream, got %+v", cream)
+	}
+	if out.Ingredients[1].Name != "peanut butter" {
+		t.Errorf("peanut butter should be kept, got %q", out.Ingredients[1].Name)
+	}
+	if got := out.Substitutions[1]; got.Substitute != "olive oil" || got.Source != SubstitutionTable {
+		t.Errorf("expected butter to become olive oil from the table, got %+v", got)
+	}
+
+	if got, want := out.Instructions[0], "Melt the olive oil and whisk in the peanut butter."; got != want {
+		t.Errorf("instruction = %q, want %q", got, want)
+	}
+	if got, want := out.Instructions[1], "Stir in the oat cream."; got != want {
+		t.Errorf("instruction = %q, want %q", got, want)
+	}
+	if got, want := out.Description, "Noodles in a oat cream sauce."; got != want {
+		t.Errorf("description = %q, want %q", got, want)
+	}
+	if recipe.Ingredients[0].Name != "heavy cream" {
+		t.Error("the original recipe was modified")
+	}
+}
+
+func TestSubstituteSkipsCandidatesWithOtherAllergens(t *testing.T) {
+	s := NewSubstituter(nil, logger.GetLogger("error"))
+	recipe := Recipe{Ingredients: []Ingredient{{Name: "whole milk"}}}
+
+	out, ok := s.Substitute(context.Background(), recipe, []string{"milk", "soy"}, nil, []PantryItem{{Name: "Soy Milk"}})
+	if !ok {
+		t.Fatal("expected a substitute for milk")
+	}
+	if got := out.Ingredients[0].Name; got != "oat milk" {
+		t.Errorf("expected oat milk, not the pantry's soy milk, got %q", got)
+	}
+}
+
+func TestSubstituteRespectsDiets(t *testing.T) {
+	s := NewSubstituter(nil, logger.GetLogger("error"))
+	recipe := Recipe{
+		Title:        "Seared Salmon",
+		Ingredients:  []Ingredient{{Name: "salmon fillet"}},
+		Instructions: []string{"Sear the salmon."},
+	}
+	pantry := []PantryItem{{Name: "Chicken Breast"}}
+
+	// Without a diet the pantry's chicken wins
+	out, ok := s.Substitute(context.Background(), recipe, []string{"fish"}, nil, pantry)
+	if !ok || out.Ingredients[0].Name != "chicken breast" {
+		t.Fatalf("expected chicken breast from the pantry, got %+v", out.Ingredients)
+	}
+
+	out, ok = s.Substitute(context.Background(), recipe, []string{"fish"}, []string{"pescatarian"}, pantry)
+	if !ok || out.Ingredients[0].Name != "firm tofu" {
+		t.Fatalf("expected firm tofu for a pescatarian, got %+v", out.Ingredients)
+	}
+
+	// A vegan avoiding soy cannot have tofu or chicken
+	out, ok = s.Substitute(context.Background(), recipe, []string{"fish", "soy"}, []string{"vegan"}, pantry)
+	if !ok || out.Ingredients[0].Name != "hearts of palm" {
+		t.Fatalf("expected hearts of palm for a soy-free vegan, got %+v", out.Ingredients)
+	}
+}
+
+func TestSubstituteFallsBackToModel(t *testing.T) {
+	fake := gemini.NewFakeClient(logger.GetLogger("error"))
+	fake.Enqueue(gemini.FakeResponse{Text: "```json\n{\"substitutes\": [\"sesame oil\", \"sunflower oil\"]}\n```"})
+	s := NewSubstituter(fake, logger.GetLogger("error"))
+
+	recipe := Recipe{Title: "Tahini Slaw", Ingredients: []Ingredient{{Name: "benne seeds"}}}
+	out, ok := s.Substitute(context.Background(), recipe, []string{"sesame"}, nil, nil)
+	if !ok {
+		t.Fatal("expected the model's suggestion to be used")
+	}
+	if got := out.Substitutions[0]; got.Substitute != "sunflower oil" || got.Source != SubstitutionLLM {
+		t.Errorf("expected the first safe suggestion from the model, got %+v", got)
+	}
+
+	fake.Enqueue(gemini.FakeResponse{Err: gemini.ErrGenerationFail})
+	if _, ok := s.Substitute(context.Background(), recipe, []string{"sesame"}, nil, nil); ok {
+		t.Error("expected no substitute when the model fails")
+	}
+}
+
+func TestOrchestratorStrictPolicySubstitutesUnsafeRecipes(t *testing.T) {
+	fake := gemini.NewFakeClient(logger.GetLogger("error"))
+	o := newTestOrchestrator(fake)
+
+	var streamed []Recipe
+	result, err := o.GenerateStream(context.Background(), GenerateRequest{
+		RecipeRequest: RecipeRequest{PantryItems: testPantry(), RecipeCount: 2, Allergens: []string{"fish"}},
+		Mode:          ModeFlexible,
+	}, func(ev RecipeEvent) {
+		if ev.Type == RecipeEventRecipe {
+			streamed = append(streamed, *ev.Recipe)
+		}
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.TotalCount != 2 || result.FilteredCount != 0 || result.SubstitutedCount != 1 || fake.Calls() != 1 {
+		t.Fatalf("expected the salmon recipe rescued without retries, got total=%d filtered=%d substituted=%d calls=%d",
+			result.TotalCount, result.FilteredCount, result.SubstitutedCount, fake.Calls())
+	}
+
+	pasta := result.AllRecipes[0]
+	if len(pasta.Substitutions) != 1 || pasta.Ingredients[0].SubstitutedFor != "salmon fillet" {
+		t.Fatalf("expected salmon fillet to be substituted, got %+v", pasta.Ingredients[0])
+	}
+	if !pasta.Ingredients[0].FromPantry || pasta.Explanation.AllergenCheck.Status != AllergenSafe {
+		t.Errorf("expected the pantry's chicken breast and a safe recipe, got %+v", pasta.Ingredients[0])
+	}
+	if len(streamed) != 2 || streamed[1].Ingredients[0].SubstitutedFor == "" {
+		t.Errorf("expected the rescued recipe to be streamed, got %d recipes", len(streamed))
+	}
+}
+
+func TestSubstitutionTableOffersSafeCandidates(t *testing.T) {
+	for key, candidates := range substitutionTable {
+		for name := range allergenOntology {
+			rules := allergenRules([]string{name})
+			if len(matchIngredient(key, rules)) == 0 {
+				continue
+			}
+			if len(safeSubstitutes(candidates, rules)) == 0 {
+				t.Errorf("%q has no substitute safe for %s", key, name)
+			}
+		}
+	}
+}
@@ -14,6 +14,10 @@ type Agent interface {
 
 	// GenerateRecipes generates recipes based on the request
 	GenerateRecipes(ctx context.Context, req RecipeRequest) (*RecipeResponse, error)
+
+	// StreamRecipes is GenerateRecipes that also reports steps and recipes
+	// through emit as they are generated. emit may be nil.
+	StreamRecipes(ctx context.Context, req RecipeRequest, emit EmitFunc) (*RecipeResponse, error)
 }
 
 // RecipeRequest contains all the information needed to generate recipes
@@ -22,15 +26,37 @@ type RecipeRequest struct {
 	PantryItems []PantryItem `json:"pantry_items"`
 
 	// User's preferences and restrictions
-	Allergens          []string `json:"allergens"`
-	DietaryPreferences []string `json:"dietary_preferences"`
-	NutritionalGoals   []string `json:"nutritional_goals"`
-	CookingSkill       string   `json:"cooking_skill"`
-	CuisinePreferences []string `json:"cuisine_preferences"`
+	Allergens          []string       `json:"allergens"`
+	AllergenPolicy     AllergenPolicy `json:"allergen_policy"` // empty means strict
+	DietaryPreferences []string       `json:"dietary_preferences"`
+	NutritionalGoals   []string       `json:"nutritional_goals"`
+	CookingSkill       string         `json:"cooking_skill"`
+	CuisinePreferences []string       `json:"cuisine_preferences"`
 
 	// Generation options
 	RecipeCount int    `json:"recipe_count"` // How many recipes to generate (1-3)
 	UserPrompt  string `json:"user_prompt"`  // Optional free-text guidance (e.g. "grilled chicken")
+
+	// AvoidIngredients lists ingredients that failed the allergen check in
+	// earlier attempts; set when asking an agent for replacements
+	AvoidIngredients []string `json:"avoid_ingredients,omitempty"`
+}
+
+// AllergenPolicy decides what happens to recipes that fail the allergen check
+type AllergenPolicy string
+
+const (
+	// AllergenPolicyStrict drops unsafe recipes and asks for replacements.
+	// It is the default.
+	AllergenPolicyStrict AllergenPolicy = "strict"
+	// AllergenPolicyWarn keeps unsafe recipes with their flagged ingredients
+	// annotated
+	AllergenPolicyWarn AllergenPolicy = "warn"
+)
+
+// Strict reports whether unsafe recipes must be dropped
+func (p AllergenPolicy) Strict() bool {
+	return p != AllergenPolicyWarn
 }
 
 // PantryItem represents an item in the user's pantry
@@ -43,6 +69,10 @@ type PantryItem struct {
 	ExpirationDate *time.Time `json:"expiration_date,omitempty"`
 	IsExpiringSoon bool      `json:"is_expiring_soon"`
 	IsExpired      bool      `json:"is_expired"`
+
+	// Declared allergens and traces of the product, e.g. "en:milk"
+	Allergens []string `json:"allergens,omitempty"`
+	Traces    []string `json:"traces,omitempty"`
 }
 
 // RecipeResponse contains the generated recipes and metadata
@@ -70,7 +100,15 @@ type Recipe struct {
 	CarbsG             float64      `json:"carbs_g,omitempty"`
 	FatG               float64      `json:"fat_g,omitempty"`
 	Tags               []string     `json:"tags,omitempty"`
-	Source             string       `json:"source"` // "pantry_only" or "flexible"
+	Source             string       `json:"source"` // agent that produced the recipe
+	Score              float64      `json:"score"`  // ranking score in [0, 1]; see Explanation
+
+	// Explanation breaks the score down; set by the orchestrator
+	Explanation *RecipeExplanation `json:"explanation,omitempty"`
+
+	// Substitutions lists the ingredients swapped out to make the recipe
+	// safe for the user's allergens
+	Substitutions []Substitution `json:"substitutions,omitempty"`
 }
 
 // Ingredient represents an ingredient in a recipe
@@ -79,6 +117,13 @@ type Ingredient struct {
 	Amount     string `json:"amount"`
 	Unit       string `json:"unit,omitempty"`
 	FromPantry bool   `json:"from_pantry"`
+
+	// AllergenFlags explains why the ingredient matched the user's
+	// allergens; set by the orchestrator
+	AllergenFlags []AllergenMatch `json:"allergen_flags,omitempty"`
+
+	// SubstitutedFor names the ingredient this one replaced, if any
+	SubstitutedFor string `json:"substituted_for,omitempty"`
 }
 
 // convertToGeminiPantryItems converts agent PantryItems to Gemini PantryItems
@@ -112,6 +157,7 @@ func convertToGeminiPreferences(req RecipeRequest) gemini.UserPreferences {
 		NutritionalGoals:   req.NutritionalGoals,
 		CookingSkill:       req.CookingSkill,
 		CuisinePreferences: req.CuisinePreferences,
+		AvoidIngredients:   req.AvoidIngredients,
 	}
 }
 
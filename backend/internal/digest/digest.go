@@ -0,0 +1,82 @@
+// Package digest sends each user a daily digest of the pantry items about
+// to go bad, with a recipe suggested to use them up.
+package digest
+
+import (
+	"context"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/internal/agents"
+	"github.com/Jayyk09/CUHackIt/internal/pantry"
+	"github.com/Jayyk09/CUHackIt/internal/users"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Item is one expiring pantry item in a digest
+type Item struct {
+	PantryItemID   int       `json:"pantry_item_id"`
+	ProductName    string    `json:"product_name"`
+	Quantity       float64   `json:"quantity"`
+	Unit           string    `json:"unit"`
+	ExpirationDate time.Time `json:"expiration_date"`
+	DaysRemaining  int       `json:"days_remaining"`
+	IsExpired      bool      `json:"is_expired"`
+}
+
+// Digest is what one user is told about their pantry on one day
+type Digest struct {
+	UserID string    `json:"user_id"`
+	Email  string    `json:"email"`
+	Name   string    `json:"name,omitempty"`
+	Date   time.Time `json:"date"`
+	Items  []Item    `json:"items"`
+
+	// SuggestedRecipe is a spoiling-mode recipe for the items, when one
+	// could be generated; RecipeError says why not otherwise
+	SuggestedRecipe *agents.Recipe `json:"suggested_recipe,omitempty"`
+	RecipeError     string         `json:"recipe_error,omitempty"`
+}
+
+// Store is where the scheduler reads users and their pantries
+type Store interface {
+	ListUsers(ctx context.Context) ([]users.User, error)
+	ListPantry(ctx context.Context, userID string) ([]pantry.PantryItemWithFood, error)
+}
+
+// dbStore implements Store with the users and pantry repositories
+type dbStore struct {
+	users  *users.Repository
+	pantry *pantry.Repository
+}
+
+// NewStore creates a Store backed by the database
+func NewStore(pool *pgxpool.Pool) Store {
+	return &dbStore{users: users.NewRepository(pool), pantry: pantry.NewRepository(pool)}
+}
+
+// ListUsers implements Store; users with an empty pantry have nothing to hear about
+func (s *dbStore) ListUsers(ctx context.Context) ([]users.User, error) {
+	return s.users.ListWithPantry(ctx)
+}
+
+// ListPantry implements Store
+func (s *dbStore) ListPantry(ctx context.Context, userID string) ([]pantry.PantryItemWithFood, error) {
+	return s.pantry.ListByUserID(ctx, userID)
+}
+
+// digestItems converts expiring pantry items to digest items
+func digestItems(expiring []pantry.PantryItemWithFood) []Item {
+	out := make([]Item, 0, len(expiring))
+	for _, p := range expiring {
+		out = append(out, Item{
+			PantryItemID:   p.ID,
+			ProductName:    p.ProductName,
+			Quantity:       p.Quantity,
+			Unit:           p.Unit,
+			ExpirationDate: *p.Expiry.Date,
+			DaysRemaining:  *p.Expiry.DaysRemaining,
+			IsExpired:      p.Expiry.IsExpired,
+		})
+	}
+	return out
+}
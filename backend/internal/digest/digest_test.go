@@ -0,0 +1,105 @@
+package digest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/internal/agents"
+	"github.com/Jayyk09/CUHackIt/internal/pantry"
+	"github.com/Jayyk09/CUHackIt/internal/users"
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+	"github.com/Jayyk09/CUHackIt/services/gemini"
+)
+
+type memStore struct {
+	users  []users.User
+	pantry map[string][]pantry.PantryItemWithFood
+}
+
+func (s *memStore) ListUsers(context.Context) ([]users.User, error) {
+	return s.users, nil
+}
+
+func (s *memStore) ListPantry(_ context.Context, userID string) ([]pantry.PantryItemWithFood, error) {
+	return s.pantry[userID], nil
+}
+
+func TestNextRun(t *testing.T) {
+	morning := time.Date(2026, 5, 1, 6, 30, 0, 0, time.UTC)
+	if got := nextRun(morning, 8); !got.Equal(time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("nextRun before the hour = %v", got)
+	}
+	if got := nextRun(morning.Add(90*time.Minute), 8); !got.Equal(time.Date(2026, 5, 2, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("nextRun at the hour = %v, want the next day", got)
+	}
+}
+
+func TestRunOnceWritesDigests(t *testing.T) {
+	now := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	day := func(d int) *time.Time {
+		t := now.AddDate(0, 0, d)
+		return &t
+	}
+	store := &memStore{
+		users: []users.User{
+			{ID: "u1", Email: "cook@example.com"},
+			{ID: "u2", Email: "fresh@example.com"},
+			{ID: "u3", Email: "forgetful@example.com"},
+		},
+		pantry: map[string][]pantry.PantryItemWithFood{
+			"u1": {
+				{ID: 1, ProductName: "Spinach", ExpiresAt: day(2)},
+				{ID: 2, ProductName: "Milk", ExpiresAt: day(-1)},
+				{ID: 3, ProductName: "Rice", ExpiresAt: day(200)},
+			},
+			"u2": {{ID: 4, ProductName: "Honey"}},
+			// Long expired, so no longer worth a digest
+			"u3": {{ID: 5, ProductName: "Yogurt", ExpiresAt: day(-10)}},
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "digests.jsonl")
+	notifier, err := NewNotifier(NotifierFile, path, logger.GetLogger("error"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	generator := agents.NewOrchestrator(gemini.NewFakeClient(logger.GetLogger("error")), logger.GetLogger("error"))
+	s := NewScheduler(store, generator, notifier, Config{Days: 3, SuggestRecipe: true}, logger.GetLogger("error"))
+	s.now = func() time.Time { return now }
+
+	sent, err := s.RunOnce(context.Background())
+	if err != nil || sent != 1 {
+		t.Fatalf("RunOnce = %d, %v; want 1 digest", sent, err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var digests []Digest
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var d Digest
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			t.Fatal(err)
+		}
+		digests = append(digests, d)
+	}
+
+	if len(digests) != 1 || digests[0].UserID != "u1" {
+		t.Fatalf("expected one digest for u1, got %+v", digests)
+	}
+	d := digests[0]
+	if len(d.Items) != 2 || d.Items[0].ProductName != "Milk" || !d.Items[0].IsExpired || d.Items[1].DaysRemaining != 2 {
+		t.Errorf("expected expired milk then spinach, got %+v", d.Items)
+	}
+	if d.SuggestedRecipe == nil || d.RecipeError != "" {
+		t.Errorf("expected a suggested recipe, got %v (%s)", d.SuggestedRecipe, d.RecipeError)
+	}
+}
@@ -0,0 +1,96 @@
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+)
+
+// Notifier delivers digests to users
+type Notifier interface {
+	Notify(ctx context.Context, d Digest) error
+}
+
+// Notifier kinds accepted by NewNotifier
+const (
+	NotifierLog  = "log"
+	NotifierFile = "file"
+)
+
+// NewNotifier creates the notifier named by kind. path is only used by
+// the file notifier.
+func NewNotifier(kind, path string, log *logger.Logger) (Notifier, error) {
+	switch kind {
+	case NotifierLog, "":
+		return NewLogNotifier(log), nil
+	case NotifierFile:
+		return NewFileNotifier(path)
+	}
+	return nil, fmt.Errorf("unknown digest notifier %q", kind)
+}
+
+// LogNotifier writes a one-line summary of each digest to the log, for
+// local development
+type LogNotifier struct {
+	log *logger.Logger
+}
+
+// NewLogNotifier creates a LogNotifier
+func NewLogNotifier(log *logger.Logger) *LogNotifier {
+	return &LogNotifier{log: log}
+}
+
+// Notify implements Notifier
+func (n *LogNotifier) Notify(_ context.Context, d Digest) error {
+	names := make([]string, len(d.Items))
+	for i, item := range d.Items {
+		names[i] = fmt.Sprintf("%s (%dd)", item.ProductName, item.DaysRemaining)
+	}
+	recipe := "none"
+	if d.SuggestedRecipe != nil {
+		recipe = d.SuggestedRecipe.Title
+	}
+	n.log.Info("Digest for %s: %d expiring: %s; suggested recipe: %s",
+		d.Email, len(d.Items), strings.Join(names, ", "), recipe)
+	return nil
+}
+
+// FileNotifier appends each digest to a file as one JSON line
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileNotifier creates a FileNotifier writing to path
+func NewFileNotifier(path string) (*FileNotifier, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file digest notifier needs a path")
+	}
+	return &FileNotifier{path: path}, nil
+}
+
+// Notify implements Notifier
+func (n *FileNotifier) Notify(_ context.Context, d Digest) error {
+	line, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open digest file: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write digest: %w", err)
+	}
+	return f.Close()
+}
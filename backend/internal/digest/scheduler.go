@@ -0,0 +1,194 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/internal/agents"
+	"github.com/Jayyk09/CUHackIt/internal/pantry"
+	"github.com/Jayyk09/CUHackIt/internal/users"
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+)
+
+// recipeTimeout bounds the recipe suggestion for one digest
+const recipeTimeout = 60 * time.Second
+
+// defaultExpiredDays is how long an expired item keeps appearing in digests
+const defaultExpiredDays = 3
+
+// RecipeGenerator suggests recipes; *agents.Orchestrator implements it
+type RecipeGenerator interface {
+	Generate(ctx context.Context, req agents.GenerateRequest) (*agents.GenerateResult, error)
+}
+
+// Config controls when digests are sent and what they cover
+type Config struct {
+	// Hour is the UTC hour of day the digest runs at
+	Hour int
+	// Days is how far ahead an item's expiry counts
+	Days int
+	// ExpiredDays is how many days after expiring an item is still reported,
+	// so one forgotten item does not bring a digest, and a recipe
+	// suggestion, every day forever
+	ExpiredDays int
+	// SuggestRecipe adds a spoiling-mode recipe to each digest
+	SuggestRecipe bool
+}
+
+// Scheduler builds and sends the daily digests
+type Scheduler struct {
+	store     Store
+	generator RecipeGenerator
+	notifier  Notifier
+	cfg       Config
+	log       *logger.Logger
+	now       func() time.Time
+}
+
+// NewScheduler creates a Scheduler. generator may be nil, in which case no
+// recipes are suggested.
+func NewScheduler(store Store, generator RecipeGenerator, notifier Notifier, cfg Config, log *logger.Logger) *Scheduler {
+	if cfg.Days <= 0 {
+		cfg.Days = pantry.ExpiringSoonDays
+	}
+	if cfg.ExpiredDays <= 0 {
+		cfg.ExpiredDays = defaultExpiredDays
+	}
+	cfg.Hour = ((cfg.Hour % 24) + 24) % 24
+	return &Scheduler{
+		store:     store,
+		generator: generator,
+		notifier:  notifier,
+		cfg:       cfg,
+		log:       log,
+		now:       time.Now,
+	}
+}
+
+// Start runs the digest every day at the configured hour until ctx is done
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		for {
+			next := nextRun(s.now(), s.cfg.Hour)
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			sent, err := s.RunOnce(ctx)
+			if err != nil {
+				s.log.Error("Daily digest failed: %v", err)
+				continue
+			}
+			s.log.Info("Daily digest sent to %d users", sent)
+		}
+	}()
+}
+
+// nextRun is the first time at hour (UTC) strictly after now
+func nextRun(now time.Time, hour int) time.Time {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// RunOnce builds and sends a digest to every user with something expiring
+// and returns how many were sent. A failure for one user is logged and
+// does not stop the others.
+func (s *Scheduler) RunOnce(ctx context.Context) (int, error) {
+	list, err := s.store.ListUsers(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	sent := 0
+	for _, user := range list {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		d, err := s.Build(ctx, user)
+		if err != nil {
+			s.log.Error("Failed to build digest for user %s: %v", user.ID, err)
+			continue
+		}
+		if d == nil {
+			continue
+		}
+		if err := s.notifier.Notify(ctx, *d); err != nil {
+			s.log.Error("Failed to send digest to user %s: %v", user.ID, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// Build computes a user's digest, or nil if nothing of theirs is expiring
+// or recently expired
+func (s *Scheduler) Build(ctx context.Context, user users.User) (*Digest, error) {
+	now := s.now()
+	items, err := s.store.ListPantry(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	var expiring []pantry.PantryItemWithFood
+	for _, item := range pantry.ExpiringItems(items, s.cfg.Days, now) {
+		if *item.Expiry.DaysRemaining >= -s.cfg.ExpiredDays {
+			expiring = append(expiring, item)
+		}
+	}
+	if len(expiring) == 0 {
+		return nil, nil
+	}
+
+	d := &Digest{
+		UserID: user.ID,
+		Email:  user.Email,
+		Name:   user.Name,
+		Date:   now.UTC().Truncate(24 * time.Hour),
+		Items:  digestItems(expiring),
+	}
+	if s.cfg.SuggestRecipe && s.generator != nil {
+		d.SuggestedRecipe, err = s.suggestRecipe(ctx, user, items, now)
+		if err != nil {
+			d.RecipeError = err.Error()
+		}
+	}
+	return d, nil
+}
+
+// suggestRecipe asks for one spoiling-mode recipe from the user's pantry
+func (s *Scheduler) suggestRecipe(ctx context.Context, user users.User, items []pantry.PantryItemWithFood, now time.Time) (*agents.Recipe, error) {
+	ctx, cancel := context.WithTimeout(ctx, recipeTimeout)
+	defer cancel()
+
+	result, err := s.generator.Generate(ctx, agents.GenerateRequest{
+		RecipeRequest: agents.RecipeRequest{
+			PantryItems:        pantry.AgentItems(items, now),
+			Allergens:          user.Allergens,
+			AllergenPolicy:     agents.AllergenPolicy(user.AllergenPolicy),
+			DietaryPreferences: user.DietaryPreferences,
+			NutritionalGoals:   user.NutritionalGoals,
+			CookingSkill:       user.CookingSkill,
+			CuisinePreferences: user.CuisinePreferences,
+			RecipeCount:        1,
+		},
+		Mode:   agents.ModeSpoiling,
+		UserID: user.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.AllRecipes) == 0 {
+		return nil, fmt.Errorf("no recipe generated")
+	}
+	recipe := result.AllRecipes[0]
+	return &recipe, nil
+}
@@ -0,0 +1,54 @@
+package food
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidBarcode = errors.New("invalid barcode")
+
+// NormalizeGTIN validates a scanned UPC or EAN barcode and returns it as a
+// 14-digit GTIN. Spaces and dashes are ignored. EAN-8, UPC-A (12 digits),
+// EAN-13 and GTIN-14 are accepted; the last digit must be the GS1 check
+// digit of the others.
+func NormalizeGTIN(code string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(code))
+
+	switch len(digits) {
+	case 8, 12, 13, 14:
+	default:
+		return "", fmt.Errorf("%w: %q must have 8, 12, 13 or 14 digits", ErrInvalidBarcode, code)
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("%w: %q must only contain digits", ErrInvalidBarcode, code)
+		}
+	}
+
+	body, check := digits[:len(digits)-1], digits[len(digits)-1]
+	if want := checkDigit(body); check != want {
+		return "", fmt.Errorf("%w: %q has check digit %c, want %c", ErrInvalidBarcode, code, check, want)
+	}
+	return strings.Repeat("0", 14-len(digits)) + digits, nil
+}
+
+// checkDigit computes the GS1 check digit: digits are weighted 3 and 1
+// alternately from the right, and the check digit brings the sum to a
+// multiple of 10
+func checkDigit(body string) byte {
+	sum := 0
+	for i := len(body) - 1; i >= 0; i-- {
+		d := int(body[i] - '0')
+		if (len(body)-1-i)%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
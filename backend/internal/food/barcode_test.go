@@ -0,0 +1,28 @@
+package food
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeGTIN(t *testing.T) {
+	cases := map[string]string{
+		"036000291452":    "00036000291452", // UPC-A
+		"0-36000-29145-2": "00036000291452",
+		"4006381333931":   "04006381333931", // EAN-13
+		"96385074":        "00000096385074", // EAN-8
+		"10036000291459":  "10036000291459", // GTIN-14
+	}
+	for in, want := range cases {
+		got, err := NormalizeGTIN(in)
+		if err != nil || got != want {
+			t.Errorf("NormalizeGTIN(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+
+	for _, bad := range []string{"036000291453", "12345", "03600029145A", ""} {
+		if _, err := NormalizeGTIN(bad); !errors.Is(err, ErrInvalidBarcode) {
+			t.Errorf("NormalizeGTIN(%q) = %v, want ErrInvalidBarcode", bad, err)
+		}
+	}
+}
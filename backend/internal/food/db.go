@@ -25,6 +25,7 @@ type Product struct {
 	ImageSmallURL          *string  `json:"image_small_url"`
 	ShelfLife              *int     `json:"shelf_life"`
 	Category               *string  `json:"category"`
+	Barcode                *string  `json:"barcode,omitempty"`
 }
 
 func fetchProducts(ctx context.Context, db *database.DB, search string, limit, offset int) ([]Product, error) {
@@ -43,7 +44,8 @@ func fetchProducts(ctx context.Context, db *database.DB, search string, limit, o
 		image_url,
 		image_small_url,
 		shelf_life,
-		category
+		category,
+		barcode
 		FROM %s`, foodTable)
 
 	var rows interface {
@@ -79,6 +81,7 @@ func fetchProducts(ctx context.Context, db *database.DB, search string, limit, o
 			&product.ImageSmallURL,
 			&product.ShelfLife,
 			&product.Category,
+			&product.Barcode,
 		); err != nil {
 			return nil, fmt.Errorf("scan product: %w", err)
 		}
@@ -129,6 +132,16 @@ func updateProductMetadata(ctx context.Context, db *database.DB, id int64, categ
 }
 
 func getProductByID(ctx context.Context, db *database.DB, id int64) (*Product, error) {
+	return getProduct(ctx, db, "id = $1", id)
+}
+
+// getProductByGTIN finds the product whose barcode is gtin, a 14-digit GTIN
+// from NormalizeGTIN
+func getProductByGTIN(ctx context.Context, db *database.DB, gtin string) (*Product, error) {
+	return getProduct(ctx, db, "barcode IS NOT NULL AND lpad(barcode, 14, '0') = $1", gtin)
+}
+
+func getProduct(ctx context.Context, db *database.DB, where string, arg any) (*Product, error) {
 	if db == nil || db.Pool == nil {
 		return nil, fmt.Errorf("database connection is not initialized")
 	}
@@ -145,8 +158,11 @@ func getProductByID(ctx context.Context, db *database.DB, id int64) (*Product, e
 		image_url,
 		image_small_url,
 		shelf_life,
-		category
-		FROM %s WHERE id = $1`, foodTable), id).Scan(
+		category,
+		barcode
+		FROM %s WHERE %s
+		ORDER BY id
+		LIMIT 1`, foodTable, where), arg).Scan(
 		&product.ID,
 		&product.ProductName,
 		&product.NormEnvironmentalScore,
@@ -158,6 +174,7 @@ func getProductByID(ctx context.Context, db *database.DB, id int64) (*Product, e
 		&product.ImageSmallURL,
 		&product.ShelfLife,
 		&product.Category,
+		&product.Barcode,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
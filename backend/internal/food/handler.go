@@ -19,7 +19,7 @@ import (
 type foodHandler struct {
 	db  *database.DB
 	log *logger.Logger
-	ai  *gemini.Client
+	ai  gemini.Provider
 	cfg *config.Config
 }
 
@@ -29,7 +29,7 @@ const (
 )
 
 // NewHandler creates a new food handler
-func NewHandler(db *database.DB, ai *gemini.Client, cfg *config.Config, log *logger.Logger) *foodHandler {
+func NewHandler(db *database.DB, ai gemini.Provider, cfg *config.Config, log *logger.Logger) *foodHandler {
 	return &foodHandler{db: db, ai: ai, cfg: cfg, log: log}
 }
 
@@ -107,6 +107,39 @@ func (h *foodHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 	h.writeJSON(w, http.StatusOK, product)
 }
 
+// BarcodeResult is the body of GET /food/barcode/{code}
+type BarcodeResult struct {
+	GTIN string `json:"gtin"`
+	*Product
+}
+
+// GetByBarcode handles GET /food/barcode/{code}. The code is check-digit
+// validated and normalized to a GTIN-14 before lookup.
+func (h *foodHandler) GetByBarcode(w http.ResponseWriter, r *http.Request) {
+	gtin, err := NormalizeGTIN(r.PathValue("code"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	product, err := getProductByGTIN(r.Context(), h.db, gtin)
+	if err != nil {
+		if errors.Is(err, ErrProductNotFound) {
+			h.writeError(w, http.StatusNotFound, "product not found")
+			return
+		}
+		h.log.Error("Failed to look up barcode: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "failed to look up barcode")
+		return
+	}
+
+	if h.ai != nil && needsEnrichment(*product) {
+		h.enrichProduct(r.Context(), product)
+	}
+
+	h.writeJSON(w, http.StatusOK, BarcodeResult{GTIN: gtin, Product: product})
+}
+
 // UpdateMetadata handles PATCH /food/{id}/metadata
 func (h *foodHandler) UpdateMetadata(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
@@ -182,6 +215,7 @@ func (h *foodHandler) enrichProduct(ctx context.Context, product *Product) {
 		return
 	}
 
+	ctx = gemini.WithUsageTags(ctx, gemini.UsageTags{Agent: "food_enrichment"})
 	categories, err := h.ai.CategorizeFood(ctx, []string{product.ProductName})
 	if err != nil {
 		h.log.Error("gemini categorize failed: %v", err)
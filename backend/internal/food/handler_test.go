@@ -3,6 +3,8 @@ package food
 import (
 	"net/http/httptest"
 	"testing"
+
+	"github.com/Jayyk09/CUHackIt/services/gemini"
 )
 
 func TestParsePaginationDefaults(t *testing.T) {
@@ -64,7 +66,7 @@ func TestNeedsEnrichment(t *testing.T) {
 
 func TestCleanGeminiResponse(t *testing.T) {
 	input := "```json\n[{\"food_name\":\"Banana\",\"category\":\"PRODUCE\",\"shelf_life\":5}]\n```"
-	cleaned := cleanGeminiResponse(input)
+	cleaned := gemini.RepairJSON(input)
 	expected := "[{\"food_name\":\"Banana\",\"category\":\"PRODUCE\",\"shelf_life\":5}]"
 	if cleaned != expected {
 		t.Fatalf("expected cleaned response %q, got %q", expected, cleaned)
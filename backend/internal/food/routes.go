@@ -1,7 +1,6 @@
 package food
 
 import (
-	"context"
 	"net/http"
 
 	"github.com/Jayyk09/CUHackIt/config"
@@ -12,17 +11,15 @@ import (
 	"github.com/gorilla/sessions"
 )
 
-// RegisterRoutes registers all food routes
-func RegisterRoutes(r *http.ServeMux, db *database.DB, store sessions.Store) {
+// RegisterRoutes registers all food routes. ai may be nil, in which case
+// products are returned without category/shelf-life enrichment.
+func RegisterRoutes(r *http.ServeMux, db *database.DB, store sessions.Store, ai gemini.Provider) {
 	cfg := config.GetConfig()
 	log := logger.GetLogger(cfg.Log.Level)
-	aiClient, err := gemini.NewClient(context.Background(), cfg.Gemini.APIKey, cfg.Gemini.Model, log)
-	if err != nil {
-		log.Warn("failed to initialize gemini client: %v", err)
-	}
 
-	h := NewHandler(db, aiClient, cfg, log)
+	h := NewHandler(db, ai, cfg, log)
 	r.Handle("GET /food", auth.IsAuthenticated(store, http.HandlerFunc(h.List)))
 	r.Handle("GET /food/{id}", auth.IsAuthenticated(store, http.HandlerFunc(h.GetProduct)))
+	r.Handle("GET /food/barcode/{code}", auth.IsAuthenticated(store, http.HandlerFunc(h.GetByBarcode)))
 	r.Handle("PATCH /food/{id}/metadata", auth.IsAuthenticated(store, http.HandlerFunc(h.UpdateMetadata)))
 }
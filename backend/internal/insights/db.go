@@ -0,0 +1,211 @@
+package insights
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/internal/pantry"
+	"github.com/Jayyk09/CUHackIt/internal/recipes"
+	"github.com/Jayyk09/CUHackIt/internal/units"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Repository reads the pantry history and cooked recipes insights are
+// computed from
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+// NewRepository creates a new insights repository
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+// Insights computes a user's metrics over rng
+func (r *Repository) Insights(ctx context.Context, userID string, rng Range) (*Insights, error) {
+	changes, err := r.changes(ctx, userID, rng)
+	if err != nil {
+		return nil, err
+	}
+	items, err := r.shelved(ctx, userID, rng)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, expiredChanges(items, rng, time.Now())...)
+	cooks, err := r.cooks(ctx, userID, rng)
+	if err != nil {
+		return nil, err
+	}
+	return build(userID, rng, changes, cooks), nil
+}
+
+// changes reads the user's pantry events that had a reason, or undid a
+// cooked recipe, in rng. Each comes with the item's price and quantity as
+// recorded when it was added, for pricing the part the event removed.
+func (r *Repository) changes(ctx context.Context, userID string, rng Range) ([]change, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT e.created_at, e.pantry_item_id, COALESCE(f.product_name, ''), e.action, COALESCE(e.reason, ''),
+		       e.quantity_before - e.quantity_after, e.unit, e.price, f.norm_environmental_score,
+		       COALESCE((
+		           SELECT a.quantity_after FROM pantry_events a
+		           WHERE a.pantry_item_id = e.pantry_item_id AND a.user_id = e.user_id
+		             AND a.action = 'added' AND a.unit = e.unit
+		           ORDER BY a.id LIMIT 1
+		       ), e.quantity_before)
+		FROM pantry_events e
+		LEFT JOIN foods f ON f.id = e.food_id
+		WHERE e.user_id = $1 AND e.created_at >= $2 AND e.created_at < $3
+		  AND (e.reason IS NOT NULL OR e.action = 'restored')
+		ORDER BY e.created_at, e.id
+	`, userID, rng.Start, rng.End)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pantry events: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []change
+	for rows.Next() {
+		var c change
+		if err := rows.Scan(&c.at, &c.itemID, &c.productName, &c.action, &c.reason,
+			&c.removed, &c.unit, &c.price, &c.envScore, &c.initial); err != nil {
+			return nil, fmt.Errorf("failed to scan pantry event: %w", err)
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// shelved reads the user's items added before the end of rng that are
+// still in the pantry and were never marked expired, with the quantity
+// their added event recorded
+func (r *Repository) shelved(ctx context.Context, userID string, rng Range) ([]shelved, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT p.id, p.quantity, p.unit, p.is_frozen, p.added_at, p.purchased_at, p.expires_at,
+		       p.opened_at, p.shelf_life_days, p.price, f.product_name, f.norm_environmental_score,
+		       f.shelf_life, f.category, a.quantity_after, a.unit
+		FROM pantry_items p
+		JOIN foods f ON f.id = p.food_id
+		LEFT JOIN LATERAL (
+		    SELECT quantity_after, unit FROM pantry_events
+		    WHERE pantry_item_id = p.id AND user_id = p.user_id AND action = 'added'
+		    ORDER BY id LIMIT 1
+		) a ON true
+		WHERE p.user_id = $1 AND p.added_at < $2 AND p.quantity > 0
+		  AND NOT EXISTS (
+		      SELECT 1 FROM pantry_events e
+		      WHERE e.pantry_item_id = p.id AND e.user_id = p.user_id AND e.reason = 'expired'
+		  )
+	`, userID, rng.End)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pantry items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []shelved
+	for rows.Next() {
+		var s shelved
+		var addedQuantity *float64
+		var addedUnit *string
+		p := &s.item
+		if err := rows.Scan(&p.ID, &p.Quantity, &p.Unit, &p.IsFrozen, &p.AddedAt, &p.PurchasedAt, &p.ExpiresAt,
+			&p.OpenedAt, &p.ShelfLifeDays, &p.Price, &p.ProductName, &p.NormEnvironmentalScore,
+			&p.ShelfLife, &p.Category, &addedQuantity, &addedUnit); err != nil {
+			return nil, fmt.Errorf("failed to scan pantry item: %w", err)
+		}
+		// Quantities in events are normalized, so the added one only prices
+		// the item if it is still in the same dimension
+		if addedQuantity != nil && addedUnit != nil &&
+			*addedUnit == string(units.Normalize(units.Quantity{Amount: p.Quantity, Unit: units.Unit(p.Unit)}).Unit) {
+			s.initial = addedQuantity
+		}
+		items = append(items, s)
+	}
+	return items, rows.Err()
+}
+
+// cooks reads the recipes the user cooked from the pantry in rng and did
+// not undo, with the consumed rows' shelf-life details
+func (r *Repository) cooks(ctx context.Context, userID string, rng Range) ([]cook, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT c.created_at, COALESCE(r.source::text, ''), c.items
+		FROM pantry_consumptions c
+		LEFT JOIN recipes r ON r.id = c.recipe_id
+		WHERE c.user_id = $1 AND c.undone_at IS NULL
+		  AND c.created_at >= $2 AND c.created_at < $3
+		ORDER BY c.created_at
+	`, userID, rng.Start, rng.End)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cooked recipes: %w", err)
+	}
+	defer rows.Close()
+
+	var cooks []cook
+	var foodIDs []int64
+	for rows.Next() {
+		var c cook
+		var encoded []byte
+		if err := rows.Scan(&c.at, &c.source, &encoded); err != nil {
+			return nil, fmt.Errorf("failed to scan cooked recipe: %w", err)
+		}
+		var consumed []recipes.ConsumedItem
+		if err := json.Unmarshal(encoded, &consumed); err != nil {
+			return nil, fmt.Errorf("failed to decode consumed items: %w", err)
+		}
+		for _, item := range consumed {
+			c.items = append(c.items, pantry.PantryItemWithFood{
+				ID:            item.PantryItemID,
+				FoodID:        item.FoodID,
+				ProductName:   item.ProductName,
+				IsFrozen:      item.IsFrozen,
+				AddedAt:       item.AddedAt,
+				PurchasedAt:   item.PurchasedAt,
+				ExpiresAt:     item.ExpiresAt,
+				OpenedAt:      item.OpenedAt,
+				ShelfLifeDays: item.ShelfLifeDays,
+			})
+			foodIDs = append(foodIDs, item.FoodID)
+		}
+		cooks = append(cooks, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(foodIDs) == 0 {
+		return cooks, nil
+	}
+
+	// The food's shelf life and category complete each row's expiry
+	type food struct {
+		shelfLife *int
+		category  *string
+	}
+	foods := make(map[int64]food)
+	foodRows, err := r.pool.Query(ctx, `
+		SELECT id, shelf_life, category FROM foods WHERE id = ANY($1)
+	`, foodIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query foods: %w", err)
+	}
+	defer foodRows.Close()
+	for foodRows.Next() {
+		var id int64
+		var f food
+		if err := foodRows.Scan(&id, &f.shelfLife, &f.category); err != nil {
+			return nil, fmt.Errorf("failed to scan food: %w", err)
+		}
+		foods[id] = f
+	}
+	if err := foodRows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, c := range cooks {
+		for i := range c.items {
+			f := foods[c.items[i].FoodID]
+			c.items[i].ShelfLife, c.items[i].Category = f.shelfLife, f.category
+		}
+	}
+	return cooks, nil
+}
@@ -0,0 +1,63 @@
+package insights
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/internal/database"
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+)
+
+// Handler handles the insights endpoints
+type Handler struct {
+	repo *Repository
+	log  *logger.Logger
+}
+
+// NewHandler creates a new insights handler
+func NewHandler(db *database.DB, log *logger.Logger) *Handler {
+	return &Handler{
+		repo: NewRepository(db.Pool),
+		log:  log,
+	}
+}
+
+// writeJSON writes a JSON response
+func (h *Handler) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.log.Error("Failed to encode response: %v", err)
+	}
+}
+
+// writeError writes an error response
+func (h *Handler) writeError(w http.ResponseWriter, status int, message string) {
+	h.writeJSON(w, status, map[string]string{"error": message})
+}
+
+// GetInsights handles GET /users/{user_id}/insights?period=week|month&from=YYYY-MM-DD&to=YYYY-MM-DD
+func (h *Handler) GetInsights(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("user_id")
+	if userID == "" {
+		h.writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	q := r.URL.Query()
+	rng, err := ParseRange(q.Get("period"), q.Get("from"), q.Get("to"), time.Now())
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	insights, err := h.repo.Insights(r.Context(), userID, rng)
+	if err != nil {
+		h.log.Error("Failed to compute insights: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "failed to compute insights")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, insights)
+}
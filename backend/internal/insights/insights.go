@@ -0,0 +1,386 @@
+// Package insights reports how a user's pantry is used over time: what
+// was eaten and what went to waste, the money and CO2 the waste cost, and
+// how many recipes rescued expiring food.
+package insights
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/internal/pantry"
+	"github.com/Jayyk09/CUHackIt/internal/recipes"
+	"github.com/Jayyk09/CUHackIt/internal/units"
+)
+
+// Bucket periods
+const (
+	PeriodWeek  = "week"  // Monday to Sunday, UTC
+	PeriodMonth = "month" // calendar months, UTC
+)
+
+// Range defaults and bounds, in buckets
+const (
+	defaultWeeks  = 12
+	defaultMonths = 6
+	maxWeeks      = 104
+	maxMonths     = 36
+)
+
+// Waste estimates. CO2 per kilogram of food is interpolated geometrically
+// between maxCO2PerKg at an environmental score of 0 and minCO2PerKg at 100,
+// which spans roughly beef to root vegetables; foods without a score count
+// as the middle of the scale. Counted items are assumed to weigh
+// gramsPerItem, and liquids of unknown density a gram per milliliter.
+const (
+	maxCO2PerKg     = 20.0
+	minCO2PerKg     = 0.5
+	defaultEnvScore = 50.0
+	gramsPerItem    = 200.0
+)
+
+// Range is the span insights cover, from Start to End exclusive, both on
+// bucket boundaries
+type Range struct {
+	Period string
+	Start  time.Time
+	End    time.Time
+}
+
+// ParseRange reads a Range from query values: period as week or month
+// (week by default), and from and to as YYYY-MM-DD. The dates are widened
+// to whole buckets; without them the range is the last 12 weeks or 6
+// months, the current one included.
+func ParseRange(period, from, to string, now time.Time) (Range, error) {
+	rng := Range{Period: period}
+	if rng.Period == "" {
+		rng.Period = PeriodWeek
+	}
+	if rng.Period != PeriodWeek && rng.Period != PeriodMonth {
+		return rng, errors.New("period must be week or month")
+	}
+
+	end := now.UTC()
+	if to != "" {
+		day, err := time.Parse(time.DateOnly, to)
+		if err != nil {
+			return rng, errors.New("invalid to date - use YYYY-MM-DD")
+		}
+		end = day
+	}
+	rng.End = rng.next(bucketStart(rng.Period, end))
+
+	if from == "" {
+		n := defaultWeeks
+		if rng.Period == PeriodMonth {
+			n = defaultMonths
+		}
+		rng.Start = rng.End
+		for range n {
+			rng.Start = rng.prev(rng.Start)
+		}
+		return rng, nil
+	}
+	day, err := time.Parse(time.DateOnly, from)
+	if err != nil {
+		return rng, errors.New("invalid from date - use YYYY-MM-DD")
+	}
+	if day.After(end) {
+		return rng, errors.New("from must not be after to")
+	}
+	rng.Start = bucketStart(rng.Period, day)
+
+	limit := maxWeeks
+	if rng.Period == PeriodMonth {
+		limit = maxMonths
+	}
+	if n := len(rng.buckets()); n > limit {
+		return rng, fmt.Errorf("range spans %d %ss, at most %d are allowed", n, rng.Period, limit)
+	}
+	return rng, nil
+}
+
+// bucketStart is the start of the bucket t falls in
+func bucketStart(period string, t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	if period == PeriodMonth {
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	}
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+func (r Range) next(t time.Time) time.Time {
+	if r.Period == PeriodMonth {
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 7)
+}
+
+func (r Range) prev(t time.Time) time.Time {
+	if r.Period == PeriodMonth {
+		return t.AddDate(0, -1, 0)
+	}
+	return t.AddDate(0, 0, -7)
+}
+
+// buckets lists the empty buckets of the range, oldest first
+func (r Range) buckets() []Bucket {
+	var out []Bucket
+	for start := r.Start; start.Before(r.End); start = r.next(start) {
+		out = append(out, Bucket{Start: start, End: r.next(start)})
+	}
+	return out
+}
+
+// Bucket holds a user's metrics for one week or month. Items are counted
+// once per bucket however many times they were touched. Money is in
+// whatever currency prices were entered in, and only covers priced items.
+//
+// An item counts as expired in the bucket it was removed in with reason
+// expired. An item still in the pantry past its computed expiry, and never
+// marked expired, counts as expired in the bucket of its expiry date, with
+// all of its remaining quantity wasted.
+type Bucket struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"` // exclusive
+
+	ItemsConsumed  int `json:"items_consumed"`
+	ItemsExpired   int `json:"items_expired"`
+	ItemsDiscarded int `json:"items_discarded"`
+	ItemsDonated   int `json:"items_donated"`
+
+	// WasteRate is the share of expired and discarded items among those
+	// and the consumed ones; nil when there were none
+	WasteRate *float64 `json:"waste_rate"`
+
+	MoneyConsumed float64 `json:"money_consumed"`
+	MoneyWasted   float64 `json:"money_wasted"`
+	CO2WastedKg   float64 `json:"co2_wasted_kg"` // estimated, in kg CO2e
+
+	RecipesCooked int `json:"recipes_cooked"`
+
+	// RecipesFromExpiring counts cooked recipes that were generated to use
+	// up spoiling food or that used an item expiring within
+	// pantry.ExpiringSoonDays
+	RecipesFromExpiring int `json:"recipes_from_expiring"`
+}
+
+// Insights is GET /users/{user_id}/insights: the range's buckets, oldest
+// first, and totals over all of them
+type Insights struct {
+	UserID  string    `json:"user_id"`
+	Period  string    `json:"period"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"` // exclusive
+	Buckets []Bucket  `json:"buckets"`
+	Totals  Bucket    `json:"totals"`
+}
+
+// change is a pantry event that took food out of the pantry for a reason,
+// or put food back by undoing a cooked recipe
+type change struct {
+	at          time.Time
+	itemID      int
+	productName string
+	action      string
+	reason      string
+	removed     *float64 // quantity taken out, negative when restored; nil if unknown
+	initial     *float64 // the item's quantity when added, or else before the change
+	unit        string
+	price       *float64 // paid for the item as bought
+	envScore    *float64 // the food's norm_environmental_score
+}
+
+// shelved is an item still in the pantry that no event marked expired
+type shelved struct {
+	item    pantry.PantryItemWithFood
+	initial *float64 // the item's normalized quantity when added, if known
+}
+
+// expiredChanges are the changes for shelved items whose computed expiry
+// falls in rng and has passed by now, dated at their expiry
+func expiredChanges(items []shelved, rng Range, now time.Time) []change {
+	var changes []change
+	for _, s := range items {
+		expiry := pantry.ComputeExpiry(&s.item, now)
+		if !expiry.IsExpired || expiry.Date.Before(rng.Start) || !expiry.Date.Before(rng.End) {
+			continue
+		}
+		remaining := units.Normalize(units.Quantity{Amount: s.item.Quantity, Unit: units.Unit(s.item.Unit)})
+		initial := s.initial
+		if initial == nil {
+			initial = &remaining.Amount
+		}
+		changes = append(changes, change{
+			at:          *expiry.Date,
+			itemID:      s.item.ID,
+			productName: s.item.ProductName,
+			reason:      pantry.ReasonExpired,
+			removed:     &remaining.Amount,
+			initial:     initial,
+			unit:        string(remaining.Unit),
+			price:       s.item.Price,
+			envScore:    s.item.NormEnvironmentalScore,
+		})
+	}
+	return changes
+}
+
+// cook is a recipe cooked from the pantry and not undone. items are the
+// consumed rows as they were before cooking.
+type cook struct {
+	at     time.Time
+	source string
+	items  []pantry.PantryItemWithFood
+}
+
+// fromExpiring reports whether the cook rescued food about to go bad
+func (c cook) fromExpiring() bool {
+	if c.source == string(recipes.SourceSpoiling) {
+		return true
+	}
+	for i := range c.items {
+		if pantry.ComputeExpiry(&c.items[i], c.at).IsExpiringSoon {
+			return true
+		}
+	}
+	return false
+}
+
+// value estimates what the quantity a change removed had cost, as its
+// share of the item's price
+func (c change) value() float64 {
+	if c.price == nil || c.removed == nil || c.initial == nil || *c.initial <= 0 {
+		return 0
+	}
+	return *c.price * max(-1, min(1, *c.removed / *c.initial))
+}
+
+// co2Kg estimates the kilograms of CO2e behind the quantity a change removed
+func (c change) co2Kg() float64 {
+	if c.removed == nil || *c.removed <= 0 {
+		return 0
+	}
+	q := units.Quantity{Amount: *c.removed, Unit: units.Unit(c.unit)}
+	var grams float64
+	switch q.Unit.Dimension() {
+	case units.Mass:
+		grams = units.Normalize(q).Amount
+	case units.Volume:
+		if g, err := units.Convert(q, units.Gram, c.productName); err == nil {
+			grams = g.Amount
+		} else {
+			grams = units.Normalize(q).Amount
+		}
+	case units.Count:
+		grams = q.Amount * gramsPerItem
+	}
+	return grams / 1000 * co2PerKg(c.envScore)
+}
+
+// co2PerKg is the estimated kg CO2e per kg of a food with the given
+// environmental score, from 0 (worst) to 100 (best)
+func co2PerKg(score *float64) float64 {
+	s := defaultEnvScore
+	if score != nil {
+		s = max(0, min(100, *score))
+	}
+	return maxCO2PerKg * math.Pow(minCO2PerKg/maxCO2PerKg, s/100)
+}
+
+// tally accumulates one bucket
+type tally struct {
+	bucket *Bucket
+	eaten  map[int]int // net consumed events per item
+	wasted map[string]map[int]bool
+}
+
+func newTally(b *Bucket) *tally {
+	return &tally{bucket: b, eaten: map[int]int{}, wasted: map[string]map[int]bool{}}
+}
+
+func (t *tally) addChange(c change) {
+	b := t.bucket
+	switch {
+	case c.action == pantry.ActionRestored:
+		t.eaten[c.itemID]--
+		b.MoneyConsumed += c.value()
+	case c.reason == pantry.ReasonEaten:
+		t.eaten[c.itemID]++
+		b.MoneyConsumed += c.value()
+	case c.reason == pantry.ReasonExpired || c.reason == pantry.ReasonDiscarded:
+		b.MoneyWasted += c.value()
+		b.CO2WastedKg += c.co2Kg()
+		fallthrough
+	default:
+		if t.wasted[c.reason] == nil {
+			t.wasted[c.reason] = map[int]bool{}
+		}
+		t.wasted[c.reason][c.itemID] = true
+	}
+}
+
+func (t *tally) addCook(c cook) {
+	t.bucket.RecipesCooked++
+	if c.fromExpiring() {
+		t.bucket.RecipesFromExpiring++
+	}
+}
+
+// finish counts the items and rounds the estimates
+func (t *tally) finish() {
+	b := t.bucket
+	for _, n := range t.eaten {
+		if n > 0 {
+			b.ItemsConsumed++
+		}
+	}
+	b.ItemsExpired = len(t.wasted[pantry.ReasonExpired])
+	b.ItemsDiscarded = len(t.wasted[pantry.ReasonDiscarded])
+	b.ItemsDonated = len(t.wasted[pantry.ReasonDonated])
+	if wasted := b.ItemsExpired + b.ItemsDiscarded; wasted+b.ItemsConsumed > 0 {
+		rate := units.Round(float64(wasted) / float64(wasted+b.ItemsConsumed))
+		b.WasteRate = &rate
+	}
+	b.MoneyConsumed = math.Round(b.MoneyConsumed*100) / 100
+	b.MoneyWasted = math.Round(b.MoneyWasted*100) / 100
+	b.CO2WastedKg = units.Round(b.CO2WastedKg)
+}
+
+// build buckets the changes and cooks of a range. Both must fall in it.
+func build(userID string, rng Range, changes []change, cooks []cook) *Insights {
+	in := &Insights{
+		UserID:  userID,
+		Period:  rng.Period,
+		From:    rng.Start,
+		To:      rng.End,
+		Buckets: rng.buckets(),
+		Totals:  Bucket{Start: rng.Start, End: rng.End},
+	}
+	tallies := make(map[time.Time]*tally, len(in.Buckets))
+	for i := range in.Buckets {
+		tallies[in.Buckets[i].Start] = newTally(&in.Buckets[i])
+	}
+	totals := newTally(&in.Totals)
+
+	for _, c := range changes {
+		if t, ok := tallies[bucketStart(rng.Period, c.at)]; ok {
+			t.addChange(c)
+			totals.addChange(c)
+		}
+	}
+	for _, c := range cooks {
+		if t, ok := tallies[bucketStart(rng.Period, c.at)]; ok {
+			t.addCook(c)
+			totals.addCook(c)
+		}
+	}
+
+	for _, t := range tallies {
+		t.finish()
+	}
+	totals.finish()
+	return in
+}
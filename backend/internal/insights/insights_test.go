@@ -0,0 +1,182 @@
+package insights
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/internal/pantry"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return t.Add(12 * time.Hour)
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestParseRange(t *testing.T) {
+	now := day("2026-03-12") // a Thursday
+	tests := []struct {
+		period, from, to string
+		start, end       string
+	}{
+		{"", "", "", "2025-12-22", "2026-03-16"},
+		{"month", "", "", "2025-10-01", "2026-04-01"},
+		{"week", "2026-03-04", "2026-03-09", "2026-03-02", "2026-03-16"},
+		{"month", "2026-01-15", "2026-02-03", "2026-01-01", "2026-03-01"},
+	}
+	for _, tt := range tests {
+		rng, err := ParseRange(tt.period, tt.from, tt.to, now)
+		if err != nil {
+			t.Errorf("ParseRange(%q, %q, %q): %v", tt.period, tt.from, tt.to, err)
+			continue
+		}
+		if got := rng.Start.Format(time.DateOnly); got != tt.start {
+			t.Errorf("ParseRange(%q, %q, %q) start = %s, want %s", tt.period, tt.from, tt.to, got, tt.start)
+		}
+		if got := rng.End.Format(time.DateOnly); got != tt.end {
+			t.Errorf("ParseRange(%q, %q, %q) end = %s, want %s", tt.period, tt.from, tt.to, got, tt.end)
+		}
+	}
+
+	for _, bad := range [][3]string{
+		{"day", "", ""},
+		{"week", "2026-03-10", "2026-03-01"},
+		{"week", "03/01/2026", ""},
+		{"week", "2020-01-01", ""},
+	} {
+		if _, err := ParseRange(bad[0], bad[1], bad[2], now); err == nil {
+			t.Errorf("ParseRange(%q, %q, %q) should fail", bad[0], bad[1], bad[2])
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	rng, err := ParseRange(PeriodWeek, "2026-03-02", "2026-03-15", day("2026-03-16"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := []change{
+		// Milk eaten twice in the first week counts as one item
+		{at: day("2026-03-03"), itemID: 1, productName: "Milk", action: pantry.ActionConsumed, reason: pantry.ReasonEaten,
+			removed: ptr(500.0), initial: ptr(1000.0), unit: "ml", price: ptr(2.0)},
+		{at: day("2026-03-04"), itemID: 1, productName: "Milk", action: pantry.ActionUpdated, reason: pantry.ReasonEaten,
+			removed: ptr(250.0), initial: ptr(1000.0), unit: "ml", price: ptr(2.0)},
+		// A cook undone is not consumption
+		{at: day("2026-03-05"), itemID: 2, action: pantry.ActionConsumed, reason: pantry.ReasonEaten,
+			removed: ptr(200.0), initial: ptr(400.0), unit: "g", price: ptr(4.0)},
+		{at: day("2026-03-05"), itemID: 2, action: pantry.ActionRestored,
+			removed: ptr(-200.0), initial: ptr(400.0), unit: "g", price: ptr(4.0)},
+
+		{at: day("2026-03-10"), itemID: 3, action: pantry.ActionDeleted, reason: pantry.ReasonExpired,
+			removed: ptr(1000.0), initial: ptr(1000.0), unit: "g", price: ptr(5.0), envScore: ptr(100.0)},
+		{at: day("2026-03-11"), itemID: 4, action: pantry.ActionUpdated, reason: pantry.ReasonDiscarded,
+			removed: ptr(2.0), initial: ptr(4.0), unit: "item", price: ptr(3.0)},
+		{at: day("2026-03-12"), itemID: 5, action: pantry.ActionDeleted, reason: pantry.ReasonDonated,
+			removed: ptr(1.0), initial: ptr(1.0), unit: "item"},
+
+		// Outside the range
+		{at: day("2026-03-20"), itemID: 6, action: pantry.ActionDeleted, reason: pantry.ReasonExpired,
+			removed: ptr(1.0), initial: ptr(1.0), unit: "item", price: ptr(9.0)},
+	}
+	cooks := []cook{
+		{at: day("2026-03-03"), source: "spoiling"},
+		{at: day("2026-03-04"), source: "pantry_only", items: []pantry.PantryItemWithFood{
+			{AddedAt: day("2026-03-01"), ExpiresAt: ptr(day("2026-03-06"))},
+		}},
+		{at: day("2026-03-11"), items: []pantry.PantryItemWithFood{
+			{AddedAt: day("2026-03-01"), ShelfLife: ptr(30)},
+		}},
+	}
+
+	in := build("u1", rng, changes, cooks)
+	if len(in.Buckets) != 2 {
+		t.Fatalf("got %d buckets, want 2", len(in.Buckets))
+	}
+
+	first, second := in.Buckets[0], in.Buckets[1]
+	if first.ItemsConsumed != 1 || first.MoneyConsumed != 1.5 || first.ItemsExpired != 0 {
+		t.Errorf("first week: %+v", first)
+	}
+	if first.WasteRate == nil || *first.WasteRate != 0 {
+		t.Errorf("first week waste rate = %v, want 0", first.WasteRate)
+	}
+	if first.RecipesCooked != 2 || first.RecipesFromExpiring != 2 {
+		t.Errorf("first week cooked %d, %d from expiring; want 2 and 2", first.RecipesCooked, first.RecipesFromExpiring)
+	}
+
+	if second.ItemsExpired != 1 || second.ItemsDiscarded != 1 || second.ItemsDonated != 1 || second.ItemsConsumed != 0 {
+		t.Errorf("second week: %+v", second)
+	}
+	if second.MoneyWasted != 6.5 {
+		t.Errorf("second week money wasted = %v, want 6.5", second.MoneyWasted)
+	}
+	// 1 kg at the best score, plus two 200 g items at the default score
+	wantCO2 := 1*minCO2PerKg + 0.4*co2PerKg(nil)
+	if math.Abs(second.CO2WastedKg-wantCO2) > 0.001 {
+		t.Errorf("second week CO2 = %v, want %v", second.CO2WastedKg, wantCO2)
+	}
+	if second.RecipesCooked != 1 || second.RecipesFromExpiring != 0 {
+		t.Errorf("second week cooked %d, %d from expiring; want 1 and 0", second.RecipesCooked, second.RecipesFromExpiring)
+	}
+
+	totals := in.Totals
+	if totals.ItemsConsumed != 1 || totals.ItemsExpired != 1 || totals.RecipesCooked != 3 || totals.MoneyWasted != 6.5 {
+		t.Errorf("totals: %+v", totals)
+	}
+	if totals.WasteRate == nil || *totals.WasteRate != 0.667 {
+		t.Errorf("total waste rate = %v, want 0.667", totals.WasteRate)
+	}
+}
+
+func TestExpiredChanges(t *testing.T) {
+	rng, err := ParseRange(PeriodWeek, "2026-03-02", "2026-03-15", day("2026-03-16"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := day("2026-03-16")
+	items := []shelved{
+		// Printed date in the first week, half of it left
+		{item: pantry.PantryItemWithFood{ID: 1, Quantity: 0.5, Unit: "l", AddedAt: day("2026-02-20"),
+			ExpiresAt: ptr(day("2026-03-04")), Price: ptr(2.0)}, initial: ptr(1000.0)},
+		// Shelf life runs out in the second week
+		{item: pantry.PantryItemWithFood{ID: 2, Quantity: 2, Unit: "item", AddedAt: day("2026-03-01"),
+			ShelfLife: ptr(10)}},
+		// Before the range, not yet expired, and no expiry at all
+		{item: pantry.PantryItemWithFood{ID: 3, Quantity: 1, Unit: "item", ExpiresAt: ptr(day("2026-02-20"))}},
+		{item: pantry.PantryItemWithFood{ID: 4, Quantity: 1, Unit: "item", ExpiresAt: ptr(day("2026-03-20"))}},
+		{item: pantry.PantryItemWithFood{ID: 5, Quantity: 1, Unit: "item"}},
+	}
+
+	changes := expiredChanges(items, rng, now)
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2: %+v", len(changes), changes)
+	}
+	if c := changes[0]; c.itemID != 1 || *c.removed != 500 || c.unit != "ml" || c.value() != 1 {
+		t.Errorf("unexpected first change: %+v", c)
+	}
+	if c := changes[1]; c.itemID != 2 || c.at.Format(time.DateOnly) != "2026-03-11" || *c.initial != 2 {
+		t.Errorf("unexpected second change: %+v", c)
+	}
+
+	in := build("u1", rng, changes, nil)
+	if in.Buckets[0].ItemsExpired != 1 || in.Buckets[1].ItemsExpired != 1 || in.Totals.MoneyWasted != 1 {
+		t.Errorf("expired items were not counted: %+v", in.Buckets)
+	}
+}
+
+func TestCO2PerKg(t *testing.T) {
+	if got := co2PerKg(ptr(0.0)); got != maxCO2PerKg {
+		t.Errorf("co2PerKg(0) = %v, want %v", got, maxCO2PerKg)
+	}
+	if got := co2PerKg(ptr(100.0)); math.Abs(got-minCO2PerKg) > 1e-9 {
+		t.Errorf("co2PerKg(100) = %v, want %v", got, minCO2PerKg)
+	}
+	if a, b := co2PerKg(ptr(30.0)), co2PerKg(ptr(70.0)); a <= b {
+		t.Errorf("a worse score should cost more CO2: %v <= %v", a, b)
+	}
+}
@@ -0,0 +1,16 @@
+package insights
+
+import (
+	"net/http"
+
+	"github.com/Jayyk09/CUHackIt/internal/database"
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+)
+
+// RegisterRoutes registers the insights routes
+func RegisterRoutes(r *http.ServeMux, db *database.DB, log *logger.Logger) {
+	h := NewHandler(db, log)
+
+	// Waste, savings and cooking metrics in weekly or monthly buckets
+	r.HandleFunc("GET /users/{user_id}/insights", h.GetInsights)
+}
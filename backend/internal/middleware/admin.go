@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// RequireAdminToken only lets requests through that carry
+// "Authorization: Bearer <token>". With an empty token the admin API is
+// disabled and every request is refused.
+func RequireAdminToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if token == "" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":"admin API not configured"}`))
+			return
+		}
+
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"admin token required"}`))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/Jayyk09/CUHackIt/config"
+	"github.com/Jayyk09/CUHackIt/internal/quota"
 )
 
 // CORS wraps an http.Handler and adds the necessary CORS headers so the
@@ -29,6 +30,7 @@ func CORS(cfg *config.Config, next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Accept")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(quota.Headers, ", "))
 
 		// Handle preflight.
 		if r.Method == http.MethodOptions {
@@ -0,0 +1,345 @@
+package pantry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/internal/units"
+	"github.com/jackc/pgx/v5"
+)
+
+// maxBulkOperations bounds the operations in one bulk request
+const maxBulkOperations = 500
+
+// Bulk operations
+const (
+	BulkAdd    = "add"
+	BulkUpdate = "update"
+	BulkDelete = "delete"
+)
+
+// Bulk result statuses
+const (
+	BulkOK         = "ok"
+	BulkInvalid    = "invalid"     // failed validation
+	BulkNotFound   = "not_found"   // no such item
+	BulkForbidden  = "forbidden"   // the item belongs to another user
+	BulkConflict   = "conflict"    // the item is no longer at the version sent
+	BulkRolledBack = "rolled_back" // valid, but not applied because another operation failed
+)
+
+// BulkUpdateInput is one item edit in a bulk request
+type BulkUpdateInput struct {
+	ID int `json:"id"`
+	UpdatePantryItemInput
+}
+
+// BulkInput is the input for POST /users/{user_id}/pantry/bulk. All
+// operations are applied or none are, unless Partial is set, in which case
+// the valid ones are applied and the rest reported. Reason is recorded in
+// the history of deletes, and of updates that do not give their own.
+type BulkInput struct {
+	Partial bool                 `json:"partial"`
+	Reason  string               `json:"reason,omitempty"`
+	Add     []NewPantryItemInput `json:"add,omitempty"`
+	Update  []BulkUpdateInput    `json:"update,omitempty"`
+	Delete  []int                `json:"delete,omitempty"` // pantry item ids
+}
+
+// BulkItemResult is the outcome of one operation. Index is the operation's
+// position in its list in the request. Item is the added SimplePantryEntry
+// or the updated PantryItemWithFood.
+type BulkItemResult struct {
+	Op     string `json:"op"`
+	Index  int    `json:"index"`
+	ID     int    `json:"id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Item   any    `json:"item,omitempty"`
+}
+
+// BulkResult reports every operation of a bulk request. Applied is false
+// when nothing was written.
+type BulkResult struct {
+	Partial   bool             `json:"partial"`
+	Applied   bool             `json:"applied"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []BulkItemResult `json:"results"`
+}
+
+func (res *BulkItemResult) fail(status string, err error) {
+	res.Status, res.Error = status, err.Error()
+}
+
+// Bulk adds, updates and deletes many of a user's pantry items in one
+// transaction. The writes go to the database as a single pgx batch; COPY
+// is not used because each added item's id has to be returned.
+func (r *Repository) Bulk(ctx context.Context, userID string, input BulkInput) (*BulkResult, error) {
+	total := len(input.Add) + len(input.Update) + len(input.Delete)
+	if total == 0 {
+		return nil, fmt.Errorf("%w: no operations", ErrInvalidInput)
+	}
+	if total > maxBulkOperations {
+		return nil, fmt.Errorf("%w: at most %d operations are allowed, got %d", ErrInvalidInput, maxBulkOperations, total)
+	}
+	reason, err := ParseReason(input.Reason)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Check the foods of the adds exist and lock the items of the updates
+	// and deletes, then check every operation against them
+	foodIDs := make([]int64, 0, len(input.Add))
+	for _, in := range input.Add {
+		foodIDs = append(foodIDs, in.FoodID)
+	}
+	foods, err := existingFoods(ctx, tx, foodIDs)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(input.Update)+len(input.Delete))
+	for _, in := range input.Update {
+		ids = append(ids, in.ID)
+	}
+	ids = append(ids, input.Delete...)
+	existing, err := lockItems(ctx, tx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := planBulk(userID, input, reason, foods, existing, now)
+	result, results := plan.result, plan.result.Results
+	adds, updates, deletes := plan.adds, plan.updates, plan.deletes
+	if !plan.apply {
+		return result, nil
+	}
+
+	// Queue the writes in request order so results can be read back in it
+	batch := &pgx.Batch{}
+	var order []int
+	for i := range results {
+		if item, ok := adds[i]; ok {
+			batch.Queue(insertItemSQL, item.args(userID)...)
+		} else if u, ok := updates[i]; ok {
+			batch.Queue(updateItemSQL, updateArgs(u.item, u.item.Version, u.event)...)
+		} else if item, ok := deletes[i]; ok {
+			batch.Queue(deleteItemSQL, deleteArgs(item, reason, SourceBulk)...)
+		} else {
+			continue
+		}
+		order = append(order, i)
+	}
+
+	br := tx.SendBatch(ctx, batch)
+	var updated []int
+	for _, i := range order {
+		res := &results[i]
+		if _, ok := adds[i]; ok {
+			entry, err := scanEntry(br.QueryRow())
+			if err != nil {
+				br.Close()
+				return nil, fmt.Errorf("failed to add item %d: %w", res.Index, err)
+			}
+			res.ID, res.Item = entry.ID, entry
+			continue
+		}
+		// The items are locked, so the writes cannot miss
+		if _, err := br.Exec(); err != nil {
+			br.Close()
+			return nil, fmt.Errorf("failed to %s item %d: %w", res.Op, res.ID, err)
+		}
+		if res.Op == BulkUpdate {
+			updated = append(updated, res.ID)
+		}
+	}
+	if err := br.Close(); err != nil {
+		return nil, fmt.Errorf("failed to run bulk batch: %w", err)
+	}
+
+	// Return updated items as stored, with their new versions
+	if len(updated) > 0 {
+		fresh, err := lockItems(ctx, tx, updated)
+		if err != nil {
+			return nil, err
+		}
+		for i := range results {
+			if results[i].Op == BulkUpdate && results[i].Status == BulkOK {
+				results[i].Item = fresh[results[i].ID]
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit bulk operations: %w", err)
+	}
+	result.Applied = true
+	result.Succeeded = len(adds) + len(updates) + len(deletes)
+	return result, nil
+}
+
+// bulkUpdate is a checked item edit and the event recording it
+type bulkUpdate struct {
+	item  *PantryItemWithFood
+	event Event
+}
+
+// bulkPlan is a bulk request checked against the database. The writes of
+// the valid operations are keyed by their position in result.Results, and
+// are made only if apply is set.
+type bulkPlan struct {
+	result  *BulkResult
+	apply   bool
+	adds    map[int]newItem
+	updates map[int]bulkUpdate
+	deletes map[int]*PantryItemWithFood
+}
+
+// planBulk checks every operation of a bulk request, given which of the
+// added foods exist and the locked items to update or delete. When the
+// valid operations should not be written, because there are none or
+// another failed outside a partial request, they are reported as rolled
+// back.
+func planBulk(userID string, input BulkInput, reason string, foods map[int64]bool, existing map[int]*PantryItemWithFood, now time.Time) *bulkPlan {
+	results := make([]BulkItemResult, 0, len(input.Add)+len(input.Update)+len(input.Delete))
+	plan := &bulkPlan{
+		adds:    make(map[int]newItem, len(input.Add)),
+		updates: make(map[int]bulkUpdate, len(input.Update)),
+		deletes: make(map[int]*PantryItemWithFood, len(input.Delete)),
+	}
+
+	for i, in := range input.Add {
+		res := BulkItemResult{Op: BulkAdd, Index: i, Status: BulkOK}
+		if item, err := in.validate(now); err != nil {
+			res.fail(BulkInvalid, err)
+		} else if !foods[item.foodID] {
+			res.fail(BulkInvalid, fmt.Errorf("%w: food %d does not exist", ErrInvalidInput, item.foodID))
+		} else {
+			item.source = SourceBulk
+			plan.adds[len(results)] = item
+		}
+		results = append(results, res)
+	}
+
+	seen := make(map[int]bool, len(input.Update)+len(input.Delete))
+	target := func(res *BulkItemResult, id int) *PantryItemWithFood {
+		item, ok := existing[id]
+		switch {
+		case seen[id]:
+			res.fail(BulkInvalid, fmt.Errorf("%w: item %d appears in more than one operation", ErrInvalidInput, id))
+		case !ok:
+			res.fail(BulkNotFound, ErrItemNotFound)
+		case item.UserID != userID:
+			res.fail(BulkForbidden, ErrUnauthorized)
+		}
+		seen[id] = true
+		if res.Status != BulkOK {
+			return nil
+		}
+		return item
+	}
+
+	for i, in := range input.Update {
+		res := BulkItemResult{Op: BulkUpdate, Index: i, ID: in.ID, Status: BulkOK}
+		if item := target(&res, in.ID); item != nil {
+			before := units.Quantity{Amount: item.Quantity, Unit: units.Unit(item.Unit)}
+			switch {
+			case in.Version <= 0:
+				res.fail(BulkInvalid, fmt.Errorf("%w: version is required", ErrInvalidInput))
+			case item.Version != in.Version:
+				res.fail(BulkConflict, ErrConflict)
+			default:
+				if err := in.apply(item, now); err != nil {
+					res.fail(BulkInvalid, err)
+				} else {
+					itemReason, _ := ParseReason(in.Reason) // validated by apply
+					if itemReason == "" {
+						itemReason = reason
+					}
+					plan.updates[len(results)] = bulkUpdate{item, updateEvent(before, item, itemReason, SourceBulk)}
+				}
+			}
+		}
+		results = append(results, res)
+	}
+
+	for i, id := range input.Delete {
+		res := BulkItemResult{Op: BulkDelete, Index: i, ID: id, Status: BulkOK}
+		if item := target(&res, id); item != nil {
+			plan.deletes[len(results)] = item
+		}
+		results = append(results, res)
+	}
+
+	plan.result = &BulkResult{Partial: input.Partial, Results: results}
+	for _, res := range results {
+		if res.Status != BulkOK {
+			plan.result.Failed++
+		}
+	}
+	valid := len(plan.adds) + len(plan.updates) + len(plan.deletes)
+	if valid == 0 || (plan.result.Failed > 0 && !input.Partial) {
+		for i := range results {
+			if results[i].Status == BulkOK {
+				results[i].Status = BulkRolledBack
+			}
+		}
+		return plan
+	}
+	plan.apply = true
+	return plan
+}
+
+// lockItems reads and locks pantry items by id
+func lockItems(ctx context.Context, tx pgx.Tx, ids []int) (map[int]*PantryItemWithFood, error) {
+	items := make(map[int]*PantryItemWithFood, len(ids))
+	if len(ids) == 0 {
+		return items, nil
+	}
+	rows, err := tx.Query(ctx, `
+		SELECT `+pantryJoinSelect+`
+		FROM pantry_items p
+		JOIN foods f ON f.id = p.food_id
+		WHERE p.id = ANY($1)
+		FOR UPDATE OF p
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock pantry items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanPantryItemWithFood(rows)
+		if err != nil {
+			return nil, err
+		}
+		items[item.ID] = item
+	}
+	return items, rows.Err()
+}
+
+// existingFoods reports which of the food ids exist
+func existingFoods(ctx context.Context, q querier, ids []int64) (map[int64]bool, error) {
+	exists := make(map[int64]bool, len(ids))
+	if len(ids) == 0 {
+		return exists, nil
+	}
+	var found []int64
+	if err := q.QueryRow(ctx, `
+		SELECT COALESCE(array_agg(id), '{}') FROM foods WHERE id = ANY($1)
+	`, ids).Scan(&found); err != nil {
+		return nil, fmt.Errorf("failed to check foods: %w", err)
+	}
+	for _, id := range found {
+		exists[id] = true
+	}
+	return exists, nil
+}
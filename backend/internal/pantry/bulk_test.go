@@ -0,0 +1,112 @@
+package pantry
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPlanBulk(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	foods := map[int64]bool{10: true, 20: true}
+	qty := 0.5
+	locked := func() map[int]*PantryItemWithFood {
+		return map[int]*PantryItemWithFood{
+			1: {ID: 1, UserID: "u1", FoodID: 10, ProductName: "Milk", Quantity: 1, Unit: "l", Version: 3},
+			2: {ID: 2, UserID: "u1", FoodID: 20, ProductName: "Eggs", Quantity: 12, Unit: "item", Version: 1},
+			3: {ID: 3, UserID: "u2", FoodID: 10, ProductName: "Milk", Quantity: 1, Unit: "l", Version: 1},
+		}
+	}
+	update := func(id, version int) BulkUpdateInput {
+		return BulkUpdateInput{ID: id, UpdatePantryItemInput: UpdatePantryItemInput{Version: version, Quantity: &qty}}
+	}
+
+	tests := []struct {
+		name  string
+		input BulkInput
+		want  []string // statuses in request order
+		apply bool
+	}{
+		{
+			name: "all valid",
+			input: BulkInput{
+				Add:    []NewPantryItemInput{{FoodID: 10, Quantity: 2}},
+				Update: []BulkUpdateInput{update(1, 3)},
+				Delete: []int{2},
+			},
+			want:  []string{BulkOK, BulkOK, BulkOK},
+			apply: true,
+		},
+		{
+			name: "one failure rolls back the rest",
+			input: BulkInput{
+				Add:    []NewPantryItemInput{{FoodID: 99}, {FoodID: 20}},
+				Delete: []int{2},
+			},
+			want: []string{BulkInvalid, BulkRolledBack, BulkRolledBack},
+		},
+		{
+			name: "partial applies the valid ones",
+			input: BulkInput{
+				Partial: true,
+				Add:     []NewPantryItemInput{{FoodID: 99}, {FoodID: 20}},
+				Delete:  []int{2},
+			},
+			want:  []string{BulkInvalid, BulkOK, BulkOK},
+			apply: true,
+		},
+		{
+			name: "stale version conflicts",
+			input: BulkInput{
+				Partial: true,
+				Update:  []BulkUpdateInput{update(1, 2), update(2, 0)},
+			},
+			want: []string{BulkConflict, BulkInvalid},
+		},
+		{
+			name: "other user's and missing items",
+			input: BulkInput{
+				Partial: true,
+				Update:  []BulkUpdateInput{update(3, 1)},
+				Delete:  []int{4, 2},
+			},
+			want:  []string{BulkForbidden, BulkNotFound, BulkOK},
+			apply: true,
+		},
+		{
+			name: "same item updated and deleted",
+			input: BulkInput{
+				Update: []BulkUpdateInput{update(1, 3)},
+				Delete: []int{1},
+			},
+			want: []string{BulkRolledBack, BulkInvalid},
+		},
+	}
+	for _, tt := range tests {
+		plan := planBulk("u1", tt.input, "", foods, locked(), now)
+		var got []string
+		ok, failed := 0, 0
+		for _, res := range plan.result.Results {
+			got = append(got, res.Status)
+			switch res.Status {
+			case BulkOK:
+				ok++
+			case BulkRolledBack:
+			default:
+				failed++
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: statuses = %v, want %v", tt.name, got, tt.want)
+		}
+		if plan.apply != tt.apply {
+			t.Errorf("%s: apply = %v, want %v", tt.name, plan.apply, tt.apply)
+		}
+		if plan.result.Failed != failed {
+			t.Errorf("%s: failed = %d, want %d", tt.name, plan.result.Failed, failed)
+		}
+		if n := len(plan.adds) + len(plan.updates) + len(plan.deletes); plan.apply && n != ok {
+			t.Errorf("%s: %d writes planned for %d ok operations", tt.name, n, ok)
+		}
+	}
+}
@@ -3,8 +3,11 @@ package pantry
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/Jayyk09/CUHackIt/internal/units"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -14,6 +17,7 @@ var (
 	ErrInvalidInput = errors.New("invalid input")
 	ErrUnauthorized = errors.New("unauthorized to access this item")
 	ErrUserNotFound = errors.New("user not found")
+	ErrConflict     = errors.New("pantry item was changed by someone else")
 )
 
 // PantryItemWithFood represents a pantry_items row joined with the foods table.
@@ -23,10 +27,30 @@ type PantryItemWithFood struct {
 	ID       int       `json:"id"`
 	UserID   string    `json:"user_id"`
 	FoodID   int64     `json:"food_id"`
-	Quantity int       `json:"quantity"`
+	Quantity float64   `json:"quantity"`
+	Unit     string    `json:"unit"`
 	IsFrozen bool      `json:"is_frozen"`
 	AddedAt  time.Time `json:"added_at"`
 
+	PurchasedAt   *time.Time `json:"purchased_at,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"` // printed best-by date
+	OpenedAt      *time.Time `json:"opened_at,omitempty"`
+	ShelfLifeDays *int       `json:"shelf_life_days,omitempty"` // overrides the food's shelf_life
+	Price         *float64   `json:"price,omitempty"`           // paid for the item as bought
+
+	Notes    *string `json:"notes,omitempty"`
+	Location *string `json:"location,omitempty"` // pantry, fridge, freezer or counter
+
+	// Version increases on every update; PATCH requests must send it back
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Normalized is Quantity in grams, milliliters or items
+	Normalized units.Quantity `json:"normalized"`
+
+	// Expiry is computed from the dates above and the food's shelf life
+	Expiry Expiry `json:"expiry"`
+
 	// foods columns (joined)
 	ProductName            string   `json:"product_name"`
 	EnvironmentalScore     *float64 `json:"environmental_score,omitempty"`
@@ -42,12 +66,178 @@ type PantryItemWithFood struct {
 	Category               *string  `json:"category,omitempty"`
 }
 
+// NewPantryItemInput describes a pantry item to add
+type NewPantryItemInput struct {
+	FoodID   int64   `json:"food_id"`
+	Quantity float64 `json:"quantity"`
+	Unit     string  `json:"unit"` // any spelling units.ParseUnit accepts; empty means items
+	IsFrozen bool    `json:"is_frozen"`
+
+	// Dates are YYYY-MM-DD. PurchasedAt defaults to today.
+	PurchasedAt   string `json:"purchased_at,omitempty"`
+	ExpiresAt     string `json:"expires_at,omitempty"`
+	OpenedAt      string `json:"opened_at,omitempty"`
+	ShelfLifeDays *int   `json:"shelf_life_days,omitempty"`
+}
+
+// validate checks the input and returns the item to insert
+func (in NewPantryItemInput) validate(now time.Time) (newItem, error) {
+	if in.FoodID <= 0 {
+		return newItem{}, fmt.Errorf("%w: food_id is required", ErrInvalidInput)
+	}
+	if in.Quantity <= 0 {
+		in.Quantity = 1
+	}
+	quantity, err := units.New(in.Quantity, in.Unit)
+	if err != nil {
+		return newItem{}, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	dates, err := parseItemDates(in.PurchasedAt, in.ExpiresAt, in.OpenedAt, in.ShelfLifeDays, now)
+	if err != nil {
+		return newItem{}, err
+	}
+	return newItem{
+		foodID:        in.FoodID,
+		quantity:      quantity,
+		isFrozen:      in.IsFrozen,
+		dates:         dates,
+		shelfLifeDays: in.ShelfLifeDays,
+	}, nil
+}
+
 // AddToPantryInput is the input for the POST /pantry endpoint
 type AddToPantryInput struct {
-	Auth0ID  string `json:"auth0_id"`
-	FoodID   int64  `json:"food_id"`
-	Quantity int    `json:"quantity"`
-	IsFrozen bool   `json:"is_frozen"`
+	Auth0ID string `json:"auth0_id"`
+	NewPantryItemInput
+}
+
+// UpdatePantryItemInput is the input for PATCH /users/{user_id}/pantry/{id}.
+// Only the fields given change. An empty string clears expires_at,
+// opened_at, notes and location, and a shelf_life_days of 0 clears the
+// override. Version must be the item's current version.
+type UpdatePantryItemInput struct {
+	Version       int      `json:"version"`
+	Reason        string   `json:"reason,omitempty"` // why the quantity went down: eaten, discarded, expired or donated
+	Quantity      *float64 `json:"quantity,omitempty"`
+	Unit          *string  `json:"unit,omitempty"` // without quantity, the current quantity is converted
+	IsFrozen      *bool    `json:"is_frozen,omitempty"`
+	PurchasedAt   *string  `json:"purchased_at,omitempty"`
+	ExpiresAt     *string  `json:"expires_at,omitempty"`
+	OpenedAt      *string  `json:"opened_at,omitempty"`
+	ShelfLifeDays *int     `json:"shelf_life_days,omitempty"`
+	Notes         *string  `json:"notes,omitempty"`
+	Location      *string  `json:"location,omitempty"`
+}
+
+// maxNotesLength bounds a pantry item's notes
+const maxNotesLength = 1000
+
+// locations are where a pantry item can be kept
+var locations = map[string]bool{"pantry": true, "fridge": true, "freezer": true, "counter": true}
+
+// empty reports whether the input changes nothing
+func (in UpdatePantryItemInput) empty() bool {
+	return in.Quantity == nil && in.Unit == nil && in.IsFrozen == nil &&
+		in.PurchasedAt == nil && in.ExpiresAt == nil && in.OpenedAt == nil &&
+		in.ShelfLifeDays == nil && in.Notes == nil && in.Location == nil
+}
+
+// apply validates the input and applies it to item
+func (in UpdatePantryItemInput) apply(item *PantryItemWithFood, now time.Time) error {
+	if in.empty() {
+		return fmt.Errorf("%w: nothing to update", ErrInvalidInput)
+	}
+	if _, err := ParseReason(in.Reason); err != nil {
+		return err
+	}
+
+	if in.Quantity != nil || in.Unit != nil {
+		amount, unit := item.Quantity, item.Unit
+		if in.Unit != nil {
+			u, err := units.ParseUnit(*in.Unit)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+			}
+			if in.Quantity == nil && string(u) != item.Unit {
+				converted, err := units.Convert(units.Quantity{Amount: item.Quantity, Unit: units.Unit(item.Unit)}, u, item.ProductName)
+				if err != nil {
+					return fmt.Errorf("%w: cannot express %s %s in %s: %v", ErrInvalidInput, units.FormatAmount(item.Quantity), item.Unit, u, err)
+				}
+				amount = converted.Amount
+			}
+			unit = string(u)
+		}
+		if in.Quantity != nil {
+			amount = *in.Quantity
+		}
+		quantity, err := units.New(amount, unit)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+		item.Quantity, item.Unit = quantity.Amount, string(quantity.Unit)
+	}
+
+	if in.IsFrozen != nil {
+		item.IsFrozen = *in.IsFrozen
+	}
+
+	dates := itemDates{purchasedAt: item.PurchasedAt, expiresAt: item.ExpiresAt, openedAt: item.OpenedAt}
+	var err error
+	if in.PurchasedAt != nil {
+		if *in.PurchasedAt == "" {
+			return fmt.Errorf("%w: purchased_at cannot be cleared", ErrInvalidInput)
+		}
+		if dates.purchasedAt, err = parseDate("purchased_at", *in.PurchasedAt); err != nil {
+			return err
+		}
+	}
+	if in.ExpiresAt != nil {
+		if dates.expiresAt, err = parseDate("expires_at", *in.ExpiresAt); err != nil {
+			return err
+		}
+	}
+	if in.OpenedAt != nil {
+		if dates.openedAt, err = parseDate("opened_at", *in.OpenedAt); err != nil {
+			return err
+		}
+	}
+	shelfLifeDays := item.ShelfLifeDays
+	if in.ShelfLifeDays != nil {
+		shelfLifeDays = in.ShelfLifeDays
+		if *in.ShelfLifeDays == 0 {
+			shelfLifeDays = nil
+		}
+	}
+	if err := dates.validate(shelfLifeDays, now); err != nil {
+		return err
+	}
+	item.PurchasedAt, item.ExpiresAt, item.OpenedAt = dates.purchasedAt, dates.expiresAt, dates.openedAt
+	item.ShelfLifeDays = shelfLifeDays
+
+	if in.Notes != nil {
+		notes := strings.TrimSpace(*in.Notes)
+		if len(notes) > maxNotesLength {
+			return fmt.Errorf("%w: notes must be at most %d characters", ErrInvalidInput, maxNotesLength)
+		}
+		item.Notes = &notes
+		if notes == "" {
+			item.Notes = nil
+		}
+	}
+
+	if in.Location != nil {
+		location := strings.ToLower(strings.TrimSpace(*in.Location))
+		item.Location = nil
+		if location != "" {
+			if !locations[location] {
+				return fmt.Errorf("%w: location must be pantry, fridge, freezer or counter", ErrInvalidInput)
+			}
+			item.Location = &location
+		}
+	}
+
+	item.Normalized = normalize(item.Quantity, item.Unit)
+	return nil
 }
 
 // SimplePantryEntry represents a raw row in the pantry_items table (no join)
@@ -55,9 +245,97 @@ type SimplePantryEntry struct {
 	ID       int       `json:"id"`
 	UserID   string    `json:"user_id"`
 	FoodID   int64     `json:"food_id"`
-	Quantity int       `json:"quantity"`
+	Quantity float64   `json:"quantity"`
+	Unit     string    `json:"unit"`
 	IsFrozen bool      `json:"is_frozen"`
 	AddedAt  time.Time `json:"added_at"`
+
+	PurchasedAt   *time.Time `json:"purchased_at,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	OpenedAt      *time.Time `json:"opened_at,omitempty"`
+	ShelfLifeDays *int       `json:"shelf_life_days,omitempty"`
+	Price         *float64   `json:"price,omitempty"` // paid for the item as bought
+
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Normalized is Quantity in grams, milliliters or items
+	Normalized units.Quantity `json:"normalized"`
+}
+
+// normalize expresses a stored quantity in its dimension's base unit
+func normalize(quantity float64, unit string) units.Quantity {
+	return units.Normalize(units.Quantity{Amount: quantity, Unit: units.Unit(unit)})
+}
+
+// dateLayout is how pantry dates are written in requests
+const dateLayout = "2006-01-02"
+
+// parseDate reads an optional YYYY-MM-DD date
+func parseDate(field, s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be a YYYY-MM-DD date", ErrInvalidInput, field)
+	}
+	return &t, nil
+}
+
+// itemDates are the validated dates of a pantry item
+type itemDates struct {
+	purchasedAt, expiresAt, openedAt *time.Time
+}
+
+// parseItemDates reads and validates the dates given for a new pantry item
+func parseItemDates(purchased, expires, opened string, shelfLifeDays *int, now time.Time) (itemDates, error) {
+	var d itemDates
+	var err error
+	if d.purchasedAt, err = parseDate("purchased_at", purchased); err != nil {
+		return d, err
+	}
+	if d.expiresAt, err = parseDate("expires_at", expires); err != nil {
+		return d, err
+	}
+	if d.openedAt, err = parseDate("opened_at", opened); err != nil {
+		return d, err
+	}
+	return d, d.validate(shelfLifeDays, now)
+}
+
+// validate checks a pantry item's dates fit together: none may be in the
+// future except the expiry date, and neither the expiry nor the opened date
+// may come before the purchase date. "The future" starts the day after
+// tomorrow in UTC, since a client east of UTC may already be on tomorrow.
+func (d itemDates) validate(shelfLifeDays *int, now time.Time) error {
+	if shelfLifeDays != nil && *shelfLifeDays <= 0 {
+		return fmt.Errorf("%w: shelf_life_days must be positive", ErrInvalidInput)
+	}
+
+	latest := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	if d.purchasedAt != nil && d.purchasedAt.After(latest) {
+		return fmt.Errorf("%w: purchased_at is in the future", ErrInvalidInput)
+	}
+	if d.openedAt != nil && d.openedAt.After(latest) {
+		return fmt.Errorf("%w: opened_at is in the future", ErrInvalidInput)
+	}
+	if d.purchasedAt != nil {
+		if d.expiresAt != nil && d.expiresAt.Before(*d.purchasedAt) {
+			return fmt.Errorf("%w: expires_at is before purchased_at", ErrInvalidInput)
+		}
+		if d.openedAt != nil && d.openedAt.Before(*d.purchasedAt) {
+			return fmt.Errorf("%w: opened_at is before purchased_at", ErrInvalidInput)
+		}
+	}
+	return nil
+}
+
+// ProductAllergens is what the foods table declares about a product's allergens
+type ProductAllergens struct {
+	ProductName string
+	AllergensEn []string
+	TracesEn    []string
 }
 
 // Repository handles database operations for pantry items
@@ -72,7 +350,9 @@ func NewRepository(pool *pgxpool.Pool) *Repository {
 
 // columns selected for the joined query
 const pantryJoinSelect = `
-	p.id, p.user_id, p.food_id, p.quantity, p.is_frozen, p.added_at,
+	p.id, p.user_id, p.food_id, p.quantity, p.unit, p.is_frozen, p.added_at,
+	p.purchased_at, p.expires_at, p.opened_at, p.shelf_life_days, p.price,
+	p.notes, p.location, p.version, p.updated_at,
 	f.product_name,
 	f.environmental_score,
 	f.nutriscore_score,
@@ -91,7 +371,9 @@ const pantryJoinSelect = `
 func scanPantryItemWithFood(scanner interface{ Scan(dest ...any) error }) (*PantryItemWithFood, error) {
 	var item PantryItemWithFood
 	err := scanner.Scan(
-		&item.ID, &item.UserID, &item.FoodID, &item.Quantity, &item.IsFrozen, &item.AddedAt,
+		&item.ID, &item.UserID, &item.FoodID, &item.Quantity, &item.Unit, &item.IsFrozen, &item.AddedAt,
+		&item.PurchasedAt, &item.ExpiresAt, &item.OpenedAt, &item.ShelfLifeDays, &item.Price,
+		&item.Notes, &item.Location, &item.Version, &item.UpdatedAt,
 		&item.ProductName,
 		&item.EnvironmentalScore,
 		&item.NutriscoreScore,
@@ -105,6 +387,8 @@ func scanPantryItemWithFood(scanner interface{ Scan(dest ...any) error }) (*Pant
 		&item.ShelfLife,
 		&item.Category,
 	)
+	item.Normalized = normalize(item.Quantity, item.Unit)
+	item.Expiry = ComputeExpiry(&item, time.Now())
 	return &item, err
 }
 
@@ -212,13 +496,15 @@ func (r *Repository) AddToPantry(ctx context.Context, input AddToPantryInput) (*
 		return nil, ErrInvalidInput
 	}
 
-	if input.Quantity <= 0 {
-		input.Quantity = 1
+	item, err := input.validate(time.Now())
+	if err != nil {
+		return nil, err
 	}
+	item.source = SourceManual
 
 	// Look up user_id from auth0_id
 	var userID string
-	err := r.pool.QueryRow(ctx, `SELECT id FROM users WHERE auth0_id = $1`, input.Auth0ID).Scan(&userID)
+	err = r.pool.QueryRow(ctx, `SELECT id FROM users WHERE auth0_id = $1`, input.Auth0ID).Scan(&userID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrUserNotFound
@@ -226,25 +512,193 @@ func (r *Repository) AddToPantry(ctx context.Context, input AddToPantryInput) (*
 		return nil, err
 	}
 
-	// Insert into pantry table
+	return insertItem(ctx, r.pool, userID, item)
+}
+
+// querier is satisfied by both the pool and a transaction
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// newItem is a validated pantry item to insert. source is recorded in
+// its added event.
+type newItem struct {
+	foodID        int64
+	quantity      units.Quantity
+	isFrozen      bool
+	dates         itemDates
+	shelfLifeDays *int
+	price         *float64
+	source        string
+}
+
+// insertItemSQL inserts a newItem and its added event, taking newItem.args
+const insertItemSQL = `
+	WITH item AS (
+		INSERT INTO pantry_items (user_id, food_id, quantity, unit, is_frozen, purchased_at, expires_at, opened_at, shelf_life_days, price)
+		VALUES ($1, $2, $3, $4, $5, COALESCE($6, CURRENT_DATE), $7, $8, $9, $10)
+		RETURNING id, user_id, food_id, quantity, unit, is_frozen, added_at,
+		          purchased_at, expires_at, opened_at, shelf_life_days, price, version, updated_at
+	), event AS (
+		INSERT INTO pantry_events (user_id, pantry_item_id, food_id, action, reason, quantity_before, quantity_after, unit, price, source)
+		SELECT user_id, id, food_id, 'added', $11, $12, $13, $14, price, $15 FROM item
+	)
+	SELECT * FROM item
+`
+
+func (item newItem) args(userID string) []any {
+	event := NewEvent(ActionAdded, units.Quantity{Unit: item.quantity.Unit}, item.quantity, "")
+	event.Source = item.source
+	return append([]any{userID, item.foodID, item.quantity.Amount, string(item.quantity.Unit), item.isFrozen,
+		item.dates.purchasedAt, item.dates.expiresAt, item.dates.openedAt, item.shelfLifeDays, item.price},
+		event.changeArgs()...)
+}
+
+// scanEntry scans the row returned by insertItemSQL
+func scanEntry(row pgx.Row) (*SimplePantryEntry, error) {
 	var entry SimplePantryEntry
-	err = r.pool.QueryRow(ctx, `
-		INSERT INTO pantry_items (user_id, food_id, quantity, is_frozen)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, user_id, food_id, quantity, is_frozen, added_at
-	`, userID, input.FoodID, input.Quantity, input.IsFrozen).Scan(
-		&entry.ID, &entry.UserID, &entry.FoodID, &entry.Quantity, &entry.IsFrozen, &entry.AddedAt,
+	err := row.Scan(
+		&entry.ID, &entry.UserID, &entry.FoodID, &entry.Quantity, &entry.Unit, &entry.IsFrozen, &entry.AddedAt,
+		&entry.PurchasedAt, &entry.ExpiresAt, &entry.OpenedAt, &entry.ShelfLifeDays, &entry.Price, &entry.Version, &entry.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
+	entry.Normalized = normalize(entry.Quantity, entry.Unit)
 
 	return &entry, nil
 }
 
-// Delete removes a pantry item by its id.
-func (r *Repository) Delete(ctx context.Context, id int) error {
-	result, err := r.pool.Exec(ctx, `DELETE FROM pantry_items WHERE id = $1`, id)
+// insertItem inserts a validated pantry item
+func insertItem(ctx context.Context, q querier, userID string, item newItem) (*SimplePantryEntry, error) {
+	return scanEntry(q.QueryRow(ctx, insertItemSQL, item.args(userID)...))
+}
+
+// Update applies a partial edit to a user's pantry item. The edit only
+// succeeds if the item is still at input.Version; otherwise ErrConflict is
+// returned with the item as it is now.
+func (r *Repository) Update(ctx context.Context, id int, userID string, input UpdatePantryItemInput) (*PantryItemWithFood, error) {
+	if input.Version <= 0 {
+		return nil, fmt.Errorf("%w: version is required", ErrInvalidInput)
+	}
+
+	item, err := r.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if item.UserID != userID {
+		return nil, ErrUnauthorized
+	}
+	if item.Version != input.Version {
+		return item, ErrConflict
+	}
+	before := units.Quantity{Amount: item.Quantity, Unit: units.Unit(item.Unit)}
+	if err := input.apply(item, time.Now()); err != nil {
+		return nil, err
+	}
+
+	// Triggers on pantry_items bump version and updated_at
+	reason, _ := ParseReason(input.Reason) // validated by apply
+	event := updateEvent(before, item, reason, SourceManual)
+	result, err := r.pool.Exec(ctx, updateItemSQL, updateArgs(item, input.Version, event)...)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := r.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected() == 0 {
+		// Changed between the read and the write
+		return current, ErrConflict
+	}
+	return current, nil
+}
+
+// updateItemSQL writes an edited item back, if it is still at the version
+// read, and records its updated event. It takes updateArgs.
+const updateItemSQL = `
+	WITH item AS (
+		UPDATE pantry_items
+		SET quantity = $3,
+		    unit = $4,
+		    is_frozen = $5,
+		    purchased_at = $6,
+		    expires_at = $7,
+		    opened_at = $8,
+		    shelf_life_days = $9,
+		    notes = $10,
+		    location = $11
+		WHERE id = $1 AND version = $2
+		RETURNING id, user_id, food_id, price
+	)
+	INSERT INTO pantry_events (user_id, pantry_item_id, food_id, action, reason, quantity_before, quantity_after, unit, price, source)
+	SELECT user_id, id, food_id, 'updated', $12, $13, $14, $15, price, $16 FROM item
+`
+
+func updateArgs(item *PantryItemWithFood, version int, event Event) []any {
+	return append([]any{item.ID, version, item.Quantity, item.Unit, item.IsFrozen,
+		item.PurchasedAt, item.ExpiresAt, item.OpenedAt, item.ShelfLifeDays, item.Notes, item.Location},
+		event.changeArgs()...)
+}
+
+// updateEvent is the event for editing an item that had quantity before
+func updateEvent(before units.Quantity, item *PantryItemWithFood, reason, source string) Event {
+	event := NewEvent(ActionUpdated, before, units.Quantity{Amount: item.Quantity, Unit: units.Unit(item.Unit)}, item.ProductName)
+	event.Reason, event.Source = reason, source
+	return event
+}
+
+// deleteItemSQL deletes a user's item and records its deleted event,
+// taking deleteArgs
+const deleteItemSQL = `
+	WITH item AS (
+		DELETE FROM pantry_items WHERE id = $1 AND user_id = $2
+		RETURNING id, user_id, food_id, price
+	)
+	INSERT INTO pantry_events (user_id, pantry_item_id, food_id, action, reason, quantity_before, quantity_after, unit, price, source)
+	SELECT user_id, id, food_id, 'deleted', $3, $4, $5, $6, price, $7 FROM item
+`
+
+func deleteArgs(item *PantryItemWithFood, reason, source string) []any {
+	event := NewEvent(ActionDeleted, units.Quantity{Amount: item.Quantity, Unit: units.Unit(item.Unit)}, units.Quantity{}, item.ProductName)
+	event.Reason, event.Source = reason, source
+	return append([]any{item.ID, item.UserID}, event.changeArgs()...)
+}
+
+// GetUserAllergens returns the allergens on a user's profile.
+func (r *Repository) GetUserAllergens(ctx context.Context, userID string) ([]string, error) {
+	var allergens []string
+	err := r.pool.QueryRow(ctx, `SELECT allergens FROM users WHERE id = $1`, userID).Scan(&allergens)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return allergens, nil
+}
+
+// GetProductAllergens returns a food's name, declared allergens and traces.
+func (r *Repository) GetProductAllergens(ctx context.Context, foodID int64) (*ProductAllergens, error) {
+	var p ProductAllergens
+	err := r.pool.QueryRow(ctx, `
+		SELECT product_name, allergens_en, traces_en FROM foods WHERE id = $1
+	`, foodID).Scan(&p.ProductName, &p.AllergensEn, &p.TracesEn)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrItemNotFound
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Delete removes a user's pantry item, recording why in its history. The
+// reason may be empty.
+func (r *Repository) Delete(ctx context.Context, item *PantryItemWithFood, reason string) error {
+	result, err := r.pool.Exec(ctx, deleteItemSQL, deleteArgs(item, reason, SourceManual)...)
 	if err != nil {
 		return err
 	}
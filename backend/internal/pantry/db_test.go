@@ -0,0 +1,86 @@
+package pantry
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUpdateInputApply(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	purchased := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	str := func(s string) *string { return &s }
+	intp := func(v int) *int { return &v }
+	base := func() PantryItemWithFood {
+		return PantryItemWithFood{
+			ProductName: "Whole Milk", Quantity: 1, Unit: "l",
+			PurchasedAt: &purchased, ShelfLifeDays: intp(9), Notes: str("top shelf"),
+		}
+	}
+
+	item := base()
+	qty := 500.0
+	err := UpdatePantryItemInput{Quantity: &qty, Unit: str("mL"), ExpiresAt: str("2026-03-20"), Location: str("Fridge")}.apply(&item, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Quantity != 500 || item.Unit != "ml" || item.ExpiresAt == nil || *item.Location != "fridge" || *item.Notes != "top shelf" {
+		t.Errorf("unexpected item after update: %+v", item)
+	}
+
+	item = base()
+	if err := (UpdatePantryItemInput{Unit: str("cups")}).apply(&item, now); err != nil || item.Quantity != 4.227 {
+		t.Errorf("unit alone should convert the quantity: %v cups, %v", item.Quantity, err)
+	}
+
+	item = base()
+	if err := (UpdatePantryItemInput{ShelfLifeDays: intp(0), Notes: str(" ")}).apply(&item, now); err != nil || item.ShelfLifeDays != nil || item.Notes != nil {
+		t.Errorf("expected shelf life override and notes cleared, got %+v, %v", item, err)
+	}
+
+	bad := map[string]UpdatePantryItemInput{
+		"empty":                 {},
+		"zero quantity":         {Quantity: new(float64)},
+		"clear purchase":        {PurchasedAt: str("")},
+		"expires before bought": {ExpiresAt: str("2026-02-01")},
+		"opened in future":      {OpenedAt: str("2026-04-01")},
+		"unknown location":      {Location: str("garage")},
+		"volume to count":       {Unit: str("item")},
+		"unknown reason":        {Quantity: &qty, Reason: "lost"},
+	}
+	for name, in := range bad {
+		item := base()
+		if err := in.apply(&item, now); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%s: expected ErrInvalidInput, got %v", name, err)
+		}
+	}
+}
+
+func TestNewItemInputValidate(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+
+	item, err := NewPantryItemInput{FoodID: 7, Unit: "lbs", PurchasedAt: "2026-03-08"}.validate(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.foodID != 7 || item.quantity.Amount != 1 || item.quantity.Unit != "lb" || item.dates.purchasedAt == nil {
+		t.Errorf("unexpected item: %+v", item)
+	}
+
+	// A client ahead of UTC may already be on tomorrow
+	if _, err := (NewPantryItemInput{FoodID: 7, PurchasedAt: "2026-03-11", OpenedAt: "2026-03-11"}).validate(now); err != nil {
+		t.Errorf("tomorrow's date should be accepted: %v", err)
+	}
+
+	bad := map[string]NewPantryItemInput{
+		"no food":        {Quantity: 1},
+		"unknown unit":   {FoodID: 7, Unit: "bushel"},
+		"bought later":   {FoodID: 7, PurchasedAt: "2026-03-12"},
+		"bad shelf life": {FoodID: 7, ShelfLifeDays: new(int)},
+	}
+	for name, in := range bad {
+		if _, err := in.validate(now); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%s: expected ErrInvalidInput, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package pantry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/internal/units"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Pantry event actions
+const (
+	ActionAdded    = "added"
+	ActionUpdated  = "updated"
+	ActionDeleted  = "deleted"
+	ActionConsumed = "consumed" // by cooking a recipe
+	ActionRestored = "restored" // by undoing a cooked recipe
+)
+
+// Reasons an item left the pantry
+const (
+	ReasonEaten     = "eaten"
+	ReasonDiscarded = "discarded"
+	ReasonExpired   = "expired"
+	ReasonDonated   = "donated"
+)
+
+// Sources of pantry changes
+const (
+	SourceManual  = "manual"
+	SourceScan    = "scan"
+	SourceReceipt = "receipt"
+	SourceBulk    = "bulk"
+	SourceRecipe  = "recipe"
+)
+
+var (
+	actions = map[string]bool{ActionAdded: true, ActionUpdated: true, ActionDeleted: true, ActionConsumed: true, ActionRestored: true}
+	reasons = map[string]bool{ReasonEaten: true, ReasonDiscarded: true, ReasonExpired: true, ReasonDonated: true}
+)
+
+// ParseReason validates a reason code. The empty reason is allowed and
+// means none was given.
+func ParseReason(s string) (string, error) {
+	reason := strings.ToLower(strings.TrimSpace(s))
+	if reason != "" && !reasons[reason] {
+		return "", fmt.Errorf("%w: reason must be eaten, discarded, expired or donated", ErrInvalidInput)
+	}
+	return reason, nil
+}
+
+// Event is an entry in a user's pantry history. Quantities are in grams,
+// milliliters or items; QuantityBefore is nil when it could not be
+// expressed in the same unit as QuantityAfter.
+type Event struct {
+	ID             int64     `json:"id"`
+	UserID         string    `json:"user_id"`
+	PantryItemID   int       `json:"pantry_item_id"`
+	FoodID         int64     `json:"food_id"`
+	ProductName    string    `json:"product_name,omitempty"`
+	Action         string    `json:"action"`
+	Reason         string    `json:"reason,omitempty"`
+	QuantityBefore *float64  `json:"quantity_before,omitempty"`
+	QuantityAfter  float64   `json:"quantity_after"`
+	Unit           string    `json:"unit"`
+	Price          *float64  `json:"price,omitempty"`
+	Source         string    `json:"source"`
+	RecipeID       *string   `json:"recipe_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// NewEvent builds an event for an item's quantity going from before to
+// after. Adds start from zero and deletes end at zero. food is the item's
+// product name, for converting between mass and volume.
+func NewEvent(action string, before, after units.Quantity, food string) Event {
+	a := units.Normalize(after)
+	b := units.Normalize(before)
+	e := Event{Action: action, QuantityAfter: a.Amount, Unit: string(a.Unit)}
+	switch {
+	case after.Amount == 0:
+		e.QuantityAfter, e.Unit = 0, string(b.Unit)
+		e.QuantityBefore = &b.Amount
+	case before.Amount == 0:
+		e.QuantityBefore = new(float64)
+	case b.Unit == a.Unit:
+		e.QuantityBefore = &b.Amount
+	default:
+		if converted, err := units.Convert(b, a.Unit, food); err == nil {
+			e.QuantityBefore = &converted.Amount
+		}
+	}
+	return e
+}
+
+// changeArgs are the arguments the item writes in this package take to
+// record e alongside the change: reason, quantities, unit and source
+func (e Event) changeArgs() []any {
+	var reason any
+	if e.Reason != "" {
+		reason = e.Reason
+	}
+	return []any{reason, e.QuantityBefore, e.QuantityAfter, e.Unit, e.Source}
+}
+
+// Execer is satisfied by both the pool and a transaction
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// RecordEvent writes an event for a change made outside this package, such
+// as a recipe consuming pantry items. q should be the change's transaction.
+func RecordEvent(ctx context.Context, q Execer, e Event) error {
+	var reason any
+	if e.Reason != "" {
+		reason = e.Reason
+	}
+	_, err := q.Exec(ctx, `
+		INSERT INTO pantry_events (user_id, pantry_item_id, food_id, action, reason,
+		                           quantity_before, quantity_after, unit, price, source, recipe_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, e.UserID, e.PantryItemID, e.FoodID, e.Action, reason,
+		e.QuantityBefore, e.QuantityAfter, e.Unit, e.Price, e.Source, e.RecipeID)
+	if err != nil {
+		return fmt.Errorf("failed to record pantry event: %w", err)
+	}
+	return nil
+}
+
+// HistoryFilter narrows a user's pantry history. From and To are
+// inclusive dates; empty Reasons or Actions match all.
+type HistoryFilter struct {
+	From, To *time.Time
+	Reasons  []string
+	Actions  []string
+	Limit    int
+	Offset   int
+}
+
+// ParseHistoryFilter reads a HistoryFilter from query values: from and to
+// as YYYY-MM-DD, and reason and action as comma-separated lists
+func ParseHistoryFilter(from, to, reason, action string) (HistoryFilter, error) {
+	var f HistoryFilter
+	var err error
+	if f.From, err = parseDate("from", from); err != nil {
+		return f, err
+	}
+	if f.To, err = parseDate("to", to); err != nil {
+		return f, err
+	}
+	if f.From != nil && f.To != nil && f.To.Before(*f.From) {
+		return f, fmt.Errorf("%w: to is before from", ErrInvalidInput)
+	}
+	for _, s := range strings.Split(reason, ",") {
+		if r, err := ParseReason(s); err != nil {
+			return f, err
+		} else if r != "" {
+			f.Reasons = append(f.Reasons, r)
+		}
+	}
+	for _, s := range strings.Split(action, ",") {
+		a := strings.ToLower(strings.TrimSpace(s))
+		if a == "" {
+			continue
+		}
+		if !actions[a] {
+			return f, fmt.Errorf("%w: action must be added, updated, deleted, consumed or restored", ErrInvalidInput)
+		}
+		f.Actions = append(f.Actions, a)
+	}
+	return f, nil
+}
+
+// History retrieves a user's pantry events, newest first
+func (r *Repository) History(ctx context.Context, userID string, f HistoryFilter) ([]Event, error) {
+	var to *time.Time
+	if f.To != nil {
+		end := f.To.AddDate(0, 0, 1)
+		to = &end
+	}
+	rows, err := r.pool.Query(ctx, `
+		SELECT e.id, e.user_id, e.pantry_item_id, e.food_id, COALESCE(f.product_name, ''),
+		       e.action, COALESCE(e.reason, ''), e.quantity_before, e.quantity_after, e.unit,
+		       e.price, e.source, e.recipe_id, e.created_at
+		FROM pantry_events e
+		LEFT JOIN foods f ON f.id = e.food_id
+		WHERE e.user_id = $1
+		  AND ($2::timestamptz IS NULL OR e.created_at >= $2)
+		  AND ($3::timestamptz IS NULL OR e.created_at < $3)
+		  AND (COALESCE(cardinality($4::text[]), 0) = 0 OR e.reason = ANY($4))
+		  AND (COALESCE(cardinality($5::text[]), 0) = 0 OR e.action = ANY($5))
+		ORDER BY e.created_at DESC, e.id DESC
+		LIMIT $6 OFFSET $7
+	`, userID, f.From, to, f.Reasons, f.Actions, f.Limit, f.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.UserID, &e.PantryItemID, &e.FoodID, &e.ProductName,
+			&e.Action, &e.Reason, &e.QuantityBefore, &e.QuantityAfter, &e.Unit,
+			&e.Price, &e.Source, &e.RecipeID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,56 @@
+package pantry
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Jayyk09/CUHackIt/internal/units"
+)
+
+func TestNewEvent(t *testing.T) {
+	added := NewEvent(ActionAdded, units.Quantity{Unit: units.Kilogram}, units.Quantity{Amount: 1.5, Unit: units.Kilogram}, "")
+	if *added.QuantityBefore != 0 || added.QuantityAfter != 1500 || added.Unit != "g" {
+		t.Errorf("unexpected added event: %+v", added)
+	}
+
+	deleted := NewEvent(ActionDeleted, units.Quantity{Amount: 2, Unit: units.Liter}, units.Quantity{}, "Milk")
+	if *deleted.QuantityBefore != 2000 || deleted.QuantityAfter != 0 || deleted.Unit != "ml" {
+		t.Errorf("unexpected deleted event: %+v", deleted)
+	}
+
+	// A unit change is recorded in the new unit when the food's density is known
+	converted := NewEvent(ActionUpdated, units.Quantity{Amount: 1, Unit: units.Cup}, units.Quantity{Amount: 100, Unit: units.Gram}, "Sugar")
+	if converted.QuantityBefore == nil || converted.Unit != "g" {
+		t.Errorf("expected before in grams, got %+v", converted)
+	}
+	unknown := NewEvent(ActionUpdated, units.Quantity{Amount: 1, Unit: units.Cup}, units.Quantity{Amount: 100, Unit: units.Gram}, "Mystery")
+	if unknown.QuantityBefore != nil {
+		t.Errorf("expected no before without a density, got %v", *unknown.QuantityBefore)
+	}
+}
+
+func TestParseHistoryFilter(t *testing.T) {
+	f, err := ParseHistoryFilter("2026-03-01", "2026-03-31", "Eaten, discarded", "deleted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.From == nil || f.To == nil || len(f.Reasons) != 2 || f.Reasons[0] != ReasonEaten || len(f.Actions) != 1 {
+		t.Errorf("unexpected filter: %+v", f)
+	}
+
+	if f, err := ParseHistoryFilter("", "", "", ""); err != nil || f.From != nil || f.Reasons != nil || f.Actions != nil {
+		t.Errorf("empty query should match everything, got %+v, %v", f, err)
+	}
+
+	bad := [][4]string{
+		{"03/01/2026", "", "", ""},
+		{"2026-03-31", "2026-03-01", "", ""},
+		{"", "", "lost", ""},
+		{"", "", "", "moved"},
+	}
+	for _, in := range bad {
+		if _, err := ParseHistoryFilter(in[0], in[1], in[2], in[3]); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("ParseHistoryFilter%q: expected ErrInvalidInput, got %v", in, err)
+		}
+	}
+}
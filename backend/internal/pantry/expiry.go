@@ -0,0 +1,163 @@
+package pantry
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/internal/agents"
+)
+
+// ExpiringSoonDays is how many days before its expiry date an item counts
+// as expiring soon
+const ExpiringSoonDays = 3
+
+// frozenShelfLifeFactor stretches a food's shelf life while it is frozen
+const frozenShelfLifeFactor = 4
+
+// Where an item's expiry date comes from
+const (
+	ExpirySourcePrinted   = "printed"    // the item's explicit expires_at
+	ExpirySourceShelfLife = "shelf_life" // purchase date + shelf life
+	ExpirySourceOpened    = "opened"     // opened date + how long the category keeps once opened
+)
+
+// openedShelfLife is how many days a food keeps once opened, by category
+var openedShelfLife = map[string]int{
+	"PRODUCE":   5,
+	"DAIRY":     7,
+	"MEAT":      3,
+	"SEAFOOD":   2,
+	"PANTRY":    60,
+	"BAKERY":    5,
+	"SNACKS":    30,
+	"BEVERAGE":  7,
+	"DELI":      5,
+	"SPECIALTY": 14,
+}
+
+// defaultOpenedShelfLife applies to categories not in openedShelfLife
+const defaultOpenedShelfLife = 7
+
+// Expiry is when a pantry item expires and how close that is
+type Expiry struct {
+	Date           *time.Time `json:"expiration_date,omitempty"`
+	Source         string     `json:"source,omitempty"`
+	DaysRemaining  *int       `json:"days_remaining,omitempty"`
+	IsExpiringSoon bool       `json:"is_expiring_soon"`
+	IsExpired      bool       `json:"is_expired"`
+}
+
+// ComputeExpiry works out when item expires, as of now. A printed expiry
+// date wins over the shelf-life estimate (purchase date + the item's shelf
+// life override or the food's shelf life), except that freezing extends
+// the shelf life by frozenShelfLifeFactor and may outlast the printed date.
+// Opening an unfrozen item can only bring its expiry forward. Items with
+// no dates and no known shelf life have no expiry.
+func ComputeExpiry(item *PantryItemWithFood, now time.Time) Expiry {
+	start := item.AddedAt
+	if item.PurchasedAt != nil {
+		start = *item.PurchasedAt
+	}
+	shelfLife := item.ShelfLife
+	if item.ShelfLifeDays != nil {
+		shelfLife = item.ShelfLifeDays
+	}
+
+	var expiry Expiry
+	if item.ExpiresAt != nil {
+		date := *item.ExpiresAt
+		expiry.Date, expiry.Source = &date, ExpirySourcePrinted
+	}
+	if shelfLife != nil {
+		days := *shelfLife
+		if item.IsFrozen {
+			days *= frozenShelfLifeFactor
+		}
+		date := start.AddDate(0, 0, days)
+		if expiry.Date == nil || (item.IsFrozen && date.After(*expiry.Date)) {
+			expiry.Date, expiry.Source = &date, ExpirySourceShelfLife
+		}
+	}
+	if item.OpenedAt != nil && !item.IsFrozen {
+		days := defaultOpenedShelfLife
+		if item.Category != nil {
+			if d, ok := openedShelfLife[*item.Category]; ok {
+				days = d
+			}
+		}
+		date := item.OpenedAt.AddDate(0, 0, days)
+		if expiry.Date == nil || date.Before(*expiry.Date) {
+			expiry.Date, expiry.Source = &date, ExpirySourceOpened
+		}
+	}
+
+	if expiry.Date != nil {
+		days := daysBetween(now, *expiry.Date)
+		expiry.DaysRemaining = &days
+		expiry.IsExpiringSoon = days <= ExpiringSoonDays
+		expiry.IsExpired = days < 0
+	}
+	return expiry
+}
+
+// daysBetween counts calendar days from a to b
+func daysBetween(a, b time.Time) int {
+	day := func(t time.Time) time.Time {
+		y, m, d := t.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+	return int(day(b).Sub(day(a)).Hours() / 24)
+}
+
+// MaxExpiringDays bounds the look-ahead of ExpiringItems
+const MaxExpiringDays = 365
+
+// ExpiringItems returns the items that expire within days of now, already
+// expired items included, most urgent first. Items with no known expiry are
+// left out. Each returned item's Expiry is computed as of now.
+func ExpiringItems(items []PantryItemWithFood, days int, now time.Time) []PantryItemWithFood {
+	expiring := []PantryItemWithFood{}
+	for _, item := range items {
+		item.Expiry = ComputeExpiry(&item, now)
+		if item.Expiry.DaysRemaining != nil && *item.Expiry.DaysRemaining <= days {
+			expiring = append(expiring, item)
+		}
+	}
+	sort.SliceStable(expiring, func(i, j int) bool {
+		a, b := *expiring[i].Expiry.DaysRemaining, *expiring[j].Expiry.DaysRemaining
+		if a != b {
+			return a < b
+		}
+		return expiring[i].ProductName < expiring[j].ProductName
+	})
+	return expiring
+}
+
+// AgentItems converts pantry items to the agents' format with their expiry
+// as of now. Every recipe generation path goes through here so they agree
+// on what is expiring.
+func AgentItems(items []PantryItemWithFood, now time.Time) []agents.PantryItem {
+	out := make([]agents.PantryItem, len(items))
+	for i := range items {
+		item := &items[i]
+		category := ""
+		if item.Category != nil {
+			category = *item.Category
+		}
+		expiry := ComputeExpiry(item, now)
+		out[i] = agents.PantryItem{
+			ID:             strconv.Itoa(item.ID),
+			Name:           item.ProductName,
+			Category:       category,
+			Quantity:       item.Quantity,
+			Unit:           item.Unit,
+			ExpirationDate: expiry.Date,
+			IsExpiringSoon: expiry.IsExpiringSoon,
+			IsExpired:      expiry.IsExpired,
+			Allergens:      item.AllergensEn,
+			Traces:         item.TracesEn,
+		}
+	}
+	return out
+}
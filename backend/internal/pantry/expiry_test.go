@@ -0,0 +1,75 @@
+package pantry
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestComputeExpiry(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	day := func(d int) *time.Time {
+		t := time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	intp := func(v int) *int { return &v }
+	dairy := "DAIRY"
+
+	cases := []struct {
+		name   string
+		item   PantryItemWithFood
+		want   *time.Time
+		source string
+	}{
+		{"shelf life from added_at", PantryItemWithFood{AddedAt: *day(1), ShelfLife: intp(7)}, day(8), ExpirySourceShelfLife},
+		{"shelf life from purchase", PantryItemWithFood{AddedAt: *day(5), PurchasedAt: day(2), ShelfLife: intp(7)}, day(9), ExpirySourceShelfLife},
+		{"override", PantryItemWithFood{AddedAt: *day(1), ShelfLife: intp(7), ShelfLifeDays: intp(20)}, day(21), ExpirySourceShelfLife},
+		{"printed wins", PantryItemWithFood{AddedAt: *day(1), ShelfLife: intp(7), ExpiresAt: day(12)}, day(12), ExpirySourcePrinted},
+		{"frozen outlasts printed", PantryItemWithFood{AddedAt: *day(1), ShelfLife: intp(5), ExpiresAt: day(6), IsFrozen: true}, day(21), ExpirySourceShelfLife},
+		{"opened brings it forward", PantryItemWithFood{AddedAt: *day(1), ExpiresAt: day(30), OpenedAt: day(9), Category: &dairy}, day(16), ExpirySourceOpened},
+		{"opened later than printed", PantryItemWithFood{AddedAt: *day(1), ExpiresAt: day(11), OpenedAt: day(9), Category: &dairy}, day(11), ExpirySourcePrinted},
+		{"unknown", PantryItemWithFood{AddedAt: *day(1)}, nil, ""},
+	}
+	for _, tc := range cases {
+		got := ComputeExpiry(&tc.item, now)
+		if (got.Date == nil) != (tc.want == nil) || (got.Date != nil && !got.Date.Equal(*tc.want)) || got.Source != tc.source {
+			t.Errorf("%s: expiry = %v (%s), want %v (%s)", tc.name, got.Date, got.Source, tc.want, tc.source)
+		}
+	}
+
+	soon := ComputeExpiry(&PantryItemWithFood{AddedAt: *day(1), ExpiresAt: day(13)}, now)
+	if *soon.DaysRemaining != 3 || !soon.IsExpiringSoon || soon.IsExpired {
+		t.Errorf("expected 3 days left and expiring soon, got %+v", soon)
+	}
+	expired := ComputeExpiry(&PantryItemWithFood{AddedAt: *day(1), ExpiresAt: day(9)}, now)
+	if *expired.DaysRemaining != -1 || !expired.IsExpired {
+		t.Errorf("expected expired yesterday, got %+v", expired)
+	}
+	if today := ComputeExpiry(&PantryItemWithFood{AddedAt: *day(1), ExpiresAt: day(10)}, now); today.IsExpired {
+		t.Errorf("an item expiring today is not yet expired, got %+v", today)
+	}
+}
+
+func TestParseItemDates(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	zero := 0
+
+	if _, err := parseItemDates("2026-03-01", "2026-04-01", "2026-03-05", nil, now); err != nil {
+		t.Errorf("valid dates rejected: %v", err)
+	}
+	bad := []struct{ purchased, expires, opened string }{
+		{"03/01/2026", "", ""},
+		{"2026-03-12", "", ""},
+		{"2026-03-05", "2026-03-04", ""},
+		{"2026-03-05", "", "2026-03-01"},
+		{"", "", "2026-03-20"},
+	}
+	for _, b := range bad {
+		if _, err := parseItemDates(b.purchased, b.expires, b.opened, nil, now); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("parseItemDates(%q, %q, %q) = %v, want ErrInvalidInput", b.purchased, b.expires, b.opened, err)
+		}
+	}
+	if _, err := parseItemDates("", "", "", &zero, now); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected a zero shelf life override to be rejected, got %v", err)
+	}
+}
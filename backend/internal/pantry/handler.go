@@ -1,26 +1,47 @@
 package pantry
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Jayyk09/CUHackIt/internal/agents"
 	"github.com/Jayyk09/CUHackIt/internal/database"
 	"github.com/Jayyk09/CUHackIt/pkg/logger"
 )
 
+// ChangeNotifier is told when a user's pantry changes so data derived from
+// it, such as cached recipe generations, can be dropped
+type ChangeNotifier interface {
+	PantryChanged(userID string)
+}
+
 // Handler handles HTTP requests for pantry items
 type Handler struct {
-	repo *Repository
-	log  *logger.Logger
+	repo     *Repository
+	notifier ChangeNotifier
+	log      *logger.Logger
 }
 
-// NewHandler creates a new pantry handler
-func NewHandler(db *database.DB, log *logger.Logger) *Handler {
+// NewHandler creates a new pantry handler. notifier may be nil.
+func NewHandler(db *database.DB, log *logger.Logger, notifier ChangeNotifier) *Handler {
 	return &Handler{
-		repo: NewRepository(db.Pool),
-		log:  log,
+		repo:     NewRepository(db.Pool),
+		notifier: notifier,
+		log:      log,
+	}
+}
+
+// pantryChanged notifies the ChangeNotifier, if any
+func (h *Handler) pantryChanged(userID string) {
+	if h.notifier != nil {
+		h.notifier.PantryChanged(userID)
 	}
 }
 
@@ -109,9 +130,47 @@ func (h *Handler) GetItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, item)
 	h.writeJSON(w, http.StatusOK, item)
 }
 
+// ExpiringResponse is the body of GET /users/{user_id}/pantry/expiring
+type ExpiringResponse struct {
+	Days  int                  `json:"days"`
+	Count int                  `json:"count"`
+	Items []PantryItemWithFood `json:"items"`
+}
+
+// GetExpiring handles GET /users/{user_id}/pantry/expiring?days=N. It lists
+// items expiring within N days (default ExpiringSoonDays), expired items
+// included, most urgent first.
+func (h *Handler) GetExpiring(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	days := ExpiringSoonDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		days, err = strconv.Atoi(v)
+		if err != nil || days < 0 || days > MaxExpiringDays {
+			h.writeError(w, http.StatusBadRequest, fmt.Sprintf("days must be a whole number from 0 to %d", MaxExpiringDays))
+			return
+		}
+	}
+
+	items, err := h.repo.ListByUserID(r.Context(), userID)
+	if err != nil {
+		h.log.Error("Failed to list pantry items: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	expiring := ExpiringItems(items, days, time.Now())
+	h.writeJSON(w, http.StatusOK, ExpiringResponse{Days: days, Count: len(expiring), Items: expiring})
+}
+
 // GetCategorySummary handles GET /users/{user_id}/pantry/summary
 func (h *Handler) GetCategorySummary(w http.ResponseWriter, r *http.Request) {
 	userID, err := h.getUserID(r)
@@ -130,7 +189,38 @@ func (h *Handler) GetCategorySummary(w http.ResponseWriter, r *http.Request) {
 	h.writeJSON(w, http.StatusOK, summary)
 }
 
-// DeleteItem handles DELETE /users/{user_id}/pantry/{id}
+// GetSafety handles GET /users/{user_id}/pantry/safety
+func (h *Handler) GetSafety(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	allergens, err := h.repo.GetUserAllergens(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			h.writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		h.log.Error("Failed to get user allergens: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	items, err := h.repo.ListByUserID(r.Context(), userID)
+	if err != nil {
+		h.log.Error("Failed to list pantry items: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, buildSafetyReport(userID, allergens, items))
+}
+
+// DeleteItem handles DELETE /users/{user_id}/pantry/{id}?reason=... The
+// optional reason (eaten, discarded, expired or donated) is recorded in the
+// pantry history.
 func (h *Handler) DeleteItem(w http.ResponseWriter, r *http.Request) {
 	userID, err := h.getUserID(r)
 	if err != nil {
@@ -144,6 +234,12 @@ func (h *Handler) DeleteItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	reason, err := ParseReason(r.URL.Query().Get("reason"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Verify ownership first
 	existing, err := h.repo.GetByID(r.Context(), itemID)
 	if err != nil {
@@ -161,15 +257,86 @@ func (h *Handler) DeleteItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.repo.Delete(r.Context(), itemID); err != nil {
+	if err := h.repo.Delete(r.Context(), existing, reason); err != nil {
+		if errors.Is(err, ErrItemNotFound) {
+			h.writeError(w, http.StatusNotFound, "item not found")
+			return
+		}
 		h.log.Error("Failed to delete pantry item: %v", err)
 		h.writeError(w, http.StatusInternalServerError, "internal server error")
 		return
 	}
+	h.pantryChanged(userID)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// ConflictResponse is the 409 body of a stale PATCH; Current is the item as
+// it is now, so the client can reapply its edit
+type ConflictResponse struct {
+	Error   string              `json:"error"`
+	Current *PantryItemWithFood `json:"current"`
+}
+
+// UpdateItem handles PATCH /users/{user_id}/pantry/{id}. The item's current
+// version must be sent as "version" in the body or as an If-Match header.
+func (h *Handler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	itemID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid item id")
+		return
+	}
+
+	var input UpdatePantryItemInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if input.Version == 0 {
+		if match := r.Header.Get("If-Match"); match != "" {
+			input.Version, err = strconv.Atoi(strings.Trim(match, `W/"`))
+			if err != nil {
+				h.writeError(w, http.StatusBadRequest, "invalid If-Match version")
+				return
+			}
+		}
+	}
+
+	item, err := h.repo.Update(r.Context(), itemID, userID, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrItemNotFound):
+			h.writeError(w, http.StatusNotFound, "item not found")
+		case errors.Is(err, ErrUnauthorized):
+			h.writeError(w, http.StatusForbidden, "access denied")
+		case errors.Is(err, ErrConflict):
+			setETag(w, item)
+			h.writeJSON(w, http.StatusConflict, ConflictResponse{Error: err.Error(), Current: item})
+		case errors.Is(err, ErrInvalidInput):
+			h.writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			h.log.Error("Failed to update pantry item: %v", err)
+			h.writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+	h.pantryChanged(userID)
+
+	setETag(w, item)
+	h.writeJSON(w, http.StatusOK, item)
+}
+
+// setETag exposes an item's version for If-Match
+func setETag(w http.ResponseWriter, item *PantryItemWithFood) {
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, item.Version))
+}
+
 // AddToPantry handles POST /pantry
 func (h *Handler) AddToPantry(w http.ResponseWriter, r *http.Request) {
 	var input AddToPantryInput
@@ -195,13 +362,330 @@ func (h *Handler) AddToPantry(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if errors.Is(err, ErrInvalidInput) {
-			h.writeError(w, http.StatusBadRequest, "invalid input")
+			h.writeError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 		h.log.Error("Failed to add pantry entry: %v", err)
 		h.writeError(w, http.StatusInternalServerError, "internal server error")
 		return
 	}
+	h.pantryChanged(entry.UserID)
+
+	h.writeJSON(w, http.StatusCreated, AddToPantryResult{
+		SimplePantryEntry: *entry,
+		AllergenWarnings:  h.allergenWarnings(r.Context(), entry.UserID, entry.FoodID),
+	})
+}
+
+// allergenWarnings checks a newly added food against its owner's allergens.
+// The item is already stored, so lookup failures are logged, not returned.
+func (h *Handler) allergenWarnings(ctx context.Context, userID string, foodID int64) []agents.ProductConflict {
+	allergens, err := h.repo.GetUserAllergens(ctx, userID)
+	if err != nil {
+		h.log.Warn("Failed to get allergens for user %s: %v", userID, err)
+		return nil
+	}
+	if len(allergens) == 0 {
+		return nil
+	}
+
+	product, err := h.repo.GetProductAllergens(ctx, foodID)
+	if err != nil {
+		h.log.Warn("Failed to get allergens for food %d: %v", foodID, err)
+		return nil
+	}
+	return agents.CheckProduct(product.ProductName, product.AllergensEn, product.TracesEn, allergens)
+}
+
+// ScanToPantry handles POST /users/{user_id}/pantry/scan. A known barcode
+// adds the product (201); an unknown one is kept as a pending product (202)
+// for the user to complete.
+func (h *Handler) ScanToPantry(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	var input ScanInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	result, err := h.repo.Scan(r.Context(), userID, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUserNotFound):
+			h.writeError(w, http.StatusNotFound, "user not found")
+		case errors.Is(err, ErrInvalidInput):
+			h.writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			h.log.Error("Failed to scan into pantry: %v", err)
+			h.writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	if result.Status == ScanPending {
+		h.writeJSON(w, http.StatusAccepted, result)
+		return
+	}
+	h.pantryChanged(userID)
+	result.AllergenWarnings = h.allergenWarnings(r.Context(), userID, result.Item.FoodID)
+	h.writeJSON(w, http.StatusCreated, result)
+}
+
+// ListPending handles GET /users/{user_id}/pantry/pending
+func (h *Handler) ListPending(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	pending, err := h.repo.ListPending(r.Context(), userID)
+	if err != nil {
+		h.log.Error("Failed to list pending products: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, pending)
+}
+
+// CompletePending handles POST /users/{user_id}/pantry/pending/{id}/complete
+func (h *Handler) CompletePending(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	pendingID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid pending product id")
+		return
+	}
+
+	var input CompletePendingInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	entry, err := h.repo.CompletePending(r.Context(), userID, pendingID, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrPendingNotFound):
+			h.writeError(w, http.StatusNotFound, "pending product not found")
+		case errors.Is(err, ErrInvalidInput):
+			h.writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			h.log.Error("Failed to complete pending product: %v", err)
+			h.writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+	h.pantryChanged(userID)
+
+	h.writeJSON(w, http.StatusCreated, AddToPantryResult{
+		SimplePantryEntry: *entry,
+		AllergenWarnings:  h.allergenWarnings(r.Context(), userID, entry.FoodID),
+	})
+}
+
+// ImportReceipt handles POST /users/{user_id}/pantry/import. The receipt is
+// parsed and matched into a draft; nothing is added until it is committed.
+func (h *Handler) ImportReceipt(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	var input ImportReceiptInput
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxReceiptBytes)).Decode(&input); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	draft, err := h.repo.ImportReceipt(r.Context(), userID, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUserNotFound):
+			h.writeError(w, http.StatusNotFound, "user not found")
+		case errors.Is(err, ErrInvalidInput):
+			h.writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			h.log.Error("Failed to import receipt: %v", err)
+			h.writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, draft)
+}
+
+// GetReceiptDraft handles GET /users/{user_id}/pantry/import/{id}
+func (h *Handler) GetReceiptDraft(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	draftID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid draft id")
+		return
+	}
+
+	draft, err := h.repo.GetReceiptDraft(r.Context(), userID, draftID)
+	if err != nil {
+		if errors.Is(err, ErrDraftNotFound) {
+			h.writeError(w, http.StatusNotFound, "receipt draft not found")
+			return
+		}
+		h.log.Error("Failed to get receipt draft: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, draft)
+}
+
+// CommitReceipt handles POST /users/{user_id}/pantry/import/{id}/commit.
+// The body lists the user's changes to the draft and may be empty.
+func (h *Handler) CommitReceipt(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	draftID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid draft id")
+		return
+	}
+
+	var input CommitReceiptInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		h.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	result, err := h.repo.CommitReceipt(r.Context(), userID, draftID, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrDraftNotFound):
+			h.writeError(w, http.StatusNotFound, "receipt draft not found")
+		case errors.Is(err, ErrDraftCommitted):
+			h.writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, ErrInvalidInput):
+			h.writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			h.log.Error("Failed to commit receipt: %v", err)
+			h.writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+	h.pantryChanged(userID)
+
+	h.writeJSON(w, http.StatusCreated, result)
+}
+
+// Bulk handles POST /users/{user_id}/pantry/bulk. It responds 200 when every
+// operation succeeded, 207 when a partial request applied only some, and
+// 422 when nothing was applied.
+func (h *Handler) Bulk(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	var input BulkInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	result, err := h.repo.Bulk(r.Context(), userID, input)
+	if err != nil {
+		if errors.Is(err, ErrInvalidInput) {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.log.Error("Failed to apply bulk pantry operations: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	status := http.StatusOK
+	switch {
+	case !result.Applied:
+		status = http.StatusUnprocessableEntity
+	case result.Failed > 0:
+		status = http.StatusMultiStatus
+	}
+	if result.Applied {
+		h.pantryChanged(userID)
+	}
+	h.writeJSON(w, status, result)
+}
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+// HistoryResponse is the body of GET /users/{user_id}/pantry/history
+type HistoryResponse struct {
+	Events []Event `json:"events"`
+	Limit  int     `json:"limit"`
+	Offset int     `json:"offset"`
+}
+
+// GetHistory handles GET /users/{user_id}/pantry/history. Optional query
+// parameters: from and to (YYYY-MM-DD, inclusive), reason and action
+// (comma-separated), limit and offset.
+func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	q := r.URL.Query()
+	filter, err := ParseHistoryFilter(q.Get("from"), q.Get("to"), q.Get("reason"), q.Get("action"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.Limit = defaultHistoryLimit
+	if v := q.Get("limit"); v != "" {
+		filter.Limit, err = strconv.Atoi(v)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxHistoryLimit {
+			h.writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be a whole number from 1 to %d", maxHistoryLimit))
+			return
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		filter.Offset, err = strconv.Atoi(v)
+		if err != nil || filter.Offset < 0 {
+			h.writeError(w, http.StatusBadRequest, "offset must be a non-negative whole number")
+			return
+		}
+	}
+
+	events, err := h.repo.History(r.Context(), userID, filter)
+	if err != nil {
+		h.log.Error("Failed to get pantry history: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
 
-	h.writeJSON(w, http.StatusCreated, entry)
+	h.writeJSON(w, http.StatusOK, HistoryResponse{Events: events, Limit: filter.Limit, Offset: filter.Offset})
 }
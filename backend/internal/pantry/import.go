@@ -0,0 +1,349 @@
+package pantry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/internal/units"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrDraftNotFound  = errors.New("receipt draft not found")
+	ErrDraftCommitted = errors.New("receipt draft was already committed")
+)
+
+const (
+	// maxReceiptBytes bounds the receipt text accepted for import
+	maxReceiptBytes = 64 << 10
+
+	// maxReceiptLines bounds the item lines of one receipt, each of which
+	// costs a food search
+	maxReceiptLines = 200
+
+	// minMatchScore is the matchScore below which a food is not offered as
+	// the match for a receipt line
+	minMatchScore = 0.4
+
+	// matchAlternatives is how many runner-up foods a draft line lists
+	matchAlternatives = 3
+
+	// matchCandidates is how many foods are scored per receipt line
+	matchCandidates = 50
+)
+
+// ImportReceiptInput is the input for POST /users/{user_id}/pantry/import
+type ImportReceiptInput struct {
+	Text        string `json:"text"`                   // receipt text, one item per line
+	PurchasedAt string `json:"purchased_at,omitempty"` // YYYY-MM-DD, defaults to today
+}
+
+// FoodMatch is a food a receipt line may be
+type FoodMatch struct {
+	FoodID      int64   `json:"food_id"`
+	ProductName string  `json:"product_name"`
+	Score       float64 `json:"score"` // 0 to 1
+}
+
+// DraftLine is a parsed receipt line with the foods it may be. Match is
+// the food it will be added as unless the commit says otherwise.
+type DraftLine struct {
+	ReceiptLine
+	Match        *FoodMatch  `json:"match,omitempty"`
+	Alternatives []FoodMatch `json:"alternatives,omitempty"`
+}
+
+// ReceiptDraft is an imported receipt waiting for the user's review
+type ReceiptDraft struct {
+	ID          int         `json:"id"`
+	UserID      string      `json:"user_id"`
+	PurchasedAt time.Time   `json:"purchased_at"`
+	Status      string      `json:"status"` // draft or committed
+	Lines       []DraftLine `json:"lines"`
+	CreatedAt   time.Time   `json:"created_at"`
+	CommittedAt *time.Time  `json:"committed_at,omitempty"`
+}
+
+// CommitLine is the user's review of one draft line. Fields left out keep
+// the draft's values.
+type CommitLine struct {
+	Line      int      `json:"line"`
+	Skip      bool     `json:"skip,omitempty"`
+	FoodID    *int64   `json:"food_id,omitempty"`
+	Quantity  *float64 `json:"quantity,omitempty"`
+	Unit      *string  `json:"unit,omitempty"`
+	IsFrozen  bool     `json:"is_frozen,omitempty"`
+	ExpiresAt string   `json:"expires_at,omitempty"` // YYYY-MM-DD
+}
+
+// CommitReceiptInput is the input for committing a draft. Only lines the
+// user changed need to be listed.
+type CommitReceiptInput struct {
+	Lines []CommitLine `json:"lines"`
+}
+
+// CommitReceiptResult lists what a commit added, and the draft lines it
+// skipped because they were skipped or had no food
+type CommitReceiptResult struct {
+	DraftID int                 `json:"draft_id"`
+	Items   []SimplePantryEntry `json:"items"`
+	Skipped []int               `json:"skipped"`
+}
+
+// plannedItem is a draft line ready to insert
+type plannedItem struct {
+	line int
+	item newItem
+}
+
+// plan applies the user's review to the draft, returning the items to add
+// and the lines skipped
+func (d *ReceiptDraft) plan(input CommitReceiptInput, now time.Time) ([]plannedItem, []int, error) {
+	reviews := make(map[int]CommitLine, len(input.Lines))
+	known := make(map[int]bool, len(d.Lines))
+	for _, line := range d.Lines {
+		known[line.Line] = true
+	}
+	for _, review := range input.Lines {
+		if !known[review.Line] {
+			return nil, nil, fmt.Errorf("%w: line %d is not in the draft", ErrInvalidInput, review.Line)
+		}
+		reviews[review.Line] = review
+	}
+
+	var planned []plannedItem
+	skipped := []int{}
+	for _, line := range d.Lines {
+		review := reviews[line.Line]
+		var foodID int64
+		switch {
+		case review.FoodID != nil:
+			foodID = *review.FoodID
+		case line.Match != nil:
+			foodID = line.Match.FoodID
+		}
+		if review.Skip || foodID <= 0 {
+			skipped = append(skipped, line.Line)
+			continue
+		}
+
+		amount, unit := line.Quantity, line.Unit
+		if review.Quantity != nil {
+			amount = *review.Quantity
+		}
+		if review.Unit != nil {
+			unit = *review.Unit
+		}
+		quantity, err := units.New(amount, unit)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: line %d: %v", ErrInvalidInput, line.Line, err)
+		}
+
+		purchasedAt := d.PurchasedAt
+		dates := itemDates{purchasedAt: &purchasedAt}
+		if dates.expiresAt, err = parseDate("expires_at", review.ExpiresAt); err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", line.Line, err)
+		}
+		if err := dates.validate(nil, now); err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", line.Line, err)
+		}
+
+		planned = append(planned, plannedItem{line: line.Line, item: newItem{
+			foodID:   foodID,
+			quantity: quantity,
+			isFrozen: review.IsFrozen,
+			dates:    dates,
+			price:    line.Price,
+			source:   SourceReceipt,
+		}})
+	}
+	if len(planned) == 0 {
+		return nil, nil, fmt.Errorf("%w: no lines to add", ErrInvalidInput)
+	}
+	return planned, skipped, nil
+}
+
+// ImportReceipt parses receipt text, matches each line to a food and saves
+// the result as a draft for the user to review
+func (r *Repository) ImportReceipt(ctx context.Context, userID string, input ImportReceiptInput) (*ReceiptDraft, error) {
+	if len(input.Text) > maxReceiptBytes {
+		return nil, fmt.Errorf("%w: receipt text is longer than %d bytes", ErrInvalidInput, maxReceiptBytes)
+	}
+	purchasedAt, err := parseDate("purchased_at", input.PurchasedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := (itemDates{purchasedAt: purchasedAt}).validate(nil, time.Now()); err != nil {
+		return nil, err
+	}
+
+	parsed := ParseReceipt(input.Text)
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("%w: no item lines found in the receipt", ErrInvalidInput)
+	}
+	if len(parsed) > maxReceiptLines {
+		return nil, fmt.Errorf("%w: receipt has %d item lines, at most %d are allowed", ErrInvalidInput, len(parsed), maxReceiptLines)
+	}
+	lines := make([]DraftLine, len(parsed))
+	for i, line := range parsed {
+		matches, err := r.matchFoods(ctx, line.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to match receipt line %d: %w", line.Line, err)
+		}
+		lines[i] = DraftLine{ReceiptLine: line}
+		if len(matches) > 0 {
+			lines[i].Match = &matches[0]
+			lines[i].Alternatives = matches[1:]
+		}
+	}
+
+	encoded, err := json.Marshal(lines)
+	if err != nil {
+		return nil, err
+	}
+	draft := &ReceiptDraft{UserID: userID, Lines: lines}
+	err = r.pool.QueryRow(ctx, `
+		INSERT INTO receipt_imports (user_id, purchased_at, lines)
+		VALUES ($1, COALESCE($2, CURRENT_DATE), $3)
+		RETURNING id, purchased_at, status, created_at
+	`, userID, purchasedAt, encoded).Scan(&draft.ID, &draft.PurchasedAt, &draft.Status, &draft.CreatedAt)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return draft, nil
+}
+
+// matchFoods returns the foods best matching a receipt line's name, best
+// first: the match, if any scored high enough, then its runners-up
+func (r *Repository) matchFoods(ctx context.Context, name string) ([]FoodMatch, error) {
+	query := matchWords(name)
+	var patterns []string
+	for _, w := range query {
+		if len(w) >= 3 {
+			patterns = append(patterns, "%"+w+"%")
+		}
+	}
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	// Foods containing the most of the line's words are scored first
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, product_name FROM foods
+		WHERE product_name ILIKE ANY($1)
+		ORDER BY (SELECT count(*) FROM unnest($1::text[]) AS p WHERE product_name ILIKE p) DESC,
+		         length(product_name)
+		LIMIT $2
+	`, patterns, matchCandidates)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []FoodMatch
+	for rows.Next() {
+		var m FoodMatch
+		if err := rows.Scan(&m.FoodID, &m.ProductName); err != nil {
+			return nil, err
+		}
+		if m.Score = matchScore(query, m.ProductName); m.Score >= minMatchScore {
+			m.Score = units.Round(m.Score)
+			matches = append(matches, m)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches[:min(len(matches), 1+matchAlternatives)], nil
+}
+
+// receiptDraftSelect are the columns a ReceiptDraft is scanned from
+const receiptDraftSelect = `id, user_id, purchased_at, status, lines, created_at, committed_at`
+
+func scanReceiptDraft(row pgx.Row) (*ReceiptDraft, error) {
+	var d ReceiptDraft
+	var lines []byte
+	if err := row.Scan(&d.ID, &d.UserID, &d.PurchasedAt, &d.Status, &lines, &d.CreatedAt, &d.CommittedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrDraftNotFound
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(lines, &d.Lines); err != nil {
+		return nil, fmt.Errorf("failed to decode receipt draft %d: %w", d.ID, err)
+	}
+	return &d, nil
+}
+
+// GetReceiptDraft retrieves one of a user's receipt drafts
+func (r *Repository) GetReceiptDraft(ctx context.Context, userID string, id int) (*ReceiptDraft, error) {
+	return scanReceiptDraft(r.pool.QueryRow(ctx, `
+		SELECT `+receiptDraftSelect+` FROM receipt_imports WHERE id = $1 AND user_id = $2
+	`, id, userID))
+}
+
+// CommitReceipt adds a reviewed draft's lines to the pantry. Every line is
+// added or none are.
+func (r *Repository) CommitReceipt(ctx context.Context, userID string, id int, input CommitReceiptInput) (*CommitReceiptResult, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	draft, err := scanReceiptDraft(tx.QueryRow(ctx, `
+		SELECT `+receiptDraftSelect+` FROM receipt_imports WHERE id = $1 AND user_id = $2
+		FOR UPDATE
+	`, id, userID))
+	if err != nil {
+		return nil, err
+	}
+	if draft.Status == "committed" {
+		return nil, ErrDraftCommitted
+	}
+
+	planned, skipped, err := draft.plan(input, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	foodIDs := make([]int64, len(planned))
+	for i, p := range planned {
+		foodIDs[i] = p.item.foodID
+	}
+	exists, err := existingFoods(ctx, tx, foodIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CommitReceiptResult{DraftID: id, Skipped: skipped}
+	for _, p := range planned {
+		if !exists[p.item.foodID] {
+			return nil, fmt.Errorf("%w: line %d: food %d does not exist", ErrInvalidInput, p.line, p.item.foodID)
+		}
+		entry, err := insertItem(ctx, tx, userID, p.item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add line %d: %w", p.line, err)
+		}
+		result.Items = append(result.Items, *entry)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE receipt_imports SET status = 'committed', committed_at = NOW() WHERE id = $1
+	`, id); err != nil {
+		return nil, fmt.Errorf("failed to mark receipt committed: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit receipt: %w", err)
+	}
+	return result, nil
+}
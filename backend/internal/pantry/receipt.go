@@ -0,0 +1,270 @@
+package pantry
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Jayyk09/CUHackIt/internal/units"
+)
+
+// ReceiptLine is an item line parsed from receipt text
+type ReceiptLine struct {
+	Line     int      `json:"line"` // 1-based line number in the text
+	Raw      string   `json:"raw"`
+	Name     string   `json:"name"`
+	Quantity float64  `json:"quantity"`
+	Unit     string   `json:"unit"`
+	Price    *float64 `json:"price,omitempty"` // what the line cost in total
+}
+
+var (
+	// trailing line total, maybe negative and followed by a tax flag: "3.49 F", "1.00-"
+	receiptPriceRe = regexp.MustCompile(`(?i)(?:^|\s)(-?)\$?(\d+\.\d{2})(-?)(?:\s+[a-z]{1,2})?$`)
+
+	// weighed items: "1.52 lb @ 3.99/lb"
+	receiptWeightRe = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*(lbs?|kg|oz|g)\s*@\s*\$?\d+(?:\.\d+)?\s*/\s*(?:lbs?|kg|oz|g)\b`)
+
+	// several of an item: "3 @ 0.99", "3 @ 0.99 ea"
+	receiptEachRe = regexp.MustCompile(`(?i)(\d+)\s*@\s*\$?\d+(?:\.\d+)?(?:\s*/\s*ea|\s+ea)?\b`)
+
+	// a count before or after the name: "2 x MILK", "2 MILK", "MILK x2"
+	receiptLeadCountRe  = regexp.MustCompile(`(?i)^(\d{1,2})(?:\s*[x*]\s*|\s+)`)
+	receiptTrailCountRe = regexp.MustCompile(`(?i)\s[x*]\s*(\d{1,2})$`)
+
+	// items per package: "12CT", "6 PK"
+	receiptPackRe = regexp.MustCompile(`(?i)\b(\d+)\s*(?:ct|pk|pack)\b`)
+
+	// package size: "16OZ", "1.5 L", "12 FL OZ"
+	receiptSizeRe = regexp.MustCompile(`(?i)\b(\d+(?:\.\d+)?)\s*(fl\s*oz|oz|lbs?|kg|g|ml|l)\b`)
+
+	// PLU and UPC codes
+	receiptCodeRe = regexp.MustCompile(`\b\d{4,}\b`)
+)
+
+// receiptNoise are words that mark a line as something other than an item
+var receiptNoise = map[string]bool{
+	"SUBTOTAL": true, "TOTAL": true, "TAX": true, "CHANGE": true, "CASH": true,
+	"VISA": true, "MASTERCARD": true, "AMEX": true, "DEBIT": true, "CREDIT": true,
+	"BALANCE": true, "TENDER": true, "TENDERED": true, "SAVINGS": true, "SAVED": true,
+	"DISCOUNT": true, "COUPON": true, "THANK": true, "RECEIPT": true, "CASHIER": true,
+	"REGISTER": true, "AUTH": true, "APPROVED": true, "REFUND": true, "DEPOSIT": true,
+}
+
+// mlPerFluidOunce converts "fl oz" sizes, which the units package does not
+// model, to milliliters
+const mlPerFluidOunce = 29.5735295625
+
+// ParseReceipt extracts item lines from receipt text, one item per line.
+// Totals, tenders and other non-item lines are skipped, and so are lines
+// without a price when others have one, such as the store's address.
+// Quantities default to one item when the line does not give a count,
+// weight or size.
+func ParseReceipt(text string) []ReceiptLine {
+	var lines []ReceiptLine
+	priced := false
+	for i, raw := range strings.Split(text, "\n") {
+		if line, ok := parseReceiptLine(strings.TrimSpace(raw)); ok {
+			line.Line = i + 1
+			lines = append(lines, line)
+			priced = priced || line.Price != nil
+		}
+	}
+	if priced {
+		lines = slices.DeleteFunc(lines, func(l ReceiptLine) bool { return l.Price == nil })
+	}
+	return lines
+}
+
+func parseReceiptLine(raw string) (ReceiptLine, bool) {
+	line := ReceiptLine{Raw: raw}
+	if !strings.ContainsFunc(raw, unicode.IsLetter) || isReceiptNoise(raw) {
+		return line, false
+	}
+
+	s := raw
+	if m := receiptPriceRe.FindStringSubmatchIndex(s); m != nil {
+		if m[3] > m[2] || m[7] > m[6] {
+			return line, false // discounts and voids
+		}
+		price, _ := strconv.ParseFloat(s[m[4]:m[5]], 64)
+		line.Price = &price
+		s = s[:m[0]]
+	}
+
+	var weight *units.Quantity
+	if m := receiptWeightRe.FindStringSubmatch(s); m != nil {
+		if q, ok := receiptQuantity(m[1], m[2]); ok {
+			weight = &q
+		}
+		s = strings.Replace(s, m[0], " ", 1)
+	}
+	perPackage := 1.0
+	if m := receiptPackRe.FindStringSubmatch(s); m != nil {
+		perPackage, _ = strconv.ParseFloat(m[1], 64)
+		s = strings.Replace(s, m[0], " ", 1)
+	}
+	var size *units.Quantity
+	if m := receiptSizeRe.FindStringSubmatch(s); m != nil {
+		if q, ok := receiptQuantity(m[1], m[2]); ok {
+			size = &q
+			s = strings.Replace(s, m[0], " ", 1)
+		}
+	}
+
+	count := 1.0
+	if m := receiptEachRe.FindStringSubmatch(s); m != nil {
+		count, _ = strconv.ParseFloat(m[1], 64)
+		s = strings.Replace(s, m[0], " ", 1)
+	} else if m := receiptLeadCountRe.FindStringSubmatch(s); m != nil && startsWithLetter(s[len(m[0]):]) {
+		count, _ = strconv.ParseFloat(m[1], 64)
+		s = s[len(m[0]):]
+	} else if m := receiptTrailCountRe.FindStringSubmatch(s); m != nil {
+		count, _ = strconv.ParseFloat(m[1], 64)
+		s = s[:len(s)-len(m[0])]
+	}
+
+	s = receiptCodeRe.ReplaceAllString(s, " ")
+	line.Name = strings.Trim(strings.Join(strings.Fields(strings.Map(func(r rune) rune {
+		if strings.ContainsRune("@$*#", r) {
+			return ' '
+		}
+		return r
+	}, s)), " "), " -.,:")
+	if !strings.ContainsFunc(line.Name, unicode.IsLetter) || count <= 0 || perPackage <= 0 {
+		return line, false
+	}
+
+	switch {
+	case weight != nil:
+		line.Quantity, line.Unit = weight.Amount, string(weight.Unit)
+	case size != nil:
+		line.Quantity, line.Unit = units.Round(count*perPackage*size.Amount), string(size.Unit)
+	default:
+		line.Quantity, line.Unit = count*perPackage, string(units.Item)
+	}
+	return line, true
+}
+
+// receiptQuantity reads an amount and a unit as receipts print them
+func receiptQuantity(amount, unit string) (units.Quantity, bool) {
+	v, err := strconv.ParseFloat(amount, 64)
+	if err != nil || v <= 0 {
+		return units.Quantity{}, false
+	}
+	unit = strings.ToLower(unit)
+	if strings.HasPrefix(unit, "fl") {
+		return units.Quantity{Amount: units.Round(v * mlPerFluidOunce), Unit: units.Milliliter}, true
+	}
+	q, err := units.New(v, unit)
+	return q, err == nil
+}
+
+func isReceiptNoise(s string) bool {
+	for _, w := range strings.FieldsFunc(strings.ToUpper(s), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		if receiptNoise[w] {
+			return true
+		}
+	}
+	return false
+}
+
+func startsWithLetter(s string) bool {
+	for _, r := range s {
+		return unicode.IsLetter(r)
+	}
+	return false
+}
+
+// receiptAbbreviations expands words receipts commonly shorten
+var receiptAbbreviations = map[string]string{
+	"org": "organic", "chkn": "chicken", "chk": "chicken", "brst": "breast",
+	"bnls": "boneless", "sknls": "skinless", "grnd": "ground", "bf": "beef",
+	"mlk": "milk", "whl": "whole", "wht": "white", "brd": "bread",
+	"chs": "cheese", "chdr": "cheddar", "ched": "cheddar", "ygrt": "yogurt",
+	"yog": "yogurt", "veg": "vegetable", "frz": "frozen", "frzn": "frozen",
+	"bnna": "banana", "tom": "tomato", "pot": "potato", "grn": "green",
+	"crm": "cream", "btr": "butter", "oj": "orange juice", "pb": "peanut butter",
+	"evoo": "extra virgin olive oil", "spnch": "spinach", "lttc": "lettuce",
+	"strwb": "strawberry", "bluebry": "blueberry", "sausg": "sausage",
+}
+
+// matchStopWords carry no information about which food a name is
+var matchStopWords = map[string]bool{
+	"the": true, "and": true, "of": true, "with": true, "ea": true, "pkg": true,
+	"lg": true, "sm": true, "fresh": true,
+}
+
+// matchWords lower-cases a food name, expands receipt abbreviations and
+// splits it into singular words, dropping numbers and stop words
+func matchWords(name string) []string {
+	var out []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if expanded, ok := receiptAbbreviations[w]; ok {
+			w = expanded
+		}
+		for _, w := range strings.Fields(w) {
+			if matchStopWords[w] || !strings.ContainsFunc(w, unicode.IsLetter) {
+				continue
+			}
+			switch {
+			case len(w) > 4 && strings.HasSuffix(w, "ies"):
+				w = w[:len(w)-3] + "y"
+			case len(w) > 4 && strings.HasSuffix(w, "oes"):
+				w = w[:len(w)-2]
+			case len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss"):
+				w = w[:len(w)-1]
+			}
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// matchScore rates from 0 to 1 how well a food name matches the words of a
+// receipt line. Words count fully when equal, and partly when the receipt
+// word is a prefix or an abbreviation of the food's word; the total is
+// scaled by both names' lengths so extra words on either side cost.
+func matchScore(query []string, name string) float64 {
+	candidate := matchWords(name)
+	if len(query) == 0 || len(candidate) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, q := range query {
+		best := 0.0
+		for _, c := range candidate {
+			best = max(best, wordSimilarity(q, c))
+		}
+		total += best
+	}
+	return 2 * total / float64(len(query)+len(candidate))
+}
+
+func wordSimilarity(q, c string) float64 {
+	switch {
+	case q == c:
+		return 1
+	case len(q) >= 3 && strings.HasPrefix(c, q):
+		return 0.8
+	case len(q) >= 3 && q[0] == c[0] && isSubsequence(q, c):
+		return 0.6
+	}
+	return 0
+}
+
+// isSubsequence reports whether the letters of abbr occur in word in order,
+// e.g. "brst" in "breast"
+func isSubsequence(abbr, word string) bool {
+	i := 0
+	for j := 0; i < len(abbr) && j < len(word); j++ {
+		if abbr[i] == word[j] {
+			i++
+		}
+	}
+	return i == len(abbr)
+}
@@ -0,0 +1,123 @@
+package pantry
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseReceipt(t *testing.T) {
+	text := `FRESH MART #0412
+123 MAIN ST
+BANANAS 2.5 lb @ 0.59/lb      1.48 F
+2 x WHOLE MILK 1 L            5.98 F
+ORG LARGE EGGS 12CT           4.29 F
+YOGURT 3 @ 1.25               3.75 F
+4011 CHKN BRST BNLS           9.87
+12 FL OZ COLD BREW            3.99
+  COUPON SAVINGS              1.00-
+AVOCADO                       -0.50
+SUBTOTAL                     29.36
+TAX                           0.00
+VISA                         29.36`
+
+	want := []ReceiptLine{
+		{Line: 3, Name: "BANANAS", Quantity: 2.5, Unit: "lb", Price: ptr(1.48)},
+		{Line: 4, Name: "WHOLE MILK", Quantity: 2, Unit: "l", Price: ptr(5.98)},
+		{Line: 5, Name: "ORG LARGE EGGS", Quantity: 12, Unit: "item", Price: ptr(4.29)},
+		{Line: 6, Name: "YOGURT", Quantity: 3, Unit: "item", Price: ptr(3.75)},
+		{Line: 7, Name: "CHKN BRST BNLS", Quantity: 1, Unit: "item", Price: ptr(9.87)},
+		{Line: 8, Name: "COLD BREW", Quantity: 354.882, Unit: "ml", Price: ptr(3.99)},
+	}
+
+	got := ParseReceipt(text)
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Line != w.Line || g.Name != w.Name || g.Quantity != w.Quantity || g.Unit != w.Unit {
+			t.Errorf("line %d: got %q %v %s (line %d), want %q %v %s", w.Line, g.Name, g.Quantity, g.Unit, g.Line, w.Name, w.Quantity, w.Unit)
+		}
+		if (g.Price == nil) != (w.Price == nil) || (g.Price != nil && *g.Price != *w.Price) {
+			t.Errorf("line %d: got price %v, want %v", w.Line, g.Price, w.Price)
+		}
+	}
+
+	// A pasted list has no prices, so no line is dropped for lacking one
+	list := ParseReceipt("pasta\n2 lemons\n\nolive oil 500ml")
+	if len(list) != 3 || list[1].Name != "lemons" || list[1].Quantity != 2 || list[2].Unit != "ml" {
+		t.Errorf("unexpected lines from a list: %+v", list)
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	query := matchWords("CHKN BRST BNLS")
+	best := matchScore(query, "Boneless Chicken Breast")
+	for _, worse := range []string{"Chicken Noodle Soup", "Breaded Chicken Breast Nuggets", "Whole Milk"} {
+		if s := matchScore(query, worse); s >= best {
+			t.Errorf("%q scored %.2f, not below the right match's %.2f", worse, s, best)
+		}
+	}
+	if best < minMatchScore {
+		t.Errorf("right match scored %.2f, below the %.2f threshold", best, minMatchScore)
+	}
+
+	if s := matchScore(matchWords("BANANAS"), "Banana"); s != 1 {
+		t.Errorf("plural should match exactly, got %.2f", s)
+	}
+	if s := matchScore(matchWords("OJ"), "Orange Juice"); s != 1 {
+		t.Errorf("abbreviation should expand, got %.2f", s)
+	}
+}
+
+func TestReceiptDraftPlan(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	draft := ReceiptDraft{
+		ID:          1,
+		PurchasedAt: time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC),
+		Lines: []DraftLine{
+			{ReceiptLine: ReceiptLine{Line: 3, Name: "BANANAS", Quantity: 2.5, Unit: "lb", Price: ptr(1.48)}, Match: &FoodMatch{FoodID: 10}},
+			{ReceiptLine: ReceiptLine{Line: 4, Name: "WHOLE MILK", Quantity: 2, Unit: "l"}, Match: &FoodMatch{FoodID: 20}},
+			{ReceiptLine: ReceiptLine{Line: 5, Name: "MYSTERY", Quantity: 1, Unit: "item"}},
+			{ReceiptLine: ReceiptLine{Line: 6, Name: "GUM", Quantity: 1, Unit: "item"}, Match: &FoodMatch{FoodID: 30}},
+		},
+	}
+	foodID := int64(40)
+	qty := 3.0
+
+	planned, skipped, err := draft.plan(CommitReceiptInput{Lines: []CommitLine{
+		{Line: 4, Quantity: &qty, ExpiresAt: "2026-03-20"},
+		{Line: 5, FoodID: &foodID},
+		{Line: 6, Skip: true},
+	}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(planned) != 3 || len(skipped) != 1 || skipped[0] != 6 {
+		t.Fatalf("got %d planned and skipped %v, want 3 and [6]", len(planned), skipped)
+	}
+	if p := planned[0].item; p.foodID != 10 || p.quantity.Amount != 2.5 || *p.price != 1.48 || !p.dates.purchasedAt.Equal(draft.PurchasedAt) {
+		t.Errorf("unexpected first item: %+v", p)
+	}
+	if p := planned[1].item; p.quantity.Amount != 3 || p.dates.expiresAt == nil {
+		t.Errorf("review was not applied: %+v", p)
+	}
+	if p := planned[2].item; p.foodID != 40 {
+		t.Errorf("unmatched line should take the chosen food, got %d", p.foodID)
+	}
+
+	bad := map[string]CommitReceiptInput{
+		"unknown line":    {Lines: []CommitLine{{Line: 99}}},
+		"bad unit":        {Lines: []CommitLine{{Line: 3, Unit: ptr("bushel")}}},
+		"expires earlier": {Lines: []CommitLine{{Line: 3, ExpiresAt: "2026-01-01"}}},
+		"nothing left":    {Lines: []CommitLine{{Line: 3, Skip: true}, {Line: 4, Skip: true}, {Line: 6, Skip: true}}},
+	}
+	for name, in := range bad {
+		if _, _, err := draft.plan(in, now); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%s: expected ErrInvalidInput, got %v", name, err)
+		}
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -7,18 +7,42 @@ import (
 	"github.com/Jayyk09/CUHackIt/pkg/logger"
 )
 
-// RegisterRoutes registers all pantry routes
-func RegisterRoutes(r *http.ServeMux, db *database.DB, log *logger.Logger) {
-	h := NewHandler(db, log)
+// RegisterRoutes registers all pantry routes. notifier is told about every
+// pantry change and may be nil.
+func RegisterRoutes(r *http.ServeMux, db *database.DB, log *logger.Logger, notifier ChangeNotifier) {
+	h := NewHandler(db, log, notifier)
 
 	// Pantry item reads (nested under users)
 	r.HandleFunc("GET /users/{user_id}/pantry", h.ListItems)
 	r.HandleFunc("GET /users/{user_id}/pantry/{id}", h.GetItem)
+	r.HandleFunc("PATCH /users/{user_id}/pantry/{id}", h.UpdateItem)
 	r.HandleFunc("DELETE /users/{user_id}/pantry/{id}", h.DeleteItem)
 
+	// Many adds, updates and deletes in one transaction
+	r.HandleFunc("POST /users/{user_id}/pantry/bulk", h.Bulk)
+
+	// Items about to go bad, most urgent first
+	r.HandleFunc("GET /users/{user_id}/pantry/expiring", h.GetExpiring)
+
+	// Barcode scanning; unknown barcodes wait as pending products
+	r.HandleFunc("POST /users/{user_id}/pantry/scan", h.ScanToPantry)
+	r.HandleFunc("GET /users/{user_id}/pantry/pending", h.ListPending)
+	r.HandleFunc("POST /users/{user_id}/pantry/pending/{id}/complete", h.CompletePending)
+
+	// Receipt import: parse into a draft, review, then commit
+	r.HandleFunc("POST /users/{user_id}/pantry/import", h.ImportReceipt)
+	r.HandleFunc("GET /users/{user_id}/pantry/import/{id}", h.GetReceiptDraft)
+	r.HandleFunc("POST /users/{user_id}/pantry/import/{id}/commit", h.CommitReceipt)
+
+	// Audit log of pantry changes
+	r.HandleFunc("GET /users/{user_id}/pantry/history", h.GetHistory)
+
 	// Category summary
 	r.HandleFunc("GET /users/{user_id}/pantry/summary", h.GetCategorySummary)
 
+	// Allergen cross-check against the user's profile
+	r.HandleFunc("GET /users/{user_id}/pantry/safety", h.GetSafety)
+
 	// Simplified pantry endpoint (uses auth0_id to resolve user)
 	r.HandleFunc("POST /pantry", h.AddToPantry)
 }
@@ -0,0 +1,70 @@
+package pantry
+
+import "github.com/Jayyk09/CUHackIt/internal/agents"
+
+// ItemSafety is the allergen check of one pantry item against its owner
+type ItemSafety struct {
+	ID          int                      `json:"id"`
+	FoodID      int64                    `json:"food_id"`
+	ProductName string                   `json:"product_name"`
+	Conflicts   []agents.ProductConflict `json:"conflicts"`
+}
+
+// SafetyReport lists the pantry items that conflict with the user's allergens
+type SafetyReport struct {
+	UserID       string       `json:"user_id"`
+	Allergens    []string     `json:"allergens"`
+	CheckedCount int          `json:"checked_count"`
+	SafeCount    int          `json:"safe_count"`
+	Contains     int          `json:"contains_count"`    // items that contain an allergen
+	MayContain   int          `json:"may_contain_count"` // items with only trace warnings
+	Items        []ItemSafety `json:"items"`             // conflicting items only
+}
+
+// AddToPantryResult is the created entry plus any allergen warnings
+type AddToPantryResult struct {
+	SimplePantryEntry
+	AllergenWarnings []agents.ProductConflict `json:"allergen_warnings,omitempty"`
+}
+
+// buildSafetyReport checks every item against allergens
+func buildSafetyReport(userID string, allergens []string, items []PantryItemWithFood) SafetyReport {
+	report := SafetyReport{
+		UserID:       userID,
+		Allergens:    allergens,
+		CheckedCount: len(items),
+		Items:        []ItemSafety{},
+	}
+	if report.Allergens == nil {
+		report.Allergens = []string{}
+	}
+
+	for _, item := range items {
+		conflicts := agents.CheckProduct(item.ProductName, item.AllergensEn, item.TracesEn, allergens)
+		if len(conflicts) == 0 {
+			report.SafeCount++
+			continue
+		}
+		if hasContains(conflicts) {
+			report.Contains++
+		} else {
+			report.MayContain++
+		}
+		report.Items = append(report.Items, ItemSafety{
+			ID:          item.ID,
+			FoodID:      item.FoodID,
+			ProductName: item.ProductName,
+			Conflicts:   conflicts,
+		})
+	}
+	return report
+}
+
+func hasContains(conflicts []agents.ProductConflict) bool {
+	for _, c := range conflicts {
+		if c.Level == agents.ConflictContains {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+package pantry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/internal/agents"
+	"github.com/Jayyk09/CUHackIt/internal/food"
+	"github.com/Jayyk09/CUHackIt/internal/units"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var ErrPendingNotFound = errors.New("pending product not found")
+
+// Scan outcomes
+const (
+	ScanAdded   = "added"   // the barcode matched a product, which was added
+	ScanPending = "pending" // no product has the barcode; the user must say which it is
+)
+
+// ScanInput is the input for POST /users/{user_id}/pantry/scan
+type ScanInput struct {
+	Barcode  string  `json:"barcode"`
+	Quantity float64 `json:"quantity"`
+	Unit     string  `json:"unit"`
+	IsFrozen bool    `json:"is_frozen"`
+
+	// Dates are YYYY-MM-DD. PurchasedAt defaults to today.
+	PurchasedAt string `json:"purchased_at,omitempty"`
+	ExpiresAt   string `json:"expires_at,omitempty"`
+	OpenedAt    string `json:"opened_at,omitempty"`
+}
+
+// PendingProduct is a scan of a barcode no product has yet, kept until the
+// user completes it by choosing the product
+type PendingProduct struct {
+	ID          int        `json:"id"`
+	UserID      string     `json:"user_id"`
+	GTIN        string     `json:"gtin"`
+	Quantity    float64    `json:"quantity"`
+	Unit        string     `json:"unit"`
+	IsFrozen    bool       `json:"is_frozen"`
+	PurchasedAt *time.Time `json:"purchased_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	OpenedAt    *time.Time `json:"opened_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// ScanResult is the response to a scan: either the added pantry item or
+// the pending record
+type ScanResult struct {
+	Status           string                   `json:"status"`
+	GTIN             string                   `json:"gtin"`
+	ProductName      string                   `json:"product_name,omitempty"`
+	Item             *SimplePantryEntry       `json:"item,omitempty"`
+	Pending          *PendingProduct          `json:"pending,omitempty"`
+	AllergenWarnings []agents.ProductConflict `json:"allergen_warnings,omitempty"`
+}
+
+// CompletePendingInput is the input for completing a pending product
+type CompletePendingInput struct {
+	FoodID int64 `json:"food_id"`
+}
+
+// isForeignKeyViolation reports whether err is a foreign key violation,
+// e.g. an insert for a user that does not exist
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
+
+// Scan adds the product with the scanned barcode to a user's pantry. A
+// barcode no product in the catalog has resolves to the product the user
+// chose when completing an earlier scan of it; failing that, the scan is
+// kept as a pending product.
+func (r *Repository) Scan(ctx context.Context, userID string, input ScanInput) (*ScanResult, error) {
+	gtin, err := food.NormalizeGTIN(input.Barcode)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	if input.Quantity <= 0 {
+		input.Quantity = 1
+	}
+	quantity, err := units.New(input.Quantity, input.Unit)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	dates, err := parseItemDates(input.PurchasedAt, input.ExpiresAt, input.OpenedAt, nil, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ScanResult{GTIN: gtin}
+	var foodID int64
+	err = r.pool.QueryRow(ctx, `
+		SELECT id, product_name FROM foods
+		WHERE barcode IS NOT NULL AND lpad(barcode, 14, '0') = $1
+		ORDER BY id
+		LIMIT 1
+	`, gtin).Scan(&foodID, &result.ProductName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = r.pool.QueryRow(ctx, `
+			SELECT f.id, f.product_name
+			FROM pending_products p
+			JOIN foods f ON f.id = p.food_id
+			WHERE p.user_id = $1 AND p.gtin = $2 AND p.status = 'completed'
+			ORDER BY p.completed_at DESC
+			LIMIT 1
+		`, userID, gtin).Scan(&foodID, &result.ProductName)
+	}
+	switch {
+	case err == nil:
+		result.Status = ScanAdded
+		result.Item, err = insertItem(ctx, r.pool, userID, newItem{
+			foodID:   foodID,
+			quantity: quantity,
+			isFrozen: input.IsFrozen,
+			dates:    dates,
+			source:   SourceScan,
+		})
+	case errors.Is(err, pgx.ErrNoRows):
+		result.Status = ScanPending
+		result.Pending, err = r.insertPending(ctx, userID, gtin, quantity, input.IsFrozen, dates)
+	}
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// pendingColumns are the columns a PendingProduct is scanned from
+const pendingColumns = `id, user_id, gtin, quantity, unit, is_frozen, purchased_at, expires_at, opened_at, created_at`
+
+func scanPending(row pgx.Row) (*PendingProduct, error) {
+	var p PendingProduct
+	err := row.Scan(&p.ID, &p.UserID, &p.GTIN, &p.Quantity, &p.Unit, &p.IsFrozen, &p.PurchasedAt, &p.ExpiresAt, &p.OpenedAt, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *Repository) insertPending(ctx context.Context, userID, gtin string, quantity units.Quantity, isFrozen bool, dates itemDates) (*PendingProduct, error) {
+	return scanPending(r.pool.QueryRow(ctx, `
+		INSERT INTO pending_products (user_id, gtin, quantity, unit, is_frozen, purchased_at, expires_at, opened_at)
+		VALUES ($1, $2, $3, $4, $5, COALESCE($6, CURRENT_DATE), $7, $8)
+		RETURNING `+pendingColumns,
+		userID, gtin, quantity.Amount, string(quantity.Unit), isFrozen, dates.purchasedAt, dates.expiresAt, dates.openedAt))
+}
+
+// ListPending retrieves a user's pending products, newest first
+func (r *Repository) ListPending(ctx context.Context, userID string) ([]PendingProduct, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+pendingColumns+`
+		FROM pending_products
+		WHERE user_id = $1 AND status = 'pending'
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pending := []PendingProduct{}
+	for rows.Next() {
+		p, err := scanPending(rows)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, *p)
+	}
+	return pending, rows.Err()
+}
+
+// CompletePending resolves a pending product to foodID and adds the scanned
+// item to the pantry. The completed record is the user's own mapping of the
+// barcode, which their later scans use; the shared catalog is left alone,
+// so one user's pick cannot change what a barcode means for everyone.
+func (r *Repository) CompletePending(ctx context.Context, userID string, pendingID int, input CompletePendingInput) (*SimplePantryEntry, error) {
+	if input.FoodID <= 0 {
+		return nil, fmt.Errorf("%w: food_id is required", ErrInvalidInput)
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	pending, err := scanPending(tx.QueryRow(ctx, `
+		SELECT `+pendingColumns+`
+		FROM pending_products
+		WHERE id = $1 AND user_id = $2 AND status = 'pending'
+		FOR UPDATE
+	`, pendingID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrPendingNotFound
+		}
+		return nil, err
+	}
+
+	exists, err := existingFoods(ctx, tx, []int64{input.FoodID})
+	if err != nil {
+		return nil, err
+	}
+	if !exists[input.FoodID] {
+		return nil, fmt.Errorf("%w: food %d does not exist", ErrInvalidInput, input.FoodID)
+	}
+
+	entry, err := insertItem(ctx, tx, userID, newItem{
+		foodID:   input.FoodID,
+		quantity: units.Quantity{Amount: pending.Quantity, Unit: units.Unit(pending.Unit)},
+		isFrozen: pending.IsFrozen,
+		dates:    itemDates{purchasedAt: pending.PurchasedAt, expiresAt: pending.ExpiresAt, openedAt: pending.OpenedAt},
+		source:   SourceScan,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE pending_products
+		SET status = 'completed', food_id = $2, pantry_item_id = $3, completed_at = NOW()
+		WHERE id = $1
+	`, pendingID, input.FoodID, entry.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete pending product: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit pending product: %w", err)
+	}
+	return entry, nil
+}
@@ -0,0 +1,97 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Usage is how many generations a user has made on a day and in its month
+type Usage struct {
+	Daily   int
+	Monthly int
+}
+
+// Store persists per-user generation counts
+type Store interface {
+	// Reserve counts one generation for userID on day unless that would
+	// exceed dailyLimit or monthlyLimit (0 means unlimited). It returns the
+	// usage after the attempt and whether the generation was counted.
+	Reserve(ctx context.Context, userID string, day time.Time, dailyLimit, monthlyLimit int) (Usage, bool, error)
+	// Release gives back one generation previously counted on day
+	Release(ctx context.Context, userID string, day time.Time) error
+}
+
+// Repository is the PostgreSQL Store, backed by the generation_usage table
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+// NewRepository creates a new quota repository
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+// Reserve implements Store. Concurrent reservations for the same user are
+// serialised with a transaction-scoped advisory lock so the limits hold.
+func (r *Repository) Reserve(ctx context.Context, userID string, day time.Time, dailyLimit, monthlyLimit int) (Usage, bool, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return Usage{}, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, userID); err != nil {
+		return Usage{}, false, fmt.Errorf("failed to lock usage: %w", err)
+	}
+
+	var usage Usage
+	err = tx.QueryRow(ctx, `
+		SELECT
+			COALESCE(SUM(count) FILTER (WHERE day = $2), 0),
+			COALESCE(SUM(count), 0)
+		FROM generation_usage
+		WHERE user_id = $1
+		  AND day >= date_trunc('month', $2::date)
+		  AND day <= $2
+	`, userID, day).Scan(&usage.Daily, &usage.Monthly)
+	if err != nil {
+		return Usage{}, false, fmt.Errorf("failed to read usage: %w", err)
+	}
+
+	if (dailyLimit > 0 && usage.Daily >= dailyLimit) || (monthlyLimit > 0 && usage.Monthly >= monthlyLimit) {
+		return usage, false, nil
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO generation_usage (user_id, day, count)
+		VALUES ($1, $2, 1)
+		ON CONFLICT (user_id, day) DO UPDATE SET count = generation_usage.count + 1
+	`, userID, day)
+	if err != nil {
+		return Usage{}, false, fmt.Errorf("failed to record usage: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Usage{}, false, fmt.Errorf("failed to commit usage: %w", err)
+	}
+
+	usage.Daily++
+	usage.Monthly++
+	return usage, true, nil
+}
+
+// Release implements Store
+func (r *Repository) Release(ctx context.Context, userID string, day time.Time) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE generation_usage
+		SET count = GREATEST(count - 1, 0)
+		WHERE user_id = $1 AND day = $2
+	`, userID, day)
+	if err != nil {
+		return fmt.Errorf("failed to release usage: %w", err)
+	}
+	return nil
+}
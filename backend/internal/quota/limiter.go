@@ -0,0 +1,93 @@
+package quota
+
+import (
+	"sync"
+	"time"
+)
+
+// maxIdleBuckets bounds memory use; once reached, buckets that have refilled
+// completely are dropped since they are indistinguishable from new ones
+const maxIdleBuckets = 10000
+
+// KeyedLimiter is a set of token buckets, one per key (a user ID or client
+// IP). Each bucket holds up to burst tokens and refills at rate tokens per
+// second. It is safe for concurrent use.
+type KeyedLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewKeyedLimiter creates a limiter allowing perMinute requests per key on
+// average with bursts of up to burst. A zero or negative perMinute returns nil,
+// which allows everything.
+func NewKeyedLimiter(perMinute float64, burst int) *KeyedLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &KeyedLimiter{
+		rate:    perMinute / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from key's bucket. When the bucket is empty it returns
+// false and how long until the next token is available.
+func (l *KeyedLimiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxIdleBuckets {
+			l.sweep(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// refill adds the tokens earned since the bucket was last touched
+func (l *KeyedLimiter) refill(b *bucket, now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * l.rate
+		if b.tokens > l.burst {
+			b.tokens = l.burst
+		}
+	}
+	b.last = now
+}
+
+// sweep drops buckets that have refilled completely; the caller holds mu
+func (l *KeyedLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+)
+
+var (
+	// ErrRateLimited is matched by a *LimitError caused by a token bucket
+	ErrRateLimited = errors.New("too many generation requests")
+	// ErrQuotaExceeded is matched by a *LimitError caused by a daily or monthly budget
+	ErrQuotaExceeded = errors.New("generation quota exceeded")
+)
+
+// Reason identifies which limit rejected a request
+type Reason string
+
+const (
+	ReasonIPRate   Reason = "ip_rate"
+	ReasonUserRate Reason = "user_rate"
+	ReasonDaily    Reason = "daily_quota"
+	ReasonMonthly  Reason = "monthly_quota"
+)
+
+// LimitError reports a rejected generation and when to try again
+type LimitError struct {
+	Reason     Reason
+	RetryAfter time.Duration
+	Status     *Status // remaining quota, for quota rejections only
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v (%s): retry after %s", e.sentinel(), e.Reason, e.RetryAfter.Round(time.Second))
+}
+
+// Is makes errors.Is match ErrRateLimited or ErrQuotaExceeded
+func (e *LimitError) Is(target error) bool {
+	return target == e.sentinel()
+}
+
+func (e *LimitError) sentinel() error {
+	if e.Reason == ReasonIPRate || e.Reason == ReasonUserRate {
+		return ErrRateLimited
+	}
+	return ErrQuotaExceeded
+}
+
+// RetryAfterSeconds rounds RetryAfter up to whole seconds, at least 1
+func (e *LimitError) RetryAfterSeconds() int {
+	return max(1, int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// Config holds the budgets and rates. Zero values disable the matching limit.
+type Config struct {
+	DailyLimit        int     // generations per user per UTC day
+	MonthlyLimit      int     // generations per user per UTC calendar month
+	UserRatePerMinute float64 // token bucket refill rate per user
+	UserBurst         int
+	IPRatePerMinute   float64 // token bucket refill rate per client IP
+	IPBurst           int
+	TrustProxy        bool // take the client IP from X-Forwarded-For
+}
+
+// Status is a user's remaining generation quota. A zero limit means
+// unlimited, in which case the remaining count is meaningless.
+type Status struct {
+	DailyLimit       int       `json:"daily_limit"`
+	DailyRemaining   int       `json:"daily_remaining"`
+	DailyReset       time.Time `json:"daily_reset"`
+	MonthlyLimit     int       `json:"monthly_limit"`
+	MonthlyRemaining int       `json:"monthly_remaining"`
+	MonthlyReset     time.Time `json:"monthly_reset"`
+}
+
+// WriteHeaders sets the X-Quota-* response headers for the enabled limits
+func (s *Status) WriteHeaders(h http.Header) {
+	if s == nil {
+		return
+	}
+	if s.DailyLimit > 0 {
+		h.Set("X-Quota-Daily-Limit", strconv.Itoa(s.DailyLimit))
+		h.Set("X-Quota-Daily-Remaining", strconv.Itoa(s.DailyRemaining))
+		h.Set("X-Quota-Daily-Reset", strconv.FormatInt(s.DailyReset.Unix(), 10))
+	}
+	if s.MonthlyLimit > 0 {
+		h.Set("X-Quota-Monthly-Limit", strconv.Itoa(s.MonthlyLimit))
+		h.Set("X-Quota-Monthly-Remaining", strconv.Itoa(s.MonthlyRemaining))
+		h.Set("X-Quota-Monthly-Reset", strconv.FormatInt(s.MonthlyReset.Unix(), 10))
+	}
+}
+
+// Headers lists every response header the manager may set, for CORS
+var Headers = []string{
+	"Retry-After",
+	"X-Quota-Daily-Limit", "X-Quota-Daily-Remaining", "X-Quota-Daily-Reset",
+	"X-Quota-Monthly-Limit", "X-Quota-Monthly-Remaining", "X-Quota-Monthly-Reset",
+}
+
+// Reservation is one generation counted against a user's quota. Release it
+// if the generation did not end up calling the model.
+type Reservation struct {
+	Status Status
+
+	userID   string
+	day      time.Time
+	counted  bool
+	released bool
+}
+
+// Manager enforces per-IP and per-user rate limits and per-user daily and
+// monthly generation budgets. All methods are safe on a nil *Manager, which
+// allows everything.
+type Manager struct {
+	cfg    Config
+	store  Store
+	ipRate *KeyedLimiter
+	user   *KeyedLimiter
+	log    *logger.Logger
+	now    func() time.Time
+}
+
+// NewManager creates a Manager persisting usage in store
+func NewManager(cfg Config, store Store, log *logger.Logger) *Manager {
+	return &Manager{
+		cfg:    cfg,
+		store:  store,
+		ipRate: NewKeyedLimiter(cfg.IPRatePerMinute, cfg.IPBurst),
+		user:   NewKeyedLimiter(cfg.UserRatePerMinute, cfg.UserBurst),
+		log:    log,
+		now:    time.Now,
+	}
+}
+
+// Limit takes a token from the client IP's and the user's buckets. It is
+// cheap and should run before any other work on a generate request.
+func (m *Manager) Limit(userID, ip string) error {
+	if m == nil {
+		return nil
+	}
+	if ip != "" {
+		if ok, wait := m.ipRate.Allow(ip); !ok {
+			return &LimitError{Reason: ReasonIPRate, RetryAfter: wait}
+		}
+	}
+	if ok, wait := m.user.Allow(userID); !ok {
+		return &LimitError{Reason: ReasonUserRate, RetryAfter: wait}
+	}
+	return nil
+}
+
+// Reserve counts one generation against userID's budgets. When a budget is
+// exhausted it returns a *LimitError carrying the current Status.
+func (m *Manager) Reserve(ctx context.Context, userID string) (*Reservation, error) {
+	if m == nil {
+		return &Reservation{}, nil
+	}
+
+	now := m.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	res := &Reservation{userID: userID, day: day}
+
+	if m.cfg.DailyLimit <= 0 && m.cfg.MonthlyLimit <= 0 {
+		res.Status = m.status(day, Usage{})
+		return res, nil
+	}
+
+	usage, ok, err := m.store.Reserve(ctx, userID, day, m.cfg.DailyLimit, m.cfg.MonthlyLimit)
+	if err != nil {
+		return nil, err
+	}
+	res.Status = m.status(day, usage)
+	if ok {
+		res.counted = true
+		return res, nil
+	}
+
+	// An exhausted monthly budget outlasts the daily one
+	status := res.Status
+	if m.cfg.MonthlyLimit > 0 && usage.Monthly >= m.cfg.MonthlyLimit {
+		return nil, &LimitError{Reason: ReasonMonthly, RetryAfter: status.MonthlyReset.Sub(now), Status: &status}
+	}
+	return nil, &LimitError{Reason: ReasonDaily, RetryAfter: status.DailyReset.Sub(now), Status: &status}
+}
+
+// Release gives a reserved generation back, e.g. when the result came from
+// the cache or the model could not be reached, and updates res.Status.
+func (m *Manager) Release(ctx context.Context, res *Reservation) {
+	if m == nil || res == nil || !res.counted || res.released {
+		return
+	}
+	res.released = true
+
+	if err := m.store.Release(ctx, res.userID, res.day); err != nil {
+		if m.log != nil {
+			m.log.Error("Failed to release generation quota for user %s: %v", res.userID, err)
+		}
+		return
+	}
+	if res.Status.DailyLimit > 0 {
+		res.Status.DailyRemaining = min(res.Status.DailyLimit, res.Status.DailyRemaining+1)
+	}
+	if res.Status.MonthlyLimit > 0 {
+		res.Status.MonthlyRemaining = min(res.Status.MonthlyLimit, res.Status.MonthlyRemaining+1)
+	}
+}
+
+// status builds the Status for usage on day
+func (m *Manager) status(day time.Time, usage Usage) Status {
+	return Status{
+		DailyLimit:       m.cfg.DailyLimit,
+		DailyRemaining:   max(0, m.cfg.DailyLimit-usage.Daily),
+		DailyReset:       day.AddDate(0, 0, 1),
+		MonthlyLimit:     m.cfg.MonthlyLimit,
+		MonthlyRemaining: max(0, m.cfg.MonthlyLimit-usage.Monthly),
+		MonthlyReset:     time.Date(day.Year(), day.Month()+1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// ClientIP returns the address rate limits are keyed on: the first
+// X-Forwarded-For entry when behind a trusted proxy, else the peer address
+func (m *Manager) ClientIP(r *http.Request) string {
+	if m != nil && m.cfg.TrustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			first, _, _ := strings.Cut(fwd, ",")
+			if ip := strings.TrimSpace(first); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
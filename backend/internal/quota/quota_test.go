@@ -0,0 +1,206 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore is an in-memory Store
+type memStore struct {
+	mu     sync.Mutex
+	counts map[string]map[time.Time]int
+}
+
+func newMemStore() *memStore {
+	return &memStore{counts: make(map[string]map[time.Time]int)}
+}
+
+func (s *memStore) Reserve(_ context.Context, userID string, day time.Time, dailyLimit, monthlyLimit int) (Usage, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var usage Usage
+	for d, n := range s.counts[userID] {
+		if d.Year() == day.Year() && d.Month() == day.Month() && !d.After(day) {
+			usage.Monthly += n
+		}
+		if d.Equal(day) {
+			usage.Daily += n
+		}
+	}
+	if (dailyLimit > 0 && usage.Daily >= dailyLimit) || (monthlyLimit > 0 && usage.Monthly >= monthlyLimit) {
+		return usage, false, nil
+	}
+
+	if s.counts[userID] == nil {
+		s.counts[userID] = make(map[time.Time]int)
+	}
+	s.counts[userID][day]++
+	usage.Daily++
+	usage.Monthly++
+	return usage, true, nil
+}
+
+func (s *memStore) Release(_ context.Context, userID string, day time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counts[userID][day] > 0 {
+		s.counts[userID][day]--
+	}
+	return nil
+}
+
+func TestKeyedLimiterRefills(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewKeyedLimiter(60, 2) // one token per second
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d within burst rejected", i+1)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatal("request beyond burst allowed")
+	}
+	if wait != time.Second {
+		t.Errorf("wait = %s, want 1s", wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("buckets are not independent per key")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("token not refilled after 1s")
+	}
+
+	if ok, _ := NewKeyedLimiter(0, 0).Allow("a"); !ok {
+		t.Error("disabled limiter rejected a request")
+	}
+}
+
+func TestManagerLimitReasons(t *testing.T) {
+	m := NewManager(Config{UserRatePerMinute: 1, UserBurst: 1, IPRatePerMinute: 1, IPBurst: 2}, newMemStore(), nil)
+
+	if err := m.Limit("u1", "10.0.0.1"); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+
+	err := m.Limit("u1", "10.0.0.2")
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Reason != ReasonUserRate {
+		t.Fatalf("err = %v, want user rate limit", err)
+	}
+	if !errors.Is(err, ErrRateLimited) || errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("rate limit error matches the wrong sentinel: %v", err)
+	}
+
+	if err := m.Limit("u2", "10.0.0.1"); err != nil {
+		t.Fatalf("second request from IP within burst: %v", err)
+	}
+	err = m.Limit("u3", "10.0.0.1")
+	if !errors.As(err, &limitErr) || limitErr.Reason != ReasonIPRate {
+		t.Fatalf("err = %v, want IP rate limit", err)
+	}
+}
+
+func TestManagerReserveAndRelease(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 30, 22, 0, 0, 0, time.UTC)
+	m := NewManager(Config{DailyLimit: 2, MonthlyLimit: 3}, newMemStore(), nil)
+	m.now = func() time.Time { return now }
+
+	res, err := m.Reserve(ctx, "u1")
+	if err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if res.Status.DailyRemaining != 1 || res.Status.MonthlyRemaining != 2 {
+		t.Errorf("remaining = %d/%d, want 1/2", res.Status.DailyRemaining, res.Status.MonthlyRemaining)
+	}
+	if want := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC); !res.Status.DailyReset.Equal(want) {
+		t.Errorf("daily reset = %s, want %s", res.Status.DailyReset, want)
+	}
+	if want := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC); !res.Status.MonthlyReset.Equal(want) {
+		t.Errorf("monthly reset = %s, want %s", res.Status.MonthlyReset, want)
+	}
+
+	// A released generation is given back
+	m.Release(ctx, res)
+	m.Release(ctx, res)
+	if res.Status.DailyRemaining != 2 {
+		t.Errorf("remaining after release = %d, want 2", res.Status.DailyRemaining)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := m.Reserve(ctx, "u1"); err != nil {
+			t.Fatalf("Reserve %d: %v", i+1, err)
+		}
+	}
+	_, err = m.Reserve(ctx, "u1")
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Reason != ReasonDaily {
+		t.Fatalf("err = %v, want daily quota", err)
+	}
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("quota error does not match ErrQuotaExceeded: %v", err)
+	}
+	if limitErr.RetryAfter != 2*time.Hour || limitErr.Status.DailyRemaining != 0 {
+		t.Errorf("retry after %s with %d remaining, want 2h and 0", limitErr.RetryAfter, limitErr.Status.DailyRemaining)
+	}
+
+	// Next day: one left for the month, then the monthly budget is exhausted
+	now = time.Date(2024, 3, 31, 9, 0, 0, 0, time.UTC)
+	if _, err := m.Reserve(ctx, "u1"); err != nil {
+		t.Fatalf("Reserve on another day: %v", err)
+	}
+	_, err = m.Reserve(ctx, "u1")
+	if !errors.As(err, &limitErr) || limitErr.Reason != ReasonMonthly {
+		t.Fatalf("err = %v, want monthly quota", err)
+	}
+}
+
+func TestStatusHeadersAndNilManager(t *testing.T) {
+	var m *Manager
+	if err := m.Limit("u1", "10.0.0.1"); err != nil {
+		t.Errorf("nil manager Limit: %v", err)
+	}
+	res, err := m.Reserve(context.Background(), "u1")
+	if err != nil {
+		t.Fatalf("nil manager Reserve: %v", err)
+	}
+	m.Release(context.Background(), res)
+
+	rec := httptest.NewRecorder()
+	res.Status.WriteHeaders(rec.Header())
+	if len(rec.Header()) != 0 {
+		t.Errorf("headers written without limits: %v", rec.Header())
+	}
+
+	status := &Status{DailyLimit: 5, DailyRemaining: 4, DailyReset: time.Unix(100, 0)}
+	status.WriteHeaders(rec.Header())
+	if rec.Header().Get("X-Quota-Daily-Remaining") != "4" || rec.Header().Get("X-Quota-Daily-Reset") != "100" {
+		t.Errorf("headers = %v", rec.Header())
+	}
+	if rec.Header().Get("X-Quota-Monthly-Limit") != "" {
+		t.Error("monthly header written for a disabled limit")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+
+	if ip := NewManager(Config{}, nil, nil).ClientIP(r); ip != "192.0.2.1" {
+		t.Errorf("untrusted ClientIP = %q, want peer address", ip)
+	}
+	if ip := NewManager(Config{TrustProxy: true}, nil, nil).ClientIP(r); ip != "203.0.113.7" {
+		t.Errorf("trusted ClientIP = %q, want first forwarded address", ip)
+	}
+}
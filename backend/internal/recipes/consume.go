@@ -0,0 +1,212 @@
+package recipes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/internal/agents"
+	"github.com/Jayyk09/CUHackIt/internal/pantry"
+	"github.com/Jayyk09/CUHackIt/internal/units"
+	"github.com/google/uuid"
+)
+
+// depleted is the remaining quantity below which a pantry row is deleted
+const depleted = 0.0005
+
+// CookInput is the optional body of POST /users/{user_id}/recipes/{id}/cooked
+type CookInput struct {
+	// ConsumePantry takes the recipe's pantry ingredients out of the pantry;
+	// it defaults to true
+	ConsumePantry *bool `json:"consume_pantry,omitempty"`
+	// Servings scales the amounts consumed; 0 means the recipe's servings
+	Servings int `json:"servings,omitempty"`
+}
+
+// ConsumedItem is the change cooking made to one pantry row, in the row's unit
+type ConsumedItem struct {
+	PantryItemID   int       `json:"pantry_item_id"`
+	FoodID         int64     `json:"food_id"`
+	ProductName    string    `json:"product_name"`
+	Ingredients    []string  `json:"ingredients"` // recipe ingredients drawn from the row
+	Unit           string    `json:"unit"`
+	QuantityBefore float64   `json:"quantity_before"`
+	QuantityAfter  float64   `json:"quantity_after"`
+	Consumed       float64   `json:"consumed"`
+	Deleted        bool      `json:"deleted"` // the row was used up and removed
+	IsFrozen       bool      `json:"is_frozen"`
+	AddedAt        time.Time `json:"added_at"`
+
+	// Dates and price of the row, so a deleted row is restored as it was
+	PurchasedAt   *time.Time `json:"purchased_at,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	OpenedAt      *time.Time `json:"opened_at,omitempty"`
+	ShelfLifeDays *int       `json:"shelf_life_days,omitempty"`
+	Price         *float64   `json:"price,omitempty"`
+}
+
+// event is the pantry history entry for the item going from before to
+// after by cooking or undoing recipeID
+func (item ConsumedItem) event(userID string, recipeID uuid.UUID, action string, before, after float64) pantry.Event {
+	unit := units.Unit(item.Unit)
+	e := pantry.NewEvent(action, units.Quantity{Amount: before, Unit: unit}, units.Quantity{Amount: after, Unit: unit}, item.ProductName)
+	recipe := recipeID.String()
+	e.UserID, e.PantryItemID, e.FoodID = userID, item.PantryItemID, item.FoodID
+	e.Price, e.Source, e.RecipeID = item.Price, pantry.SourceRecipe, &recipe
+	if action == pantry.ActionConsumed {
+		e.Reason = pantry.ReasonEaten
+	}
+	return e
+}
+
+// UnconsumedIngredient is a pantry ingredient that was not, or not fully,
+// taken out of the pantry
+type UnconsumedIngredient struct {
+	Ingredient string `json:"ingredient"`
+	Amount     string `json:"amount"`
+	Unit       string `json:"unit,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+// Consumption records what cooking a recipe took out of the pantry so it
+// can be undone
+type Consumption struct {
+	ID         uuid.UUID              `json:"id"`
+	RecipeID   uuid.UUID              `json:"recipe_id"`
+	Scale      float64                `json:"scale"` // servings cooked / recipe servings
+	Items      []ConsumedItem         `json:"items"`
+	Unconsumed []UnconsumedIngredient `json:"unconsumed"`
+	CreatedAt  time.Time              `json:"created_at"`
+	UndoneAt   *time.Time             `json:"undone_at,omitempty"`
+}
+
+// CookResult is the cooked recipe and, when the pantry was consumed, the diff
+type CookResult struct {
+	*Recipe
+	Consumption *Consumption `json:"consumption,omitempty"`
+}
+
+// pantryRow is a pantry item as consumption sees it
+type pantryRow struct {
+	id       int
+	foodID   int64
+	name     string
+	quantity float64
+	unit     string
+	isFrozen bool
+	addedAt  time.Time
+
+	purchasedAt   *time.Time
+	expiresAt     *time.Time
+	openedAt      *time.Time
+	shelfLifeDays *int
+	price         *float64
+}
+
+// planConsumption works out how much of each pantry row the recipe's
+// from_pantry ingredients use, scaled by scale. Rows are drawn down in the
+// order given, so callers pass the oldest purchase first; an ingredient spread over
+// several rows of the same food empties them in turn. rows is not modified.
+func planConsumption(ingredients []Ingredient, rows []pantryRow, scale float64) ([]ConsumedItem, []UnconsumedIngredient) {
+	remaining := make([]float64, len(rows))
+	for i, row := range rows {
+		remaining[i] = row.quantity
+	}
+
+	items := []ConsumedItem{}
+	unconsumed := []UnconsumedIngredient{}
+	touched := make(map[int]int) // row index -> items index
+
+	for _, ing := range ingredients {
+		if !ing.FromPantry {
+			continue
+		}
+		skip := func(reason string) {
+			unconsumed = append(unconsumed, UnconsumedIngredient{Ingredient: ing.Name, Amount: ing.Amount, Unit: ing.Unit, Reason: reason})
+		}
+
+		need, err := units.ParseQuantity(ing.Amount, ing.Unit)
+		if err != nil {
+			skip("amount could not be read")
+			continue
+		}
+		need.Amount *= scale
+
+		var convErr error
+		matched, drawn := false, false
+		for i, row := range rows {
+			if need.Amount <= depleted {
+				break
+			}
+			if agents.MatchPantryName(ing.Name, []string{row.name}) < 0 {
+				continue
+			}
+			matched = true
+			if remaining[i] <= depleted {
+				continue
+			}
+
+			inRowUnit, err := units.Convert(need, units.Unit(row.unit), row.name)
+			if err != nil {
+				convErr = err
+				continue
+			}
+			take := min(inRowUnit.Amount, remaining[i])
+			if take <= 0 {
+				continue
+			}
+			remaining[i] = units.Round(remaining[i] - take)
+			need.Amount -= need.Amount * take / inRowUnit.Amount
+			drawn = true
+
+			idx, ok := touched[i]
+			if !ok {
+				idx = len(items)
+				touched[i] = idx
+				items = append(items, ConsumedItem{
+					PantryItemID:   row.id,
+					FoodID:         row.foodID,
+					ProductName:    row.name,
+					Unit:           row.unit,
+					QuantityBefore: row.quantity,
+					IsFrozen:       row.isFrozen,
+					AddedAt:        row.addedAt,
+					PurchasedAt:    row.purchasedAt,
+					ExpiresAt:      row.expiresAt,
+					OpenedAt:       row.openedAt,
+					ShelfLifeDays:  row.shelfLifeDays,
+					Price:          row.price,
+				})
+			}
+			item := &items[idx]
+			item.Ingredients = appendIngredient(item.Ingredients, ing.Name)
+			item.Consumed = units.Round(row.quantity - remaining[i])
+			item.QuantityAfter = remaining[i]
+			item.Deleted = remaining[i] <= depleted
+			if item.Deleted {
+				item.QuantityAfter = 0
+				item.Consumed = row.quantity
+			}
+		}
+
+		switch {
+		case !matched:
+			skip("not found in the pantry")
+		case need.Amount > depleted && !drawn && convErr != nil:
+			skip(fmt.Sprintf("cannot convert %s to the pantry's unit", need.Unit))
+		case need.Amount > depleted:
+			skip(fmt.Sprintf("pantry ran out, %s %s short", units.FormatAmount(need.Amount), need.Unit))
+		}
+	}
+	return items, unconsumed
+}
+
+// appendIngredient appends name unless it is already listed
+func appendIngredient(list []string, name string) []string {
+	for _, existing := range list {
+		if strings.EqualFold(existing, name) {
+			return list
+		}
+	}
+	return append(list, name)
+}
@@ -0,0 +1,85 @@
+package recipes
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanConsumption(t *testing.T) {
+	old := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := []pantryRow{
+		{id: 1, foodID: 10, name: "Chicken Breast", quantity: 1, unit: "lb", addedAt: old},
+		{id: 2, foodID: 10, name: "Chicken Breast", quantity: 2, unit: "lb", addedAt: old.Add(time.Hour)},
+		{id: 3, foodID: 20, name: "Whole Milk", quantity: 1, unit: "l", addedAt: old},
+		{id: 4, foodID: 30, name: "Eggs", quantity: 12, unit: "item", addedAt: old},
+		{id: 5, foodID: 40, name: "Mystery Powder", quantity: 500, unit: "g", addedAt: old},
+	}
+	ingredients := []Ingredient{
+		{Name: "chicken breast", Amount: "1 1/2", Unit: "lbs", FromPantry: true},
+		{Name: "milk", Amount: "1", Unit: "cup", FromPantry: true},
+		{Name: "eggs", Amount: "2", FromPantry: true},
+		{Name: "mystery powder", Amount: "1", Unit: "tbsp", FromPantry: true},
+		{Name: "saffron", Amount: "1", Unit: "pinch", FromPantry: true},
+		{Name: "basil", Amount: "1", Unit: "bunch", FromPantry: true},
+		{Name: "olive oil", Amount: "2", Unit: "tbsp"},
+	}
+
+	items, unconsumed := planConsumption(ingredients, rows, 2)
+
+	byID := make(map[int]ConsumedItem)
+	for _, item := range items {
+		byID[item.PantryItemID] = item
+	}
+	if len(items) != 4 {
+		t.Fatalf("expected 4 rows touched, got %+v", items)
+	}
+	if first := byID[1]; !first.Deleted || first.Consumed != 1 || first.QuantityAfter != 0 {
+		t.Errorf("expected the oldest chicken row used up, got %+v", first)
+	}
+	if second := byID[2]; !second.Deleted || second.Consumed != 2 {
+		// 3 lb needed at double servings: 1 from the first row, 2 from the second
+		t.Errorf("expected the second chicken row used up, got %+v", second)
+	}
+	if milk := byID[3]; milk.Unit != "l" || milk.QuantityAfter != 0.527 {
+		t.Errorf("expected 2 cups taken from 1 l of milk, got %+v", milk)
+	}
+	if eggs := byID[4]; eggs.QuantityAfter != 8 || eggs.Consumed != 4 {
+		t.Errorf("expected 4 eggs consumed, got %+v", eggs)
+	}
+	if rows[0].quantity != 1 {
+		t.Error("planConsumption must not modify rows")
+	}
+
+	reasons := make(map[string]string)
+	for _, u := range unconsumed {
+		reasons[u.Ingredient] = u.Reason
+	}
+	want := map[string]string{
+		"mystery powder": "cannot convert",
+		"saffron":        "could not be read",
+		"basil":          "not found",
+	}
+	if len(reasons) != len(want) {
+		t.Errorf("unconsumed = %+v", unconsumed)
+	}
+	for name, reason := range want {
+		if !strings.Contains(reasons[name], reason) {
+			t.Errorf("%s: reason = %q, want it to mention %q", name, reasons[name], reason)
+		}
+	}
+}
+
+func TestPlanConsumptionRunsOut(t *testing.T) {
+	rows := []pantryRow{{id: 1, name: "Brown Rice", quantity: 200, unit: "g"}}
+	items, unconsumed := planConsumption([]Ingredient{
+		{Name: "brown rice", Amount: "2", Unit: "cups", FromPantry: true},
+	}, rows, 1)
+
+	if len(items) != 1 || !items[0].Deleted || items[0].Consumed != 200 {
+		t.Fatalf("expected the rice used up, got %+v", items)
+	}
+	if len(unconsumed) != 1 || !strings.Contains(unconsumed[0].Reason, "ran out") {
+		t.Errorf("expected the shortfall reported, got %+v", unconsumed)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/Jayyk09/CUHackIt/internal/pantry"
+	"github.com/Jayyk09/CUHackIt/internal/units"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -15,6 +18,10 @@ var (
 	ErrRecipeNotFound = errors.New("recipe not found")
 	ErrUnauthorized   = errors.New("unauthorized to access this recipe")
 	ErrInvalidInput   = errors.New("invalid input")
+
+	ErrConsumptionNotFound = errors.New("consumption not found")
+	ErrAlreadyUndone       = errors.New("consumption already undone")
+	ErrCannotRestore       = errors.New("consumed quantity cannot be restored")
 )
 
 // RecipeDifficulty represents the difficulty level
@@ -322,10 +329,19 @@ func (r *Repository) Update(ctx context.Context, id uuid.UUID, input UpdateRecip
 	return &recipe, nil
 }
 
+// querier is satisfied by both the pool and a transaction
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 // MarkAsCooked increments the times_cooked counter and updates last_cooked_at
 func (r *Repository) MarkAsCooked(ctx context.Context, id uuid.UUID) (*Recipe, error) {
+	return markAsCooked(ctx, r.pool, id)
+}
+
+func markAsCooked(ctx context.Context, q querier, id uuid.UUID) (*Recipe, error) {
 	var recipe Recipe
-	err := r.pool.QueryRow(ctx, `
+	err := q.QueryRow(ctx, `
 		UPDATE recipes
 		SET times_cooked = times_cooked + 1,
 		    last_cooked_at = NOW()
@@ -354,6 +370,206 @@ func (r *Repository) MarkAsCooked(ctx context.Context, id uuid.UUID) (*Recipe, e
 	return &recipe, nil
 }
 
+// CookAndConsume marks a recipe cooked and takes its from_pantry ingredients,
+// scaled by scale, out of the user's pantry in one transaction. Pantry rows
+// are drawn down oldest first and deleted when used up. The consumption is
+// recorded so UndoCook can put it back.
+func (r *Repository) CookAndConsume(ctx context.Context, userID string, recipeID uuid.UUID, ingredients []Ingredient, scale float64) (*Recipe, *Consumption, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT p.id, p.food_id, f.product_name, p.quantity, p.unit, p.is_frozen, p.added_at,
+		       p.purchased_at, p.expires_at, p.opened_at, p.shelf_life_days, p.price
+		FROM pantry_items p
+		JOIN foods f ON f.id = p.food_id
+		WHERE p.user_id = $1
+		ORDER BY p.purchased_at, p.added_at, p.id
+		FOR UPDATE OF p
+	`, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to lock pantry: %w", err)
+	}
+	var stock []pantryRow
+	for rows.Next() {
+		var row pantryRow
+		if err := rows.Scan(&row.id, &row.foodID, &row.name, &row.quantity, &row.unit, &row.isFrozen, &row.addedAt,
+			&row.purchasedAt, &row.expiresAt, &row.openedAt, &row.shelfLifeDays, &row.price); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		stock = append(stock, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	consumption := &Consumption{RecipeID: recipeID, Scale: scale}
+	consumption.Items, consumption.Unconsumed = planConsumption(ingredients, stock, scale)
+
+	for _, item := range consumption.Items {
+		event := item.event(userID, recipeID, pantry.ActionConsumed, item.QuantityBefore, item.QuantityAfter)
+		if err := pantry.RecordEvent(ctx, tx, event); err != nil {
+			return nil, nil, err
+		}
+		if item.Deleted {
+			_, err = tx.Exec(ctx, `DELETE FROM pantry_items WHERE id = $1`, item.PantryItemID)
+		} else {
+			_, err = tx.Exec(ctx, `UPDATE pantry_items SET quantity = $2 WHERE id = $1`, item.PantryItemID, item.QuantityAfter)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to update pantry item %d: %w", item.PantryItemID, err)
+		}
+	}
+
+	itemsJSON, err := json.Marshal(consumption.Items)
+	if err != nil {
+		return nil, nil, err
+	}
+	unconsumedJSON, err := json.Marshal(consumption.Unconsumed)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO pantry_consumptions (user_id, recipe_id, scale, items, unconsumed)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, userID, recipeID, scale, itemsJSON, unconsumedJSON).Scan(&consumption.ID, &consumption.CreatedAt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to record consumption: %w", err)
+	}
+
+	recipe, err := markAsCooked(ctx, tx, recipeID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit consumption: %w", err)
+	}
+	return recipe, consumption, nil
+}
+
+// UndoCook reverses a CookAndConsume: consumed quantities go back to their
+// pantry rows, converted to the unit each row has now, deleted rows are
+// restored with their original id, and the recipe's times_cooked is
+// decremented. ErrCannotRestore is returned when a row's unit no longer
+// converts from the consumed one.
+func (r *Repository) UndoCook(ctx context.Context, userID string, recipeID, consumptionID uuid.UUID) (*Recipe, *Consumption, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	consumption := &Consumption{ID: consumptionID, RecipeID: recipeID}
+	var itemsJSON, unconsumedJSON []byte
+	err = tx.QueryRow(ctx, `
+		SELECT scale, items, unconsumed, created_at, undone_at
+		FROM pantry_consumptions
+		WHERE id = $1 AND user_id = $2 AND recipe_id = $3
+		FOR UPDATE
+	`, consumptionID, userID, recipeID).Scan(&consumption.Scale, &itemsJSON, &unconsumedJSON, &consumption.CreatedAt, &consumption.UndoneAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, ErrConsumptionNotFound
+		}
+		return nil, nil, err
+	}
+	if consumption.UndoneAt != nil {
+		return nil, nil, ErrAlreadyUndone
+	}
+	if err := json.Unmarshal(itemsJSON, &consumption.Items); err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(unconsumedJSON, &consumption.Unconsumed); err != nil {
+		return nil, nil, err
+	}
+
+	for _, item := range consumption.Items {
+		// The row may have been edited since, possibly into another unit;
+		// the consumed quantity goes back in whatever unit it has now
+		back := units.Quantity{Amount: item.Consumed, Unit: units.Unit(item.Unit)}
+		var owner, unit string
+		err := tx.QueryRow(ctx, `
+			SELECT user_id, unit FROM pantry_items WHERE id = $1 FOR UPDATE
+		`, item.PantryItemID).Scan(&owner, &unit)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+		case err != nil:
+			return nil, nil, fmt.Errorf("failed to lock pantry item %d: %w", item.PantryItemID, err)
+		case owner != userID:
+			return nil, nil, fmt.Errorf("%w: pantry item %d belongs to another user", ErrCannotRestore, item.PantryItemID)
+		case unit != item.Unit:
+			back, err = units.Convert(back, units.Unit(unit), item.ProductName)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: pantry item %d is now in %s: %v", ErrCannotRestore, item.PantryItemID, unit, err)
+			}
+		}
+
+		var restored float64
+		err = tx.QueryRow(ctx, `
+			INSERT INTO pantry_items (id, user_id, food_id, quantity, unit, is_frozen, added_at,
+			                          purchased_at, expires_at, opened_at, shelf_life_days, price)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE($8, $7::date), $9, $10, $11, $12)
+			ON CONFLICT (id) DO UPDATE SET quantity = pantry_items.quantity + EXCLUDED.quantity
+			WHERE pantry_items.user_id = EXCLUDED.user_id AND pantry_items.unit = EXCLUDED.unit
+			RETURNING quantity
+		`, item.PantryItemID, userID, item.FoodID, back.Amount, string(back.Unit), item.IsFrozen, item.AddedAt,
+			item.PurchasedAt, item.ExpiresAt, item.OpenedAt, item.ShelfLifeDays, item.Price).Scan(&restored)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to restore pantry item %d: %w", item.PantryItemID, err)
+		}
+		item.Unit = string(back.Unit)
+		event := item.event(userID, recipeID, pantry.ActionRestored, units.Round(restored-back.Amount), restored)
+		if err := pantry.RecordEvent(ctx, tx, event); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	err = tx.QueryRow(ctx, `
+		UPDATE pantry_consumptions SET undone_at = NOW() WHERE id = $1 RETURNING undone_at
+	`, consumptionID).Scan(&consumption.UndoneAt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to mark consumption undone: %w", err)
+	}
+
+	var recipe Recipe
+	err = tx.QueryRow(ctx, `
+		UPDATE recipes
+		SET times_cooked = GREATEST(times_cooked - 1, 0)
+		WHERE id = $1
+		RETURNING id, user_id, title, description, cuisine,
+		          prep_time_minutes, cook_time_minutes, total_time_minutes, servings, difficulty,
+		          ingredients, missing_ingredients, instructions,
+		          calories_per_serving, protein_g, carbs_g, fat_g,
+		          source, ai_model, is_favorite, times_cooked, last_cooked_at,
+		          rating, notes, tags, created_at, updated_at
+	`, recipeID).Scan(
+		&recipe.ID, &recipe.UserID, &recipe.Title, &recipe.Description, &recipe.Cuisine,
+		&recipe.PrepTimeMinutes, &recipe.CookTimeMinutes, &recipe.TotalTimeMinutes, &recipe.Servings, &recipe.Difficulty,
+		&recipe.Ingredients, &recipe.MissingIngredients, &recipe.Instructions,
+		&recipe.CaloriesPerServing, &recipe.ProteinG, &recipe.CarbsG, &recipe.FatG,
+		&recipe.Source, &recipe.AIModel, &recipe.IsFavorite, &recipe.TimesCooked, &recipe.LastCookedAt,
+		&recipe.Rating, &recipe.Notes, &recipe.Tags, &recipe.CreatedAt, &recipe.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, ErrRecipeNotFound
+		}
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit undo: %w", err)
+	}
+	return &recipe, consumption, nil
+}
+
 // Delete removes a recipe
 func (r *Repository) Delete(ctx context.Context, id uuid.UUID) error {
 	result, err := r.pool.Exec(ctx, `DELETE FROM recipes WHERE id = $1`, id)
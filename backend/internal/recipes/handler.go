@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
@@ -11,6 +13,7 @@ import (
 	"github.com/Jayyk09/CUHackIt/internal/agents"
 	"github.com/Jayyk09/CUHackIt/internal/database"
 	"github.com/Jayyk09/CUHackIt/internal/pantry"
+	"github.com/Jayyk09/CUHackIt/internal/quota"
 	"github.com/Jayyk09/CUHackIt/internal/users"
 	"github.com/Jayyk09/CUHackIt/pkg/logger"
 	"github.com/Jayyk09/CUHackIt/services/gemini"
@@ -20,26 +23,51 @@ import (
 // Handler handles HTTP requests for recipes
 type Handler struct {
 	repo         *Repository
-	pantryRepo   *pantry.Repository
-	userRepo     *users.Repository
+	pantryRepo   pantryLister
+	userRepo     userGetter
 	orchestrator *agents.Orchestrator
+	notifier     pantry.ChangeNotifier
+	limits       *quota.Manager
 	log          *logger.Logger
 }
 
-// NewHandler creates a new recipe handler
-func NewHandler(db *database.DB, geminiClient *gemini.Client, log *logger.Logger) *Handler {
+// pantryLister and userGetter are the reads recipe generation makes,
+// satisfied by the pantry and users repositories
+type pantryLister interface {
+	ListByUserID(ctx context.Context, userID string) ([]pantry.PantryItemWithFood, error)
+}
+
+type userGetter interface {
+	GetByID(ctx context.Context, id string) (*users.User, error)
+}
+
+// NewHandler creates a new recipe handler. cache may be nil to disable
+// result caching and limits nil to disable quotas and rate limiting.
+func NewHandler(db *database.DB, provider gemini.Provider, cache *agents.ResultCache, limits *quota.Manager, log *logger.Logger) *Handler {
 	var orchestrator *agents.Orchestrator
-	if geminiClient != nil {
-		orchestrator = agents.NewOrchestrator(geminiClient, log)
+	if provider != nil {
+		orchestrator = agents.NewOrchestrator(provider, log).WithCache(cache)
 	}
 
-	return &Handler{
+	h := &Handler{
 		repo:         NewRepository(db.Pool),
 		pantryRepo:   pantry.NewRepository(db.Pool),
 		userRepo:     users.NewRepository(db.Pool),
 		orchestrator: orchestrator,
+		limits:       limits,
 		log:          log,
 	}
+	if cache != nil {
+		h.notifier = cache
+	}
+	return h
+}
+
+// pantryChanged notifies the ChangeNotifier, if any
+func (h *Handler) pantryChanged(userID string) {
+	if h.notifier != nil {
+		h.notifier.PantryChanged(userID)
+	}
 }
 
 // writeJSON writes a JSON response
@@ -66,15 +94,21 @@ func (h *Handler) getUserID(r *http.Request) (string, error) {
 
 // GenerateRecipesRequest is the request body for generating recipes
 type GenerateRecipesRequest struct {
-	Mode        string `json:"mode"`         // "pantry_only" | "flexible" | "both" | "personal" | "spoiling"
+	Mode        string `json:"mode"`         // "pantry_only" | "flexible" | "both" | "personal" | "spoiling" | "ensemble"
 	RecipeCount int    `json:"recipe_count"` // 1-3
 	UserPrompt  string `json:"user_prompt"`  // Optional free-text (e.g. "grilled chicken")
+
+	ForceRefresh bool `json:"force_refresh"` // Skip the result cache and generate fresh recipes
+
+	// Keep pantry items whose allergens or traces conflict with the user's
+	// allergens away from the agents
+	ExcludeUnsafePantryItems bool `json:"exclude_unsafe_pantry_items"`
 }
 
 // GenerateRecipes handles POST /users/{user_id}/recipes/generate
 func (h *Handler) GenerateRecipes(w http.ResponseWriter, r *http.Request) {
 	if h.orchestrator == nil {
-		h.writeError(w, http.StatusServiceUnavailable, "recipe generation not available - Gemini API not configured")
+		h.writeError(w, http.StatusServiceUnavailable, "recipe generation not available - LLM provider not configured")
 		return
 	}
 
@@ -84,6 +118,11 @@ func (h *Handler) GenerateRecipes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := h.limits.Limit(userID, h.limits.ClientIP(r)); err != nil {
+		h.writeLimitError(w, err)
+		return
+	}
+
 	var req GenerateRecipesRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		// Use defaults if no body provided
@@ -126,47 +165,16 @@ func (h *Handler) GenerateRecipes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert pantry items to agent format with computed expiration data
-	agentPantryItems := make([]agents.PantryItem, len(pantryItems))
-	for i, item := range pantryItems {
-		category := ""
-		if item.Category != nil {
-			category = *item.Category
-		}
-
-		// Compute expiration from added_at + shelf_life
-		var expirationDate *time.Time
-		isExpiringSoon := false
-		isExpired := false
-		if item.ShelfLife != nil {
-			shelfDays := *item.ShelfLife
-			// Frozen items get 4x shelf life
-			if item.IsFrozen {
-				shelfDays *= 4
-			}
-			exp := item.AddedAt.AddDate(0, 0, shelfDays)
-			expirationDate = &exp
-			daysRemaining := int(time.Until(exp).Hours() / 24)
-			if daysRemaining <= 3 {
-				isExpiringSoon = true
-			}
-			if daysRemaining < 0 {
-				isExpired = true
-			}
-		}
-
-		agentPantryItems[i] = agents.PantryItem{
-			ID:             strconv.Itoa(item.ID),
-			Name:           item.ProductName,
-			Category:       category,
-			Quantity:       float64(item.Quantity),
-			Unit:           "item",
-			ExpirationDate: expirationDate,
-			IsExpiringSoon: isExpiringSoon,
-			IsExpired:      isExpired,
-		}
+	// Count this generation against the user's budgets
+	reservation, err := h.limits.Reserve(r.Context(), userID)
+	if err != nil {
+		h.writeLimitError(w, err)
+		return
 	}
 
+	// Convert pantry items to agent format with computed expiration data
+	agentPantryItems := pantry.AgentItems(pantryItems, time.Now())
+
 	// Determine mode
 	var mode agents.OrchestratorMode
 	switch req.Mode {
@@ -178,6 +186,8 @@ func (h *Handler) GenerateRecipes(w http.ResponseWriter, r *http.Request) {
 		mode = agents.ModeSpoiling
 	case "personal":
 		mode = agents.ModePersonal
+	case "ensemble":
+		mode = agents.ModeEnsemble
 	default:
 		mode = agents.ModePantryOnly
 	}
@@ -190,6 +200,7 @@ func (h *Handler) GenerateRecipes(w http.ResponseWriter, r *http.Request) {
 		RecipeRequest: agents.RecipeRequest{
 			PantryItems:        agentPantryItems,
 			Allergens:          user.Allergens,
+			AllergenPolicy:     agents.AllergenPolicy(user.AllergenPolicy),
 			DietaryPreferences: user.DietaryPreferences,
 			NutritionalGoals:   user.NutritionalGoals,
 			CookingSkill:       user.CookingSkill,
@@ -197,19 +208,37 @@ func (h *Handler) GenerateRecipes(w http.ResponseWriter, r *http.Request) {
 			RecipeCount:        req.RecipeCount,
 			UserPrompt:         req.UserPrompt,
 		},
-		Mode: mode,
+		Mode:                     mode,
+		UserID:                   userID,
+		ForceRefresh:             req.ForceRefresh,
+		ExcludeUnsafePantryItems: req.ExcludeUnsafePantryItems,
 	})
+	if !agents.ChargesQuota(result, err) {
+		h.limits.Release(context.WithoutCancel(r.Context()), reservation)
+	}
+	reservation.Status.WriteHeaders(w.Header())
+
 	if err != nil {
 		if errors.Is(err, agents.ErrAllRecipesFiltered) {
+			message := "all generated recipes contained allergens and were filtered"
+			if result.FilteredCount == 0 {
+				message = "all generated recipes broke your dietary preferences and were filtered"
+			}
 			h.writeJSON(w, http.StatusOK, map[string]interface{}{
-				"message":        "all generated recipes contained allergens and were filtered",
-				"all_recipes":    []interface{}{},
-				"total_count":    0,
-				"filtered_count": result.FilteredCount,
-				"generated_at":   result.GeneratedAt,
+				"message":             message,
+				"all_recipes":         []interface{}{},
+				"total_count":         0,
+				"filtered_count":      result.FilteredCount,
+				"diet_filtered_count": result.DietFilteredCount,
+				"dietary_rejections":  result.DietaryRejections,
+				"generated_at":        result.GeneratedAt,
 			})
 			return
 		}
+		if retryAfter, ok := gemini.RetryAfter(err); ok {
+			h.writeUnavailable(w, retryAfter)
+			return
+		}
 		h.log.Error("Failed to generate recipes: %v", err)
 		h.writeError(w, http.StatusInternalServerError, "failed to generate recipes")
 		return
@@ -218,6 +247,41 @@ func (h *Handler) GenerateRecipes(w http.ResponseWriter, r *http.Request) {
 	h.writeJSON(w, http.StatusOK, result)
 }
 
+// writeLimitError answers a request rejected by the quota manager with 429
+// and Retry-After, or 500 if the quota could not be checked
+func (h *Handler) writeLimitError(w http.ResponseWriter, err error) {
+	var limitErr *quota.LimitError
+	if !errors.As(err, &limitErr) {
+		h.log.Error("Failed to check generation quota: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "failed to check generation quota")
+		return
+	}
+
+	limitErr.Status.WriteHeaders(w.Header())
+	w.Header().Set("Retry-After", strconv.Itoa(limitErr.RetryAfterSeconds()))
+	message := "too many generation requests - slow down"
+	if errors.Is(err, quota.ErrQuotaExceeded) {
+		message = "generation quota exceeded"
+	}
+	h.writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+		"error":       message,
+		"reason":      limitErr.Reason,
+		"retry_after": limitErr.RetryAfterSeconds(),
+		"quota":       limitErr.Status,
+	})
+}
+
+// writeUnavailable tells the client the LLM provider is failing and when to retry
+func (h *Handler) writeUnavailable(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+	h.writeError(w, http.StatusServiceUnavailable, "recipe generation temporarily unavailable - try again later")
+}
+
+// retryAfterSeconds rounds a delay up to whole seconds for Retry-After
+func retryAfterSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
 // SaveRecipe handles POST /users/{user_id}/recipes
 func (h *Handler) SaveRecipe(w http.ResponseWriter, r *http.Request) {
 	userID, err := h.getUserID(r)
@@ -404,7 +468,9 @@ func (h *Handler) ToggleFavorite(w http.ResponseWriter, r *http.Request) {
 	h.writeJSON(w, http.StatusOK, recipe)
 }
 
-// MarkAsCooked handles POST /users/{user_id}/recipes/{id}/cooked
+// MarkAsCooked handles POST /users/{user_id}/recipes/{id}/cooked. Unless the
+// body sets consume_pantry to false, the recipe's pantry ingredients are
+// taken out of the pantry and the response includes what was consumed.
 func (h *Handler) MarkAsCooked(w http.ResponseWriter, r *http.Request) {
 	userID, err := h.getUserID(r)
 	if err != nil {
@@ -418,6 +484,16 @@ func (h *Handler) MarkAsCooked(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var input CookInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		h.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if input.Servings < 0 {
+		h.writeError(w, http.StatusBadRequest, "servings must not be negative")
+		return
+	}
+
 	// Verify ownership
 	existing, err := h.repo.GetByID(r.Context(), recipeID)
 	if err != nil {
@@ -435,14 +511,80 @@ func (h *Handler) MarkAsCooked(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	recipe, err := h.repo.MarkAsCooked(r.Context(), recipeID)
+	if input.ConsumePantry != nil && !*input.ConsumePantry {
+		recipe, err := h.repo.MarkAsCooked(r.Context(), recipeID)
+		if err != nil {
+			h.log.Error("Failed to mark as cooked: %v", err)
+			h.writeError(w, http.StatusInternalServerError, "failed to mark as cooked")
+			return
+		}
+		h.writeJSON(w, http.StatusOK, CookResult{Recipe: recipe})
+		return
+	}
+
+	var ingredients []Ingredient
+	if err := json.Unmarshal(existing.Ingredients, &ingredients); err != nil {
+		h.log.Error("Failed to read ingredients of recipe %s: %v", recipeID, err)
+		h.writeError(w, http.StatusInternalServerError, "failed to read recipe ingredients")
+		return
+	}
+
+	scale := 1.0
+	if input.Servings > 0 && existing.Servings > 0 {
+		scale = float64(input.Servings) / float64(existing.Servings)
+	}
+
+	recipe, consumption, err := h.repo.CookAndConsume(r.Context(), userID, recipeID, ingredients, scale)
 	if err != nil {
 		h.log.Error("Failed to mark as cooked: %v", err)
 		h.writeError(w, http.StatusInternalServerError, "failed to mark as cooked")
 		return
 	}
+	if len(consumption.Items) > 0 {
+		h.pantryChanged(userID)
+	}
 
-	h.writeJSON(w, http.StatusOK, recipe)
+	h.writeJSON(w, http.StatusOK, CookResult{Recipe: recipe, Consumption: consumption})
+}
+
+// UndoCooked handles POST /users/{user_id}/recipes/{id}/cooked/{consumption_id}/undo
+func (h *Handler) UndoCooked(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	recipeID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid recipe id")
+		return
+	}
+
+	consumptionID, err := uuid.Parse(r.PathValue("consumption_id"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid consumption id")
+		return
+	}
+
+	recipe, consumption, err := h.repo.UndoCook(r.Context(), userID, recipeID, consumptionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrConsumptionNotFound), errors.Is(err, ErrRecipeNotFound):
+			h.writeError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, ErrAlreadyUndone), errors.Is(err, ErrCannotRestore):
+			h.writeError(w, http.StatusConflict, err.Error())
+		default:
+			h.log.Error("Failed to undo cook: %v", err)
+			h.writeError(w, http.StatusInternalServerError, "failed to undo cook")
+		}
+		return
+	}
+	if len(consumption.Items) > 0 {
+		h.pantryChanged(userID)
+	}
+
+	h.writeJSON(w, http.StatusOK, CookResult{Recipe: recipe, Consumption: consumption})
 }
 
 // DeleteRecipe handles DELETE /users/{user_id}/recipes/{id}
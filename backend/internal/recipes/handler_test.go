@@ -0,0 +1,122 @@
+package recipes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/internal/agents"
+	"github.com/Jayyk09/CUHackIt/internal/database"
+	"github.com/Jayyk09/CUHackIt/internal/pantry"
+	"github.com/Jayyk09/CUHackIt/internal/users"
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+	"github.com/Jayyk09/CUHackIt/services/gemini"
+)
+
+type stubPantry []pantry.PantryItemWithFood
+
+func (s stubPantry) ListByUserID(ctx context.Context, userID string) ([]pantry.PantryItemWithFood, error) {
+	return s, nil
+}
+
+type stubUsers struct{}
+
+func (stubUsers) GetByID(ctx context.Context, id string) (*users.User, error) {
+	return &users.User{ID: id, AllergenPolicy: "filter"}, nil
+}
+
+// newGenerateServer serves the generate endpoint backed by fake and a
+// pantry of items
+func newGenerateServer(fake *gemini.FakeClient, items stubPantry) *httptest.Server {
+	h := NewHandler(&database.DB{}, fake, nil, nil, logger.GetLogger("error"))
+	h.pantryRepo, h.userRepo = items, stubUsers{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /users/{user_id}/recipes/generate", h.GenerateRecipes)
+	return httptest.NewServer(mux)
+}
+
+func testPantry() stubPantry {
+	soon := time.Now().Add(24 * time.Hour)
+	return stubPantry{
+		{ID: 1, ProductName: "Chicken Breast", Quantity: 2, Unit: "lb", AddedAt: time.Now(), ExpiresAt: &soon},
+		{ID: 2, ProductName: "Brown Rice", Quantity: 1, Unit: "lb", AddedAt: time.Now()},
+		{ID: 3, ProductName: "Eggs", Quantity: 12, Unit: "item", AddedAt: time.Now()},
+	}
+}
+
+func TestGenerateRecipesWithFakeProvider(t *testing.T) {
+	srv := newGenerateServer(gemini.NewFakeClient(logger.GetLogger("error")), testPantry())
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/users/u1/recipes/generate", "application/json",
+		strings.NewReader(`{"mode":"pantry_only","recipe_count":2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var result agents.GenerateResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.TotalCount != 2 || len(result.AllRecipes) != 2 {
+		t.Fatalf("expected 2 recipes, got %d: %+v", result.TotalCount, result.AllRecipes)
+	}
+	for _, r := range result.AllRecipes {
+		if r.Title == "" || len(r.Ingredients) == 0 {
+			t.Errorf("incomplete recipe: %+v", r)
+		}
+	}
+}
+
+func TestGenerateRecipesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		items   stubPantry
+		script  []gemini.FakeResponse
+		status  int
+		message string
+	}{
+		{name: "empty pantry", status: http.StatusBadRequest, message: "pantry is empty - add some items first"},
+		{
+			name:    "provider still failing after retries",
+			items:   testPantry(),
+			script:  []gemini.FakeResponse{{Err: &gemini.RetriesExhaustedError{Attempts: 3, RetryAfter: 5 * time.Second, Err: gemini.ErrGenerationFail}}},
+			status:  http.StatusServiceUnavailable,
+			message: "recipe generation temporarily unavailable - try again later",
+		},
+		{
+			name:    "provider failure",
+			items:   testPantry(),
+			script:  []gemini.FakeResponse{{Err: errors.New("boom")}, {Err: errors.New("boom")}, {Err: errors.New("boom")}},
+			status:  http.StatusInternalServerError,
+			message: "failed to generate recipes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := gemini.NewFakeClient(logger.GetLogger("error"))
+			fake.Enqueue(tt.script...)
+			srv := newGenerateServer(fake, tt.items)
+			defer srv.Close()
+
+			resp, err := http.Post(srv.URL+"/users/u1/recipes/generate", "application/json", strings.NewReader(`{}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			var body map[string]string
+			json.NewDecoder(resp.Body).Decode(&body)
+			if resp.StatusCode != tt.status || body["error"] != tt.message {
+				t.Errorf("got %d %q, want %d %q", resp.StatusCode, body["error"], tt.status, tt.message)
+			}
+		})
+	}
+}
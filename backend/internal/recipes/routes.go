@@ -3,14 +3,16 @@ package recipes
 import (
 	"net/http"
 
+	"github.com/Jayyk09/CUHackIt/internal/agents"
 	"github.com/Jayyk09/CUHackIt/internal/database"
+	"github.com/Jayyk09/CUHackIt/internal/quota"
 	"github.com/Jayyk09/CUHackIt/pkg/logger"
 	"github.com/Jayyk09/CUHackIt/services/gemini"
 )
 
 // RegisterRoutes registers all recipe routes
-func RegisterRoutes(r *http.ServeMux, db *database.DB, geminiClient *gemini.Client, log *logger.Logger) {
-	h := NewHandler(db, geminiClient, log)
+func RegisterRoutes(r *http.ServeMux, db *database.DB, provider gemini.Provider, cache *agents.ResultCache, limits *quota.Manager, log *logger.Logger) {
+	h := NewHandler(db, provider, cache, limits, log)
 
 	// Recipe generation
 	r.HandleFunc("POST /users/{user_id}/recipes/generate", h.GenerateRecipes)
@@ -25,4 +27,5 @@ func RegisterRoutes(r *http.ServeMux, db *database.DB, geminiClient *gemini.Clie
 	// Recipe actions
 	r.HandleFunc("POST /users/{user_id}/recipes/{id}/favorite", h.ToggleFavorite)
 	r.HandleFunc("POST /users/{user_id}/recipes/{id}/cooked", h.MarkAsCooked)
+	r.HandleFunc("POST /users/{user_id}/recipes/{id}/cooked/{consumption_id}/undo", h.UndoCooked)
 }
@@ -2,15 +2,21 @@ package routes
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/Jayyk09/CUHackIt/config"
+	"github.com/Jayyk09/CUHackIt/internal/agents"
 	"github.com/Jayyk09/CUHackIt/internal/auth"
 	"github.com/Jayyk09/CUHackIt/internal/database"
+	"github.com/Jayyk09/CUHackIt/internal/digest"
 	"github.com/Jayyk09/CUHackIt/internal/food"
+	"github.com/Jayyk09/CUHackIt/internal/insights"
 	"github.com/Jayyk09/CUHackIt/internal/pantry"
+	"github.com/Jayyk09/CUHackIt/internal/quota"
 	"github.com/Jayyk09/CUHackIt/internal/recipes"
+	"github.com/Jayyk09/CUHackIt/internal/usage"
 	"github.com/Jayyk09/CUHackIt/internal/users"
 	"github.com/Jayyk09/CUHackIt/internal/ws"
 	"github.com/Jayyk09/CUHackIt/pkg/logger"
@@ -19,25 +25,46 @@ import (
 
 // Setup registers all application routes
 func Setup(r *http.ServeMux, db *database.DB, cfg *config.Config, log *logger.Logger) error {
-	// Initialize Gemini client (optional - can work without it)
-	var geminiClient *gemini.Client
-	if cfg.Gemini.APIKey != "" {
-		var err error
-		geminiClient, err = gemini.NewClient(context.Background(), cfg.Gemini.APIKey, cfg.Gemini.Model, log)
-		if err != nil {
-			log.Warn("Failed to initialize Gemini client: %v - recipe generation will be disabled", err)
+	// Every LLM call is priced and written to the usage ledger
+	usageRecorder := usage.NewRecorder(usage.NewRepository(db.Pool), usage.DefaultPrices, log)
+
+	// Initialize the LLM provider (optional - can work without it)
+	provider, err := gemini.NewProvider(context.Background(), cfg, usageRecorder, log)
+	if err != nil {
+		if errors.Is(err, gemini.ErrNoAPIKey) {
+			log.Warn("GEMINI_API_KEY not set - recipe generation will be disabled")
 		} else {
-			log.Info("Gemini client initialized with model: %s", cfg.Gemini.Model)
+			log.Warn("Failed to initialize %s provider: %v - recipe generation will be disabled", cfg.LLM.Provider, err)
 		}
 	} else {
-		log.Warn("GEMINI_API_KEY not set - recipe generation will be disabled")
+		log.Info("LLM provider initialized: %s", cfg.LLM.Provider)
 	}
 
+	// Generation results are cached per user until the pantry or profile changes
+	var recipeCache *agents.ResultCache
+	if cfg.Cache.RecipeTTL > 0 {
+		recipeCache = agents.NewResultCache(cfg.Cache.RecipeTTL)
+	}
+
+	// Generation budgets and rate limits shared by HTTP and WebSocket generation
+	limits := quota.NewManager(quota.Config{
+		DailyLimit:        cfg.Quota.DailyLimit,
+		MonthlyLimit:      cfg.Quota.MonthlyLimit,
+		UserRatePerMinute: cfg.Quota.UserRatePerMinute,
+		UserBurst:         cfg.Quota.UserBurst,
+		IPRatePerMinute:   cfg.Quota.IPRatePerMinute,
+		IPBurst:           cfg.Quota.IPBurst,
+		TrustProxy:        cfg.Quota.TrustProxy,
+	}, quota.NewRepository(db.Pool), log)
+
 	// User routes
-	users.RegisterRoutes(r, db, log)
+	users.RegisterRoutes(r, db, log, recipeCache)
 
 	// Pantry routes
-	pantry.RegisterRoutes(r, db, log)
+	pantry.RegisterRoutes(r, db, log, recipeCache)
+
+	// Pantry and cooking insights
+	insights.RegisterRoutes(r, db, log)
 
 	// Auth routes
 	store, err := auth.RegisterRoutes(r, cfg, db)
@@ -45,14 +72,36 @@ func Setup(r *http.ServeMux, db *database.DB, cfg *config.Config, log *logger.Lo
 		return fmt.Errorf("auth routes: %w", err)
 	}
 
-	// Food search routes (with optional Gemini enrichment)
-	food.RegisterRoutes(r, db, store)
+	// Food search routes (with optional LLM enrichment)
+	food.RegisterRoutes(r, db, store, provider)
 
-	// Recipe routes (with optional Gemini client)
-	recipes.RegisterRoutes(r, db, geminiClient, log)
+	// Recipe routes (with optional LLM provider)
+	recipes.RegisterRoutes(r, db, provider, recipeCache, limits, log)
 
 	// WebSocket routes for real-time recipe streaming
-	ws.RegisterRoutes(r, db, geminiClient, log)
+	ws.RegisterRoutes(r, db, provider, recipeCache, limits, log)
+
+	// Admin usage and cost reports
+	usage.RegisterRoutes(r, db, cfg.Admin.APIToken, log)
+
+	// Daily digest of expiring pantry items
+	if cfg.Digest.Enabled {
+		notifier, err := digest.NewNotifier(cfg.Digest.Notifier, cfg.Digest.FilePath, log)
+		if err != nil {
+			return fmt.Errorf("digest: %w", err)
+		}
+		var generator digest.RecipeGenerator
+		if provider != nil {
+			generator = agents.NewOrchestrator(provider, log).WithCache(recipeCache)
+		}
+		digest.NewScheduler(digest.NewStore(db.Pool), generator, notifier, digest.Config{
+			Hour:          cfg.Digest.Hour,
+			Days:          cfg.Digest.Days,
+			ExpiredDays:   cfg.Digest.ExpiredDays,
+			SuggestRecipe: cfg.Digest.SuggestRecipe,
+		}, log).Start(context.Background())
+		log.Info("Daily digest scheduled at %02d:00 UTC", cfg.Digest.Hour)
+	}
 
 	// Health check
 	r.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
@@ -73,10 +122,19 @@ func Setup(r *http.ServeMux, db *database.DB, cfg *config.Config, log *logger.Lo
 				"health": "GET /health",
 				"users": "GET/POST /users",
 				"pantry": "GET/POST /users/{user_id}/pantry",
+				"pantry_safety": "GET /users/{user_id}/pantry/safety",
+				"pantry_expiring": "GET /users/{user_id}/pantry/expiring?days=N",
+				"pantry_scan": "POST /users/{user_id}/pantry/scan",
+				"pantry_import": "POST /users/{user_id}/pantry/import",
+				"pantry_bulk": "POST /users/{user_id}/pantry/bulk",
+				"pantry_history": "GET /users/{user_id}/pantry/history?from=YYYY-MM-DD&to=YYYY-MM-DD&reason=...",
+				"insights": "GET /users/{user_id}/insights?period=week|month&from=YYYY-MM-DD&to=YYYY-MM-DD",
 				"recipes": "GET/POST /users/{user_id}/recipes",
 				"generate": "POST /users/{user_id}/recipes/generate",
 				"food_search": "GET /food/search?q=...",
-				"websocket": "GET /ws (real-time recipe streaming)"
+				"food_barcode": "GET /food/barcode/{code}",
+				"websocket": "GET /ws (real-time recipe streaming)",
+				"admin_usage": "GET /admin/usage?from=YYYY-MM-DD&to=YYYY-MM-DD"
 			}
 		}`))
 	})
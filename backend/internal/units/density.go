@@ -0,0 +1,144 @@
+package units
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// densities are approximate densities of common foods in grams per
+// milliliter, as measured in the kitchen (flour spooned, brown sugar packed,
+// cheese shredded). Keys are singular, lower-case phrases.
+var densities = map[string]float64{
+	// liquids
+	"water":       1.0,
+	"milk":        1.03,
+	"buttermilk":  1.03,
+	"cream":       0.99,
+	"heavy cream": 0.99,
+	"oil":         0.92,
+	"olive oil":   0.91,
+	"vinegar":     1.01,
+	"broth":       1.0,
+	"stock":       1.0,
+	"juice":       1.04,
+	"soy sauce":   1.15,
+	"honey":       1.42,
+	"maple syrup": 1.32,
+	"syrup":       1.33,
+	"wine":        0.99,
+
+	// dairy and spreads
+	"butter":        0.91,
+	"yogurt":        1.03,
+	"sour cream":    1.0,
+	"cream cheese":  1.0,
+	"cheese":        0.47,
+	"parmesan":      0.42,
+	"peanut butter": 1.09,
+	"mayonnaise":    0.95,
+	"ketchup":       1.15,
+	"tomato sauce":  1.04,
+
+	// dry goods
+	"flour":             0.53,
+	"whole wheat flour": 0.51,
+	"almond flour":      0.41,
+	"cornstarch":        0.54,
+	"sugar":             0.85,
+	"brown sugar":       0.93,
+	"powdered sugar":    0.51,
+	"salt":              1.2,
+	"baking soda":       0.92,
+	"baking powder":     0.81,
+	"cocoa":             0.42,
+	"rice":              0.85,
+	"oat":               0.34,
+	"quinoa":            0.72,
+	"lentil":            0.81,
+	"pasta":             0.42,
+	"breadcrumb":        0.45,
+	"chocolate chip":    0.72,
+	"nut":               0.56,
+	"almond":            0.6,
+	"walnut":            0.42,
+
+	// produce
+	"spinach": 0.13,
+	"berry":   0.6,
+	"pea":     0.61,
+	"corn":    0.68,
+	"onion":   0.67,
+	"tomato":  0.76,
+	"carrot":  0.54,
+}
+
+// densityKey is a density phrase split into words
+type densityKey struct {
+	words   []string
+	density float64
+}
+
+// densityKeys holds densities longest phrase first, so "brown sugar" is
+// preferred to "sugar"
+var densityKeys = func() []densityKey {
+	keys := make([]densityKey, 0, len(densities))
+	for phrase, d := range densities {
+		keys = append(keys, densityKey{words: words(phrase), density: d})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i].words) != len(keys[j].words) {
+			return len(keys[i].words) > len(keys[j].words)
+		}
+		return strings.Join(keys[i].words, " ") < strings.Join(keys[j].words, " ")
+	})
+	return keys
+}()
+
+// Density returns the density of a food in grams per milliliter, matched
+// by the longest known phrase in its name, e.g. "Organic Brown Sugar"
+// matches "brown sugar"
+func Density(food string) (float64, bool) {
+	name := words(food)
+	for _, key := range densityKeys {
+		if containsPhrase(name, key.words) {
+			return key.density, true
+		}
+	}
+	return 0, false
+}
+
+// words lower-cases s and splits it into singular words
+func words(s string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range fields {
+		switch {
+		case len(w) > 4 && strings.HasSuffix(w, "ies"):
+			fields[i] = w[:len(w)-3] + "y"
+		case len(w) > 4 && strings.HasSuffix(w, "oes"):
+			fields[i] = w[:len(w)-2]
+		case len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss"):
+			fields[i] = w[:len(w)-1]
+		}
+	}
+	return fields
+}
+
+// containsPhrase reports whether phrase occurs contiguously in name
+func containsPhrase(name, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(name); i++ {
+		match := true
+		for j, w := range phrase {
+			if name[i+j] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,292 @@
+// Package units models pantry and recipe quantities: the units they are
+// measured in, conversion between them, and food densities for converting
+// between mass and volume.
+package units
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrUnknownUnit       = errors.New("unknown unit")
+	ErrIncompatibleUnits = errors.New("incompatible units")
+	ErrUnknownDensity    = errors.New("no density known for food")
+	ErrInvalidQuantity   = errors.New("invalid quantity")
+)
+
+// Unit is a canonical unit of measure
+type Unit string
+
+const (
+	Gram       Unit = "g"
+	Kilogram   Unit = "kg"
+	Ounce      Unit = "oz"
+	Pound      Unit = "lb"
+	Milliliter Unit = "ml"
+	Liter      Unit = "l"
+	Teaspoon   Unit = "tsp"
+	Tablespoon Unit = "tbsp"
+	Cup        Unit = "cup"
+	Item       Unit = "item"
+)
+
+// Dimension is what a unit measures
+type Dimension string
+
+const (
+	Mass   Dimension = "mass"
+	Volume Dimension = "volume"
+	Count  Dimension = "count"
+)
+
+// unitInfo is a unit's dimension and size in its dimension's base unit
+// (grams, milliliters or items)
+type unitInfo struct {
+	dimension Dimension
+	base      float64
+}
+
+var unitTable = map[Unit]unitInfo{
+	Gram:       {Mass, 1},
+	Kilogram:   {Mass, 1000},
+	Ounce:      {Mass, 28.349523125},
+	Pound:      {Mass, 453.59237},
+	Milliliter: {Volume, 1},
+	Liter:      {Volume, 1000},
+	Teaspoon:   {Volume, 4.92892159375},
+	Tablespoon: {Volume, 14.78676478125},
+	Cup:        {Volume, 236.5882365},
+	Item:       {Count, 1},
+}
+
+// unitAliases maps how people write units to canonical units
+var unitAliases = map[string]Unit{
+	"g": Gram, "gr": Gram, "gram": Gram, "grams": Gram, "gramme": Gram, "grammes": Gram,
+	"kg": Kilogram, "kgs": Kilogram, "kilo": Kilogram, "kilos": Kilogram, "kilogram": Kilogram, "kilograms": Kilogram,
+	"oz": Ounce, "ozs": Ounce, "ounce": Ounce, "ounces": Ounce,
+	"lb": Pound, "lbs": Pound, "pound": Pound, "pounds": Pound,
+	"ml": Milliliter, "mls": Milliliter, "milliliter": Milliliter, "milliliters": Milliliter, "millilitre": Milliliter, "millilitres": Milliliter,
+	"l": Liter, "liter": Liter, "liters": Liter, "litre": Liter, "litres": Liter,
+	"tsp": Teaspoon, "tsps": Teaspoon, "teaspoon": Teaspoon, "teaspoons": Teaspoon,
+	"tbsp": Tablespoon, "tbsps": Tablespoon, "tbs": Tablespoon, "tablespoon": Tablespoon, "tablespoons": Tablespoon,
+	"cup": Cup, "cups": Cup, "c": Cup,
+	"": Item, "item": Item, "items": Item, "each": Item, "ea": Item, "piece": Item, "pieces": Item,
+	"pc": Item, "pcs": Item, "count": Item, "unit": Item, "units": Item, "whole": Item,
+	// containers and natural portions are counted too
+	"can": Item, "cans": Item, "jar": Item, "jars": Item, "bottle": Item, "bottles": Item,
+	"package": Item, "packages": Item, "pkg": Item, "bag": Item, "bags": Item, "box": Item, "boxes": Item,
+	"clove": Item, "cloves": Item, "slice": Item, "slices": Item, "head": Item, "heads": Item,
+	"bunch": Item, "bunches": Item, "stalk": Item, "stalks": Item, "fillet": Item, "fillets": Item,
+}
+
+// ParseUnit resolves a written unit, e.g. "Tablespoons" or "lbs", to its
+// canonical Unit. An empty string is an item count.
+func ParseUnit(s string) (Unit, error) {
+	key := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), ".")
+	if u, ok := unitAliases[key]; ok {
+		return u, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownUnit, s)
+}
+
+// Dimension returns what u measures
+func (u Unit) Dimension() Dimension {
+	return unitTable[u].dimension
+}
+
+// Valid reports whether u is a canonical unit
+func (u Unit) Valid() bool {
+	_, ok := unitTable[u]
+	return ok
+}
+
+// BaseUnit returns the unit a dimension is normalized to
+func BaseUnit(d Dimension) Unit {
+	switch d {
+	case Mass:
+		return Gram
+	case Volume:
+		return Milliliter
+	}
+	return Item
+}
+
+// Quantity is an amount in a unit
+type Quantity struct {
+	Amount float64 `json:"amount"`
+	Unit   Unit    `json:"unit"`
+}
+
+// String formats q as e.g. "1.5 lb"
+func (q Quantity) String() string {
+	return fmt.Sprintf("%s %s", FormatAmount(q.Amount), q.Unit)
+}
+
+// Normalize expresses q in its dimension's base unit: grams, milliliters
+// or items
+func Normalize(q Quantity) Quantity {
+	info, ok := unitTable[q.Unit]
+	if !ok {
+		return q
+	}
+	return Quantity{Amount: Round(q.Amount * info.base), Unit: BaseUnit(info.dimension)}
+}
+
+// Convert expresses q in unit to. Mass and volume convert into each other
+// through the density of food; counts convert only to counts.
+func Convert(q Quantity, to Unit, food string) (Quantity, error) {
+	from, ok := unitTable[q.Unit]
+	if !ok {
+		return Quantity{}, fmt.Errorf("%w: %q", ErrUnknownUnit, q.Unit)
+	}
+	target, ok := unitTable[to]
+	if !ok {
+		return Quantity{}, fmt.Errorf("%w: %q", ErrUnknownUnit, to)
+	}
+
+	base := q.Amount * from.base
+	if from.dimension != target.dimension {
+		if from.dimension == Count || target.dimension == Count {
+			return Quantity{}, fmt.Errorf("%w: %s to %s", ErrIncompatibleUnits, q.Unit, to)
+		}
+		density, ok := Density(food)
+		if !ok {
+			return Quantity{}, fmt.Errorf("%w: %q", ErrUnknownDensity, food)
+		}
+		if from.dimension == Volume {
+			base *= density // ml -> g
+		} else {
+			base /= density // g -> ml
+		}
+	}
+	return Quantity{Amount: Round(base / target.base), Unit: to}, nil
+}
+
+// New validates amount and resolves unit, as the pantry APIs accept them
+func New(amount float64, unit string) (Quantity, error) {
+	if amount <= 0 || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return Quantity{}, fmt.Errorf("%w: %v", ErrInvalidQuantity, amount)
+	}
+	u, err := ParseUnit(unit)
+	if err != nil {
+		return Quantity{}, err
+	}
+	return Quantity{Amount: Round(amount), Unit: u}, nil
+}
+
+// Round rounds to the three decimals quantities are stored with
+func Round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// FormatAmount formats an amount without trailing zeros
+func FormatAmount(v float64) string {
+	s := fmt.Sprintf("%.3f", Round(v))
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// unicodeFractions maps vulgar fraction characters to their values
+var unicodeFractions = map[rune]float64{
+	'½': 0.5, '⅓': 1.0 / 3, '⅔': 2.0 / 3, '¼': 0.25, '¾': 0.75,
+	'⅕': 0.2, '⅖': 0.4, '⅗': 0.6, '⅘': 0.8, '⅙': 1.0 / 6, '⅚': 5.0 / 6,
+	'⅛': 0.125, '⅜': 0.375, '⅝': 0.625, '⅞': 0.875,
+}
+
+// ParseAmount reads a recipe amount such as "2", "1.5", "1/2", "1 1/2",
+// "1½" or "a". Ranges such as "2-3" read as their lower bound.
+func ParseAmount(s string) (float64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if i := strings.IndexAny(s, "-–"); i > 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	switch s {
+	case "a", "an", "one":
+		return 1, nil
+	case "":
+		return 0, fmt.Errorf("%w: empty amount", ErrInvalidQuantity)
+	}
+
+	// Split a trailing unicode fraction off a whole number: "1½" -> "1 ½"
+	var b strings.Builder
+	for _, r := range s {
+		if _, ok := unicodeFractions[r]; ok {
+			b.WriteRune(' ')
+		}
+		b.WriteRune(r)
+	}
+
+	total := 0.0
+	for _, part := range strings.Fields(b.String()) {
+		v, err := parseAmountPart(part)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidQuantity, s)
+		}
+		total += v
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidQuantity, s)
+	}
+	return total, nil
+}
+
+// parseAmountPart reads one number, fraction or unicode fraction
+func parseAmountPart(part string) (float64, error) {
+	if r := []rune(part); len(r) == 1 {
+		if v, ok := unicodeFractions[r[0]]; ok {
+			return v, nil
+		}
+	}
+	if num, den, ok := strings.Cut(part, "/"); ok {
+		n, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return 0, err
+		}
+		d, err := strconv.ParseFloat(den, 64)
+		if err != nil || d == 0 {
+			return 0, ErrInvalidQuantity
+		}
+		return n / d, nil
+	}
+	return strconv.ParseFloat(part, 64)
+}
+
+// ParseQuantity reads a recipe ingredient's amount and unit. When unit is
+// empty the amount may carry it, as in "2 cups" or "500g"; other trailing
+// words, as in "2 large", leave a count.
+func ParseQuantity(amount, unit string) (Quantity, error) {
+	if strings.TrimSpace(unit) == "" {
+		amount, unit = splitUnit(amount)
+		if _, err := ParseUnit(unit); err != nil {
+			unit = ""
+		}
+	}
+	u, err := ParseUnit(unit)
+	if err != nil {
+		return Quantity{}, err
+	}
+	v, err := ParseAmount(amount)
+	if err != nil {
+		return Quantity{}, err
+	}
+	return Quantity{Amount: Round(v), Unit: u}, nil
+}
+
+// splitUnit separates the words after the leading number of an amount:
+// "2 cups" -> "2", "cups"
+func splitUnit(amount string) (string, string) {
+	amount = strings.TrimSpace(amount)
+	i := strings.IndexFunc(amount, func(r rune) bool {
+		_, fraction := unicodeFractions[r]
+		return !unicode.IsDigit(r) && !unicode.IsSpace(r) && r != '/' && r != '.' && r != '-' && r != '–' && !fraction
+	})
+	if i <= 0 {
+		return amount, ""
+	}
+	return strings.TrimSpace(amount[:i]), strings.TrimSpace(amount[i:])
+}
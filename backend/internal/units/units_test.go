@@ -0,0 +1,119 @@
+package units
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseUnit(t *testing.T) {
+	cases := map[string]Unit{
+		"g": Gram, "Grams": Gram, "KG": Kilogram, "lbs": Pound, "oz.": Ounce,
+		"mL": Milliliter, "Litres": Liter, "Tablespoons": Tablespoon, "tsp": Teaspoon,
+		"cups": Cup, "": Item, "each": Item,
+	}
+	for in, want := range cases {
+		got, err := ParseUnit(in)
+		if err != nil || got != want {
+			t.Errorf("ParseUnit(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseUnit("handful"); !errors.Is(err, ErrUnknownUnit) {
+		t.Errorf("expected ErrUnknownUnit, got %v", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		in   Quantity
+		want Quantity
+	}{
+		{Quantity{1.5, Kilogram}, Quantity{1500, Gram}},
+		{Quantity{2, Pound}, Quantity{907.185, Gram}},
+		{Quantity{0.5, Liter}, Quantity{500, Milliliter}},
+		{Quantity{1, Cup}, Quantity{236.588, Milliliter}},
+		{Quantity{6, Item}, Quantity{6, Item}},
+	}
+	for _, tc := range cases {
+		if got := Normalize(tc.in); got != tc.want {
+			t.Errorf("Normalize(%v) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	got, err := Convert(Quantity{16, Ounce}, Pound, "")
+	if err != nil || got.Amount != 1 {
+		t.Errorf("16 oz = %v lb, %v; want 1", got.Amount, err)
+	}
+
+	got, err = Convert(Quantity{1, Cup}, Gram, "All-Purpose Flour")
+	if err != nil || got.Amount < 120 || got.Amount > 130 {
+		t.Errorf("1 cup flour = %v g, %v; want about 125", got.Amount, err)
+	}
+
+	got, err = Convert(Quantity{100, Gram}, Tablespoon, "packed brown sugar")
+	if err != nil || got.Amount < 7 || got.Amount > 7.5 {
+		t.Errorf("100 g brown sugar = %v tbsp, %v; want about 7.3", got.Amount, err)
+	}
+
+	if _, err := Convert(Quantity{1, Cup}, Gram, "mystery powder"); !errors.Is(err, ErrUnknownDensity) {
+		t.Errorf("expected ErrUnknownDensity, got %v", err)
+	}
+	if _, err := Convert(Quantity{2, Item}, Gram, "flour"); !errors.Is(err, ErrIncompatibleUnits) {
+		t.Errorf("expected ErrIncompatibleUnits, got %v", err)
+	}
+}
+
+func TestDensityPrefersLongestPhrase(t *testing.T) {
+	if d, _ := Density("Creamy Peanut Butter"); d != densities["peanut butter"] {
+		t.Errorf("peanut butter density = %v, want %v", d, densities["peanut butter"])
+	}
+	if d, _ := Density("cherry tomatoes"); d != densities["tomato"] {
+		t.Errorf("tomato density = %v, want %v", d, densities["tomato"])
+	}
+}
+
+func TestNew(t *testing.T) {
+	q, err := New(1.23456, "Pounds")
+	if err != nil || q != (Quantity{1.235, Pound}) {
+		t.Errorf("New = %v, %v", q, err)
+	}
+	if _, err := New(0, "g"); !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("expected ErrInvalidQuantity for 0, got %v", err)
+	}
+	if got := (Quantity{1.5, Cup}).String(); got != "1.5 cup" {
+		t.Errorf("String = %q", got)
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	cases := []struct {
+		amount, unit string
+		want         Quantity
+	}{
+		{"2", "lbs", Quantity{2, Pound}},
+		{"1/2", "cup", Quantity{0.5, Cup}},
+		{"1 1/2", "Tablespoons", Quantity{1.5, Tablespoon}},
+		{"1½", "cups", Quantity{1.5, Cup}},
+		{"2 cups", "", Quantity{2, Cup}},
+		{"500g", "", Quantity{500, Gram}},
+		{"2 large", "", Quantity{2, Item}},
+		{"2-3", "cloves", Quantity{2, Item}},
+		{"a", "", Quantity{1, Item}},
+	}
+	for _, tc := range cases {
+		got, err := ParseQuantity(tc.amount, tc.unit)
+		if err != nil || got != tc.want {
+			t.Errorf("ParseQuantity(%q, %q) = %v, %v; want %v", tc.amount, tc.unit, got, err, tc.want)
+		}
+	}
+
+	for _, amount := range []string{"to taste", "", "0"} {
+		if _, err := ParseQuantity(amount, ""); err == nil {
+			t.Errorf("ParseQuantity(%q) should fail", amount)
+		}
+	}
+	if _, err := ParseQuantity("1", "pinch"); !errors.Is(err, ErrUnknownUnit) {
+		t.Errorf("expected ErrUnknownUnit for a pinch, got %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Entry is one row of the llm_usage ledger
+type Entry struct {
+	UserID          string // empty for calls not made for a user
+	Agent           string
+	Mode            string
+	Provider        string
+	Model           string
+	Streamed        bool
+	PromptTokens    int
+	CandidateTokens int
+	TotalTokens     int
+	LatencyMs       int64
+	Success         bool
+	CostUSD         float64
+}
+
+// Summary aggregates the calls sharing a key
+type Summary struct {
+	Key             string  `json:"key,omitempty"` // user ID, agent name or YYYY-MM-DD day
+	Calls           int64   `json:"calls"`
+	Failures        int64   `json:"failures"`
+	PromptTokens    int64   `json:"prompt_tokens"`
+	CandidateTokens int64   `json:"candidate_tokens"`
+	TotalTokens     int64   `json:"total_tokens"`
+	AvgLatencyMs    float64 `json:"avg_latency_ms"`
+	CostUSD         float64 `json:"estimated_cost_usd"`
+}
+
+// Report breaks usage in [From, To) down per user, per agent and per UTC day
+type Report struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Totals  Summary   `json:"totals"`
+	ByUser  []Summary `json:"by_user"`
+	ByAgent []Summary `json:"by_agent"`
+	ByDay   []Summary `json:"by_day"`
+}
+
+// Store persists ledger entries
+type Store interface {
+	Insert(ctx context.Context, entry Entry) error
+}
+
+// Repository handles database operations for the usage ledger
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+// NewRepository creates a new usage repository
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+// Insert implements Store
+func (r *Repository) Insert(ctx context.Context, e Entry) error {
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO llm_usage (
+			user_id, agent, mode, provider, model, streamed,
+			prompt_tokens, candidate_tokens, total_tokens,
+			latency_ms, success, cost_usd
+		) VALUES (NULLIF($1, '')::uuid, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`, e.UserID, e.Agent, e.Mode, e.Provider, e.Model, e.Streamed,
+		e.PromptTokens, e.CandidateTokens, e.TotalTokens,
+		e.LatencyMs, e.Success, e.CostUSD)
+	if err != nil {
+		return fmt.Errorf("failed to insert usage: %w", err)
+	}
+	return nil
+}
+
+// Report aggregates the calls made in [from, to). Users and agents are
+// ordered by cost, days chronologically.
+func (r *Repository) Report(ctx context.Context, from, to time.Time) (*Report, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT
+			CASE
+				WHEN GROUPING(u.user_key) = 0 THEN 'user'
+				WHEN GROUPING(u.agent) = 0 THEN 'agent'
+				WHEN GROUPING(u.day) = 0 THEN 'day'
+				ELSE 'total'
+			END,
+			COALESCE(u.user_key, u.agent, u.day, ''),
+			COUNT(*),
+			COUNT(*) FILTER (WHERE NOT u.success),
+			COALESCE(SUM(u.prompt_tokens), 0),
+			COALESCE(SUM(u.candidate_tokens), 0),
+			COALESCE(SUM(u.total_tokens), 0),
+			COALESCE(AVG(u.latency_ms), 0)::float8,
+			COALESCE(SUM(u.cost_usd), 0)::float8
+		FROM (
+			SELECT
+				COALESCE(user_id::text, '') AS user_key,
+				agent,
+				to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day,
+				success, prompt_tokens, candidate_tokens, total_tokens, latency_ms, cost_usd
+			FROM llm_usage
+			WHERE created_at >= $1 AND created_at < $2
+		) u
+		GROUP BY GROUPING SETS ((u.user_key), (u.agent), (u.day), ())
+		ORDER BY 9 DESC, 2
+	`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	defer rows.Close()
+
+	report := &Report{
+		From:    from,
+		To:      to,
+		ByUser:  []Summary{},
+		ByAgent: []Summary{},
+		ByDay:   []Summary{},
+	}
+	for rows.Next() {
+		var dimension string
+		var s Summary
+		if err := rows.Scan(&dimension, &s.Key, &s.Calls, &s.Failures,
+			&s.PromptTokens, &s.CandidateTokens, &s.TotalTokens, &s.AvgLatencyMs, &s.CostUSD); err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+		switch dimension {
+		case "user":
+			report.ByUser = append(report.ByUser, s)
+		case "agent":
+			report.ByAgent = append(report.ByAgent, s)
+		case "day":
+			report.ByDay = append(report.ByDay, s)
+		default:
+			report.Totals = s
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage: %w", err)
+	}
+
+	sort.Slice(report.ByDay, func(i, j int) bool { return report.ByDay[i].Key < report.ByDay[j].Key })
+	return report, nil
+}
@@ -0,0 +1,80 @@
+package usage
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/internal/database"
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+)
+
+// defaultReportDays is the report window when no from date is given
+const defaultReportDays = 30
+
+// Handler handles the admin usage endpoints
+type Handler struct {
+	repo *Repository
+	log  *logger.Logger
+}
+
+// NewHandler creates a new usage handler
+func NewHandler(db *database.DB, log *logger.Logger) *Handler {
+	return &Handler{
+		repo: NewRepository(db.Pool),
+		log:  log,
+	}
+}
+
+// writeJSON writes a JSON response
+func (h *Handler) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.log.Error("Failed to encode response: %v", err)
+	}
+}
+
+// writeError writes an error response
+func (h *Handler) writeError(w http.ResponseWriter, status int, message string) {
+	h.writeJSON(w, status, map[string]string{"error": message})
+}
+
+// GetReport handles GET /admin/usage?from=YYYY-MM-DD&to=YYYY-MM-DD
+// Both dates are inclusive UTC days; the default is the last 30 days.
+func (h *Handler) GetReport(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if s := r.URL.Query().Get("to"); s != "" {
+		day, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid to date - use YYYY-MM-DD")
+			return
+		}
+		to = day
+	}
+
+	from := to.AddDate(0, 0, -(defaultReportDays - 1))
+	if s := r.URL.Query().Get("from"); s != "" {
+		day, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid from date - use YYYY-MM-DD")
+			return
+		}
+		from = day
+	}
+
+	if from.After(to) {
+		h.writeError(w, http.StatusBadRequest, "from must not be after to")
+		return
+	}
+
+	report, err := h.repo.Report(r.Context(), from, to.AddDate(0, 0, 1))
+	if err != nil {
+		h.log.Error("Failed to build usage report: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "failed to build usage report")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, report)
+}
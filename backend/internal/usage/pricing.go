@@ -0,0 +1,48 @@
+package usage
+
+import "strings"
+
+// Price is what a model charges in USD per million tokens
+type Price struct {
+	InputPerMTok  float64
+	OutputPerMTok float64
+}
+
+// Prices maps a model name, or a prefix of one, to its price
+type Prices map[string]Price
+
+// DefaultPrices are list prices at the time of writing. Models not listed,
+// such as local ones behind an OpenAI-compatible server, cost nothing.
+var DefaultPrices = Prices{
+	"gemini-1.5-flash-8b": {InputPerMTok: 0.0375, OutputPerMTok: 0.15},
+	"gemini-1.5-flash":    {InputPerMTok: 0.075, OutputPerMTok: 0.30},
+	"gemini-1.5-pro":      {InputPerMTok: 1.25, OutputPerMTok: 5.00},
+	"gemini-2.0-flash":    {InputPerMTok: 0.10, OutputPerMTok: 0.40},
+	"gpt-4o-mini":         {InputPerMTok: 0.15, OutputPerMTok: 0.60},
+	"gpt-4o":              {InputPerMTok: 2.50, OutputPerMTok: 10.00},
+}
+
+// Lookup returns the price for model, matching the longest listed prefix so
+// that versioned names like "gemini-1.5-flash-002" resolve
+func (p Prices) Lookup(model string) (Price, bool) {
+	model = strings.ToLower(model)
+	best := ""
+	for name := range p {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return p[best], true
+}
+
+// Cost estimates the USD cost of one call
+func (p Prices) Cost(model string, promptTokens, candidateTokens int) float64 {
+	price, ok := p.Lookup(model)
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*price.InputPerMTok + float64(candidateTokens)*price.OutputPerMTok) / 1e6
+}
@@ -0,0 +1,79 @@
+package usage
+
+import (
+	"context"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+	"github.com/Jayyk09/CUHackIt/services/gemini"
+	"github.com/google/uuid"
+)
+
+// queueSize bounds how many entries wait to be written; beyond it entries
+// are dropped rather than slowing generation down
+const queueSize = 256
+
+// insertTimeout bounds each ledger write
+const insertTimeout = 5 * time.Second
+
+// Recorder implements gemini.UsageRecorder, pricing each call and writing
+// it to a Store from a background goroutine
+type Recorder struct {
+	store  Store
+	prices Prices
+	queue  chan Entry
+	log    *logger.Logger
+}
+
+var _ gemini.UsageRecorder = (*Recorder)(nil)
+
+// NewRecorder creates a Recorder and starts its writer
+func NewRecorder(store Store, prices Prices, log *logger.Logger) *Recorder {
+	r := &Recorder{
+		store:  store,
+		prices: prices,
+		queue:  make(chan Entry, queueSize),
+		log:    log,
+	}
+	go r.run()
+	return r
+}
+
+// RecordUsage queues one call for the ledger without blocking
+func (r *Recorder) RecordUsage(_ context.Context, u gemini.Usage) {
+	entry := Entry{
+		UserID:          u.Tags.UserID,
+		Agent:           u.Tags.Agent,
+		Mode:            u.Tags.Mode,
+		Provider:        u.Provider,
+		Model:           u.Model,
+		Streamed:        u.Streamed,
+		PromptTokens:    u.PromptTokens,
+		CandidateTokens: u.CandidateTokens,
+		TotalTokens:     u.TotalTokens,
+		LatencyMs:       u.Latency.Milliseconds(),
+		Success:         u.Success,
+		CostUSD:         r.prices.Cost(u.Model, u.PromptTokens, u.CandidateTokens),
+	}
+	// Calls can be tagged with IDs that are not users, e.g. from tests
+	if _, err := uuid.Parse(entry.UserID); err != nil {
+		entry.UserID = ""
+	}
+
+	select {
+	case r.queue <- entry:
+	default:
+		r.log.Warn("Usage ledger queue full, dropping entry for model %s", entry.Model)
+	}
+}
+
+// run writes queued entries for the life of the process
+func (r *Recorder) run() {
+	for entry := range r.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), insertTimeout)
+		if err := r.store.Insert(ctx, entry); err != nil {
+			r.log.Error("Failed to record LLM usage: %v", err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,16 @@
+package usage
+
+import (
+	"net/http"
+
+	"github.com/Jayyk09/CUHackIt/internal/database"
+	"github.com/Jayyk09/CUHackIt/internal/middleware"
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+)
+
+// RegisterRoutes registers the admin usage routes behind adminToken
+func RegisterRoutes(r *http.ServeMux, db *database.DB, adminToken string, log *logger.Logger) {
+	h := NewHandler(db, log)
+
+	r.Handle("GET /admin/usage", middleware.RequireAdminToken(adminToken, http.HandlerFunc(h.GetReport)))
+}
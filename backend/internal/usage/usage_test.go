@@ -0,0 +1,84 @@
+package usage
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+	"github.com/Jayyk09/CUHackIt/services/gemini"
+)
+
+type chanStore chan Entry
+
+func (s chanStore) Insert(_ context.Context, e Entry) error {
+	s <- e
+	return nil
+}
+
+func TestPricesLookupLongestPrefix(t *testing.T) {
+	tests := []struct {
+		model string
+		want  float64
+	}{
+		{"gemini-1.5-flash-002", 0.075},
+		{"gemini-1.5-flash-8b-latest", 0.0375},
+		{"GPT-4o-mini", 0.15},
+		{"llama3", 0},
+	}
+	for _, tt := range tests {
+		price, _ := DefaultPrices.Lookup(tt.model)
+		if price.InputPerMTok != tt.want {
+			t.Errorf("Lookup(%q) input price = %v, want %v", tt.model, price.InputPerMTok, tt.want)
+		}
+	}
+
+	cost := DefaultPrices.Cost("gpt-4o", 1000, 500)
+	if want := (1000*2.50 + 500*10.00) / 1e6; math.Abs(cost-want) > 1e-12 {
+		t.Errorf("Cost = %v, want %v", cost, want)
+	}
+}
+
+func TestRecorderPricesAndTagsCalls(t *testing.T) {
+	store := make(chanStore, 1)
+	rec := NewRecorder(store, DefaultPrices, logger.GetLogger("error"))
+
+	userID := "6f1c1f7e-3b7e-4b8e-9a55-2d1a4c0e9b11"
+	rec.RecordUsage(context.Background(), gemini.Usage{
+		Provider:        gemini.ProviderGemini,
+		Model:           "gemini-1.5-flash",
+		PromptTokens:    2000,
+		CandidateTokens: 1000,
+		TotalTokens:     3000,
+		Latency:         1500 * time.Millisecond,
+		Success:         true,
+		Tags:            gemini.UsageTags{UserID: userID, Agent: "pantry_only", Mode: "both"},
+	})
+
+	select {
+	case e := <-store:
+		if e.UserID != userID || e.Agent != "pantry_only" || e.Mode != "both" {
+			t.Errorf("tags = %q/%q/%q", e.UserID, e.Agent, e.Mode)
+		}
+		if e.LatencyMs != 1500 || e.TotalTokens != 3000 {
+			t.Errorf("latency %dms, %d tokens", e.LatencyMs, e.TotalTokens)
+		}
+		if want := (2000*0.075 + 1000*0.30) / 1e6; math.Abs(e.CostUSD-want) > 1e-12 {
+			t.Errorf("cost = %v, want %v", e.CostUSD, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("entry was not written")
+	}
+
+	// IDs that are not user UUIDs are not stored
+	rec.RecordUsage(context.Background(), gemini.Usage{Model: "fake", Tags: gemini.UsageTags{UserID: "test-user"}})
+	select {
+	case e := <-store:
+		if e.UserID != "" {
+			t.Errorf("UserID = %q, want empty", e.UserID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("entry was not written")
+	}
+}
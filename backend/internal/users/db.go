@@ -3,12 +3,19 @@ package users
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Allergen policies; see agents.AllergenPolicy
+const (
+	AllergenPolicyStrict = "strict"
+	AllergenPolicyWarn   = "warn"
+)
+
 var (
 	ErrUserNotFound      = errors.New("user not found")
 	ErrUserAlreadyExists = errors.New("user already exists")
@@ -26,6 +33,7 @@ type User struct {
 	NutritionalGoals     []string  `json:"nutritional_goals"`
 	CookingSkill         string    `json:"cooking_skill"`
 	CuisinePreferences   []string  `json:"cuisine_preferences"`
+	AllergenPolicy       string    `json:"allergen_policy"`
 	OnboardingCompleted  bool      `json:"onboarding_completed"`
 	CreatedAt            time.Time `json:"created_at"`
 	UpdatedAt            time.Time `json:"updated_at"`
@@ -46,6 +54,15 @@ type UpdateProfileInput struct {
 	NutritionalGoals   []string `json:"nutritional_goals,omitempty"`
 	CookingSkill       *string  `json:"cooking_skill,omitempty"`
 	CuisinePreferences []string `json:"cuisine_preferences,omitempty"`
+	AllergenPolicy     *string  `json:"allergen_policy,omitempty"`
+}
+
+// validate rejects values the users table does not accept
+func (in UpdateProfileInput) validate() error {
+	if in.AllergenPolicy != nil && *in.AllergenPolicy != AllergenPolicyStrict && *in.AllergenPolicy != AllergenPolicyWarn {
+		return fmt.Errorf("%w: allergen_policy must be %q or %q", ErrInvalidInput, AllergenPolicyStrict, AllergenPolicyWarn)
+	}
+	return nil
 }
 
 // Repository handles database operations for users
@@ -70,7 +87,7 @@ func (r *Repository) Create(ctx context.Context, input CreateUserInput) (*User,
 		VALUES ($1, $2, $3)
 		RETURNING id, auth0_id, email, name, allergens, dietary_preferences, 
 		          nutritional_goals, cooking_skill, cuisine_preferences, 
-		          onboarding_completed, created_at, updated_at
+		          allergen_policy, onboarding_completed, created_at, updated_at
 	`, input.Auth0ID, input.Email, input.Name).Scan(
 		&user.ID,
 		&user.Auth0ID,
@@ -81,6 +98,7 @@ func (r *Repository) Create(ctx context.Context, input CreateUserInput) (*User,
 		&user.NutritionalGoals,
 		&user.CookingSkill,
 		&user.CuisinePreferences,
+		&user.AllergenPolicy,
 		&user.OnboardingCompleted,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -101,7 +119,7 @@ func (r *Repository) GetByID(ctx context.Context, id string) (*User, error) {
 	err := r.pool.QueryRow(ctx, `
 		SELECT id, auth0_id, email, name, allergens, dietary_preferences,
 		       nutritional_goals, cooking_skill, cuisine_preferences,
-		       onboarding_completed, created_at, updated_at
+		       allergen_policy, onboarding_completed, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`, id).Scan(
@@ -114,6 +132,7 @@ func (r *Repository) GetByID(ctx context.Context, id string) (*User, error) {
 		&user.NutritionalGoals,
 		&user.CookingSkill,
 		&user.CuisinePreferences,
+		&user.AllergenPolicy,
 		&user.OnboardingCompleted,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -134,7 +153,7 @@ func (r *Repository) GetByAuth0ID(ctx context.Context, auth0ID string) (*User, e
 	err := r.pool.QueryRow(ctx, `
 		SELECT id, auth0_id, email, name, allergens, dietary_preferences,
 		       nutritional_goals, cooking_skill, cuisine_preferences,
-		       onboarding_completed, created_at, updated_at
+		       allergen_policy, onboarding_completed, created_at, updated_at
 		FROM users
 		WHERE auth0_id = $1
 	`, auth0ID).Scan(
@@ -147,6 +166,7 @@ func (r *Repository) GetByAuth0ID(ctx context.Context, auth0ID string) (*User, e
 		&user.NutritionalGoals,
 		&user.CookingSkill,
 		&user.CuisinePreferences,
+		&user.AllergenPolicy,
 		&user.OnboardingCompleted,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -167,7 +187,7 @@ func (r *Repository) GetByEmail(ctx context.Context, email string) (*User, error
 	err := r.pool.QueryRow(ctx, `
 		SELECT id, auth0_id, email, name, allergens, dietary_preferences,
 		       nutritional_goals, cooking_skill, cuisine_preferences,
-		       onboarding_completed, created_at, updated_at
+		       allergen_policy, onboarding_completed, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`, email).Scan(
@@ -180,6 +200,7 @@ func (r *Repository) GetByEmail(ctx context.Context, email string) (*User, error
 		&user.NutritionalGoals,
 		&user.CookingSkill,
 		&user.CuisinePreferences,
+		&user.AllergenPolicy,
 		&user.OnboardingCompleted,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -196,6 +217,10 @@ func (r *Repository) GetByEmail(ctx context.Context, email string) (*User, error
 
 // UpdateProfile updates a user's profile information
 func (r *Repository) UpdateProfile(ctx context.Context, id string, input UpdateProfileInput) (*User, error) {
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+
 	var user User
 	err := r.pool.QueryRow(ctx, `
 		UPDATE users
@@ -205,13 +230,14 @@ func (r *Repository) UpdateProfile(ctx context.Context, id string, input UpdateP
 			dietary_preferences = COALESCE($4, dietary_preferences),
 			nutritional_goals = COALESCE($5, nutritional_goals),
 			cooking_skill = COALESCE($6, cooking_skill),
-			cuisine_preferences = COALESCE($7, cuisine_preferences)
+			cuisine_preferences = COALESCE($7, cuisine_preferences),
+			allergen_policy = COALESCE($8, allergen_policy)
 		WHERE id = $1
 		RETURNING id, auth0_id, email, name, allergens, dietary_preferences,
 		          nutritional_goals, cooking_skill, cuisine_preferences,
-		          onboarding_completed, created_at, updated_at
+		          allergen_policy, onboarding_completed, created_at, updated_at
 	`, id, input.Name, input.Allergens, input.DietaryPreferences,
-		input.NutritionalGoals, input.CookingSkill, input.CuisinePreferences).Scan(
+		input.NutritionalGoals, input.CookingSkill, input.CuisinePreferences, input.AllergenPolicy).Scan(
 		&user.ID,
 		&user.Auth0ID,
 		&user.Email,
@@ -221,6 +247,7 @@ func (r *Repository) UpdateProfile(ctx context.Context, id string, input UpdateP
 		&user.NutritionalGoals,
 		&user.CookingSkill,
 		&user.CuisinePreferences,
+		&user.AllergenPolicy,
 		&user.OnboardingCompleted,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -237,6 +264,10 @@ func (r *Repository) UpdateProfile(ctx context.Context, id string, input UpdateP
 
 // CompleteOnboarding marks a user's onboarding as complete
 func (r *Repository) CompleteOnboarding(ctx context.Context, id string, input UpdateProfileInput) (*User, error) {
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+
 	var user User
 	err := r.pool.QueryRow(ctx, `
 		UPDATE users
@@ -247,13 +278,14 @@ func (r *Repository) CompleteOnboarding(ctx context.Context, id string, input Up
 			nutritional_goals = COALESCE($5, nutritional_goals),
 			cooking_skill = COALESCE($6, cooking_skill),
 			cuisine_preferences = COALESCE($7, cuisine_preferences),
+			allergen_policy = COALESCE($8, allergen_policy),
 			onboarding_completed = TRUE
 		WHERE id = $1
 		RETURNING id, auth0_id, email, name, allergens, dietary_preferences,
 		          nutritional_goals, cooking_skill, cuisine_preferences,
-		          onboarding_completed, created_at, updated_at
+		          allergen_policy, onboarding_completed, created_at, updated_at
 	`, id, input.Name, input.Allergens, input.DietaryPreferences,
-		input.NutritionalGoals, input.CookingSkill, input.CuisinePreferences).Scan(
+		input.NutritionalGoals, input.CookingSkill, input.CuisinePreferences, input.AllergenPolicy).Scan(
 		&user.ID,
 		&user.Auth0ID,
 		&user.Email,
@@ -263,6 +295,7 @@ func (r *Repository) CompleteOnboarding(ctx context.Context, id string, input Up
 		&user.NutritionalGoals,
 		&user.CookingSkill,
 		&user.CuisinePreferences,
+		&user.AllergenPolicy,
 		&user.OnboardingCompleted,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -277,6 +310,48 @@ func (r *Repository) CompleteOnboarding(ctx context.Context, id string, input Up
 	return &user, nil
 }
 
+// ListWithPantry retrieves every user who has at least one pantry item
+func (r *Repository) ListWithPantry(ctx context.Context) ([]User, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, auth0_id, email, name, allergens, dietary_preferences,
+		       nutritional_goals, cooking_skill, cuisine_preferences,
+		       allergen_policy, onboarding_completed, created_at, updated_at
+		FROM users u
+		WHERE EXISTS (SELECT 1 FROM pantry_items p WHERE p.user_id = u.id)
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&user.ID,
+			&user.Auth0ID,
+			&user.Email,
+			&user.Name,
+			&user.Allergens,
+			&user.DietaryPreferences,
+			&user.NutritionalGoals,
+			&user.CookingSkill,
+			&user.CuisinePreferences,
+			&user.AllergenPolicy,
+			&user.OnboardingCompleted,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
 // Delete removes a user from the database
 func (r *Repository) Delete(ctx context.Context, id string) error {
 	result, err := r.pool.Exec(ctx, `DELETE FROM users WHERE id = $1`, id)
@@ -9,17 +9,32 @@ import (
 	"github.com/Jayyk09/CUHackIt/pkg/logger"
 )
 
+// ChangeNotifier is told when a user's profile changes so data derived from
+// it, such as cached recipe generations, can be dropped
+type ChangeNotifier interface {
+	ProfileChanged(userID string)
+}
+
 // Handler handles HTTP requests for users
 type Handler struct {
-	repo *Repository
-	log  *logger.Logger
+	repo     *Repository
+	notifier ChangeNotifier
+	log      *logger.Logger
 }
 
-// NewHandler creates a new user handler
-func NewHandler(db *database.DB, log *logger.Logger) *Handler {
+// NewHandler creates a new user handler. notifier may be nil.
+func NewHandler(db *database.DB, log *logger.Logger, notifier ChangeNotifier) *Handler {
 	return &Handler{
-		repo: NewRepository(db.Pool),
-		log:  log,
+		repo:     NewRepository(db.Pool),
+		notifier: notifier,
+		log:      log,
+	}
+}
+
+// profileChanged notifies the ChangeNotifier, if any
+func (h *Handler) profileChanged(userID string) {
+	if h.notifier != nil {
+		h.notifier.ProfileChanged(userID)
 	}
 }
 
@@ -155,10 +170,15 @@ func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 			h.writeError(w, http.StatusNotFound, "user not found")
 			return
 		}
+		if errors.Is(err, ErrInvalidInput) {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		h.log.Error("Failed to update profile: %v", err)
 		h.writeError(w, http.StatusInternalServerError, "internal server error")
 		return
 	}
+	h.profileChanged(id)
 
 	h.writeJSON(w, http.StatusOK, user)
 }
@@ -183,10 +203,15 @@ func (h *Handler) CompleteOnboarding(w http.ResponseWriter, r *http.Request) {
 			h.writeError(w, http.StatusNotFound, "user not found")
 			return
 		}
+		if errors.Is(err, ErrInvalidInput) {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		h.log.Error("Failed to complete onboarding: %v", err)
 		h.writeError(w, http.StatusInternalServerError, "internal server error")
 		return
 	}
+	h.profileChanged(id)
 
 	h.writeJSON(w, http.StatusOK, user)
 }
@@ -209,6 +234,7 @@ func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		h.writeError(w, http.StatusInternalServerError, "internal server error")
 		return
 	}
+	h.profileChanged(id)
 
 	w.WriteHeader(http.StatusNoContent)
 }
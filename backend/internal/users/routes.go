@@ -7,9 +7,10 @@ import (
 	"github.com/Jayyk09/CUHackIt/pkg/logger"
 )
 
-// RegisterRoutes registers all user routes
-func RegisterRoutes(r *http.ServeMux, db *database.DB, log *logger.Logger) {
-	h := NewHandler(db, log)
+// RegisterRoutes registers all user routes. notifier is told about every
+// profile change and may be nil.
+func RegisterRoutes(r *http.ServeMux, db *database.DB, log *logger.Logger, notifier ChangeNotifier) {
+	h := NewHandler(db, log, notifier)
 
 	// User CRUD
 	r.HandleFunc("GET /users/{id}", h.GetUser)
@@ -3,13 +3,15 @@ package ws
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
-	"strconv"
 	"sync"
 	"time"
 
 	"github.com/Jayyk09/CUHackIt/internal/agents"
 	"github.com/Jayyk09/CUHackIt/internal/pantry"
+	"github.com/Jayyk09/CUHackIt/internal/quota"
 	"github.com/Jayyk09/CUHackIt/internal/users"
 	"github.com/Jayyk09/CUHackIt/pkg/logger"
 	"github.com/Jayyk09/CUHackIt/services/gemini"
@@ -34,6 +36,7 @@ const (
 	MessageTypeGenerate       MessageType = "generate"
 	MessageTypeRecipeStart    MessageType = "recipe_start"
 	MessageTypeRecipeProgress MessageType = "recipe_progress"
+	MessageTypeRecipeStep     MessageType = "recipe_step"
 	MessageTypeRecipeComplete MessageType = "recipe_complete"
 	MessageTypeError          MessageType = "error"
 	MessageTypePing           MessageType = "ping"
@@ -48,41 +51,63 @@ type Message struct {
 
 // GeneratePayload is the payload for generate requests
 type GeneratePayload struct {
-	UserID      string `json:"user_id"`
-	Mode        string `json:"mode"`         // "pantry_only", "flexible", "both"
-	RecipeCount int    `json:"recipe_count"` // 1-3
+	UserID       string `json:"user_id"`
+	Mode         string `json:"mode"`          // "pantry_only", "flexible", "both", "ensemble"
+	RecipeCount  int    `json:"recipe_count"`  // 1-3
+	ForceRefresh bool   `json:"force_refresh"` // skip the result cache
+
+	ExcludeUnsafePantryItems bool `json:"exclude_unsafe_pantry_items"` // keep allergen-conflicting items from the agents
 }
 
 // RecipeStartPayload is sent when recipe generation starts
 type RecipeStartPayload struct {
-	TotalRecipes int    `json:"total_recipes"`
-	Mode         string `json:"mode"`
+	TotalRecipes int           `json:"total_recipes"`
+	Mode         string        `json:"mode"`
+	Quota        *quota.Status `json:"quota,omitempty"` // remaining after this generation
 }
 
-// RecipeProgressPayload is sent for each generated recipe
+// RecipeProgressPayload is sent as soon as each recipe has been generated
 type RecipeProgressPayload struct {
 	RecipeIndex int            `json:"recipe_index"`
-	TotalCount  int            `json:"total_count"`
+	TotalCount  int            `json:"total_count"` // expected total; the final count is in recipe_complete
+	Source      string         `json:"source"`
+	SourceIndex int            `json:"source_index"` // 0-based position within the source agent's recipes
 	Recipe      agents.Recipe  `json:"recipe"`
 }
 
+// RecipeStepPayload is sent as soon as an instruction step has been generated,
+// before the recipe it belongs to is complete
+type RecipeStepPayload struct {
+	Source      string `json:"source"`
+	SourceIndex int    `json:"source_index"` // matches RecipeProgressPayload.SourceIndex
+	StepIndex   int    `json:"step_index"`
+	Step        string `json:"step"`
+}
+
 // RecipeCompletePayload is sent when all recipes are generated
 type RecipeCompletePayload struct {
-	TotalGenerated int             `json:"total_generated"`
-	FilteredCount  int             `json:"filtered_count"`
-	Recipes        []agents.Recipe `json:"recipes"`
+	TotalGenerated    int             `json:"total_generated"`
+	FilteredCount     int             `json:"filtered_count"`
+	DietFilteredCount int             `json:"diet_filtered_count,omitempty"`
+	Recipes           []agents.Recipe `json:"recipes"`
+	Cached            bool            `json:"cached"`
+	Quota             *quota.Status   `json:"quota,omitempty"` // a cached result does not count against it
 }
 
 // ErrorPayload is sent on errors
 type ErrorPayload struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Code       string        `json:"code"`
+	Message    string        `json:"message"`
+	RetryAfter int           `json:"retry_after,omitempty"` // seconds, for service_unavailable, rate_limited and quota_exceeded
+	Reason     quota.Reason  `json:"reason,omitempty"`      // which limit was hit, for rate_limited and quota_exceeded
+	Quota      *quota.Status `json:"quota,omitempty"`
 }
 
 // Client represents a connected WebSocket client
 type Client struct {
 	ID       string
 	UserID   string
+	IP       string // client address, for rate limiting
 	Conn     *websocket.Conn
 	Send     chan []byte
 	hub      *Hub
@@ -95,17 +120,29 @@ type Hub struct {
 	register     chan *Client
 	unregister   chan *Client
 	orchestrator *agents.Orchestrator
-	pantryRepo   *pantry.Repository
-	userRepo     *users.Repository
+	limits       *quota.Manager
+	pantryRepo   pantryLister
+	userRepo     userGetter
 	log          *logger.Logger
 	mu           sync.RWMutex
 }
 
-// NewHub creates a new WebSocket hub
-func NewHub(geminiClient *gemini.Client, pantryRepo *pantry.Repository, userRepo *users.Repository, log *logger.Logger) *Hub {
+// pantryLister and userGetter are the reads generation makes, satisfied by
+// the pantry and users repositories
+type pantryLister interface {
+	ListByUserID(ctx context.Context, userID string) ([]pantry.PantryItemWithFood, error)
+}
+
+type userGetter interface {
+	GetByID(ctx context.Context, id string) (*users.User, error)
+}
+
+// NewHub creates a new WebSocket hub. cache may be nil to disable result
+// caching and limits nil to disable quotas and rate limiting.
+func NewHub(provider gemini.Provider, cache *agents.ResultCache, limits *quota.Manager, pantryRepo *pantry.Repository, userRepo *users.Repository, log *logger.Logger) *Hub {
 	var orchestrator *agents.Orchestrator
-	if geminiClient != nil {
-		orchestrator = agents.NewOrchestrator(geminiClient, log)
+	if provider != nil {
+		orchestrator = agents.NewOrchestrator(provider, log).WithCache(cache)
 	}
 
 	return &Hub{
@@ -113,6 +150,7 @@ func NewHub(geminiClient *gemini.Client, pantryRepo *pantry.Repository, userRepo
 		register:     make(chan *Client),
 		unregister:   make(chan *Client),
 		orchestrator: orchestrator,
+		limits:       limits,
 		pantryRepo:   pantryRepo,
 		userRepo:     userRepo,
 		log:          log,
@@ -152,6 +190,7 @@ func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	clientID := uuid.New().String()
 	client := &Client{
 		ID:   clientID,
+		IP:   h.limits.ClientIP(r),
 		Conn: conn,
 		Send: make(chan []byte, 256),
 		hub:  h,
@@ -316,6 +355,11 @@ func (c *Client) handleGenerate(payload GeneratePayload) {
 
 	c.UserID = userID
 
+	if err := c.hub.limits.Limit(userID, c.IP); err != nil {
+		c.sendLimitError(err)
+		return
+	}
+
 	// Get user's pantry items
 	pantryItems, err := c.hub.pantryRepo.ListByUserID(context.Background(), userID)
 	if err != nil {
@@ -335,22 +379,16 @@ func (c *Client) handleGenerate(payload GeneratePayload) {
 		return
 	}
 
-	// Convert pantry items to agent format
-	agentPantryItems := make([]agents.PantryItem, len(pantryItems))
-	for i, item := range pantryItems {
-		category := ""
-		if item.Category != nil {
-			category = *item.Category
-		}
-		agentPantryItems[i] = agents.PantryItem{
-			ID:       strconv.Itoa(item.ID),
-			Name:     item.ProductName,
-			Category: category,
-			Quantity: float64(item.Quantity),
-			Unit:     "item",
-		}
+	// Count this generation against the user's budgets
+	reservation, err := c.hub.limits.Reserve(context.Background(), userID)
+	if err != nil {
+		c.sendLimitError(err)
+		return
 	}
 
+	// Convert pantry items to agent format with computed expiration data
+	agentPantryItems := pantry.AgentItems(pantryItems, time.Now())
+
 	// Determine mode
 	var mode agents.OrchestratorMode
 	switch payload.Mode {
@@ -358,6 +396,8 @@ func (c *Client) handleGenerate(payload GeneratePayload) {
 		mode = agents.ModeFlexible
 	case "both":
 		mode = agents.ModeBoth
+	case "ensemble":
+		mode = agents.ModeEnsemble
 	default:
 		mode = agents.ModePantryOnly
 	}
@@ -370,49 +410,114 @@ func (c *Client) handleGenerate(payload GeneratePayload) {
 		recipeCount = 3
 	}
 
+	// Both mode runs two agents, each producing recipeCount recipes
+	totalRecipes := recipeCount
+	if mode == agents.ModeBoth {
+		totalRecipes *= 2
+	}
+
 	// Send start notification
 	c.sendMessage(MessageTypeRecipeStart, RecipeStartPayload{
-		TotalRecipes: recipeCount,
+		TotalRecipes: totalRecipes,
 		Mode:         string(mode),
+		Quota:        quotaStatus(reservation),
 	})
 
-	// Generate recipes
+	// Generate recipes, forwarding steps and recipes as the model produces them
 	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
 	defer cancel()
 
-	result, err := c.hub.orchestrator.Generate(ctx, agents.GenerateRequest{
+	result, err := c.hub.orchestrator.GenerateStream(ctx, agents.GenerateRequest{
 		RecipeRequest: agents.RecipeRequest{
 			PantryItems:        agentPantryItems,
 			Allergens:          user.Allergens,
+			AllergenPolicy:     agents.AllergenPolicy(user.AllergenPolicy),
 			DietaryPreferences: user.DietaryPreferences,
 			NutritionalGoals:   user.NutritionalGoals,
 			CookingSkill:       user.CookingSkill,
 			CuisinePreferences: user.CuisinePreferences,
 			RecipeCount:        recipeCount,
 		},
-		Mode: mode,
+		Mode:                     mode,
+		UserID:                   userID,
+		ForceRefresh:             payload.ForceRefresh,
+		ExcludeUnsafePantryItems: payload.ExcludeUnsafePantryItems,
+	}, func(ev agents.RecipeEvent) {
+		switch ev.Type {
+		case agents.RecipeEventStep:
+			c.sendMessage(MessageTypeRecipeStep, RecipeStepPayload{
+				Source:      ev.Source,
+				SourceIndex: ev.SourceIndex,
+				StepIndex:   ev.StepIndex,
+				Step:        ev.Step,
+			})
+		case agents.RecipeEventRecipe:
+			c.sendMessage(MessageTypeRecipeProgress, RecipeProgressPayload{
+				RecipeIndex: ev.Index + 1,
+				TotalCount:  totalRecipes,
+				Source:      ev.Source,
+				SourceIndex: ev.SourceIndex,
+				Recipe:      *ev.Recipe,
+			})
+		}
 	})
 
+	if !agents.ChargesQuota(result, err) {
+		c.hub.limits.Release(context.WithoutCancel(ctx), reservation)
+	}
+
 	if err != nil {
+		if retryAfter, ok := gemini.RetryAfter(err); ok {
+			c.sendMessage(MessageTypeError, ErrorPayload{
+				Code:       "service_unavailable",
+				Message:    "recipe generation temporarily unavailable - try again later",
+				RetryAfter: int(math.Ceil(retryAfter.Seconds())),
+			})
+			return
+		}
 		c.sendError("generation_error", err.Error())
 		return
 	}
 
-	// Send each recipe as progress
-	for i, recipe := range result.AllRecipes {
-		c.sendMessage(MessageTypeRecipeProgress, RecipeProgressPayload{
-			RecipeIndex: i + 1,
-			TotalCount:  len(result.AllRecipes),
-			Recipe:      recipe,
-		})
-		// Small delay between recipes for UX
-		time.Sleep(100 * time.Millisecond)
-	}
-
 	// Send completion
 	c.sendMessage(MessageTypeRecipeComplete, RecipeCompletePayload{
-		TotalGenerated: result.TotalCount,
-		FilteredCount:  result.FilteredCount,
-		Recipes:        result.AllRecipes,
+		TotalGenerated:    result.TotalCount,
+		FilteredCount:     result.FilteredCount,
+		DietFilteredCount: result.DietFilteredCount,
+		Recipes:           result.AllRecipes,
+		Cached:            result.Cached,
+		Quota:             quotaStatus(reservation),
 	})
 }
+
+// sendLimitError reports a generation rejected by the quota manager
+func (c *Client) sendLimitError(err error) {
+	var limitErr *quota.LimitError
+	if !errors.As(err, &limitErr) {
+		c.hub.log.Error("Failed to check generation quota: %v", err)
+		c.sendError("quota_error", "failed to check generation quota")
+		return
+	}
+
+	payload := ErrorPayload{
+		Code:       "rate_limited",
+		Message:    "too many generation requests - slow down",
+		RetryAfter: limitErr.RetryAfterSeconds(),
+		Reason:     limitErr.Reason,
+		Quota:      limitErr.Status,
+	}
+	if errors.Is(err, quota.ErrQuotaExceeded) {
+		payload.Code = "quota_exceeded"
+		payload.Message = "generation quota exceeded"
+	}
+	c.sendMessage(MessageTypeError, payload)
+}
+
+// quotaStatus returns the status to report, or nil when no budget is enforced
+func quotaStatus(res *quota.Reservation) *quota.Status {
+	if res == nil || (res.Status.DailyLimit == 0 && res.Status.MonthlyLimit == 0) {
+		return nil
+	}
+	status := res.Status
+	return &status
+}
@@ -0,0 +1,129 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/internal/pantry"
+	"github.com/Jayyk09/CUHackIt/internal/users"
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+	"github.com/Jayyk09/CUHackIt/services/gemini"
+	"github.com/gorilla/websocket"
+)
+
+type stubPantry []pantry.PantryItemWithFood
+
+func (s stubPantry) ListByUserID(ctx context.Context, userID string) ([]pantry.PantryItemWithFood, error) {
+	return s, nil
+}
+
+type stubUsers struct{}
+
+func (stubUsers) GetByID(ctx context.Context, id string) (*users.User, error) {
+	return &users.User{ID: id, AllergenPolicy: "filter"}, nil
+}
+
+// dialHub starts a hub backed by the fake provider and connects to it
+func dialHub(t *testing.T, items stubPantry) *websocket.Conn {
+	t.Helper()
+	hub := NewHub(gemini.NewFakeClient(logger.GetLogger("error")), nil, nil, nil, nil, logger.GetLogger("error"))
+	hub.pantryRepo, hub.userRepo = items, stubUsers{}
+	go hub.Run()
+
+	srv := httptest.NewServer(http.HandlerFunc(hub.HandleWebSocket))
+	t.Cleanup(srv.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readUntil reads messages, which the hub may batch into one frame, until
+// one of the given type arrives or the connection fails
+func readUntil(t *testing.T, conn *websocket.Conn, last ...MessageType) []Message {
+	t.Helper()
+	var msgs []Message
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		_, frame, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read failed after %d messages: %v", len(msgs), err)
+		}
+		for _, raw := range bytes.Split(frame, []byte{'\n'}) {
+			var msg Message
+			if err := json.Unmarshal(raw, &msg); err != nil {
+				t.Fatalf("invalid message %s: %v", raw, err)
+			}
+			msgs = append(msgs, msg)
+			for _, typ := range last {
+				if msg.Type == typ {
+					return msgs
+				}
+			}
+		}
+	}
+}
+
+func sendGenerate(t *testing.T, conn *websocket.Conn, payload GeneratePayload) {
+	t.Helper()
+	body, _ := json.Marshal(payload)
+	if err := conn.WriteJSON(Message{Type: MessageTypeGenerate, Payload: body}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenerateExchangeWithFakeProvider(t *testing.T) {
+	conn := dialHub(t, stubPantry{
+		{ID: 1, ProductName: "Chicken Breast", Quantity: 2, Unit: "lb", AddedAt: time.Now()},
+		{ID: 2, ProductName: "Brown Rice", Quantity: 1, Unit: "lb", AddedAt: time.Now()},
+		{ID: 3, ProductName: "Eggs", Quantity: 12, Unit: "item", AddedAt: time.Now()},
+	})
+	readUntil(t, conn, MessageTypeConnect)
+
+	sendGenerate(t, conn, GeneratePayload{UserID: "u1", Mode: "pantry_only", RecipeCount: 2})
+	msgs := readUntil(t, conn, MessageTypeRecipeComplete, MessageTypeError)
+
+	if msgs[0].Type != MessageTypeRecipeStart {
+		t.Fatalf("expected recipe_start first, got %s", msgs[0].Type)
+	}
+	progress := 0
+	for _, msg := range msgs {
+		if msg.Type == MessageTypeRecipeProgress {
+			progress++
+		}
+	}
+	last := msgs[len(msgs)-1]
+	if last.Type != MessageTypeRecipeComplete {
+		t.Fatalf("expected recipe_complete, got %s: %s", last.Type, last.Payload)
+	}
+	var complete RecipeCompletePayload
+	if err := json.Unmarshal(last.Payload, &complete); err != nil {
+		t.Fatal(err)
+	}
+	if complete.TotalGenerated != 2 || len(complete.Recipes) != 2 || progress != 2 {
+		t.Fatalf("expected 2 recipes streamed and completed, got %d streamed and %+v", progress, complete)
+	}
+}
+
+func TestGenerateExchangeEmptyPantry(t *testing.T) {
+	conn := dialHub(t, nil)
+	readUntil(t, conn, MessageTypeConnect)
+
+	sendGenerate(t, conn, GeneratePayload{UserID: "u1"})
+	msgs := readUntil(t, conn, MessageTypeError)
+	var payload ErrorPayload
+	if err := json.Unmarshal(msgs[len(msgs)-1].Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Code != "empty_pantry" {
+		t.Fatalf("expected empty_pantry error, got %+v", payload)
+	}
+}
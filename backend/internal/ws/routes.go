@@ -3,19 +3,21 @@ package ws
 import (
 	"net/http"
 
+	"github.com/Jayyk09/CUHackIt/internal/agents"
 	"github.com/Jayyk09/CUHackIt/internal/database"
 	"github.com/Jayyk09/CUHackIt/internal/pantry"
+	"github.com/Jayyk09/CUHackIt/internal/quota"
 	"github.com/Jayyk09/CUHackIt/internal/users"
 	"github.com/Jayyk09/CUHackIt/pkg/logger"
 	"github.com/Jayyk09/CUHackIt/services/gemini"
 )
 
 // RegisterRoutes registers the WebSocket endpoint and starts the hub
-func RegisterRoutes(r *http.ServeMux, db *database.DB, geminiClient *gemini.Client, log *logger.Logger) *Hub {
+func RegisterRoutes(r *http.ServeMux, db *database.DB, provider gemini.Provider, cache *agents.ResultCache, limits *quota.Manager, log *logger.Logger) *Hub {
 	pantryRepo := pantry.NewRepository(db.Pool)
 	userRepo := users.NewRepository(db.Pool)
 
-	hub := NewHub(geminiClient, pantryRepo, userRepo, log)
+	hub := NewHub(provider, cache, limits, pantryRepo, userRepo, log)
 
 	// Start the hub in a goroutine
 	go hub.Run()
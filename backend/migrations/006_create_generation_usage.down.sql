@@ -0,0 +1,2 @@
+-- Drop generation usage table
+DROP TABLE IF EXISTS generation_usage;
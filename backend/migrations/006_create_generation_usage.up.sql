@@ -0,0 +1,7 @@
+-- Per-user recipe generation counts, one row per UTC day, for daily and monthly quotas
+CREATE TABLE IF NOT EXISTS generation_usage (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0 CHECK (count >= 0),
+    PRIMARY KEY (user_id, day)
+);
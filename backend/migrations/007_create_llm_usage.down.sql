@@ -0,0 +1,4 @@
+-- Drop LLM usage ledger
+DROP INDEX IF EXISTS idx_llm_usage_user_id;
+DROP INDEX IF EXISTS idx_llm_usage_created_at;
+DROP TABLE IF EXISTS llm_usage;
@@ -0,0 +1,20 @@
+-- One row per LLM call (each retry and repair re-prompt counts separately)
+CREATE TABLE IF NOT EXISTS llm_usage (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL, -- NULL for calls not made for a user
+    agent VARCHAR(50) NOT NULL DEFAULT '',                -- e.g. 'pantry_only', 'flexible', 'food_enrichment'
+    mode VARCHAR(50) NOT NULL DEFAULT '',                 -- orchestrator mode
+    provider VARCHAR(50) NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    streamed BOOLEAN NOT NULL DEFAULT FALSE,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    candidate_tokens INTEGER NOT NULL DEFAULT 0,
+    total_tokens INTEGER NOT NULL DEFAULT 0,
+    latency_ms INTEGER NOT NULL DEFAULT 0,
+    success BOOLEAN NOT NULL DEFAULT TRUE,
+    cost_usd NUMERIC(12, 6) NOT NULL DEFAULT 0, -- estimated at the prices in effect when recorded
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_llm_usage_created_at ON llm_usage(created_at);
+CREATE INDEX IF NOT EXISTS idx_llm_usage_user_id ON llm_usage(user_id, created_at);
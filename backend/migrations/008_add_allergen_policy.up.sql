@@ -0,0 +1,5 @@
+-- How recipes that fail the allergen check are handled: 'strict' drops them
+-- and generates replacements, 'warn' returns them with flagged ingredients
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS allergen_policy TEXT NOT NULL DEFAULT 'strict'
+        CHECK (allergen_policy IN ('strict', 'warn'));
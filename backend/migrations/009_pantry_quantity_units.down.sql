@@ -0,0 +1,9 @@
+-- Back to 002's columns: decimal quantities and a free-form unit
+ALTER TABLE pantry_items DROP CONSTRAINT IF EXISTS pantry_items_unit_check;
+ALTER TABLE pantry_items
+    ALTER COLUMN unit TYPE VARCHAR(50),
+    ALTER COLUMN unit DROP NOT NULL,
+    ALTER COLUMN unit SET DEFAULT 'item';
+ALTER TABLE pantry_items
+    ALTER COLUMN quantity TYPE DECIMAL(10, 2) USING ROUND(quantity, 2),
+    ALTER COLUMN quantity SET DEFAULT 1;
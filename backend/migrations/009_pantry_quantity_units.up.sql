@@ -0,0 +1,36 @@
+-- Pantry quantities become decimals measured in a unit. 002 stored units as
+-- free text, so the spellings units.ParseUnit accepts are mapped to their
+-- canonical unit; anything else, including containers and portions like
+-- "can" or "slice", becomes an item count.
+ALTER TABLE pantry_items
+    ALTER COLUMN quantity TYPE NUMERIC(12, 3) USING quantity::NUMERIC(12, 3),
+    ALTER COLUMN quantity SET DEFAULT 1;
+
+ALTER TABLE pantry_items ADD COLUMN IF NOT EXISTS unit TEXT;
+
+UPDATE pantry_items p
+SET unit = a.canonical
+FROM (VALUES
+    ('g', 'g'), ('gr', 'g'), ('gram', 'g'), ('grams', 'g'), ('gramme', 'g'), ('grammes', 'g'),
+    ('kg', 'kg'), ('kgs', 'kg'), ('kilo', 'kg'), ('kilos', 'kg'), ('kilogram', 'kg'), ('kilograms', 'kg'),
+    ('oz', 'oz'), ('ozs', 'oz'), ('ounce', 'oz'), ('ounces', 'oz'),
+    ('lb', 'lb'), ('lbs', 'lb'), ('pound', 'lb'), ('pounds', 'lb'),
+    ('ml', 'ml'), ('mls', 'ml'), ('milliliter', 'ml'), ('milliliters', 'ml'), ('millilitre', 'ml'), ('millilitres', 'ml'),
+    ('l', 'l'), ('liter', 'l'), ('liters', 'l'), ('litre', 'l'), ('litres', 'l'),
+    ('tsp', 'tsp'), ('tsps', 'tsp'), ('teaspoon', 'tsp'), ('teaspoons', 'tsp'),
+    ('tbsp', 'tbsp'), ('tbsps', 'tbsp'), ('tbs', 'tbsp'), ('tablespoon', 'tbsp'), ('tablespoons', 'tbsp'),
+    ('cup', 'cup'), ('cups', 'cup'), ('c', 'cup')
+) AS a(spelling, canonical)
+WHERE regexp_replace(lower(btrim(p.unit)), '\.$', '') = a.spelling;
+
+UPDATE pantry_items
+SET unit = 'item'
+WHERE unit IS NULL
+   OR unit NOT IN ('g', 'kg', 'oz', 'lb', 'ml', 'l', 'tsp', 'tbsp', 'cup', 'item');
+
+ALTER TABLE pantry_items
+    ALTER COLUMN unit TYPE TEXT,
+    ALTER COLUMN unit SET DEFAULT 'item',
+    ALTER COLUMN unit SET NOT NULL,
+    ADD CONSTRAINT pantry_items_unit_check
+        CHECK (unit IN ('g', 'kg', 'oz', 'lb', 'ml', 'l', 'tsp', 'tbsp', 'cup', 'item'));
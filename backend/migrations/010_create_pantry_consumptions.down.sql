@@ -0,0 +1,3 @@
+-- Drop pantry consumption log
+DROP INDEX IF EXISTS idx_pantry_consumptions_user_id;
+DROP TABLE IF EXISTS pantry_consumptions;
@@ -0,0 +1,14 @@
+-- Pantry quantities taken out when a recipe is cooked. items holds the
+-- per-row diff so the consumption can be undone; undone_at is set once it is.
+CREATE TABLE IF NOT EXISTS pantry_consumptions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recipe_id UUID REFERENCES recipes(id) ON DELETE SET NULL,
+    scale NUMERIC(8, 3) NOT NULL DEFAULT 1,
+    items JSONB NOT NULL DEFAULT '[]',
+    unconsumed JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    undone_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_pantry_consumptions_user_id ON pantry_consumptions(user_id, created_at DESC);
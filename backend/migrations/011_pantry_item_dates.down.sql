@@ -0,0 +1,18 @@
+-- Back to 002's purchase_date and expiration_date, keeping their values
+DROP INDEX IF EXISTS idx_pantry_items_expires_at;
+ALTER TABLE pantry_items DROP CONSTRAINT IF EXISTS pantry_items_shelf_life_days_check;
+
+ALTER TABLE pantry_items
+    ADD COLUMN IF NOT EXISTS purchase_date DATE DEFAULT CURRENT_DATE,
+    ADD COLUMN IF NOT EXISTS expiration_date DATE;
+
+UPDATE pantry_items
+SET purchase_date = purchased_at,
+    expiration_date = expires_at;
+
+CREATE INDEX IF NOT EXISTS idx_pantry_items_expiration ON pantry_items(expiration_date);
+
+ALTER TABLE pantry_items
+    DROP COLUMN IF EXISTS opened_at,
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS purchased_at;
@@ -0,0 +1,29 @@
+-- Dates that drive pantry expiry. purchased_at starts the shelf-life clock,
+-- expires_at is a printed best-by date, opened_at shortens the remaining
+-- life, and shelf_life_days (from 002) overrides foods.shelf_life for one
+-- item. purchased_at and expires_at replace 002's purchase_date and
+-- expiration_date, whose values move over.
+ALTER TABLE pantry_items
+    ADD COLUMN IF NOT EXISTS purchased_at DATE,
+    ADD COLUMN IF NOT EXISTS expires_at DATE,
+    ADD COLUMN IF NOT EXISTS opened_at DATE,
+    ADD COLUMN IF NOT EXISTS shelf_life_days INTEGER;
+
+UPDATE pantry_items
+SET purchased_at = COALESCE(purchase_date, created_at::date),
+    expires_at = expiration_date;
+
+DROP INDEX IF EXISTS idx_pantry_items_expiration;
+ALTER TABLE pantry_items
+    DROP COLUMN IF EXISTS purchase_date,
+    DROP COLUMN IF EXISTS expiration_date;
+
+ALTER TABLE pantry_items
+    ALTER COLUMN purchased_at SET DEFAULT CURRENT_DATE,
+    ALTER COLUMN purchased_at SET NOT NULL;
+
+UPDATE pantry_items SET shelf_life_days = NULL WHERE shelf_life_days <= 0;
+ALTER TABLE pantry_items
+    ADD CONSTRAINT pantry_items_shelf_life_days_check CHECK (shelf_life_days > 0);
+
+CREATE INDEX IF NOT EXISTS idx_pantry_items_expires_at ON pantry_items(user_id, expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS bump_pantry_items_version ON pantry_items;
+DROP FUNCTION IF EXISTS bump_pantry_item_version();
+ALTER TABLE pantry_items
+    DROP COLUMN IF EXISTS version,
+    DROP COLUMN IF EXISTS location,
+    DROP COLUMN IF EXISTS notes;
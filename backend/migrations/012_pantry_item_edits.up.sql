@@ -0,0 +1,21 @@
+-- Editable pantry item details and a version for optimistic concurrency.
+-- Every update bumps version, so a client editing with a stale version can
+-- be told its copy is out of date. updated_at and its trigger come from 002.
+ALTER TABLE pantry_items
+    ADD COLUMN IF NOT EXISTS notes TEXT,
+    ADD COLUMN IF NOT EXISTS location TEXT CHECK (location IN ('pantry', 'fridge', 'freezer', 'counter')),
+    ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION bump_pantry_item_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.version = OLD.version + 1;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS bump_pantry_items_version ON pantry_items;
+CREATE TRIGGER bump_pantry_items_version
+    BEFORE UPDATE ON pantry_items
+    FOR EACH ROW
+    EXECUTE FUNCTION bump_pantry_item_version();
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_pending_products_user_gtin;
+DROP INDEX IF EXISTS idx_pending_products_user_id;
+DROP TABLE IF EXISTS pending_products;
+DROP INDEX IF EXISTS idx_foods_gtin;
+ALTER TABLE foods DROP COLUMN IF EXISTS barcode;
@@ -0,0 +1,31 @@
+-- Product barcodes, matched as 14-digit GTINs whatever length they are
+-- stored with, and scans of barcodes no product has yet. A completed scan
+-- is the user's own mapping of its barcode to a food; the shared foods
+-- catalog is not changed by users.
+ALTER TABLE foods ADD COLUMN IF NOT EXISTS barcode TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_foods_gtin ON foods ((lpad(barcode, 14, '0'))) WHERE barcode IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS pending_products (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    gtin TEXT NOT NULL,
+
+    -- What the scan would have added to the pantry
+    quantity NUMERIC(12, 3) NOT NULL DEFAULT 1,
+    unit TEXT NOT NULL DEFAULT 'item',
+    is_frozen BOOLEAN NOT NULL DEFAULT FALSE,
+    purchased_at DATE NOT NULL DEFAULT CURRENT_DATE,
+    expires_at DATE,
+    opened_at DATE,
+
+    -- Set once the user says which product it is
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'completed')),
+    food_id BIGINT,
+    pantry_item_id INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_pending_products_user_id ON pending_products(user_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_pending_products_user_gtin ON pending_products(user_id, gtin) WHERE status = 'completed';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_foods_product_name_trgm;
+DROP INDEX IF EXISTS idx_receipt_imports_user_id;
+DROP TABLE IF EXISTS receipt_imports;
+ALTER TABLE pantry_items DROP COLUMN IF EXISTS price;
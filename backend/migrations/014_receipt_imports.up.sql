@@ -0,0 +1,21 @@
+-- What was paid for a pantry item as bought, e.g. from an imported receipt
+ALTER TABLE pantry_items ADD COLUMN IF NOT EXISTS price NUMERIC(10, 2) CHECK (price >= 0);
+
+-- Receipts parsed into drafts for the user to review before they are
+-- committed to the pantry
+CREATE TABLE IF NOT EXISTS receipt_imports (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purchased_at DATE NOT NULL DEFAULT CURRENT_DATE,
+    lines JSONB NOT NULL,                    -- parsed lines with their food matches
+    status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'committed')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    committed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_receipt_imports_user_id ON receipt_imports(user_id, created_at DESC);
+
+-- Receipt lines are matched to foods with ILIKE '%word%', which only an
+-- index of trigrams can serve
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS idx_foods_product_name_trgm ON foods USING GIN (product_name gin_trgm_ops);
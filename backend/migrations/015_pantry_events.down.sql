@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_pantry_events_item;
+DROP INDEX IF EXISTS idx_pantry_events_user_created;
+DROP TABLE IF EXISTS pantry_events;
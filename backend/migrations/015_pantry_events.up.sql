@@ -0,0 +1,24 @@
+-- Audit log of pantry changes. Items are deleted from pantry_items, so
+-- events keep their ids and food without a foreign key to them.
+CREATE TABLE IF NOT EXISTS pantry_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    pantry_item_id INTEGER NOT NULL,
+    food_id BIGINT NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('added', 'updated', 'deleted', 'consumed', 'restored')),
+    reason TEXT CHECK (reason IN ('eaten', 'discarded', 'expired', 'donated')),
+
+    -- Quantities in grams, milliliters or items; before is NULL when it
+    -- could not be expressed in after's unit
+    quantity_before NUMERIC(14, 3),
+    quantity_after NUMERIC(14, 3) NOT NULL,
+    unit TEXT NOT NULL,
+    price NUMERIC(10, 2),                    -- the item's price as bought
+
+    source TEXT NOT NULL,                    -- manual, scan, receipt, bulk or recipe
+    recipe_id UUID,                          -- for consumed and restored
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_pantry_events_user_created ON pantry_events(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_pantry_events_item ON pantry_events(pantry_item_id);
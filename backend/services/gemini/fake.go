@@ -0,0 +1,419 @@
+package gemini
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+)
+
+// Request kinds a FakeMatch can select on
+const (
+	FakeKindRecipes    = "recipes"
+	FakeKindPersonal   = "personal"
+	FakeKindCategorize = "categorize"
+	FakeKindText       = "text"
+)
+
+//go:embed fixtures/fake.json
+var defaultFakeFixtures []byte
+
+// FakeMatch describes the prompt features a fixture applies to.
+// Empty fields match anything.
+type FakeMatch struct {
+	Kind       string   `json:"kind,omitempty"`
+	PantryOnly *bool    `json:"pantry_only,omitempty"`
+	Contains   []string `json:"contains,omitempty"` // all must appear in the prompt (case-insensitive)
+}
+
+// FakeFixture is a canned model response keyed by prompt features.
+// Response is either a JSON string (returned verbatim) or any other JSON
+// value (returned as its raw encoding, as if the model had produced it).
+type FakeFixture struct {
+	Name     string          `json:"name"`
+	Match    FakeMatch       `json:"match"`
+	Response json.RawMessage `json:"response"`
+}
+
+// FakeResponse is a scripted one-shot response queued with Enqueue
+type FakeResponse struct {
+	Text string
+	Err  error
+}
+
+// FakeClient is a deterministic, offline Provider for tests and local
+// development. It never talks to the network: responses come from a
+// scripted queue first, then from the first fixture matching the request.
+type FakeClient struct {
+	mu             sync.Mutex
+	fixtures       []FakeFixture
+	script         []FakeResponse
+	latency        time.Duration
+	failEvery      int
+	repairAttempts int
+	calls          int
+	prompts        []string
+	usage          UsageRecorder
+	log            *logger.Logger
+}
+
+// NewFakeClient creates a FakeClient loaded with the built-in fixtures
+func NewFakeClient(log *logger.Logger) *FakeClient {
+	fixtures, err := ParseFakeFixtures(defaultFakeFixtures)
+	if err != nil {
+		// The embedded file is part of the build; a parse failure is a bug.
+		panic(fmt.Sprintf("invalid embedded fake fixtures: %v", err))
+	}
+	return &FakeClient{
+		fixtures:       fixtures,
+		repairAttempts: DefaultRepairAttempts,
+		log:            log,
+	}
+}
+
+// ParseFakeFixtures decodes a JSON array of fixtures
+func ParseFakeFixtures(data []byte) ([]FakeFixture, error) {
+	var fixtures []FakeFixture
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return nil, fmt.Errorf("parse fake fixtures: %w", err)
+	}
+	return fixtures, nil
+}
+
+// LoadFakeFixtures reads fixtures from a JSON file
+func LoadFakeFixtures(path string) ([]FakeFixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read fake fixtures: %w", err)
+	}
+	return ParseFakeFixtures(data)
+}
+
+// WithFixtures replaces the fixtures consulted for each call
+func (c *FakeClient) WithFixtures(fixtures []FakeFixture) *FakeClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fixtures = fixtures
+	return c
+}
+
+// WithLatency delays every call by d (honouring context cancellation)
+func (c *FakeClient) WithLatency(d time.Duration) *FakeClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.latency = d
+	return c
+}
+
+// WithFailEvery makes every nth call fail with ErrGenerationFail (0 disables)
+func (c *FakeClient) WithFailEvery(n int) *FakeClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failEvery = n
+	return c
+}
+
+// WithRepairAttempts sets how many times an invalid recipe response is
+// re-requested, as on the real providers
+func (c *FakeClient) WithRepairAttempts(n int) *FakeClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.repairAttempts = n
+	return c
+}
+
+// WithUsageRecorder reports every call to rec, with token counts estimated
+// from the prompt and response length
+func (c *FakeClient) WithUsageRecorder(rec UsageRecorder) *FakeClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.usage = rec
+	return c
+}
+
+// Enqueue scripts the next responses, consumed in order before fixtures
+func (c *FakeClient) Enqueue(responses ...FakeResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.script = append(c.script, responses...)
+}
+
+// Calls returns how many provider calls have been made
+func (c *FakeClient) Calls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+// Prompts returns every prompt received, in call order
+func (c *FakeClient) Prompts() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.prompts...)
+}
+
+// GenerateRecipes returns the canned recipes matching the request. Responses
+// go through the same validation and repair loop as the real providers.
+func (c *FakeClient) GenerateRecipes(ctx context.Context, req GenerateRecipesRequest) ([]Recipe, error) {
+	recipes, err := generateValidated(ctx, buildRecipePrompt(req), c.attempts(), c.recipesResponder(req), c.log)
+	if err != nil {
+		return nil, err
+	}
+	return limitRecipes(recipes, req.RecipeCount), nil
+}
+
+// GeneratePersonalRecipes returns the canned personal recipes matching the request
+func (c *FakeClient) GeneratePersonalRecipes(ctx context.Context, req GenerateRecipesRequest) ([]Recipe, error) {
+	recipes, err := generateValidated(ctx, buildPersonalRecipePrompt(req), c.attempts(), c.personalResponder(), c.log)
+	if err != nil {
+		return nil, err
+	}
+	return limitRecipes(recipes, req.RecipeCount), nil
+}
+
+// fakeStreamChunkSize is how many bytes of a canned response each simulated
+// stream chunk carries
+const fakeStreamChunkSize = 48
+
+// StreamRecipes replays the canned response through the streaming parser in
+// small chunks, so consumers see the same events a real stream would produce.
+func (c *FakeClient) StreamRecipes(ctx context.Context, req GenerateRecipesRequest, onEvent func(StreamEvent)) ([]Recipe, error) {
+	gen := c.recipesResponder(req)
+	recipes, err := streamValidated(ctx, buildRecipePrompt(req), c.attempts(), c.replayer(gen, req.RecipeCount), gen, c.log, limitEvents(onEvent, req.RecipeCount))
+	if err != nil {
+		return nil, err
+	}
+	return limitRecipes(recipes, req.RecipeCount), nil
+}
+
+// StreamPersonalRecipes replays the canned personal response in chunks
+func (c *FakeClient) StreamPersonalRecipes(ctx context.Context, req GenerateRecipesRequest, onEvent func(StreamEvent)) ([]Recipe, error) {
+	gen := c.personalResponder()
+	recipes, err := streamValidated(ctx, buildPersonalRecipePrompt(req), c.attempts(), c.replayer(gen, req.RecipeCount), gen, c.log, limitEvents(onEvent, req.RecipeCount))
+	if err != nil {
+		return nil, err
+	}
+	return limitRecipes(recipes, req.RecipeCount), nil
+}
+
+func (c *FakeClient) attempts() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.repairAttempts
+}
+
+// recipesResponder answers recipe prompts, matching fixtures on pantry mode
+func (c *FakeClient) recipesResponder(req GenerateRecipesRequest) func(context.Context, string) (string, error) {
+	pantryOnly := req.PantryOnly || req.MaxMissingItems == 0
+	return func(ctx context.Context, prompt string) (string, error) {
+		return c.respond(ctx, FakeKindRecipes, prompt, &pantryOnly)
+	}
+}
+
+// personalResponder answers personal recipe prompts
+func (c *FakeClient) personalResponder() func(context.Context, string) (string, error) {
+	return func(ctx context.Context, prompt string) (string, error) {
+		return c.respond(ctx, FakeKindPersonal, prompt, nil)
+	}
+}
+
+// replayer resolves a response with gen and chunks it through streamText
+func (c *FakeClient) replayer(gen func(context.Context, string) (string, error), count int) func(context.Context, string, func(StreamEvent)) ([]Recipe, error) {
+	return func(ctx context.Context, prompt string, onEvent func(StreamEvent)) ([]Recipe, error) {
+		text, err := gen(ctx, prompt)
+		if err != nil {
+			return nil, err
+		}
+
+		offset := 0
+		return streamText(func() (string, bool, error) {
+			if err := ctx.Err(); err != nil {
+				return "", false, fmt.Errorf("%w: %v", ErrGenerationFail, err)
+			}
+			if offset >= len(text) {
+				return "", true, nil
+			}
+			end := offset + fakeStreamChunkSize
+			if end > len(text) {
+				end = len(text)
+			}
+			chunk := text[offset:end]
+			offset = end
+			return chunk, false, nil
+		}, onEvent)
+	}
+}
+
+// limitEvents drops events for recipes past count, matching limitRecipes
+func limitEvents(onEvent func(StreamEvent), count int) func(StreamEvent) {
+	if onEvent == nil {
+		return nil
+	}
+	return func(ev StreamEvent) {
+		if count <= 0 || ev.RecipeIndex < count {
+			onEvent(ev)
+		}
+	}
+}
+
+// CategorizeFood answers from a matching fixture, or from a small keyword
+// table when no categorize fixture is configured.
+func (c *FakeClient) CategorizeFood(ctx context.Context, items []string) (map[string]CategorizedFood, error) {
+	text, err := c.respond(ctx, FakeKindCategorize, buildCategorizerPrompt(items), nil)
+	if err == nil {
+		return parseCategories(text)
+	}
+	if !isNoFixture(err) {
+		return nil, err
+	}
+
+	categories := make(map[string]CategorizedFood, len(items))
+	for _, item := range items {
+		categories[item] = fakeCategorize(item)
+	}
+	return categories, nil
+}
+
+// GenerateText returns the canned text matching the prompt
+func (c *FakeClient) GenerateText(ctx context.Context, prompt string) (string, error) {
+	return c.respond(ctx, FakeKindText, prompt, nil)
+}
+
+// errNoFakeFixture is returned when neither the script nor a fixture applies
+var errNoFakeFixture = fmt.Errorf("%w: no fake fixture matches request", ErrGenerationFail)
+
+func isNoFixture(err error) bool {
+	return errors.Is(err, errNoFakeFixture)
+}
+
+// respond applies latency and failure injection, then resolves the response
+func (c *FakeClient) respond(ctx context.Context, kind, prompt string, pantryOnly *bool) (text string, err error) {
+	start := time.Now()
+	c.mu.Lock()
+	rec := c.usage
+	c.calls++
+	call := c.calls
+	c.prompts = append(c.prompts, prompt)
+	latency := c.latency
+	failEvery := c.failEvery
+	var scripted *FakeResponse
+	if len(c.script) > 0 {
+		scripted = &c.script[0]
+		c.script = c.script[1:]
+	}
+	fixtures := c.fixtures
+	c.mu.Unlock()
+
+	defer func() {
+		if isNoFixture(err) {
+			return
+		}
+		recordUsage(ctx, rec, Usage{
+			Provider:        ProviderFake,
+			Model:           ProviderFake,
+			PromptTokens:    fakeTokenCount(prompt),
+			CandidateTokens: fakeTokenCount(text),
+		}, start, err)
+	}()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-ctx.Done():
+			return "", fmt.Errorf("%w: %v", ErrGenerationFail, ctx.Err())
+		}
+	}
+
+	if scripted != nil {
+		return scripted.Text, scripted.Err
+	}
+
+	if failEvery > 0 && call%failEvery == 0 {
+		return "", fmt.Errorf("%w: injected failure on call %d", ErrGenerationFail, call)
+	}
+
+	for _, f := range fixtures {
+		if f.Match.matches(kind, prompt, pantryOnly) {
+			if c.log != nil {
+				c.log.Debug("FakeClient: call %d (%s) answered by fixture %q", call, kind, f.Name)
+			}
+			return f.text(), nil
+		}
+	}
+
+	return "", errNoFakeFixture
+}
+
+// fakeTokenCount approximates a token count as one token per four bytes
+func fakeTokenCount(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// matches reports whether a request has all the features m asks for
+func (m FakeMatch) matches(kind, prompt string, pantryOnly *bool) bool {
+	if m.Kind != "" && m.Kind != kind {
+		return false
+	}
+	if m.PantryOnly != nil && (pantryOnly == nil || *m.PantryOnly != *pantryOnly) {
+		return false
+	}
+	lowerPrompt := strings.ToLower(prompt)
+	for _, want := range m.Contains {
+		if !strings.Contains(lowerPrompt, strings.ToLower(want)) {
+			return false
+		}
+	}
+	return true
+}
+
+// text returns the fixture response as model output text
+func (f FakeFixture) text() string {
+	var s string
+	if err := json.Unmarshal(f.Response, &s); err == nil {
+		return s
+	}
+	return string(f.Response)
+}
+
+// limitRecipes trims canned responses to the requested count
+func limitRecipes(recipes []Recipe, count int) []Recipe {
+	if count > 0 && len(recipes) > count {
+		return recipes[:count]
+	}
+	return recipes
+}
+
+// fakeCategoryKeywords drives CategorizeFood when no fixture is configured
+var fakeCategoryKeywords = []struct {
+	keywords  []string
+	category  string
+	shelfLife int
+}{
+	{[]string{"milk", "cheese", "yogurt", "butter", "cream", "egg"}, "DAIRY", 10},
+	{[]string{"chicken", "beef", "pork", "turkey", "lamb", "sausage"}, "MEAT", 3},
+	{[]string{"salmon", "tuna", "shrimp", "cod", "fish"}, "SEAFOOD", 2},
+	{[]string{"bread", "bagel", "muffin", "tortilla"}, "BAKERY", 5},
+	{[]string{"apple", "banana", "spinach", "tomato", "lettuce", "pepper", "onion", "potato", "berr"}, "PRODUCE", 7},
+	{[]string{"juice", "soda", "coffee", "tea", "water"}, "BEVERAGES", 180},
+	{[]string{"frozen", "ice cream"}, "FROZEN", 180},
+	{[]string{"chips", "cookie", "cracker", "candy", "chocolate"}, "SNACKS", 90},
+}
+
+func fakeCategorize(name string) CategorizedFood {
+	lower := strings.ToLower(name)
+	for _, entry := range fakeCategoryKeywords {
+		for _, kw := range entry.keywords {
+			if strings.Contains(lower, kw) {
+				return CategorizedFood{Category: entry.category, ShelfLife: entry.shelfLife}
+			}
+		}
+	}
+	return CategorizedFood{Category: "PANTRY", ShelfLife: 365}
+}
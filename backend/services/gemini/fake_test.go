@@ -0,0 +1,104 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+)
+
+func newTestFake() *FakeClient {
+	return NewFakeClient(logger.GetLogger("error"))
+}
+
+func TestFakeClientMatchesRecipeKind(t *testing.T) {
+	c := newTestFake()
+
+	pantry, err := c.GenerateRecipes(context.Background(), GenerateRecipesRequest{RecipeCount: 3, PantryOnly: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(pantry) != 3 {
+		t.Fatalf("expected 3 pantry-only recipes, got %d", len(pantry))
+	}
+	for _, r := range pantry {
+		if len(r.MissingItems) != 0 {
+			t.Fatalf("expected pantry-only recipe %q to have no missing items", r.Title)
+		}
+	}
+
+	flexible, err := c.GenerateRecipes(context.Background(), GenerateRecipesRequest{RecipeCount: 1, MaxMissingItems: 3})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(flexible) != 1 || len(flexible[0].MissingItems) == 0 {
+		t.Fatalf("expected 1 flexible recipe with missing items, got %+v", flexible)
+	}
+}
+
+func TestFakeClientContainsMatch(t *testing.T) {
+	c := newTestFake()
+
+	recipes, err := c.GenerateRecipes(context.Background(), GenerateRecipesRequest{
+		RecipeCount: 2,
+		PantryOnly:  true,
+		UserPrompt:  "You are a professional chef specializing in REDUCING FOOD WASTE.",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(recipes) == 0 || recipes[0].Title != "Use-It-Up Vegetable Frittata" {
+		t.Fatalf("expected spoiling fixture, got %+v", recipes)
+	}
+}
+
+func TestFakeClientFailEveryAndScript(t *testing.T) {
+	c := newTestFake().WithFailEvery(2)
+	req := GenerateRecipesRequest{RecipeCount: 1, PantryOnly: true}
+
+	if _, err := c.GenerateRecipes(context.Background(), req); err != nil {
+		t.Fatalf("expected first call to succeed, got %v", err)
+	}
+	if _, err := c.GenerateRecipes(context.Background(), req); !errors.Is(err, ErrGenerationFail) {
+		t.Fatalf("expected injected failure on second call, got %v", err)
+	}
+
+	c.Enqueue(FakeResponse{Text: `[{"title":"Scripted","ingredients":[{"name":"egg"}],"instructions":["Cook."]}]`})
+	recipes, err := c.GenerateRecipes(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected scripted response, got %v", err)
+	}
+	if len(recipes) != 1 || recipes[0].Title != "Scripted" {
+		t.Fatalf("expected scripted recipe, got %+v", recipes)
+	}
+	if c.Calls() != 3 {
+		t.Fatalf("expected 3 calls, got %d", c.Calls())
+	}
+}
+
+func TestFakeClientLatencyHonoursContext(t *testing.T) {
+	c := newTestFake().WithLatency(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.GenerateText(ctx, "hello"); !errors.Is(err, ErrGenerationFail) {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+}
+
+func TestFakeClientCategorizeFallback(t *testing.T) {
+	c := newTestFake()
+
+	categories, err := c.CategorizeFood(context.Background(), []string{"Whole Milk", "Rolled Oats"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if categories["Whole Milk"].Category != "DAIRY" {
+		t.Fatalf("expected DAIRY, got %q", categories["Whole Milk"].Category)
+	}
+	if categories["Rolled Oats"].Category != "PANTRY" {
+		t.Fatalf("expected PANTRY, got %q", categories["Rolled Oats"].Category)
+	}
+}
@@ -5,9 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Jayyk09/CUHackIt/pkg/logger"
 	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
@@ -19,9 +23,13 @@ var (
 
 // Client is a wrapper around the Gemini API client
 type Client struct {
-	client *genai.Client
-	model  *genai.GenerativeModel
-	log    *logger.Logger
+	client         *genai.Client
+	model          *genai.GenerativeModel
+	modelName      string
+	repairAttempts int
+	guard          *Guard
+	usage          UsageRecorder
+	log            *logger.Logger
 }
 
 // Recipe represents a generated recipe
@@ -53,37 +61,61 @@ type Ingredient struct {
 	FromPantry bool   `json:"from_pantry"`
 }
 
-// UnmarshalJSON handles Amount being either a JSON string or number.
+// UnmarshalJSON handles Amount being either a JSON string or number and
+// from_pantry being a boolean or "true"/"false". Any other type mismatch is
+// returned as an error naming the field.
 func (ing *Ingredient) UnmarshalJSON(data []byte) error {
 	// Parse into a raw map to avoid any struct field type conflicts.
 	var raw map[string]json.RawMessage
 	if err := json.Unmarshal(data, &raw); err != nil {
-		return err
+		return fmt.Errorf("ingredient: %w", err)
 	}
-	if v, ok := raw["name"]; ok {
-		_ = json.Unmarshal(v, &ing.Name)
+	if err := decodeOptionalString(raw["name"], &ing.Name); err != nil {
+		return fmt.Errorf("ingredient name: %w", err)
 	}
-	if v, ok := raw["unit"]; ok {
-		_ = json.Unmarshal(v, &ing.Unit)
+	if err := decodeOptionalString(raw["unit"], &ing.Unit); err != nil {
+		return fmt.Errorf("ingredient %q unit: %w", ing.Name, err)
 	}
-	if v, ok := raw["from_pantry"]; ok {
-		_ = json.Unmarshal(v, &ing.FromPantry)
+	if v, ok := raw["from_pantry"]; ok && string(v) != "null" {
+		if err := json.Unmarshal(v, &ing.FromPantry); err != nil {
+			var s string
+			if json.Unmarshal(v, &s) != nil {
+				return fmt.Errorf("ingredient %q from_pantry: expected a boolean, got %s", ing.Name, v)
+			}
+			b, err := strconv.ParseBool(strings.TrimSpace(s))
+			if err != nil {
+				return fmt.Errorf("ingredient %q from_pantry: expected a boolean, got %q", ing.Name, s)
+			}
+			ing.FromPantry = b
+		}
 	}
-	if v, ok := raw["amount"]; ok {
+	if v, ok := raw["amount"]; ok && string(v) != "null" {
 		// Try string first, fall back to number
 		var s string
 		if err := json.Unmarshal(v, &s); err == nil {
 			ing.Amount = s
 		} else {
 			var n json.Number
-			if err := json.Unmarshal(v, &n); err == nil {
-				ing.Amount = n.String()
+			if err := json.Unmarshal(v, &n); err != nil {
+				return fmt.Errorf("ingredient %q amount: expected a string or number, got %s", ing.Name, v)
 			}
+			ing.Amount = n.String()
 		}
 	}
 	return nil
 }
 
+// decodeOptionalString decodes a JSON string into dst; absent or null leaves dst untouched
+func decodeOptionalString(v json.RawMessage, dst *string) error {
+	if len(v) == 0 || string(v) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(v, dst); err != nil {
+		return fmt.Errorf("expected a string, got %s", v)
+	}
+	return nil
+}
+
 // PantryItem represents an item in the user's pantry for recipe generation
 type PantryItem struct {
 	Name            string  `json:"name"`
@@ -101,6 +133,7 @@ type UserPreferences struct {
 	NutritionalGoals   []string `json:"nutritional_goals,omitempty"`
 	CookingSkill       string   `json:"cooking_skill,omitempty"`
 	CuisinePreferences []string `json:"cuisine_preferences,omitempty"`
+	AvoidIngredients   []string `json:"avoid_ingredients,omitempty"` // flagged as allergens in earlier attempts
 }
 
 // GenerateRecipesRequest is the input for recipe generation
@@ -137,12 +170,34 @@ func NewClient(ctx context.Context, apiKey string, modelName string, log *logger
 	model.ResponseMIMEType = "application/json"
 
 	return &Client{
-		client: client,
-		model:  model,
-		log:    log,
+		client:         client,
+		model:          model,
+		modelName:      modelName,
+		repairAttempts: DefaultRepairAttempts,
+		log:            log,
 	}, nil
 }
 
+// WithRepairAttempts sets how many times an invalid recipe response is sent
+// back to the model for correction (0 disables re-prompting)
+func (c *Client) WithRepairAttempts(n int) *Client {
+	c.repairAttempts = n
+	return c
+}
+
+// WithGuard routes every model call through g for retries, timeouts and
+// circuit breaking
+func (c *Client) WithGuard(g *Guard) *Client {
+	c.guard = g
+	return c
+}
+
+// WithUsageRecorder reports token counts and latency of every model call to rec
+func (c *Client) WithUsageRecorder(rec UsageRecorder) *Client {
+	c.usage = rec
+	return c
+}
+
 // Close closes the Gemini client
 func (c *Client) Close() error {
 	return c.client.Close()
@@ -154,36 +209,162 @@ func (c *Client) GenerateRecipes(ctx context.Context, req GenerateRecipesRequest
 
 	c.log.Debug("Generating recipes with prompt length: %d", len(prompt))
 
-	resp, err := c.model.GenerateContent(ctx, genai.Text(prompt))
+	recipes, err := generateValidated(ctx, prompt, c.repairAttempts, c.generate, c.log)
 	if err != nil {
 		c.log.Error("Gemini generation error: %v", err)
-		return nil, fmt.Errorf("%w: %v", ErrGenerationFail, err)
+		return nil, err
 	}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return nil, ErrInvalidResponse
+	return recipes, nil
+}
+
+// generate sends a single prompt to the model and returns the text of the
+// first candidate.
+func (c *Client) generate(ctx context.Context, prompt string) (string, error) {
+	var text string
+	err := c.guard.Do(ctx, func(ctx context.Context) error {
+		var err error
+		text, err = c.generateOnce(ctx, prompt)
+		return err
+	})
+	return text, err
+}
+
+// generateOnce makes one GenerateContent call
+func (c *Client) generateOnce(ctx context.Context, prompt string) (text string, err error) {
+	start := time.Now()
+	var resp *genai.GenerateContentResponse
+	defer func() {
+		c.recordUsage(ctx, resp, false, start, err)
+	}()
+
+	resp, err = c.model.GenerateContent(ctx, genai.Text(prompt))
+	if err != nil {
+		return "", generationError(err)
+	}
+
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return "", ErrInvalidResponse
 	}
 
 	// Extract text from response
-	text, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
+	part, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
 	if !ok {
-		return nil, ErrInvalidResponse
+		return "", ErrInvalidResponse
 	}
 
-	// Parse JSON response
-	var result struct {
-		Recipes []Recipe `json:"recipes"`
+	return string(part), nil
+}
+
+// recordUsage reports the usage metadata of resp, the final chunk of a
+// stream or nil if the call failed
+func (c *Client) recordUsage(ctx context.Context, resp *genai.GenerateContentResponse, streamed bool, start time.Time, err error) {
+	usage := Usage{Provider: ProviderGemini, Model: c.modelName, Streamed: streamed}
+	if resp != nil && resp.UsageMetadata != nil {
+		usage.PromptTokens = int(resp.UsageMetadata.PromptTokenCount)
+		usage.CandidateTokens = int(resp.UsageMetadata.CandidatesTokenCount)
+		usage.TotalTokens = int(resp.UsageMetadata.TotalTokenCount)
 	}
-	if err := json.Unmarshal([]byte(text), &result); err != nil {
-		// Try parsing as array directly
+	recordUsage(ctx, c.usage, usage, start, err)
+}
+
+// StreamRecipes is GenerateRecipes using streaming generation. onEvent is
+// called as each instruction step and recipe is produced by the model.
+func (c *Client) StreamRecipes(ctx context.Context, req GenerateRecipesRequest, onEvent func(StreamEvent)) ([]Recipe, error) {
+	prompt := buildRecipePrompt(req)
+
+	c.log.Debug("Streaming recipes with prompt length: %d", len(prompt))
+
+	recipes, err := streamValidated(ctx, prompt, c.repairAttempts, c.stream, c.generate, c.log, onEvent)
+	if err != nil {
+		c.log.Error("Gemini streaming error: %v", err)
+		return nil, err
+	}
+	return recipes, nil
+}
+
+// StreamPersonalRecipes is GeneratePersonalRecipes using streaming generation
+func (c *Client) StreamPersonalRecipes(ctx context.Context, req GenerateRecipesRequest, onEvent func(StreamEvent)) ([]Recipe, error) {
+	prompt := buildPersonalRecipePrompt(req)
+
+	c.log.Debug("Streaming personal recipes with prompt length: %d", len(prompt))
+
+	recipes, err := streamValidated(ctx, prompt, c.repairAttempts, c.stream, c.generate, c.log, onEvent)
+	if err != nil {
+		c.log.Error("Gemini personal streaming error: %v", err)
+		return nil, err
+	}
+	return recipes, nil
+}
+
+// stream runs GenerateContentStream and feeds each chunk to a RecipeStreamParser.
+// A failed stream is only retried if it had not produced any events yet.
+func (c *Client) stream(ctx context.Context, prompt string, onEvent func(StreamEvent)) ([]Recipe, error) {
+	var recipes []Recipe
+	err := c.guard.DoStream(ctx, func(ctx context.Context) error {
+		var err error
+		recipes, err = guardedStream(ctx, prompt, c.streamOnce, onEvent)
+		return err
+	})
+	return recipes, err
+}
+
+// streamOnce makes one GenerateContentStream call
+func (c *Client) streamOnce(ctx context.Context, prompt string, onEvent func(StreamEvent)) (recipes []Recipe, err error) {
+	start := time.Now()
+	var last *genai.GenerateContentResponse // usage metadata is cumulative
+	defer func() {
+		c.recordUsage(ctx, last, true, start, err)
+	}()
+
+	iter := c.model.GenerateContentStream(ctx, genai.Text(prompt))
+
+	return streamText(func() (string, bool, error) {
+		resp, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			return "", true, nil
+		}
+		if err != nil {
+			return "", false, generationError(err)
+		}
+		if resp.UsageMetadata != nil {
+			last = resp
+		}
+
+		var chunk string
+		for _, cand := range resp.Candidates {
+			if cand.Content == nil {
+				continue
+			}
+			for _, part := range cand.Content.Parts {
+				if text, ok := part.(genai.Text); ok {
+					chunk += string(text)
+				}
+			}
+			break // only the first candidate is used
+		}
+		return chunk, false, nil
+	}, onEvent)
+}
+
+// parseRecipes decodes a model response that is either {"recipes": [...]}
+// or a bare array of recipes. It does not repair or validate; see DecodeRecipes.
+func parseRecipes(text string) ([]Recipe, error) {
+	if strings.HasPrefix(strings.TrimSpace(text), "[") {
 		var recipes []Recipe
-		if err2 := json.Unmarshal([]byte(text), &recipes); err2 != nil {
-			c.log.Error("Failed to parse recipes JSON: %v", err)
+		if err := json.Unmarshal([]byte(text), &recipes); err != nil {
 			return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
 		}
 		return recipes, nil
 	}
 
+	var result struct {
+		Recipes []Recipe `json:"recipes"`
+	}
+	if err := json.Unmarshal([]byte(text), &result); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
 	return result.Recipes, nil
 }
 
@@ -195,29 +376,28 @@ type CategorizedFood struct {
 
 // CategorizeFood categorizes food items using AI
 func (c *Client) CategorizeFood(ctx context.Context, items []string) (map[string]CategorizedFood, error) {
-	input, _ := json.Marshal(items)
-	prompt := CategorizerPrompt + "\n\n" + string(input)
-
-	resp, err := c.model.GenerateContent(ctx, genai.Text(prompt))
+	text, err := c.generate(ctx, buildCategorizerPrompt(items))
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrGenerationFail, err)
+		return nil, err
 	}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return nil, ErrInvalidResponse
-	}
+	return parseCategories(text)
+}
 
-	text, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
-	if !ok {
-		return nil, ErrInvalidResponse
-	}
+// buildCategorizerPrompt appends the JSON-encoded food names to CategorizerPrompt
+func buildCategorizerPrompt(items []string) string {
+	input, _ := json.Marshal(items)
+	return CategorizerPrompt + "\n\n" + string(input)
+}
 
+// parseCategories decodes the categorizer response into a map keyed by food name
+func parseCategories(text string) (map[string]CategorizedFood, error) {
 	var result []struct {
 		FoodName  string `json:"food_name"`
 		Category  string `json:"category"`
 		ShelfLife int    `json:"shelf_life"`
 	}
-	if err := json.Unmarshal([]byte(text), &result); err != nil {
+	if err := json.Unmarshal([]byte(RepairJSON(text)), &result); err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
 	}
 
@@ -316,34 +496,13 @@ func (c *Client) GeneratePersonalRecipes(ctx context.Context, req GenerateRecipe
 
 	c.log.Debug("Generating personal recipes with prompt length: %d", len(prompt))
 
-	resp, err := c.model.GenerateContent(ctx, genai.Text(prompt))
+	recipes, err := generateValidated(ctx, prompt, c.repairAttempts, c.generate, c.log)
 	if err != nil {
 		c.log.Error("Gemini personal generation error: %v", err)
-		return nil, fmt.Errorf("%w: %v", ErrGenerationFail, err)
+		return nil, err
 	}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return nil, ErrInvalidResponse
-	}
-
-	text, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
-	if !ok {
-		return nil, ErrInvalidResponse
-	}
-
-	var result struct {
-		Recipes []Recipe `json:"recipes"`
-	}
-	if err := json.Unmarshal([]byte(text), &result); err != nil {
-		var recipes []Recipe
-		if err2 := json.Unmarshal([]byte(text), &recipes); err2 != nil {
-			c.log.Error("Failed to parse personal recipes JSON: %v", err)
-			return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
-		}
-		return recipes, nil
-	}
-
-	return result.Recipes, nil
+	return recipes, nil
 }
 
 // buildPersonalRecipePrompt constructs a profile-first prompt with allergens as hard blocks.
@@ -418,19 +577,5 @@ Generate recipes now:`,
 
 // GenerateText is a general-purpose text generation method
 func (c *Client) GenerateText(ctx context.Context, prompt string) (string, error) {
-	resp, err := c.model.GenerateContent(ctx, genai.Text(prompt))
-	if err != nil {
-		return "", fmt.Errorf("%w: %v", ErrGenerationFail, err)
-	}
-
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return "", ErrInvalidResponse
-	}
-
-	text, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
-	if !ok {
-		return "", ErrInvalidResponse
-	}
-
-	return string(text), nil
+	return c.generate(ctx, prompt)
 }
@@ -0,0 +1,367 @@
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+)
+
+// ErrNoBaseURL is returned when the OpenAI-compatible endpoint is not configured
+var ErrNoBaseURL = errors.New("openai-compatible base URL not configured")
+
+// OpenAIClient talks to any server that implements the OpenAI chat
+// completions API (OpenAI itself, Ollama, vLLM, LM Studio, llama.cpp, ...).
+type OpenAIClient struct {
+	httpClient     *http.Client
+	baseURL        string
+	apiKey         string
+	model          string
+	repairAttempts int
+	guard          *Guard
+	usage          UsageRecorder
+	log            *logger.Logger
+}
+
+// NewOpenAIClient creates a new OpenAI-compatible client. apiKey may be empty
+// for local model servers that do not require authentication.
+func NewOpenAIClient(baseURL, apiKey, modelName string, log *logger.Logger) (*OpenAIClient, error) {
+	if baseURL == "" {
+		return nil, ErrNoBaseURL
+	}
+	if modelName == "" {
+		modelName = "gpt-4o-mini"
+	}
+
+	return &OpenAIClient{
+		httpClient:     &http.Client{Timeout: 120 * time.Second},
+		baseURL:        strings.TrimRight(baseURL, "/"),
+		apiKey:         apiKey,
+		model:          modelName,
+		repairAttempts: DefaultRepairAttempts,
+		log:            log,
+	}, nil
+}
+
+// WithRepairAttempts sets how many times an invalid recipe response is sent
+// back to the model for correction (0 disables re-prompting)
+func (c *OpenAIClient) WithRepairAttempts(n int) *OpenAIClient {
+	c.repairAttempts = n
+	return c
+}
+
+// WithGuard routes every request through g for retries, timeouts and
+// circuit breaking
+func (c *OpenAIClient) WithGuard(g *Guard) *OpenAIClient {
+	c.guard = g
+	return c
+}
+
+// WithUsageRecorder reports token counts and latency of every request to rec
+func (c *OpenAIClient) WithUsageRecorder(rec UsageRecorder) *OpenAIClient {
+	c.usage = rec
+	return c
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatResponseFormat struct {
+	Type string `json:"type"`
+}
+
+type chatCompletionRequest struct {
+	Model          string              `json:"model"`
+	Messages       []chatMessage       `json:"messages"`
+	Temperature    float64             `json:"temperature"`
+	TopP           float64             `json:"top_p"`
+	ResponseFormat *chatResponseFormat `json:"response_format,omitempty"`
+	Stream         bool                `json:"stream,omitempty"`
+	StreamOptions  *chatStreamOptions  `json:"stream_options,omitempty"`
+}
+
+// chatStreamOptions asks for a final chunk carrying token usage
+type chatStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type chatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type chatCompletionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Usage *chatUsage `json:"usage"`
+}
+
+// chatCompletionChunk is one server-sent event of a streamed completion
+type chatCompletionChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta chatMessage `json:"delta"`
+	} `json:"choices"`
+	Usage *chatUsage `json:"usage"`
+}
+
+// GenerateRecipes generates recipes based on pantry items and preferences
+func (c *OpenAIClient) GenerateRecipes(ctx context.Context, req GenerateRecipesRequest) ([]Recipe, error) {
+	prompt := buildRecipePrompt(req)
+
+	c.log.Debug("Generating recipes with prompt length: %d", len(prompt))
+
+	recipes, err := generateValidated(ctx, prompt, c.repairAttempts, c.completeJSON, c.log)
+	if err != nil {
+		c.log.Error("OpenAI-compatible generation error: %v", err)
+		return nil, err
+	}
+
+	return recipes, nil
+}
+
+// GeneratePersonalRecipes generates recipes purely from the user's profile
+func (c *OpenAIClient) GeneratePersonalRecipes(ctx context.Context, req GenerateRecipesRequest) ([]Recipe, error) {
+	prompt := buildPersonalRecipePrompt(req)
+
+	c.log.Debug("Generating personal recipes with prompt length: %d", len(prompt))
+
+	recipes, err := generateValidated(ctx, prompt, c.repairAttempts, c.completeJSON, c.log)
+	if err != nil {
+		c.log.Error("OpenAI-compatible personal generation error: %v", err)
+		return nil, err
+	}
+
+	return recipes, nil
+}
+
+// CategorizeFood categorizes food items using AI
+func (c *OpenAIClient) CategorizeFood(ctx context.Context, items []string) (map[string]CategorizedFood, error) {
+	// The categorizer answers with a bare array, which JSON mode rejects.
+	text, err := c.complete(ctx, buildCategorizerPrompt(items), false)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseCategories(text)
+}
+
+// GenerateText is a general-purpose text generation method
+func (c *OpenAIClient) GenerateText(ctx context.Context, prompt string) (string, error) {
+	return c.complete(ctx, prompt, false)
+}
+
+// StreamRecipes is GenerateRecipes using a streamed chat completion
+func (c *OpenAIClient) StreamRecipes(ctx context.Context, req GenerateRecipesRequest, onEvent func(StreamEvent)) ([]Recipe, error) {
+	recipes, err := streamValidated(ctx, buildRecipePrompt(req), c.repairAttempts, c.stream, c.completeJSON, c.log, onEvent)
+	if err != nil {
+		c.log.Error("OpenAI-compatible streaming error: %v", err)
+		return nil, err
+	}
+	return recipes, nil
+}
+
+// StreamPersonalRecipes is GeneratePersonalRecipes using a streamed chat completion
+func (c *OpenAIClient) StreamPersonalRecipes(ctx context.Context, req GenerateRecipesRequest, onEvent func(StreamEvent)) ([]Recipe, error) {
+	recipes, err := streamValidated(ctx, buildPersonalRecipePrompt(req), c.repairAttempts, c.stream, c.completeJSON, c.log, onEvent)
+	if err != nil {
+		c.log.Error("OpenAI-compatible personal streaming error: %v", err)
+		return nil, err
+	}
+	return recipes, nil
+}
+
+// complete sends a single-message chat completion and returns the content of
+// the first choice. jsonMode asks the server for a JSON object response.
+func (c *OpenAIClient) complete(ctx context.Context, prompt string, jsonMode bool) (string, error) {
+	var text string
+	err := c.guard.Do(ctx, func(ctx context.Context) error {
+		var err error
+		text, err = c.completeOnce(ctx, prompt, jsonMode)
+		return err
+	})
+	return text, err
+}
+
+// completeOnce makes one chat completion request
+func (c *OpenAIClient) completeOnce(ctx context.Context, prompt string, jsonMode bool) (text string, err error) {
+	start := time.Now()
+	var result chatCompletionResponse
+	defer func() {
+		c.recordUsage(ctx, result.Model, result.Usage, false, start, err)
+	}()
+
+	resp, err := c.do(ctx, prompt, jsonMode, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return "", generationError(err)
+	}
+
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if len(result.Choices) == 0 || result.Choices[0].Message.Content == "" {
+		return "", ErrInvalidResponse
+	}
+
+	return result.Choices[0].Message.Content, nil
+}
+
+// completeJSON is complete in JSON mode
+func (c *OpenAIClient) completeJSON(ctx context.Context, prompt string) (string, error) {
+	return c.complete(ctx, prompt, true)
+}
+
+// stream sends a streamed JSON-mode completion and feeds each content delta
+// to a RecipeStreamParser. A failed stream is only retried if it had not
+// produced any events yet.
+func (c *OpenAIClient) stream(ctx context.Context, prompt string, onEvent func(StreamEvent)) ([]Recipe, error) {
+	var recipes []Recipe
+	err := c.guard.DoStream(ctx, func(ctx context.Context) error {
+		var err error
+		recipes, err = guardedStream(ctx, prompt, c.streamOnce, onEvent)
+		return err
+	})
+	return recipes, err
+}
+
+// streamOnce makes one streamed chat completion request
+func (c *OpenAIClient) streamOnce(ctx context.Context, prompt string, onEvent func(StreamEvent)) (recipes []Recipe, err error) {
+	start := time.Now()
+	var model string
+	var usage *chatUsage
+	defer func() {
+		c.recordUsage(ctx, model, usage, true, start, err)
+	}()
+
+	resp, err := c.do(ctx, prompt, true, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	return streamText(func() (string, bool, error) {
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			data, ok := strings.CutPrefix(line, "data:")
+			if !ok {
+				continue
+			}
+			data = strings.TrimSpace(data)
+			if data == "[DONE]" {
+				return "", true, nil
+			}
+
+			var chunk chatCompletionChunk
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return "", false, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+			}
+			if chunk.Model != "" {
+				model = chunk.Model
+			}
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+			}
+			if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+				return chunk.Choices[0].Delta.Content, false, nil
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return "", false, generationError(err)
+		}
+		return "", true, nil
+	}, onEvent)
+}
+
+// do posts a chat completion request and returns the response once a 2xx
+// status has been received. The caller must close the body.
+func (c *OpenAIClient) do(ctx context.Context, prompt string, jsonMode, stream bool) (*http.Response, error) {
+	body := chatCompletionRequest{
+		Model:       c.model,
+		Messages:    []chatMessage{{Role: "user", Content: prompt}},
+		Temperature: 0.7,
+		TopP:        0.95,
+		Stream:      stream,
+	}
+	if stream {
+		body.StreamOptions = &chatStreamOptions{IncludeUsage: true}
+	}
+	if jsonMode {
+		body.ResponseFormat = &chatResponseFormat{Type: "json_object"}
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, generationError(err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := fmt.Errorf("%w: status %d: %s", ErrGenerationFail, resp.StatusCode, truncate(string(respBody), 200))
+		if transientStatus(resp.StatusCode) {
+			return nil, &transientError{err: err}
+		}
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// recordUsage reports one request. model is the name the server answered
+// with, falling back to the configured one.
+func (c *OpenAIClient) recordUsage(ctx context.Context, model string, usage *chatUsage, streamed bool, start time.Time, err error) {
+	if model == "" {
+		model = c.model
+	}
+	u := Usage{Provider: ProviderOpenAI, Model: model, Streamed: streamed}
+	if usage != nil {
+		u.PromptTokens = usage.PromptTokens
+		u.CandidateTokens = usage.CompletionTokens
+		u.TotalTokens = usage.TotalTokens
+	}
+	recordUsage(ctx, c.usage, u, start, err)
+}
+
+// truncate shortens s to at most n bytes for log and error messages
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,84 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Jayyk09/CUHackIt/config"
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+)
+
+// Supported values for LLM_PROVIDER
+const (
+	ProviderGemini = "gemini"
+	ProviderOpenAI = "openai"
+	ProviderFake   = "fake"
+)
+
+// Provider is the model backend used by the recipe agents and the food
+// enrichment handler. Client (Gemini), OpenAIClient and FakeClient implement it.
+type Provider interface {
+	// GenerateRecipes generates recipes based on pantry items and preferences
+	GenerateRecipes(ctx context.Context, req GenerateRecipesRequest) ([]Recipe, error)
+
+	// GeneratePersonalRecipes generates recipes from the user's profile only
+	GeneratePersonalRecipes(ctx context.Context, req GenerateRecipesRequest) ([]Recipe, error)
+
+	// CategorizeFood returns a category and shelf life for each food name
+	CategorizeFood(ctx context.Context, items []string) (map[string]CategorizedFood, error)
+
+	// GenerateText is a general-purpose text generation method
+	GenerateText(ctx context.Context, prompt string) (string, error)
+}
+
+var (
+	_ Provider = (*Client)(nil)
+	_ Provider = (*OpenAIClient)(nil)
+	_ Provider = (*FakeClient)(nil)
+)
+
+// NewProvider creates the provider selected by cfg.LLM.Provider. Real
+// backends get a Guard configured from cfg.LLM; the fake does not. Every
+// model call is reported to usage, which may be nil.
+func NewProvider(ctx context.Context, cfg *config.Config, usage UsageRecorder, log *logger.Logger) (Provider, error) {
+	guard := NewGuard(GuardConfig{
+		MaxRetries:       cfg.LLM.MaxRetries,
+		RetryBaseDelay:   cfg.LLM.RetryBaseDelay,
+		RetryMaxDelay:    cfg.LLM.RetryMaxDelay,
+		CallTimeout:      cfg.LLM.CallTimeout,
+		StreamTimeout:    cfg.LLM.StreamTimeout,
+		BreakerThreshold: cfg.LLM.BreakerThreshold,
+		BreakerCooldown:  cfg.LLM.BreakerCooldown,
+	}, log)
+
+	switch cfg.LLM.Provider {
+	case "", ProviderGemini:
+		client, err := NewClient(ctx, cfg.Gemini.APIKey, cfg.Gemini.Model, log)
+		if err != nil {
+			return nil, err
+		}
+		return client.WithRepairAttempts(cfg.LLM.RepairAttempts).WithGuard(guard).WithUsageRecorder(usage), nil
+	case ProviderOpenAI:
+		client, err := NewOpenAIClient(cfg.OpenAI.BaseURL, cfg.OpenAI.APIKey, cfg.OpenAI.Model, log)
+		if err != nil {
+			return nil, err
+		}
+		return client.WithRepairAttempts(cfg.LLM.RepairAttempts).WithGuard(guard).WithUsageRecorder(usage), nil
+	case ProviderFake:
+		client := NewFakeClient(log).
+			WithLatency(cfg.Fake.Latency).
+			WithFailEvery(cfg.Fake.FailEvery).
+			WithRepairAttempts(cfg.LLM.RepairAttempts).
+			WithUsageRecorder(usage)
+		if cfg.Fake.FixturesPath != "" {
+			fixtures, err := LoadFakeFixtures(cfg.Fake.FixturesPath)
+			if err != nil {
+				return nil, err
+			}
+			client.WithFixtures(fixtures)
+		}
+		return client, nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", cfg.LLM.Provider)
+	}
+}
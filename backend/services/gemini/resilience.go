@@ -0,0 +1,354 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrCircuitOpen is returned without calling the model while the circuit
+// breaker is open. Use errors.As with *CircuitOpenError for the retry delay.
+var ErrCircuitOpen = errors.New("LLM provider temporarily unavailable")
+
+// CircuitOpenError reports how long until the breaker lets a call through
+type CircuitOpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v: retry after %s", ErrCircuitOpen, e.RetryAfter.Round(time.Second))
+}
+
+// Is makes errors.Is(err, ErrCircuitOpen) true
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// RetriesExhaustedError is returned when a call still failed transiently
+// after every retry. It unwraps to the last failure.
+type RetriesExhaustedError struct {
+	Attempts   int
+	RetryAfter time.Duration // the breaker cooldown if the failures opened it
+	Err        error
+}
+
+func (e *RetriesExhaustedError) Error() string {
+	return fmt.Sprintf("LLM provider still failing after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *RetriesExhaustedError) Unwrap() error { return e.Err }
+
+// RetryAfter returns the delay carried by a *CircuitOpenError or
+// *RetriesExhaustedError in err, if any
+func RetryAfter(err error) (time.Duration, bool) {
+	var open *CircuitOpenError
+	if errors.As(err, &open) {
+		return open.RetryAfter, true
+	}
+	var exhausted *RetriesExhaustedError
+	if errors.As(err, &exhausted) {
+		return exhausted.RetryAfter, true
+	}
+	return 0, false
+}
+
+// transientError marks a failure worth retrying: rate limits, server errors,
+// timeouts and network errors
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+// isTransient reports whether err was marked as retryable
+func isTransient(err error) bool {
+	var t *transientError
+	return errors.As(err, &t)
+}
+
+// generationError wraps a provider failure in ErrGenerationFail, marking it
+// transient when cause is a rate limit, server error, timeout or network error
+func generationError(cause error) error {
+	err := fmt.Errorf("%w: %v", ErrGenerationFail, cause)
+	if causeIsTransient(cause) {
+		return &transientError{err: err}
+	}
+	return err
+}
+
+// causeIsTransient classifies errors from the Gemini SDK and net/http
+func causeIsTransient(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return transientStatus(apiErr.Code)
+	}
+	if s, ok := status.FromError(err); ok && s.Code() != codes.Unknown {
+		switch s.Code() {
+		case codes.ResourceExhausted, codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Aborted:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// guardedStream runs one streaming attempt, making its failure permanent once
+// events have been forwarded: a retry would replay them.
+func guardedStream(ctx context.Context, prompt string,
+	stream func(ctx context.Context, prompt string, onEvent func(StreamEvent)) ([]Recipe, error),
+	onEvent func(StreamEvent)) ([]Recipe, error) {
+
+	emitted := false
+	recipes, err := stream(ctx, prompt, func(ev StreamEvent) {
+		emitted = true
+		if onEvent != nil {
+			onEvent(ev)
+		}
+	})
+	var t *transientError
+	if err != nil && emitted && errors.As(err, &t) {
+		return nil, fmt.Errorf("%w: stream interrupted: %v", ErrGenerationFail, t.err)
+	}
+	return recipes, err
+}
+
+// transientStatus reports whether an HTTP status is worth retrying
+func transientStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+}
+
+// Defaults for GuardConfig fields left at zero
+const (
+	DefaultRetryBaseDelay   = 500 * time.Millisecond
+	DefaultRetryMaxDelay    = 5 * time.Second
+	DefaultCallTimeout      = 60 * time.Second
+	DefaultStreamTimeout    = 90 * time.Second
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// GuardConfig configures retries, timeouts and the circuit breaker
+type GuardConfig struct {
+	MaxRetries       int           // retries after the first attempt; 0 disables
+	RetryBaseDelay   time.Duration // backoff before the first retry, doubled each time
+	RetryMaxDelay    time.Duration // backoff cap
+	CallTimeout      time.Duration // per attempt
+	StreamTimeout    time.Duration // per streaming attempt, which covers the whole response
+	BreakerThreshold int           // consecutive failed calls that open the breaker
+	BreakerCooldown  time.Duration // how long the breaker stays open
+}
+
+// withDefaults fills zero fields other than MaxRetries with the package defaults
+func (c GuardConfig) withDefaults() GuardConfig {
+	if c.MaxRetries < 0 {
+		c.MaxRetries = 0
+	}
+	if c.RetryBaseDelay <= 0 {
+		c.RetryBaseDelay = DefaultRetryBaseDelay
+	}
+	if c.RetryMaxDelay <= 0 {
+		c.RetryMaxDelay = DefaultRetryMaxDelay
+	}
+	if c.CallTimeout <= 0 {
+		c.CallTimeout = DefaultCallTimeout
+	}
+	if c.StreamTimeout <= 0 {
+		c.StreamTimeout = DefaultStreamTimeout
+	}
+	if c.BreakerThreshold <= 0 {
+		c.BreakerThreshold = DefaultBreakerThreshold
+	}
+	if c.BreakerCooldown <= 0 {
+		c.BreakerCooldown = DefaultBreakerCooldown
+	}
+	return c
+}
+
+// Guard wraps model calls with per-attempt timeouts, jittered exponential
+// backoff for transient errors, and a circuit breaker shared by all calls
+// made through it. It is safe for concurrent use.
+type Guard struct {
+	cfg GuardConfig
+	log *logger.Logger
+
+	mu       sync.Mutex
+	failures int       // consecutive failed calls
+	openedAt time.Time // zero while closed
+	probing  bool      // a half-open trial call is in flight
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewGuard creates a Guard; zero config fields other than MaxRetries take
+// the package defaults
+func NewGuard(cfg GuardConfig, log *logger.Logger) *Guard {
+	return &Guard{
+		cfg:   cfg.withDefaults(),
+		log:   log,
+		now:   time.Now,
+		sleep: sleepContext,
+	}
+}
+
+// Do runs fn, retrying transient failures. Each attempt gets its own
+// timeout. While the breaker is open Do fails fast with *CircuitOpenError,
+// and a transient failure that outlasts the retries is returned as a
+// *RetriesExhaustedError. A nil Guard just calls fn.
+func (g *Guard) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if g == nil {
+		return fn(ctx)
+	}
+	return g.do(ctx, g.cfg.CallTimeout, fn)
+}
+
+// DoStream is Do for a streaming call, whose attempts get StreamTimeout
+func (g *Guard) DoStream(ctx context.Context, fn func(ctx context.Context) error) error {
+	if g == nil {
+		return fn(ctx)
+	}
+	return g.do(ctx, g.cfg.StreamTimeout, fn)
+}
+
+func (g *Guard) do(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	if err := g.allow(); err != nil {
+		return err
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		callCtx, cancel := context.WithTimeout(ctx, timeout)
+		err = fn(callCtx)
+		cancel()
+
+		if err == nil {
+			g.record(true)
+			return nil
+		}
+		if ctx.Err() != nil {
+			// The caller gave up; that says nothing about provider health.
+			g.release()
+			return err
+		}
+		if !isTransient(err) {
+			// The provider answered; the request itself was at fault.
+			g.record(true)
+			return err
+		}
+		if attempt >= g.cfg.MaxRetries {
+			break
+		}
+
+		delay := g.backoff(attempt)
+		if g.log != nil {
+			g.log.Warn("LLM call failed (attempt %d of %d), retrying in %s: %v", attempt+1, g.cfg.MaxRetries+1, delay, err)
+		}
+		if sleepErr := g.sleep(ctx, delay); sleepErr != nil {
+			g.release()
+			return err
+		}
+	}
+
+	retryAfter := g.cfg.RetryMaxDelay
+	if g.record(false) {
+		retryAfter = g.cfg.BreakerCooldown
+	}
+	return &RetriesExhaustedError{Attempts: g.cfg.MaxRetries + 1, RetryAfter: retryAfter, Err: err}
+}
+
+// backoff returns the delay before retry number attempt+1: half the
+// exponential ceiling plus a random jitter of up to the other half
+func (g *Guard) backoff(attempt int) time.Duration {
+	ceiling := g.cfg.RetryBaseDelay << attempt
+	if ceiling <= 0 || ceiling > g.cfg.RetryMaxDelay {
+		ceiling = g.cfg.RetryMaxDelay
+	}
+	return ceiling/2 + time.Duration(rand.Int63n(int64(ceiling/2)+1))
+}
+
+// allow admits a call unless the breaker is open. After the cooldown one
+// trial call is let through; others keep failing fast until it completes.
+func (g *Guard) allow() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.openedAt.IsZero() {
+		return nil
+	}
+
+	remaining := g.cfg.BreakerCooldown - g.now().Sub(g.openedAt)
+	if remaining > 0 || g.probing {
+		if remaining < time.Second {
+			remaining = time.Second
+		}
+		return &CircuitOpenError{RetryAfter: remaining}
+	}
+
+	g.probing = true
+	return nil
+}
+
+// record updates the breaker with the outcome of a call and reports
+// whether it is now open
+func (g *Guard) record(ok bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.probing = false
+	if ok {
+		if !g.openedAt.IsZero() && g.log != nil {
+			g.log.Info("LLM circuit breaker closed")
+		}
+		g.failures = 0
+		g.openedAt = time.Time{}
+		return false
+	}
+
+	g.failures++
+	if !g.openedAt.IsZero() || g.failures >= g.cfg.BreakerThreshold {
+		if g.openedAt.IsZero() && g.log != nil {
+			g.log.Warn("LLM circuit breaker opened after %d consecutive failures", g.failures)
+		}
+		g.openedAt = g.now()
+	}
+	return !g.openedAt.IsZero()
+}
+
+// release ends a call without recording an outcome
+func (g *Guard) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.probing = false
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
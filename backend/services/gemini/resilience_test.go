@@ -0,0 +1,174 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// newTestGuard returns a Guard with a controllable clock and no real sleeping
+func newTestGuard(cfg GuardConfig) (*Guard, *time.Time) {
+	g := NewGuard(cfg, nil)
+	now := time.Unix(0, 0)
+	g.now = func() time.Time { return now }
+	g.sleep = func(context.Context, time.Duration) error { return nil }
+	return g, &now
+}
+
+func transientFailure() error {
+	return generationError(&googleapi.Error{Code: http.StatusServiceUnavailable})
+}
+
+func TestGuardRetriesTransientErrors(t *testing.T) {
+	g, _ := newTestGuard(GuardConfig{MaxRetries: 2})
+
+	calls := 0
+	err := g.Do(context.Background(), func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return transientFailure()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls)
+	}
+}
+
+func TestGuardReportsExhaustedRetries(t *testing.T) {
+	g, _ := newTestGuard(GuardConfig{MaxRetries: 1, RetryMaxDelay: 4 * time.Second, BreakerThreshold: 2, BreakerCooldown: 30 * time.Second})
+	fail := func(context.Context) error { return transientFailure() }
+
+	err := g.Do(context.Background(), fail)
+	retryAfter, ok := RetryAfter(err)
+	if !ok || retryAfter != 4*time.Second || !errors.Is(err, ErrGenerationFail) {
+		t.Fatalf("expected exhausted retries with a 4s delay, got %v (%s)", err, retryAfter)
+	}
+
+	// The failure that opens the breaker asks the client to wait it out
+	err = g.Do(context.Background(), fail)
+	if retryAfter, ok := RetryAfter(err); !ok || retryAfter != 30*time.Second {
+		t.Fatalf("expected retry after the 30s cooldown, got %v (%s)", err, retryAfter)
+	}
+}
+
+func TestGuardDoesNotRetryPermanentErrors(t *testing.T) {
+	g, _ := newTestGuard(GuardConfig{MaxRetries: 2})
+
+	calls := 0
+	err := g.Do(context.Background(), func(context.Context) error {
+		calls++
+		return generationError(&googleapi.Error{Code: http.StatusBadRequest})
+	})
+	if !errors.Is(err, ErrGenerationFail) || calls != 1 {
+		t.Fatalf("expected one failed call, got %d calls and %v", calls, err)
+	}
+}
+
+func TestGuardAppliesPerCallTimeout(t *testing.T) {
+	g, _ := newTestGuard(GuardConfig{MaxRetries: 1, CallTimeout: 10 * time.Millisecond})
+
+	calls := 0
+	err := g.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		<-ctx.Done()
+		return generationError(ctx.Err())
+	})
+	if !errors.Is(err, ErrGenerationFail) || calls != 2 {
+		t.Fatalf("expected timed-out call to be retried once, got %d calls and %v", calls, err)
+	}
+}
+
+func TestGuardStreamOutlivesCallTimeout(t *testing.T) {
+	g, _ := newTestGuard(GuardConfig{CallTimeout: 10 * time.Millisecond, StreamTimeout: time.Second})
+	slow := func(ctx context.Context, prompt string, onEvent func(StreamEvent)) ([]Recipe, error) {
+		onEvent(StreamEvent{Type: StreamEventStep})
+		select {
+		case <-time.After(50 * time.Millisecond):
+			return []Recipe{{Title: "Slow Stew"}}, nil
+		case <-ctx.Done():
+			return nil, generationError(ctx.Err())
+		}
+	}
+
+	var recipes []Recipe
+	err := g.DoStream(context.Background(), func(ctx context.Context) error {
+		var err error
+		recipes, err = guardedStream(ctx, "prompt", slow, nil)
+		return err
+	})
+	if err != nil || len(recipes) != 1 {
+		t.Fatalf("expected the stream to finish past CallTimeout, got %v", err)
+	}
+}
+
+func TestGuardCircuitBreaker(t *testing.T) {
+	g, now := newTestGuard(GuardConfig{MaxRetries: -1, BreakerThreshold: 2, BreakerCooldown: 30 * time.Second})
+	fail := func(context.Context) error { return transientFailure() }
+
+	for i := 0; i < 2; i++ {
+		if err := g.Do(context.Background(), fail); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("breaker opened early on call %d", i+1)
+		}
+	}
+
+	called := false
+	err := g.Do(context.Background(), func(context.Context) error { called = true; return nil })
+	retryAfter, ok := RetryAfter(err)
+	if !errors.Is(err, ErrCircuitOpen) || !ok || called {
+		t.Fatalf("expected fast failure with open breaker, got %v (called=%v)", err, called)
+	}
+	if retryAfter != 30*time.Second {
+		t.Fatalf("expected retry after 30s, got %s", retryAfter)
+	}
+
+	// After the cooldown a trial call goes through and closes the breaker.
+	*now = now.Add(31 * time.Second)
+	if err := g.Do(context.Background(), func(context.Context) error { return nil }); err != nil {
+		t.Fatalf("expected trial call to succeed, got %v", err)
+	}
+	if err := g.Do(context.Background(), func(context.Context) error { return nil }); err != nil {
+		t.Fatalf("expected breaker to be closed, got %v", err)
+	}
+}
+
+func TestGuardFailedTrialReopensBreaker(t *testing.T) {
+	g, now := newTestGuard(GuardConfig{MaxRetries: -1, BreakerThreshold: 1, BreakerCooldown: 10 * time.Second})
+	fail := func(context.Context) error { return transientFailure() }
+
+	g.Do(context.Background(), fail)
+	*now = now.Add(11 * time.Second)
+	if err := g.Do(context.Background(), fail); errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected trial call to reach the provider, got %v", err)
+	}
+	if err := g.Do(context.Background(), fail); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected breaker to reopen after failed trial, got %v", err)
+	}
+}
+
+func TestGenerationErrorClassification(t *testing.T) {
+	tests := []struct {
+		cause error
+		want  bool
+	}{
+		{&googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{&googleapi.Error{Code: http.StatusInternalServerError}, true},
+		{&googleapi.Error{Code: http.StatusBadRequest}, false},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), true},
+		{context.Canceled, false},
+		{errors.New("blocked by safety filter"), false},
+	}
+	for _, tt := range tests {
+		if got := isTransient(generationError(tt.cause)); got != tt.want {
+			t.Errorf("isTransient(%v) = %v, want %v", tt.cause, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// StreamEventType identifies what a StreamEvent carries
+type StreamEventType string
+
+const (
+	// StreamEventStep is emitted when an instruction step has been fully produced
+	StreamEventStep StreamEventType = "step"
+	// StreamEventRecipe is emitted when a whole recipe object has been produced
+	StreamEventRecipe StreamEventType = "recipe"
+)
+
+// StreamEvent is a piece of a recipe response that has finished generating
+type StreamEvent struct {
+	Type        StreamEventType
+	RecipeIndex int     // 0-based position of the recipe in the response
+	StepIndex   int     // 0-based position of the step (step events only)
+	Step        string  // instruction text (step events only)
+	Recipe      *Recipe // decoded recipe (recipe events only)
+}
+
+// RecipeStreamer is implemented by providers that can report recipes while
+// the model is still generating. onEvent is called synchronously, in order.
+// The returned slice holds every recipe in the response.
+type RecipeStreamer interface {
+	StreamRecipes(ctx context.Context, req GenerateRecipesRequest, onEvent func(StreamEvent)) ([]Recipe, error)
+	StreamPersonalRecipes(ctx context.Context, req GenerateRecipesRequest, onEvent func(StreamEvent)) ([]Recipe, error)
+}
+
+var (
+	_ RecipeStreamer = (*Client)(nil)
+	_ RecipeStreamer = (*OpenAIClient)(nil)
+	_ RecipeStreamer = (*FakeClient)(nil)
+)
+
+// RecipeStreamParser incrementally parses a recipe response of the form
+// {"recipes": [...]} or [...] as it arrives in arbitrary chunks. It only
+// tracks JSON structure (depth, strings, keys); each completed recipe object
+// is decoded with encoding/json. Anything before the first '{' or '[' (such
+// as a markdown code fence) is ignored.
+type RecipeStreamParser struct {
+	buf   []byte
+	pos   int
+	depth int
+
+	inString  bool
+	escape    bool
+	strStart  int
+	lastStr   string
+	rootKey   string
+	recipeKey string
+
+	root        byte // '{' or '[' once seen
+	arrayDepth  int  // depth inside the recipes array, 0 until it opens
+	recipeStart int  // offset of the current recipe object, -1 outside one
+	recipeIndex int
+	stepsDepth  int // depth inside the instructions array, 0 outside it
+	stepIndex   int
+
+	recipes []Recipe
+}
+
+// NewRecipeStreamParser creates an empty parser
+func NewRecipeStreamParser() *RecipeStreamParser {
+	return &RecipeStreamParser{recipeStart: -1}
+}
+
+// Recipes returns the recipes completed so far
+func (p *RecipeStreamParser) Recipes() []Recipe {
+	return p.recipes
+}
+
+// Write feeds the next chunk of model output and returns the events it completed
+func (p *RecipeStreamParser) Write(chunk string) ([]StreamEvent, error) {
+	p.buf = append(p.buf, chunk...)
+
+	var events []StreamEvent
+	for ; p.pos < len(p.buf); p.pos++ {
+		ch := p.buf[p.pos]
+
+		if p.inString {
+			switch {
+			case p.escape:
+				p.escape = false
+			case ch == '\\':
+				p.escape = true
+			case ch == '"':
+				p.inString = false
+				if ev, ok := p.endString(); ok {
+					events = append(events, ev)
+				}
+			}
+			continue
+		}
+
+		if p.root == 0 {
+			if ch == '{' || ch == '[' {
+				p.root = ch
+				p.depth = 1
+				if ch == '[' {
+					p.arrayDepth = 1
+				}
+			}
+			continue
+		}
+
+		switch ch {
+		case '"':
+			p.inString = true
+			p.strStart = p.pos
+		case ':':
+			switch {
+			case p.depth == 1 && p.root == '{':
+				p.rootKey = p.lastStr
+			case p.recipeStart >= 0 && p.depth == p.arrayDepth+1:
+				p.recipeKey = p.lastStr
+			}
+		case ',':
+			if p.recipeStart >= 0 && p.depth == p.arrayDepth+1 {
+				p.recipeKey = ""
+			}
+		case '{':
+			if p.arrayDepth > 0 && p.depth == p.arrayDepth && p.recipeStart < 0 {
+				p.recipeStart = p.pos
+				p.recipeKey = ""
+			}
+			p.depth++
+		case '[':
+			switch {
+			case p.arrayDepth == 0 && p.depth == 1 && p.rootKey == "recipes":
+				p.arrayDepth = 2
+			case p.recipeStart >= 0 && p.depth == p.arrayDepth+1 && p.recipeKey == "instructions":
+				p.stepsDepth = p.depth + 1
+				p.stepIndex = 0
+			}
+			p.depth++
+		case '}':
+			p.depth--
+			if p.recipeStart >= 0 && p.depth == p.arrayDepth {
+				ev, err := p.endRecipe()
+				if err != nil {
+					return events, err
+				}
+				events = append(events, ev)
+			}
+		case ']':
+			p.depth--
+			if p.stepsDepth > 0 && p.depth < p.stepsDepth {
+				p.stepsDepth = 0
+			}
+			if p.arrayDepth > 0 && p.depth < p.arrayDepth {
+				p.arrayDepth = -1 // recipes array closed; ignore the rest
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// endString records a completed string and emits it if it is an instruction step
+func (p *RecipeStreamParser) endString() (StreamEvent, bool) {
+	var s string
+	if err := json.Unmarshal(p.buf[p.strStart:p.pos+1], &s); err != nil {
+		return StreamEvent{}, false
+	}
+	p.lastStr = s
+
+	if p.stepsDepth > 0 && p.depth == p.stepsDepth {
+		ev := StreamEvent{
+			Type:        StreamEventStep,
+			RecipeIndex: p.recipeIndex,
+			StepIndex:   p.stepIndex,
+			Step:        s,
+		}
+		p.stepIndex++
+		return ev, true
+	}
+	return StreamEvent{}, false
+}
+
+// endRecipe decodes the recipe object that just closed
+func (p *RecipeStreamParser) endRecipe() (StreamEvent, error) {
+	raw := p.buf[p.recipeStart : p.pos+1]
+	p.recipeStart = -1
+	p.stepsDepth = 0
+
+	var recipe Recipe
+	if err := json.Unmarshal(raw, &recipe); err != nil {
+		return StreamEvent{}, fmt.Errorf("%w: recipe %d: %v", ErrInvalidResponse, p.recipeIndex, err)
+	}
+
+	p.recipes = append(p.recipes, recipe)
+	ev := StreamEvent{
+		Type:        StreamEventRecipe,
+		RecipeIndex: p.recipeIndex,
+		Recipe:      &p.recipes[len(p.recipes)-1],
+	}
+	p.recipeIndex++
+	return ev, nil
+}
+
+// streamText feeds model output chunks through a parser, forwarding events.
+// next returns the next chunk, or done=true when the stream has ended.
+// Recipes are repaired and validated as they complete; invalid ones are
+// neither forwarded nor returned. A recipe's step events are held back until
+// the recipe passes validation, then forwarded just before it, and dropped
+// with it otherwise. If the incremental parser could not make sense of the
+// output, the full text is decoded as a last resort so an unexpected
+// response shape does not lose recipes. A response with no valid recipe
+// yields a *ValidationError.
+func streamText(next func() (chunk string, done bool, err error), onEvent func(StreamEvent)) ([]Recipe, error) {
+	parser := NewRecipeStreamParser()
+	var full []byte
+	var parseErr error
+	var valid []Recipe
+	var problems []string
+	steps := make(map[int][]StreamEvent) // held back per RecipeIndex
+	forwarded := make(map[string]bool)   // titles of the recipes sent on
+
+	accept := func(ev StreamEvent) {
+		if ev.Type == StreamEventStep {
+			steps[ev.RecipeIndex] = append(steps[ev.RecipeIndex], ev)
+			return
+		}
+		held := steps[ev.RecipeIndex]
+		delete(steps, ev.RecipeIndex)
+
+		RepairRecipe(ev.Recipe)
+		if p := ValidateRecipe(*ev.Recipe); len(p) > 0 {
+			for _, msg := range p {
+				problems = append(problems, fmt.Sprintf("recipe %d (%q): %s", ev.RecipeIndex, ev.Recipe.Title, msg))
+			}
+			return
+		}
+		valid = append(valid, *ev.Recipe)
+		forwarded[ev.Recipe.Title] = true
+		if onEvent != nil {
+			for _, step := range held {
+				onEvent(step)
+			}
+			onEvent(ev)
+		}
+	}
+
+	for {
+		chunk, done, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			break
+		}
+		full = append(full, chunk...)
+		if parseErr != nil {
+			continue
+		}
+
+		events, err := parser.Write(chunk)
+		for _, ev := range events {
+			accept(ev)
+		}
+		if err != nil {
+			parseErr = err
+		}
+	}
+
+	if parseErr == nil && len(parser.Recipes()) > 0 {
+		if len(valid) == 0 {
+			return nil, &ValidationError{Problems: problems, Response: RepairJSON(string(full))}
+		}
+		return valid, nil
+	}
+
+	recipes, err := DecodeRecipes(string(full))
+	var verr *ValidationError
+	if err != nil && !errors.As(err, &verr) {
+		return nil, err
+	}
+
+	// Forward only the valid recipes the parser did not already send,
+	// at their position in the response
+	for i := range recipes {
+		if len(ValidateRecipe(recipes[i])) > 0 || forwarded[recipes[i].Title] {
+			continue
+		}
+		valid = append(valid, recipes[i])
+		forwarded[recipes[i].Title] = true
+		if onEvent != nil {
+			onEvent(StreamEvent{Type: StreamEventRecipe, RecipeIndex: i, Recipe: &valid[len(valid)-1]})
+		}
+	}
+	if len(valid) == 0 {
+		if verr == nil {
+			verr = &ValidationError{Problems: []string{"response contains no recipes"}, Response: RepairJSON(string(full))}
+		}
+		return nil, verr
+	}
+	return valid, nil
+}
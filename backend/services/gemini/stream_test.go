@@ -0,0 +1,124 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const streamFixture = "```json\n" + `{"recipes": [
+  {"title": "Eggs \"Benedict\"", "ingredients": [{"name": "egg", "amount": "2", "from_pantry": true}],
+   "instructions": ["Poach the eggs, {gently}.", "Serve [hot]."], "tags": ["breakfast"]},
+  {"title": "Toast", "instructions": ["Toast the bread."]}
+]}` + "\n```"
+
+func TestRecipeStreamParserEmitsStepsAndRecipes(t *testing.T) {
+	// Feed one byte at a time so every token boundary is split across chunks.
+	parser := NewRecipeStreamParser()
+	var events []StreamEvent
+	for i := 0; i < len(streamFixture); i++ {
+		evs, err := parser.Write(streamFixture[i : i+1])
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		events = append(events, evs...)
+	}
+
+	var got []string
+	for _, ev := range events {
+		switch ev.Type {
+		case StreamEventStep:
+			got = append(got, "step:"+ev.Step)
+		case StreamEventRecipe:
+			got = append(got, "recipe:"+ev.Recipe.Title)
+		}
+	}
+	want := []string{
+		"step:Poach the eggs, {gently}.",
+		"step:Serve [hot].",
+		`recipe:Eggs "Benedict"`,
+		"step:Toast the bread.",
+		"recipe:Toast",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("events = %q, want %q", got, want)
+	}
+	if events[3].RecipeIndex != 1 || events[3].StepIndex != 0 {
+		t.Fatalf("unexpected indices on second recipe step: %+v", events[3])
+	}
+	if len(parser.Recipes()) != 2 {
+		t.Fatalf("expected 2 recipes, got %d", len(parser.Recipes()))
+	}
+}
+
+func TestRecipeStreamParserBareArray(t *testing.T) {
+	parser := NewRecipeStreamParser()
+	events, err := parser.Write(`[{"title": "A", "instructions": ["one"]}]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 2 || events[0].Type != StreamEventStep || events[1].Type != StreamEventRecipe {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+// chunks returns a next func for streamText that yields text in pieces
+func chunks(text string, size int) func() (string, bool, error) {
+	return func() (string, bool, error) {
+		if text == "" {
+			return "", true, nil
+		}
+		n := min(size, len(text))
+		chunk := text[:n]
+		text = text[n:]
+		return chunk, false, nil
+	}
+}
+
+func TestStreamTextHoldsStepsUntilRecipeIsValid(t *testing.T) {
+	// The first recipe has no ingredients; the third has a trailing comma
+	// that stops the incremental parser, so the rest comes from the full
+	// decode
+	text := `{"recipes": [
+  {"title": "Nothing", "instructions": ["Wait."]},
+  {"title": "Toast", "ingredients": [{"name": "bread"}], "instructions": ["Toast the bread."]},
+  {"title": "Tea", "ingredients": [{"name": "tea"}], "instructions": ["Steep."],},
+  {"title": "Jam", "ingredients": [{"name": "fruit"}], "instructions": ["Boil."]}
+]}`
+
+	var got []string
+	recipes, err := streamText(chunks(text, 7), func(ev StreamEvent) {
+		switch ev.Type {
+		case StreamEventStep:
+			got = append(got, "step:"+ev.Step)
+		case StreamEventRecipe:
+			got = append(got, fmt.Sprintf("recipe:%d:%s", ev.RecipeIndex, ev.Recipe.Title))
+		}
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"step:Toast the bread.", "recipe:1:Toast", "recipe:2:Tea", "recipe:3:Jam"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("events = %q, want %q", got, want)
+	}
+	if len(recipes) != 3 || recipes[0].Title != "Toast" || recipes[2].Title != "Jam" {
+		t.Fatalf("unexpected recipes: %+v", recipes)
+	}
+}
+
+func TestStreamTextDropsStepsOfInvalidResponse(t *testing.T) {
+	var events []StreamEvent
+	_, err := streamText(chunks(`[{"title": "Nothing", "instructions": ["Wait."]}]`, 5), func(ev StreamEvent) {
+		events = append(events, ev)
+	})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a *ValidationError, got %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("no events should be forwarded, got %+v", events)
+	}
+}
@@ -0,0 +1,73 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Usage describes one model call: a single attempt, so retries and repair
+// re-prompts are reported separately
+type Usage struct {
+	Provider        string
+	Model           string
+	Streamed        bool
+	PromptTokens    int
+	CandidateTokens int
+	TotalTokens     int
+	Latency         time.Duration
+	Success         bool // false when the provider failed, not when the output was invalid
+	Tags            UsageTags
+}
+
+// UsageTags attribute a call to the user, agent and orchestrator mode it was
+// made for. They travel in the context; see WithUsageTags.
+type UsageTags struct {
+	UserID string
+	Agent  string
+	Mode   string
+}
+
+// UsageRecorder receives a Usage after every model call. RecordUsage must
+// not block for long; it runs on the generating goroutine.
+type UsageRecorder interface {
+	RecordUsage(ctx context.Context, usage Usage)
+}
+
+type usageTagsKey struct{}
+
+// WithUsageTags returns a context carrying tags, keeping any fields already
+// set on ctx that tags leaves empty
+func WithUsageTags(ctx context.Context, tags UsageTags) context.Context {
+	current := UsageTagsFrom(ctx)
+	if tags.UserID != "" {
+		current.UserID = tags.UserID
+	}
+	if tags.Agent != "" {
+		current.Agent = tags.Agent
+	}
+	if tags.Mode != "" {
+		current.Mode = tags.Mode
+	}
+	return context.WithValue(ctx, usageTagsKey{}, current)
+}
+
+// UsageTagsFrom returns the tags carried by ctx
+func UsageTagsFrom(ctx context.Context) UsageTags {
+	tags, _ := ctx.Value(usageTagsKey{}).(UsageTags)
+	return tags
+}
+
+// recordUsage tags usage from ctx and hands it to rec, if any
+func recordUsage(ctx context.Context, rec UsageRecorder, usage Usage, start time.Time, err error) {
+	if rec == nil {
+		return
+	}
+	usage.Latency = time.Since(start)
+	usage.Success = !errors.Is(err, ErrGenerationFail)
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CandidateTokens
+	}
+	usage.Tags = UsageTagsFrom(ctx)
+	rec.RecordUsage(ctx, usage)
+}
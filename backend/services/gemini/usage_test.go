@@ -0,0 +1,95 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+)
+
+type usageLog struct {
+	mu    sync.Mutex
+	calls []Usage
+}
+
+func (l *usageLog) RecordUsage(_ context.Context, u Usage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = append(l.calls, u)
+}
+
+const usageTestRecipes = `{"recipes":[{"title":"Eggs","ingredients":[{"name":"egg"}],"instructions":["Cook."]}]}`
+
+func TestOpenAIClientRecordsUsage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		content, _ := json.Marshal(usageTestRecipes)
+
+		if !req.Stream {
+			fmt.Fprintf(w, `{"model":"gpt-4o-mini-2024","choices":[{"message":{"role":"assistant","content":%s}}],"usage":{"prompt_tokens":120,"completion_tokens":40,"total_tokens":160}}`, content)
+			return
+		}
+		if req.StreamOptions == nil || !req.StreamOptions.IncludeUsage {
+			t.Error("stream request does not ask for usage")
+		}
+		fmt.Fprintf(w, "data: {\"model\":\"gpt-4o-mini-2024\",\"choices\":[{\"delta\":{\"content\":%s}}]}\n\n", content)
+		fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":100,\"completion_tokens\":30,\"total_tokens\":130}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	rec := &usageLog{}
+	client, err := NewOpenAIClient(srv.URL, "", "gpt-4o-mini", logger.GetLogger("error"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.WithUsageRecorder(rec)
+
+	ctx := WithUsageTags(context.Background(), UsageTags{UserID: "u1", Mode: "both"})
+	ctx = WithUsageTags(ctx, UsageTags{Agent: "pantry_only"})
+
+	if _, err := client.GenerateRecipes(ctx, GenerateRecipesRequest{RecipeCount: 1}); err != nil {
+		t.Fatalf("GenerateRecipes: %v", err)
+	}
+	if _, err := client.StreamRecipes(ctx, GenerateRecipesRequest{RecipeCount: 1}, nil); err != nil {
+		t.Fatalf("StreamRecipes: %v", err)
+	}
+
+	if len(rec.calls) != 2 {
+		t.Fatalf("recorded %d calls, want 2", len(rec.calls))
+	}
+	want := UsageTags{UserID: "u1", Agent: "pantry_only", Mode: "both"}
+	for i, u := range rec.calls {
+		if u.Tags != want {
+			t.Errorf("call %d tags = %+v, want %+v", i, u.Tags, want)
+		}
+		if u.Provider != ProviderOpenAI || u.Model != "gpt-4o-mini-2024" || !u.Success {
+			t.Errorf("call %d = %+v", i, u)
+		}
+	}
+	if u := rec.calls[0]; u.Streamed || u.PromptTokens != 120 || u.CandidateTokens != 40 || u.TotalTokens != 160 {
+		t.Errorf("completion usage = %+v", u)
+	}
+	if u := rec.calls[1]; !u.Streamed || u.PromptTokens != 100 || u.CandidateTokens != 30 || u.TotalTokens != 130 {
+		t.Errorf("stream usage = %+v", u)
+	}
+}
+
+func TestFakeClientRecordsFailedCalls(t *testing.T) {
+	rec := &usageLog{}
+	c := newTestFake().WithUsageRecorder(rec)
+	c.Enqueue(FakeResponse{Err: ErrGenerationFail})
+
+	if _, err := c.GenerateText(context.Background(), "hello"); err == nil {
+		t.Fatal("expected the scripted failure")
+	}
+	if len(rec.calls) != 1 || rec.calls[0].Success || rec.calls[0].PromptTokens != 2 {
+		t.Fatalf("recorded %+v", rec.calls)
+	}
+}
@@ -0,0 +1,453 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Jayyk09/CUHackIt/pkg/logger"
+)
+
+// DefaultRepairAttempts is how many times a recipe response that fails
+// validation is sent back to the model with the problems found
+const DefaultRepairAttempts = 2
+
+// Limits a recipe must stay within to pass validation
+const (
+	maxMinutes        = 24 * 60 // prep or cook time
+	maxServings       = 24
+	defaultServings   = 2    // for a recipe that left servings out
+	maxCalories       = 5000 // per serving
+	maxMacroGrams     = 500  // protein, carbs or fat per serving
+	maxRepairEchoSize = 4000 // bytes of the bad response quoted back to the model
+)
+
+// ValidationError lists everything wrong with a model's recipe response.
+// It matches ErrInvalidResponse with errors.Is.
+type ValidationError struct {
+	Problems []string
+	Response string // the (repaired) model output that failed
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrInvalidResponse, strings.Join(e.Problems, "; "))
+}
+
+// Is makes errors.Is(err, ErrInvalidResponse) true for validation failures
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidResponse
+}
+
+// validDifficulties are the values the prompts ask for
+var validDifficulties = map[string]bool{"easy": true, "medium": true, "hard": true}
+
+// ValidateRecipe checks a recipe against the schema the prompts declare and
+// returns one message per problem, or nil if the recipe is usable.
+func ValidateRecipe(r Recipe) []string {
+	var problems []string
+
+	if strings.TrimSpace(r.Title) == "" {
+		problems = append(problems, "title is required")
+	}
+
+	if len(r.Ingredients) == 0 {
+		problems = append(problems, "ingredients must not be empty")
+	}
+	for i, ing := range r.Ingredients {
+		if strings.TrimSpace(ing.Name) == "" {
+			problems = append(problems, fmt.Sprintf("ingredients[%d].name is required", i))
+		}
+	}
+	for i, ing := range r.MissingItems {
+		if strings.TrimSpace(ing.Name) == "" {
+			problems = append(problems, fmt.Sprintf("missing_items[%d].name is required", i))
+		}
+	}
+
+	if len(r.Instructions) == 0 {
+		problems = append(problems, "instructions must not be empty")
+	}
+	for i, step := range r.Instructions {
+		if strings.TrimSpace(step) == "" {
+			problems = append(problems, fmt.Sprintf("instructions[%d] is empty", i))
+		}
+	}
+
+	if r.PrepTimeMinutes < 0 || r.PrepTimeMinutes > maxMinutes {
+		problems = append(problems, fmt.Sprintf("prep_time_minutes must be between 0 and %d, got %d", maxMinutes, r.PrepTimeMinutes))
+	}
+	if r.CookTimeMinutes < 0 || r.CookTimeMinutes > maxMinutes {
+		problems = append(problems, fmt.Sprintf("cook_time_minutes must be between 0 and %d, got %d", maxMinutes, r.CookTimeMinutes))
+	}
+	if r.Servings < 1 || r.Servings > maxServings {
+		problems = append(problems, fmt.Sprintf("servings must be between 1 and %d, got %d", maxServings, r.Servings))
+	}
+	if r.Difficulty != "" && !validDifficulties[r.Difficulty] {
+		problems = append(problems, fmt.Sprintf("difficulty must be \"easy\", \"medium\" or \"hard\", got %q", r.Difficulty))
+	}
+
+	if r.CaloriesPerServing < 0 || r.CaloriesPerServing > maxCalories {
+		problems = append(problems, fmt.Sprintf("calories_per_serving must be between 0 and %d, got %g", maxCalories, r.CaloriesPerServing))
+	}
+	for _, m := range []struct {
+		name  string
+		value float64
+	}{{"protein_g", r.ProteinG}, {"carbs_g", r.CarbsG}, {"fat_g", r.FatG}} {
+		if m.value < 0 || m.value > maxMacroGrams {
+			problems = append(problems, fmt.Sprintf("%s must be between 0 and %d, got %g", m.name, maxMacroGrams, m.value))
+		}
+	}
+
+	return problems
+}
+
+// ValidateRecipes validates every recipe in a response. The returned error
+// is a *ValidationError naming each offending recipe.
+func ValidateRecipes(recipes []Recipe) error {
+	if len(recipes) == 0 {
+		return &ValidationError{Problems: []string{"response contains no recipes"}}
+	}
+
+	var problems []string
+	for i, r := range recipes {
+		for _, p := range ValidateRecipe(r) {
+			problems = append(problems, fmt.Sprintf("recipe %d (%q): %s", i, r.Title, p))
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// validRecipes returns the recipes that pass ValidateRecipe
+func validRecipes(recipes []Recipe) []Recipe {
+	var valid []Recipe
+	for _, r := range recipes {
+		if len(ValidateRecipe(r)) == 0 {
+			valid = append(valid, r)
+		}
+	}
+	return valid
+}
+
+// RepairRecipe fixes cosmetic defects that do not need another model call.
+// A missing servings count becomes defaultServings.
+func RepairRecipe(r *Recipe) {
+	r.Title = strings.TrimSpace(r.Title)
+	r.Difficulty = strings.ToLower(strings.TrimSpace(r.Difficulty))
+	if r.Servings == 0 {
+		r.Servings = defaultServings
+	}
+
+	steps := r.Instructions[:0]
+	for _, step := range r.Instructions {
+		if step = strings.TrimSpace(step); step != "" {
+			steps = append(steps, step)
+		}
+	}
+	r.Instructions = steps
+
+	for i := range r.Ingredients {
+		r.Ingredients[i].Name = strings.TrimSpace(r.Ingredients[i].Name)
+	}
+	for i := range r.MissingItems {
+		r.MissingItems[i].Name = strings.TrimSpace(r.MissingItems[i].Name)
+	}
+}
+
+// RepairJSON extracts the JSON document from model output: it strips markdown
+// code fences and any prose before or after the outermost object or array,
+// and removes trailing commas. Text without a JSON document is returned
+// trimmed but otherwise unchanged.
+func RepairJSON(text string) string {
+	text = strings.TrimSpace(text)
+
+	start := strings.IndexAny(text, "{[")
+	if start < 0 {
+		return text
+	}
+	end := matchingClose(text, start)
+	if end < 0 {
+		// Truncated output; keep what there is and let the decoder report it.
+		end = len(text) - 1
+		if fence := strings.LastIndex(text, "```"); fence > start {
+			end = fence - 1
+		}
+	}
+
+	return strings.TrimSpace(removeTrailingCommas(text[start : end+1]))
+}
+
+// matchingClose returns the index of the bracket closing the one at start,
+// or -1 if the document is never closed
+func matchingClose(text string, start int) int {
+	depth := 0
+	inString, escape := false, false
+	for i := start; i < len(text); i++ {
+		ch := text[i]
+		if inString {
+			switch {
+			case escape:
+				escape = false
+			case ch == '\\':
+				escape = true
+			case ch == '"':
+				inString = false
+			}
+			continue
+		}
+		switch ch {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// removeTrailingCommas drops commas that directly precede '}' or ']'
+func removeTrailingCommas(doc string) string {
+	var b strings.Builder
+	b.Grow(len(doc))
+	inString, escape := false, false
+	for i := 0; i < len(doc); i++ {
+		ch := doc[i]
+		if inString {
+			switch {
+			case escape:
+				escape = false
+			case ch == '\\':
+				escape = true
+			case ch == '"':
+				inString = false
+			}
+			b.WriteByte(ch)
+			continue
+		}
+		if ch == '"' {
+			inString = true
+		}
+		if ch == ',' {
+			j := i + 1
+			for j < len(doc) && strings.IndexByte(" \t\r\n", doc[j]) >= 0 {
+				j++
+			}
+			if j < len(doc) && (doc[j] == '}' || doc[j] == ']') {
+				continue
+			}
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+// DecodeRecipes repairs, decodes and validates a model recipe response.
+// Every failure is reported as a *ValidationError so it can be fed back to
+// the model.
+func DecodeRecipes(text string) ([]Recipe, error) {
+	repaired := RepairJSON(text)
+
+	recipes, err := parseRecipes(repaired)
+	if err != nil {
+		return nil, &ValidationError{
+			Problems: []string{"response is not valid recipe JSON: " + strings.TrimPrefix(err.Error(), ErrInvalidResponse.Error()+": ")},
+			Response: repaired,
+		}
+	}
+
+	for i := range recipes {
+		RepairRecipe(&recipes[i])
+	}
+
+	if err := ValidateRecipes(recipes); err != nil {
+		verr := err.(*ValidationError)
+		verr.Response = repaired
+		return recipes, verr
+	}
+	return recipes, nil
+}
+
+// buildRepairPrompt asks the model to correct its previous response
+func buildRepairPrompt(prompt string, verr *ValidationError) string {
+	return fmt.Sprintf(`%s
+
+## Correction Required:
+Your previous response could not be used:
+%s
+
+Problems found:
+- %s
+
+Return the complete corrected JSON only, with no markdown or commentary. Numbers must be JSON numbers, not strings.`,
+		prompt,
+		truncate(verr.Response, maxRepairEchoSize),
+		strings.Join(verr.Problems, "\n- "),
+	)
+}
+
+// generateValidated calls gen and validates the recipes it returns. A
+// response that fails validation is sent back with the problems found, up to
+// attempts more times. If the last response still has invalid recipes the
+// valid ones are returned; if none are valid the *ValidationError is.
+func generateValidated(ctx context.Context, prompt string, attempts int, gen func(ctx context.Context, prompt string) (string, error), log *logger.Logger) ([]Recipe, error) {
+	current := prompt
+	for attempt := 0; ; attempt++ {
+		text, err := gen(ctx, current)
+		if err != nil {
+			return nil, err
+		}
+
+		recipes, err := DecodeRecipes(text)
+		if err == nil {
+			return recipes, nil
+		}
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			return nil, err
+		}
+
+		if attempt >= attempts {
+			if valid := validRecipes(recipes); len(valid) > 0 {
+				if log != nil {
+					log.Warn("Dropping %d invalid recipes after %d repair attempts: %v", len(recipes)-len(valid), attempts, verr)
+				}
+				return valid, nil
+			}
+			return nil, verr
+		}
+
+		if log != nil {
+			log.Warn("Recipe response failed validation (attempt %d of %d), re-prompting: %v", attempt+1, attempts+1, verr)
+		}
+		current = buildRepairPrompt(prompt, verr)
+	}
+}
+
+// streamValidated streams a recipe response, passing on only recipes that
+// validate. Recipes cannot be retracted once streamed, so a response with
+// some invalid recipes is accepted without them; only a response with no
+// usable recipe is retried, without streaming, via generateValidated.
+func streamValidated(ctx context.Context, prompt string, attempts int,
+	stream func(ctx context.Context, prompt string, onEvent func(StreamEvent)) ([]Recipe, error),
+	gen func(ctx context.Context, prompt string) (string, error),
+	log *logger.Logger, onEvent func(StreamEvent)) ([]Recipe, error) {
+
+	recipes, err := stream(ctx, prompt, onEvent)
+	var verr *ValidationError
+	if err == nil || !errors.As(err, &verr) || attempts <= 0 {
+		return recipes, err
+	}
+
+	if log != nil {
+		log.Warn("Streamed recipe response had no valid recipes, re-prompting: %v", verr)
+	}
+	recipes, err = generateValidated(ctx, buildRepairPrompt(prompt, verr), attempts-1, gen, log)
+	if err != nil {
+		return nil, err
+	}
+	if onEvent != nil {
+		for i := range recipes {
+			onEvent(StreamEvent{Type: StreamEventRecipe, RecipeIndex: i, Recipe: &recipes[i]})
+		}
+	}
+	return recipes, nil
+}
+
+// numberPattern finds the first number in strings like "15 minutes" or "~450 kcal"
+var numberPattern = regexp.MustCompile(`-?\d+(?:\.\d+)?`)
+
+// decodeNumber accepts a JSON number, a numeric string with surrounding text
+// ("20 minutes", "350kcal"), or null. field names the value in errors.
+func decodeNumber(raw json.RawMessage, field string) (float64, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
+	}
+
+	var n float64
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, fmt.Errorf("%s: expected a number, got %s", field, truncate(string(raw), 40))
+	}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	match := numberPattern.FindString(s)
+	if match == "" {
+		return 0, fmt.Errorf("%s: expected a number, got %q", field, s)
+	}
+	return strconv.ParseFloat(match, 64)
+}
+
+// UnmarshalJSON accepts numeric fields given as strings ("15", "20 minutes")
+// and reports which field could not be decoded.
+func (r *Recipe) UnmarshalJSON(data []byte) error {
+	type plain Recipe
+	aux := struct {
+		*plain
+		PrepTimeMinutes    json.RawMessage `json:"prep_time_minutes"`
+		CookTimeMinutes    json.RawMessage `json:"cook_time_minutes"`
+		Servings           json.RawMessage `json:"servings"`
+		CaloriesPerServing json.RawMessage `json:"calories_per_serving"`
+		ProteinG           json.RawMessage `json:"protein_g"`
+		CarbsG             json.RawMessage `json:"carbs_g"`
+		FatG               json.RawMessage `json:"fat_g"`
+	}{plain: (*plain)(r)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	ints := []struct {
+		raw   json.RawMessage
+		field string
+		dst   *int
+	}{
+		{aux.PrepTimeMinutes, "prep_time_minutes", &r.PrepTimeMinutes},
+		{aux.CookTimeMinutes, "cook_time_minutes", &r.CookTimeMinutes},
+		{aux.Servings, "servings", &r.Servings},
+	}
+	for _, f := range ints {
+		n, err := decodeNumber(f.raw, f.field)
+		if err != nil {
+			return err
+		}
+		*f.dst = int(math.Round(n))
+	}
+
+	floats := []struct {
+		raw   json.RawMessage
+		field string
+		dst   *float64
+	}{
+		{aux.CaloriesPerServing, "calories_per_serving", &r.CaloriesPerServing},
+		{aux.ProteinG, "protein_g", &r.ProteinG},
+		{aux.CarbsG, "carbs_g", &r.CarbsG},
+		{aux.FatG, "fat_g", &r.FatG},
+	}
+	for _, f := range floats {
+		n, err := decodeNumber(f.raw, f.field)
+		if err != nil {
+			return err
+		}
+		*f.dst = n
+	}
+
+	return nil
+}
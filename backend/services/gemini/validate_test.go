@@ -0,0 +1,123 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"code fence", "```json\n{\"a\": 1}\n```", `{"a": 1}`},
+		{"surrounding prose", "Here are your recipes:\n[1, 2]\nEnjoy!", `[1, 2]`},
+		{"trailing commas", `{"a": [1, 2,], "b": "x,]",}`, `{"a": [1, 2], "b": "x,]"}`},
+		{"brackets in strings", `{"a": "}"} trailing`, `{"a": "}"}`},
+		{"no json", "  sorry  ", "sorry"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RepairJSON(tt.in); got != tt.want {
+				t.Fatalf("RepairJSON(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeRecipesCoercesNumericStrings(t *testing.T) {
+	text := "```json\n" + `{"recipes": [{
+		"title": " Omelette ", "difficulty": "Easy",
+		"prep_time_minutes": "5 minutes", "cook_time_minutes": "10", "servings": "2",
+		"calories_per_serving": "~320 kcal", "protein_g": 18.5,
+		"ingredients": [{"name": "egg", "amount": 3, "from_pantry": "true"}],
+		"instructions": ["Whisk.", "Cook."]
+	}]}` + "\n```\nLet me know if you want more!"
+
+	recipes, err := DecodeRecipes(text)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	r := recipes[0]
+	if r.Title != "Omelette" || r.Difficulty != "easy" {
+		t.Fatalf("expected trimmed title and lowercased difficulty, got %q %q", r.Title, r.Difficulty)
+	}
+	if r.PrepTimeMinutes != 5 || r.CookTimeMinutes != 10 || r.Servings != 2 || r.CaloriesPerServing != 320 {
+		t.Fatalf("numeric strings not coerced: %+v", r)
+	}
+	if r.Ingredients[0].Amount != "3" || !r.Ingredients[0].FromPantry {
+		t.Fatalf("ingredient not decoded: %+v", r.Ingredients[0])
+	}
+}
+
+func TestDecodeRecipesDefaultsMissingServings(t *testing.T) {
+	recipes, err := DecodeRecipes(`[{"title": "Toast", "ingredients": [{"name": "bread"}], "instructions": ["Toast."]}]`)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if recipes[0].Servings != defaultServings {
+		t.Fatalf("expected %d servings, got %d", defaultServings, recipes[0].Servings)
+	}
+}
+
+func TestDecodeRecipesReportsProblems(t *testing.T) {
+	_, err := DecodeRecipes(`[{"title": "", "ingredients": [], "instructions": ["x"], "servings": -1}]`)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if !errors.Is(err, ErrInvalidResponse) {
+		t.Fatal("expected ValidationError to match ErrInvalidResponse")
+	}
+	joined := strings.Join(verr.Problems, "\n")
+	for _, want := range []string{"title is required", "ingredients must not be empty", "servings must be"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("expected problem %q in %q", want, joined)
+		}
+	}
+}
+
+func TestIngredientUnmarshalReportsFieldErrors(t *testing.T) {
+	_, err := DecodeRecipes(`[{"title": "A", "ingredients": [{"name": "egg", "amount": {"n": 2}}], "instructions": ["x"]}]`)
+	if err == nil || !strings.Contains(err.Error(), `ingredient "egg" amount`) {
+		t.Fatalf("expected amount field error, got %v", err)
+	}
+}
+
+func TestGenerateRecipesRepromptsWithProblems(t *testing.T) {
+	c := newTestFake()
+	c.Enqueue(
+		FakeResponse{Text: `{"recipes": [{"title": "Broken", "ingredients": [], "instructions": []}]}`},
+		FakeResponse{Text: `{"recipes": [{"title": "Fixed", "ingredients": [{"name": "egg"}], "instructions": ["Cook."]}]}`},
+	)
+
+	recipes, err := c.GenerateRecipes(context.Background(), GenerateRecipesRequest{RecipeCount: 1, PantryOnly: true})
+	if err != nil {
+		t.Fatalf("expected repaired response, got %v", err)
+	}
+	if recipes[0].Title != "Fixed" {
+		t.Fatalf("expected repaired recipe, got %+v", recipes)
+	}
+
+	prompts := c.Prompts()
+	if len(prompts) != 2 || !strings.Contains(prompts[1], "ingredients must not be empty") {
+		t.Fatalf("expected re-prompt to include validation problems, got %d prompts", len(prompts))
+	}
+}
+
+func TestGenerateRecipesFailsAfterRepairAttempts(t *testing.T) {
+	c := newTestFake().WithRepairAttempts(1)
+	bad := FakeResponse{Text: `not json at all`}
+	c.Enqueue(bad, bad)
+
+	_, err := c.GenerateRecipes(context.Background(), GenerateRecipesRequest{RecipeCount: 1, PantryOnly: true})
+	if !errors.Is(err, ErrInvalidResponse) {
+		t.Fatalf("expected ErrInvalidResponse, got %v", err)
+	}
+	if c.Calls() != 2 {
+		t.Fatalf("expected 2 calls, got %d", c.Calls())
+	}
+}